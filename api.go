@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagAPIAlias   string
+	flagAPIBody    string
+	flagAPIHeaders []string
+)
+
+var apiCmd = &cobra.Command{
+	Use:   "api <method> <path>",
+	Short: "Make an authenticated REST API request to a stored org",
+	Long: `Send a request to the org saved under --alias (or the default org) with its
+access token in the Authorization header, and print the response. JSON
+responses are indented and can be narrowed with --filter.
+
+The path is relative to the instance URL, for example
+/services/data/v60.0/sobjects. --body sends a JSON request body from a file,
+or from stdin with "-". If the session has expired the token is refreshed,
+saved and the request sent again. A response with an error status is still
+printed, and the command then exits with status 1.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runAPI,
+}
+
+func init() {
+	apiCmd.Flags().StringVarP(&flagAPIAlias, "alias", "a", "", "Alias of the stored org (default: the default org)")
+	apiCmd.Flags().StringVar(&flagAPIBody, "body", "", "File holding the request body, or - for stdin")
+	apiCmd.Flags().StringArrayVarP(&flagAPIHeaders, "header", "H", nil, "Extra request header as \"Name: value\", repeatable")
+
+	rootCmd.AddCommand(apiCmd)
+}
+
+// orgResponse is the response to an api request
+type orgResponse struct {
+	Status      string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+func runAPI(cmd *cobra.Command, args []string) {
+	method := strings.ToUpper(args[0])
+	path := args[1]
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		log.Fatalf("Error: the path must be relative to the instance and start with /, got %q", path)
+	}
+	header, err := parseAPIHeaders(flagAPIHeaders)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	body, err := readAPIBody(flagAPIBody)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	store, org, err := useStoredOrg(flagAPIAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	resp, err := orgRequest(store, org, method, path, header, body)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	verbosef("%s %s responded %s", method, path, resp.Status)
+	if err := writeOrgResponse(os.Stdout, resp); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Fatalf("Error: %s %s returned %s", method, path, resp.Status)
+	}
+}
+
+// parseAPIHeaders reads -H values of the form "Name: value"
+func parseAPIHeaders(values []string) (http.Header, error) {
+	header := http.Header{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", v)
+		}
+		if strings.EqualFold(name, "Authorization") {
+			return nil, fmt.Errorf("the Authorization header is set from the stored org")
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// readAPIBody reads --body: a file, stdin for "-", or nothing
+func readAPIBody(source string) ([]byte, error) {
+	switch source {
+	case "":
+		return nil, nil
+	case "-":
+		body, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the request body from stdin: %v", err)
+		}
+		return body, nil
+	}
+	body, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the request body: %v", err)
+	}
+	return body, nil
+}
+
+// orgRequest sends a request to the org with its access token, refreshing
+// and saving the token and retrying once if the session has expired
+func orgRequest(store TokenStore, org *StoredOrg, method, path string, header http.Header, body []byte) (*orgResponse, error) {
+	resp, err := sendOrgRequest(org, method, path, header, body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || org.RefreshToken == "" {
+		return resp, err
+	}
+
+	verbosef("Session for %q has expired, refreshing", org.Alias)
+	if err := refreshStoredOrg(store, org, nil); err != nil {
+		return nil, err
+	}
+	return sendOrgRequest(org, method, path, header, body)
+}
+
+func sendOrgRequest(org *StoredOrg, method, path string, header http.Header, body []byte) (*orgResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(org.InstanceURL, "/")+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+org.AccessToken)
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	verbosef("%s %s", method, req.URL)
+	resp, err := doWithRateLimitRetry(http.DefaultClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	return &orgResponse{Status: resp.Status, StatusCode: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: data}, nil
+}
+
+// writeOrgResponse prints a JSON body indented, with --filter applied, and
+// any other body as it is
+func writeOrgResponse(out io.Writer, resp *orgResponse) error {
+	if len(resp.Body) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.ContentType)
+	if mediaType == "application/json" && json.Valid(resp.Body) {
+		data, err := marshalOutput(json.RawMessage(resp.Body), true)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	_, err := out.Write(resp.Body)
+	return err
+}
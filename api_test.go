@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrgRequestRefreshesAndResends(t *testing.T) {
+	withQuiet(t)
+	withFakeRevoker(t)
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/services/oauth2/token":
+			w.Write([]byte(`{"access_token": "fresh"}`))
+			return
+		case r.Method != http.MethodPatch || r.URL.Path != "/services/data/v60.0/sobjects/Account/001A":
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		case r.Header.Get("Content-Type") != "application/json" || r.Header.Get("If-Match") != `"v1"`:
+			t.Errorf("Unexpected headers %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	org := &StoredOrg{Alias: "prod", AccessToken: "stale", RefreshToken: "refresh", InstanceURL: server.URL, Domain: "login.example.com"}
+
+	header, err := parseAPIHeaders([]string{`If-Match: "v1"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := orgRequest(store, org, http.MethodPatch, "/services/data/v60.0/sobjects/Account/001A", header, []byte(`{"Name":"Acme"}`))
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the request to succeed after refreshing, got %+v (%v)", resp, err)
+	}
+	if len(bodies) != 2 || bodies[1] != `{"Name":"Acme"}` {
+		t.Errorf("Expected the body to be sent again, got %q", bodies)
+	}
+	if saved, err := store.Get("prod"); err != nil || saved.AccessToken != "fresh" {
+		t.Errorf("Expected the refreshed token to be saved, got %+v (%v)", saved, err)
+	}
+}
+
+func TestParseAPIHeaders(t *testing.T) {
+	header, err := parseAPIHeaders([]string{"Sforce-Call-Options: client=sfdc-auth", "X-Empty:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("Sforce-Call-Options") != "client=sfdc-auth" || len(header["X-Empty"]) != 1 {
+		t.Errorf("Unexpected headers %v", header)
+	}
+	for _, bad := range []string{"no colon", ": value", "Authorization: Bearer other"} {
+		if _, err := parseAPIHeaders([]string{bad}); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestReadAPIBody(t *testing.T) {
+	withStdin(t, `{"from":"stdin"}`)
+
+	if body, err := readAPIBody("-"); err != nil || string(body) != `{"from":"stdin"}` {
+		t.Errorf("Expected the body from stdin, got %q (%v)", body, err)
+	}
+	if body, err := readAPIBody(""); err != nil || body != nil {
+		t.Errorf("Expected no body, got %q (%v)", body, err)
+	}
+	if _, err := readAPIBody(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing body file")
+	}
+}
+
+func TestWriteOrgResponse(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeOrgResponse(&out, &orgResponse{ContentType: "application/json;charset=UTF-8", Body: []byte(`{"b":1,"a":[2]}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"b\": 1,\n  \"a\": [\n    2\n  ]\n}\n"; out.String() != want {
+		t.Errorf("Expected indented JSON in its own order, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := writeOrgResponse(&out, &orgResponse{ContentType: "text/csv", Body: []byte("Id\n001A\n")}); err != nil || out.String() != "Id\n001A\n" {
+		t.Errorf("Expected other bodies as they are, got %q (%v)", out.String(), err)
+	}
+}
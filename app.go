@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	metadataNamespace = "http://soap.sforce.com/2006/04/metadata"
+
+	// metadataKeyAttempts bounds how often the consumer key is read back
+	// while Salesforce is still generating it
+	metadataKeyAttempts = 5
+)
+
+var (
+	flagAppAlias              string
+	flagAppName               string
+	flagAppLabel              string
+	flagAppContactEmail       string
+	flagAppDescription        string
+	flagAppCallbackURLs       []string
+	flagAppScopes             []string
+	flagAppCertificate        string
+	flagAppRequireSecret      bool
+	flagAppIPRelaxation       string
+	flagAppRefreshTokenPolicy string
+
+	metadataSleep = time.Sleep
+)
+
+// appScopes maps OAuth scope names, as --scopes takes them for logins, to
+// the ConnectedApp metadata values for them
+var appScopes = map[string]string{
+	"api":                "Api",
+	"web":                "Web",
+	"full":               "Full",
+	"refresh_token":      "RefreshToken",
+	"offline_access":     "RefreshToken",
+	"openid":             "OpenID",
+	"id":                 "Basic",
+	"profile":            "Basic",
+	"email":              "Basic",
+	"address":            "Basic",
+	"phone":              "Basic",
+	"chatter_api":        "Chatter",
+	"custom_permissions": "CustomPermissions",
+	"visualforce":        "Visualforce",
+	"content":            "Content",
+	"lightning":          "Lightning",
+	"wave_api":           "Wave",
+	"pardot_api":         "Pardot",
+	"cdp_query_api":      "CDPQuery",
+}
+
+// appIPRelaxations and appRefreshTokenPolicies are the OAuth policy values
+// the Metadata API accepts
+var (
+	appIPRelaxations        = []string{"ENFORCE", "ENFORCE_ACTIVATED_DEVICES", "BYPASS"}
+	appRefreshTokenPolicies = []string{"infinite", "immediately", "zero"}
+)
+
+// appNamePattern is what the Metadata API allows as a ConnectedApp API name
+var appNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Manage Connected Apps",
+}
+
+var appCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a Connected App in a stored org and print its consumer key",
+	Long: `Deploy a Connected App to the org saved under --alias (or the default org)
+through the Metadata API, using that org's admin token, and print the consumer
+key Salesforce generates for it. This replaces the clicks in Setup needed
+before the first login.
+
+By default the app accepts logins at the default callback URL, with the api
+and refresh_token scopes, and without a client secret, since logins use PKCE.
+--certificate uploads the certificate the jwt command's key signs with. The
+consumer secret is never returned by the API; view it in Setup if the app
+needs one. Salesforce can take a few minutes to accept logins for a new app.`,
+	Args: cobra.NoArgs,
+	Run:  runAppCreate,
+}
+
+func init() {
+	appCreateCmd.Flags().StringVarP(&flagAppAlias, "alias", "a", "", "Alias of the stored org to create the app in (default: the default org)")
+	appCreateCmd.Flags().StringVar(&flagAppName, "name", "", "API name of the Connected App (e.g. SFDC_Auth_CLI)")
+	appCreateCmd.Flags().StringVar(&flagAppLabel, "label", "", "Label shown in Setup (default: the name)")
+	appCreateCmd.Flags().StringVar(&flagAppContactEmail, "contact-email", "", "Contact email of the app (default: the org user's email)")
+	appCreateCmd.Flags().StringVar(&flagAppDescription, "description", "", "Description of the app")
+	appCreateCmd.Flags().StringSliceVar(&flagAppCallbackURLs, "callback-url", []string{"http://localhost:" + defaultPort + defaultCallbackPath}, "Callback URLs, repeated or comma-separated")
+	appCreateCmd.Flags().StringSliceVar(&flagAppScopes, "scopes", []string{"api", "refresh_token"}, "OAuth scopes the app may grant, repeated or comma-separated")
+	appCreateCmd.Flags().StringVar(&flagAppCertificate, "certificate", "", "PEM certificate for the JWT bearer flow")
+	appCreateCmd.Flags().BoolVar(&flagAppRequireSecret, "require-secret", false, "Require the consumer secret for the web server flow")
+	appCreateCmd.Flags().StringVar(&flagAppIPRelaxation, "ip-relaxation", "ENFORCE", "IP restrictions policy: "+strings.Join(appIPRelaxations, ", "))
+	appCreateCmd.Flags().StringVar(&flagAppRefreshTokenPolicy, "refresh-token-policy", "infinite", "Refresh token policy: "+strings.Join(appRefreshTokenPolicies, ", "))
+	_ = appCreateCmd.MarkFlagRequired("name")
+
+	appCmd.AddCommand(appCreateCmd)
+	rootCmd.AddCommand(appCmd)
+}
+
+// connectedApp is the ConnectedApp metadata type. The Metadata API wants
+// elements in the order of its schema, which is the order of the fields here.
+type connectedApp struct {
+	XMLName      xml.Name            `xml:"metadata"`
+	Type         string              `xml:"xsi:type,attr"`
+	FullName     string              `xml:"fullName"`
+	ContactEmail string              `xml:"contactEmail"`
+	Description  string              `xml:"description,omitempty"`
+	Label        string              `xml:"label"`
+	OAuthConfig  connectedAppOAuth   `xml:"oauthConfig"`
+	OAuthPolicy  connectedAppOPolicy `xml:"oauthPolicy"`
+}
+
+type connectedAppOAuth struct {
+	CallbackURL              string   `xml:"callbackUrl"`
+	Certificate              string   `xml:"certificate,omitempty"`
+	ConsumerKey              string   `xml:"consumerKey,omitempty"`
+	IsConsumerSecretOptional bool     `xml:"isConsumerSecretOptional"`
+	Scopes                   []string `xml:"scopes"`
+}
+
+type connectedAppOPolicy struct {
+	IPRelaxation       string `xml:"ipRelaxation"`
+	RefreshTokenPolicy string `xml:"refreshTokenPolicy"`
+}
+
+// createdApp is what app create prints
+type createdApp struct {
+	Name         string   `json:"name"`
+	ConsumerKey  string   `json:"consumer_key"`
+	CallbackURLs []string `json:"callback_urls"`
+	Scopes       []string `json:"scopes"`
+}
+
+func runAppCreate(cmd *cobra.Command, args []string) {
+	store, org, err := useStoredOrg(flagAppAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	email := flagAppContactEmail
+	if email == "" {
+		email = org.Email
+	}
+	app, err := newConnectedApp(flagAppName, flagAppLabel, email, flagAppDescription)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if flagAppCertificate != "" {
+		raw, err := os.ReadFile(flagAppCertificate)
+		if err != nil {
+			log.Fatalf("Error reading certificate: %v", err)
+		}
+		app.OAuthConfig.Certificate = strings.TrimSpace(string(raw))
+	}
+
+	client := &metadataClient{store: store, org: org}
+	if err := client.createConnectedApp(app); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	verbosef("Created Connected App %s in %q", app.FullName, org.Alias)
+	key, err := client.readConsumerKey(app.FullName)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	result := createdApp{Name: app.FullName, ConsumerKey: key, CallbackURLs: flagAppCallbackURLs, Scopes: flagAppScopes}
+	if outputFormat(outputText) == outputText {
+		fmt.Println(key)
+		return
+	}
+	if err := writeJSON(result); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
+
+// newConnectedApp builds the app metadata from the app create flags
+func newConnectedApp(name, label, email, description string) (*connectedApp, error) {
+	if !appNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid app name %q (letters, digits and underscores, starting with a letter)", name)
+	}
+	if email == "" {
+		return nil, fmt.Errorf("no contact email known for the org user; pass --contact-email")
+	}
+	if label == "" {
+		label = name
+	}
+	if len(flagAppCallbackURLs) == 0 {
+		return nil, fmt.Errorf("--callback-url needs at least one URL")
+	}
+	scopes, err := appScopeValues(flagAppScopes)
+	if err != nil {
+		return nil, err
+	}
+	ipRelaxation := strings.ToUpper(flagAppIPRelaxation)
+	if !containsString(appIPRelaxations, ipRelaxation) {
+		return nil, fmt.Errorf("unknown --ip-relaxation %q (use %s)", flagAppIPRelaxation, strings.Join(appIPRelaxations, ", "))
+	}
+	refreshPolicy := strings.ToLower(flagAppRefreshTokenPolicy)
+	if !containsString(appRefreshTokenPolicies, refreshPolicy) {
+		return nil, fmt.Errorf("unknown --refresh-token-policy %q (use %s)", flagAppRefreshTokenPolicy, strings.Join(appRefreshTokenPolicies, ", "))
+	}
+
+	return &connectedApp{
+		Type:         "ConnectedApp",
+		FullName:     name,
+		ContactEmail: email,
+		Description:  description,
+		Label:        label,
+		OAuthConfig: connectedAppOAuth{
+			// Several callback URLs are separated by newlines
+			CallbackURL:              strings.Join(flagAppCallbackURLs, "\n"),
+			IsConsumerSecretOptional: !flagAppRequireSecret,
+			Scopes:                   scopes,
+		},
+		OAuthPolicy: connectedAppOPolicy{IPRelaxation: ipRelaxation, RefreshTokenPolicy: refreshPolicy},
+	}, nil
+}
+
+// appScopeValues turns OAuth scope names into sorted, distinct ConnectedApp
+// scope values
+func appScopeValues(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	var values []string
+	for _, scope := range scopes {
+		value, ok := appScopes[strings.ToLower(scope)]
+		if !ok {
+			return nil, fmt.Errorf("unknown scope %q for a Connected App", scope)
+		}
+		if !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("--scopes needs at least one scope")
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// metadataClient calls the Metadata API's SOAP endpoint with a stored org's
+// access token
+type metadataClient struct {
+	store TokenStore
+	org   *StoredOrg
+}
+
+// metadataFault is a SOAP fault from the Metadata API
+type metadataFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+func (f *metadataFault) Error() string {
+	return fmt.Sprintf("%s: %s", f.Code, f.String)
+}
+
+func (c *metadataClient) createConnectedApp(app *connectedApp) error {
+	var resp struct {
+		Result struct {
+			Success bool `xml:"success"`
+			Errors  []struct {
+				Message    string `xml:"message"`
+				StatusCode string `xml:"statusCode"`
+			} `xml:"errors"`
+		} `xml:"Body>createMetadataResponse>result"`
+	}
+	call := struct {
+		XMLName  xml.Name `xml:"createMetadata"`
+		XMLNS    string   `xml:"xmlns,attr"`
+		Metadata *connectedApp
+	}{XMLNS: metadataNamespace, Metadata: app}
+	if err := c.call(call, &resp); err != nil {
+		return fmt.Errorf("error creating Connected App: %v", err)
+	}
+	if !resp.Result.Success {
+		if len(resp.Result.Errors) > 0 {
+			return fmt.Errorf("error creating Connected App: %s: %s", resp.Result.Errors[0].StatusCode, resp.Result.Errors[0].Message)
+		}
+		return fmt.Errorf("error creating Connected App: the Metadata API reported no success")
+	}
+	return nil
+}
+
+// readConsumerKey reads the consumer key of a Connected App back, waiting
+// for Salesforce to generate it for a new app
+func (c *metadataClient) readConsumerKey(name string) (string, error) {
+	call := struct {
+		XMLName   xml.Name `xml:"readMetadata"`
+		XMLNS     string   `xml:"xmlns,attr"`
+		Type      string   `xml:"type"`
+		FullNames string   `xml:"fullNames"`
+	}{XMLNS: metadataNamespace, Type: "ConnectedApp", FullNames: name}
+	for attempt := 1; ; attempt++ {
+		var resp struct {
+			Key string `xml:"Body>readMetadataResponse>result>records>oauthConfig>consumerKey"`
+		}
+		if err := c.call(call, &resp); err != nil {
+			return "", fmt.Errorf("error reading Connected App: %v", err)
+		}
+		if resp.Key != "" {
+			return resp.Key, nil
+		}
+		if attempt == metadataKeyAttempts {
+			return "", fmt.Errorf("Connected App %s has no consumer key yet; look it up in Setup", name)
+		}
+		metadataSleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// call sends one SOAP request, refreshing the session and retrying once if
+// it has expired
+func (c *metadataClient) call(body, out interface{}) error {
+	err := c.send(body, out)
+	var fault *metadataFault
+	if !errors.As(err, &fault) || !strings.Contains(fault.Code, "INVALID_SESSION_ID") || c.org.RefreshToken == "" {
+		return err
+	}
+	verbosef("Session for %q has expired, refreshing", c.org.Alias)
+	if err := refreshStoredOrg(c.store, c.org, nil); err != nil {
+		return err
+	}
+	return c.send(body, out)
+}
+
+func (c *metadataClient) send(body, out interface{}) error {
+	envelope := struct {
+		XMLName xml.Name `xml:"env:Envelope"`
+		Env     string   `xml:"xmlns:env,attr"`
+		XSI     string   `xml:"xmlns:xsi,attr"`
+		Session struct {
+			XMLNS     string `xml:"xmlns,attr"`
+			SessionID string `xml:"sessionId"`
+		} `xml:"env:Header>SessionHeader"`
+		Body struct {
+			Call interface{}
+		} `xml:"env:Body"`
+	}{Env: "http://schemas.xmlsoap.org/soap/envelope/", XSI: "http://www.w3.org/2001/XMLSchema-instance"}
+	envelope.Body.Call = body
+	envelope.Session.XMLNS, envelope.Session.SessionID = metadataNamespace, c.org.AccessToken
+
+	raw, err := xml.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %v", err)
+	}
+	defer wipeBytes(raw)
+	endpoint := strings.TrimSuffix(c.org.InstanceURL, "/") + "/services/Soap/m/" + strings.TrimPrefix(salesforceAPIVersion, "v")
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(append([]byte(xml.Header), raw...)))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
+	req.Header.Set("SOAPAction", `""`)
+
+	verbosef("POST %s", endpoint)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var faultResp struct {
+			Fault metadataFault `xml:"Body>Fault"`
+		}
+		if xml.Unmarshal(data, &faultResp) == nil && faultResp.Fault.Code != "" {
+			return &faultResp.Fault
+		}
+		return &apiStatusError{Status: resp.StatusCode}
+	}
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
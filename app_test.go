@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppScopeValues(t *testing.T) {
+	got, err := appScopeValues([]string{"refresh_token", "api", "offline_access", "openid", "email", "profile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Api", "Basic", "OpenID", "RefreshToken"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("appScopeValues = %v, want %v", got, want)
+	}
+	if _, err := appScopeValues([]string{"api", "bogus"}); err == nil || !strings.Contains(err.Error(), `"bogus"`) {
+		t.Errorf("unknown scope error = %v", err)
+	}
+}
+
+func TestNewConnectedApp(t *testing.T) {
+	oldURLs, oldScopes := flagAppCallbackURLs, flagAppScopes
+	oldIP, oldPolicy := flagAppIPRelaxation, flagAppRefreshTokenPolicy
+	t.Cleanup(func() {
+		flagAppCallbackURLs, flagAppScopes = oldURLs, oldScopes
+		flagAppIPRelaxation, flagAppRefreshTokenPolicy = oldIP, oldPolicy
+	})
+	flagAppCallbackURLs = []string{"http://localhost:8080/callback", "https://example.com/oauth"}
+	flagAppScopes = []string{"api", "refresh_token"}
+	flagAppIPRelaxation, flagAppRefreshTokenPolicy = "bypass", "infinite"
+
+	app, err := newConnectedApp("SFDC_Auth_CLI", "", "admin@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Label != "SFDC_Auth_CLI" || app.OAuthConfig.CallbackURL != "http://localhost:8080/callback\nhttps://example.com/oauth" {
+		t.Errorf("app = %+v", app)
+	}
+	if !app.OAuthConfig.IsConsumerSecretOptional || app.OAuthPolicy.IPRelaxation != "BYPASS" {
+		t.Errorf("oauth settings = %+v, %+v", app.OAuthConfig, app.OAuthPolicy)
+	}
+
+	if _, err := newConnectedApp("1st app", "", "admin@example.com", ""); err == nil || !strings.Contains(err.Error(), "invalid app name") {
+		t.Errorf("bad name error = %v", err)
+	}
+	if _, err := newConnectedApp("App", "", "", ""); err == nil || !strings.Contains(err.Error(), "--contact-email") {
+		t.Errorf("missing email error = %v", err)
+	}
+	flagAppRefreshTokenPolicy = "forever"
+	if _, err := newConnectedApp("App", "", "admin@example.com", ""); err == nil || !strings.Contains(err.Error(), "--refresh-token-policy") {
+		t.Errorf("bad refresh token policy error = %v", err)
+	}
+}
+
+// fakeMetadataAPI answers createMetadata, failing for apps named Taken, and
+// readMetadata, returning no consumer key for the first pending reads
+func fakeMetadataAPI(t *testing.T, pending int) (*httptest.Server, *string) {
+	t.Helper()
+	var created string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/Soap/m/60.0" || r.Header.Get("SOAPAction") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		raw, _ := io.ReadAll(r.Body)
+		var envelope struct {
+			SessionID string `xml:"Header>SessionHeader>sessionId"`
+			Create    *struct {
+				FullName string `xml:"metadata>fullName"`
+			} `xml:"Body>createMetadata"`
+			Read *struct {
+				FullNames string `xml:"fullNames"`
+			} `xml:"Body>readMetadata"`
+		}
+		if err := xml.Unmarshal(raw, &envelope); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if envelope.SessionID != "admin-token" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><soapenv:Fault><faultcode>sf:INVALID_SESSION_ID</faultcode><faultstring>INVALID_SESSION_ID: Invalid Session ID</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+			return
+		}
+		switch {
+		case envelope.Create != nil:
+			created = string(raw)
+			success, errors := "true", ""
+			if envelope.Create.FullName == "Taken" {
+				success, errors = "false", `<errors><message>An app with this name already exists</message><statusCode>DUPLICATE_DEVELOPER_NAME</statusCode></errors>`
+			}
+			io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="http://soap.sforce.com/2006/04/metadata"><soapenv:Body><createMetadataResponse><result><fullName>`+envelope.Create.FullName+`</fullName>`+errors+`<success>`+success+`</success></result></createMetadataResponse></soapenv:Body></soapenv:Envelope>`)
+		case envelope.Read != nil:
+			key := ""
+			if pending--; pending < 0 {
+				key = "<consumerKey>3MVG9.consumer-key</consumerKey>"
+			}
+			io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="http://soap.sforce.com/2006/04/metadata"><soapenv:Body><readMetadataResponse><result><records xsi:type="ConnectedApp" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><fullName>`+envelope.Read.FullNames+`</fullName><oauthConfig><callbackUrl>http://localhost:8080/callback</callbackUrl>`+key+`</oauthConfig></records></result></readMetadataResponse></soapenv:Body></soapenv:Envelope>`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &created
+}
+
+func TestCreateConnectedApp(t *testing.T) {
+	withQuiet(t)
+	var slept []time.Duration
+	oldSleep := metadataSleep
+	metadataSleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { metadataSleep = oldSleep })
+
+	server, created := fakeMetadataAPI(t, 2)
+	client := &metadataClient{store: newTestStore(t), org: &StoredOrg{Alias: "admin", InstanceURL: server.URL, AccessToken: "admin-token"}}
+	app := &connectedApp{
+		Type: "ConnectedApp", FullName: "SFDC_Auth_CLI", ContactEmail: "admin@example.com", Label: "SFDC Auth CLI",
+		OAuthConfig: connectedAppOAuth{CallbackURL: "http://localhost:8080/callback", IsConsumerSecretOptional: true, Scopes: []string{"Api", "RefreshToken"}},
+		OAuthPolicy: connectedAppOPolicy{IPRelaxation: "ENFORCE", RefreshTokenPolicy: "infinite"},
+	}
+	if err := client.createConnectedApp(app); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`xsi:type="ConnectedApp"`, "<scopes>Api</scopes><scopes>RefreshToken</scopes>", "<isConsumerSecretOptional>true</isConsumerSecretOptional>"} {
+		if !strings.Contains(*created, want) {
+			t.Errorf("createMetadata request is missing %s:\n%s", want, *created)
+		}
+	}
+
+	key, err := client.readConsumerKey("SFDC_Auth_CLI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "3MVG9.consumer-key" || len(slept) != 2 {
+		t.Errorf("consumer key = %q after %d waits", key, len(slept))
+	}
+
+	app.FullName = "Taken"
+	if err := client.createConnectedApp(app); err == nil || !strings.Contains(err.Error(), "DUPLICATE_DEVELOPER_NAME") {
+		t.Errorf("duplicate app error = %v", err)
+	}
+
+	// Without a refresh token an expired session is reported as is
+	client.org.AccessToken = "expired-token"
+	if err := client.createConnectedApp(app); err == nil || !strings.Contains(err.Error(), "INVALID_SESSION_ID") {
+		t.Errorf("expired session error = %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	grantAuthorizationCode = "authorization-code"
+	grantHybrid            = "hybrid"
+	grantImplicit          = "implicit"
+	grantAssetToken        = "asset-token"
+
+	tokenExchangeGrant   = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	jwtTokenType         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+var (
+	flagGrant          string
+	flagActorTokenFile string
+)
+
+// assetTokenResult is the output of the asset token flow
+type assetTokenResult struct {
+	AssetToken      string `json:"asset_token"`
+	TokenType       string `json:"token_type,omitempty"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	InstanceURL     string `json:"instance_url"`
+}
+
+// checkGrant rejects unknown --grant values
+func checkGrant(grant string) error {
+	switch grant {
+	case grantAuthorizationCode, grantHybrid, grantImplicit, grantAssetToken:
+		return nil
+	}
+	return fmt.Errorf("unknown grant %q (use %s, %s, %s or %s)", grant, grantAuthorizationCode, grantHybrid, grantImplicit, grantAssetToken)
+}
+
+// runAssetTokenGrant trades the access token of the org saved under --alias
+// for an asset token describing the device in the actor token
+func runAssetTokenGrant() {
+	if flagAlias == "" {
+		log.Fatalf("Error: --grant %s needs --alias to pick the org whose access token is exchanged", grantAssetToken)
+	}
+	var actorToken string
+	if flagActorTokenFile != "" {
+		raw, err := os.ReadFile(flagActorTokenFile)
+		if err != nil {
+			log.Fatalf("Error reading actor token: %v", err)
+		}
+		actorToken = strings.TrimSpace(string(raw))
+	}
+
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	org, err := store.Get(flagAlias)
+	store.Close()
+	if errors.Is(err, errOrgNotFound) {
+		log.Fatalf("Org %q not found in the token store", flagAlias)
+	}
+	if err != nil {
+		log.Fatalf("Error reading org %q: %v", flagAlias, err)
+	}
+
+	result, err := exchangeAssetToken(org, actorToken)
+	if err != nil {
+		log.Fatalf("Asset token request failed: %v", err)
+	}
+
+	var output []byte
+	if flagTokenOnly {
+		output = tokenOnlyOutput(result.AssetToken)
+	} else if outputFormat(outputJSON) == outputText {
+		output = fmt.Appendf(nil, "asset_token: %s\ninstance_url: %s\n", result.AssetToken, result.InstanceURL)
+	} else {
+		if output, err = marshalOutput(result, true); err != nil {
+			log.Fatalf("Error formatting output: %v", err)
+		}
+	}
+	if err := writeTokenOutput(output); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
+
+// exchangeAssetToken performs the token exchange at the org's instance. The
+// actor token is a JWT holding the asset's details; it is optional when the
+// Connected App's asset token settings do not require one.
+func exchangeAssetToken(org *StoredOrg, actorToken string) (*assetTokenResult, error) {
+	if org.AccessToken == "" {
+		return nil, fmt.Errorf("org %q has no access token", org.Alias)
+	}
+	instance, err := url.Parse(org.InstanceURL)
+	if err != nil || instance.Host == "" {
+		return nil, fmt.Errorf("org %q has no valid instance URL", org.Alias)
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", tokenExchangeGrant)
+	data.Set("subject_token_type", accessTokenTokenType)
+	data.Set("subject_token", org.AccessToken)
+	if actorToken != "" {
+		data.Set("actor_token_type", jwtTokenType)
+		data.Set("actor_token", actorToken)
+	}
+
+	resp, err := withMaintenanceRetry(org.InstanceName, func() (*SalesforceOAuthResponse, error) {
+		return postTokenRequest(getSalesforceTokenURL(instance.Host), data, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &assetTokenResult{
+		AssetToken:      resp.AccessToken,
+		TokenType:       resp.TokenType,
+		IssuedTokenType: resp.IssuedTokenType,
+		InstanceURL:     org.InstanceURL,
+	}, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckGrant(t *testing.T) {
+	for _, grant := range []string{grantAuthorizationCode, grantAssetToken} {
+		if err := checkGrant(grant); err != nil {
+			t.Errorf("Grant %q should be accepted: %v", grant, err)
+		}
+	}
+	if err := checkGrant("password"); err == nil {
+		t.Error("Expected an unknown grant to be rejected")
+	}
+}
+
+func TestExchangeAssetToken(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Path != "/services/oauth2/token" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		want := map[string]string{
+			"grant_type":         tokenExchangeGrant,
+			"subject_token_type": accessTokenTokenType,
+			"subject_token":      "access",
+			"actor_token_type":   jwtTokenType,
+			"actor_token":        "actor.jwt.sig",
+		}
+		for key, value := range want {
+			if got := r.PostForm.Get(key); got != value {
+				t.Errorf("Expected %s=%q, got %q", key, value, got)
+			}
+		}
+		w.Write([]byte(`{"access_token": "asset.jwt.sig", "token_type": "Bearer", "issued_token_type": "urn:ietf:params:oauth:token-type:jwt"}`))
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = original }()
+
+	org := &StoredOrg{Alias: "iot", AccessToken: "access", InstanceURL: server.URL}
+	result, err := exchangeAssetToken(org, "actor.jwt.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AssetToken != "asset.jwt.sig" || result.IssuedTokenType != jwtTokenType || result.InstanceURL != server.URL {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestExchangeAssetTokenNeedsAccessToken(t *testing.T) {
+	if _, err := exchangeAssetToken(&StoredOrg{Alias: "iot", InstanceURL: "https://na1.salesforce.com"}, ""); err == nil {
+		t.Error("Expected an org without an access token to be rejected")
+	}
+}
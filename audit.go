@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// auditFileName is the audit log in the config directory
+const auditFileName = "audit.jsonl"
+
+// eventTokenRead is a stored token handed to a caller without a refresh. It
+// is only audited, not sent to webhooks.
+const eventTokenRead = "token-read"
+
+// Outcomes of an audited event
+const (
+	auditSuccess = "success"
+	auditFailure = "failure"
+)
+
+var (
+	// auditLogPath is the audit log for this run; empty turns auditing off
+	auditLogPath string
+	// auditCommand is the command that is running, for audit entries
+	auditCommand string
+	auditMu      sync.Mutex
+)
+
+var (
+	flagAuditAlias string
+	flagAuditEvent string
+	flagAuditSince time.Duration
+	flagAuditLimit int
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the local audit log",
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show audited logins, refreshes, revocations and token reads",
+	Long: `Print entries of the audit log, ` + auditFileName + ` in the config directory,
+oldest first. Every login, refresh, revocation and token read is appended to
+it with the time, org, outcome and the process and OS user behind it, but
+never a token.`,
+	Args: cobra.NoArgs,
+	Run:  runAuditShow,
+}
+
+func init() {
+	auditShowCmd.Flags().StringVarP(&flagAuditAlias, "alias", "a", "", "Only show entries for this org")
+	auditShowCmd.Flags().StringVar(&flagAuditEvent, "event", "", "Only show this event: login, refresh, revoke or token-read")
+	auditShowCmd.Flags().DurationVar(&flagAuditSince, "since", 0, "Only show entries from this long ago (e.g. 24h)")
+	auditShowCmd.Flags().IntVarP(&flagAuditLimit, "limit", "n", 50, "Show at most this many of the latest entries (0 for all)")
+
+	auditCmd.AddCommand(auditShowCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+// auditEntry is a line of the audit log
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Alias    string    `json:"alias,omitempty"`
+	OrgID    string    `json:"org_id,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	// Caller is the client a server handed the token to, when known
+	Caller string `json:"caller,omitempty"`
+	PID    int    `json:"pid"`
+	User   string `json:"user,omitempty"`
+}
+
+// setupAuditLog turns on the audit log in dir unless config.json has
+// "audit_log": false
+func setupAuditLog(cmd *cobra.Command, dir string, cfg *Config) {
+	auditLogPath = ""
+	if cfg.AuditLog != nil && !*cfg.AuditLog {
+		return
+	}
+	auditLogPath = filepath.Join(dir, auditFileName)
+	auditCommand = cmd.CommandPath()
+}
+
+// recordAuthEvent writes an event about an org to the audit log and, if it
+// succeeded, sends it to the webhooks
+func recordAuthEvent(event string, org *StoredOrg, err error) {
+	recordAudit(newAuditEntry(event, org, err))
+	if err != nil {
+		reportTelemetryFailure(err)
+	} else if event != eventTokenRead {
+		notifyWebhooks(event, org)
+	}
+}
+
+func newAuditEntry(event string, org *StoredOrg, err error) auditEntry {
+	entry := auditEntry{
+		Time:     authDeps.Clock.Now().UTC(),
+		Event:    event,
+		Alias:    org.Alias,
+		OrgID:    org.OrgID,
+		Username: org.Username,
+		Outcome:  auditSuccess,
+		Command:  auditCommand,
+		PID:      os.Getpid(),
+		User:     auditUser(),
+	}
+	if err != nil {
+		entry.Outcome, entry.Error = auditFailure, scrubSecrets(err.Error())
+	}
+	return entry
+}
+
+// recordAudit appends an entry to the audit log. The log is only ever
+// opened for appending, and a failure to write it is only logged.
+func recordAudit(entry auditEntry) {
+	if auditLogPath == "" {
+		return
+	}
+	if err := appendAudit(auditLogPath, entry); err != nil {
+		log.Printf("Warning: could not write the audit log: %v", err)
+	}
+}
+
+func appendAudit(path string, entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	// One write per entry, so entries from processes running at the same
+	// time are not interleaved
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditUser is the OS user running the CLI
+var auditUser = sync.OnceValue(func() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+})
+
+// auditFilter selects entries for audit show
+type auditFilter struct {
+	alias, event string
+	since        time.Time
+	limit        int
+}
+
+func (f auditFilter) matches(entry auditEntry) bool {
+	return (f.alias == "" || entry.Alias == f.alias) &&
+		(f.event == "" || entry.Event == f.event) &&
+		(f.since.IsZero() || !entry.Time.Before(f.since))
+}
+
+// readAudit reads the matching entries from an audit log, keeping the
+// latest limit of them. Lines that do not parse are skipped with a warning.
+func readAudit(r io.Reader, filter auditFilter) ([]auditEntry, error) {
+	entries := []auditEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Warning: skipping line %d of the audit log: %v", n, err)
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the audit log: %v", err)
+	}
+	if filter.limit > 0 && len(entries) > filter.limit {
+		entries = entries[len(entries)-filter.limit:]
+	}
+	return entries, nil
+}
+
+func runAuditShow(cmd *cobra.Command, args []string) {
+	switch flagAuditEvent {
+	case "", eventLogin, eventRefresh, eventRevoke, eventTokenRead:
+	default:
+		log.Fatalf("Error: unknown --event %q (use %s, %s, %s or %s)", flagAuditEvent, eventLogin, eventRefresh, eventRevoke, eventTokenRead)
+	}
+	filter := auditFilter{alias: flagAuditAlias, event: flagAuditEvent, limit: flagAuditLimit}
+	if flagAuditSince > 0 {
+		filter.since = authDeps.Clock.Now().Add(-flagAuditSince)
+	}
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	var entries []auditEntry
+	f, err := os.Open(filepath.Join(dir, auditFileName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		entries = []auditEntry{}
+	case err != nil:
+		log.Fatalf("Error opening the audit log: %v", err)
+	default:
+		entries, err = readAudit(f, filter)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	if outputFormat(outputText) == outputJSON {
+		if err := writeJSON(entries); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+		return
+	}
+	writeAuditEntries(os.Stdout, entries, useColor(os.Stdout))
+}
+
+func writeAuditEntries(out io.Writer, entries []auditEntry, color bool) {
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No audit log entries")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tALIAS\tUSERNAME\tCOMMAND\tPID\tUSER\tOUTCOME")
+	for _, e := range entries {
+		outcome := colorize(colorGreen, e.Outcome, color)
+		if e.Outcome != auditSuccess {
+			outcome = colorize(colorRed, e.Outcome+": "+e.Error, color)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Event, orDash(e.Alias), orDash(e.Username), orDash(e.Command), e.PID, orDash(e.User), outcome)
+	}
+	w.Flush()
+}
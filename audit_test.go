@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withAuditLog points the audit log at a temporary file, with webhooks off
+func withAuditLog(t *testing.T) string {
+	t.Helper()
+	oldPath, oldHooks := auditLogPath, webhooks
+	auditLogPath = filepath.Join(t.TempDir(), auditFileName)
+	webhooks = nil
+	t.Cleanup(func() { auditLogPath, webhooks = oldPath, oldHooks })
+	return auditLogPath
+}
+
+// auditedEvents reads back the audit log as "event alias outcome" lines
+func auditedEvents(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	entries, err := readAudit(bytes.NewReader(data), auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, e := range entries {
+		events = append(events, e.Event+" "+e.Alias+" "+e.Outcome)
+	}
+	return events
+}
+
+func TestRecordAuthEvent(t *testing.T) {
+	original := authDeps
+	defer func() { authDeps = original }()
+	now := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)
+	authDeps = &oauthDeps{Clock: fakeClock{now: now}}
+
+	oldPath, oldHooks := auditLogPath, webhooks
+	auditLogPath = filepath.Join(t.TempDir(), "nested", auditFileName)
+	webhooks = nil
+	t.Cleanup(func() { auditLogPath, webhooks = oldPath, oldHooks })
+
+	org := &StoredOrg{Alias: "prod", OrgID: "00D000000000001AAA", Username: "me@acme.com", AccessToken: "00D!access", RefreshToken: "5Aep861"}
+	recordAuthEvent(eventLogin, org, nil)
+	recordAuthEvent(eventRefresh, org, errors.New("invalid_grant: expired access/refresh token"))
+
+	data, err := os.ReadFile(auditLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "00D!access") || strings.Contains(string(data), "5Aep861") {
+		t.Errorf("audit log holds a token:\n%s", data)
+	}
+	if info, err := os.Stat(auditLogPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, %v", info.Mode().Perm(), err)
+	}
+
+	entries, err := readAudit(bytes.NewReader(data), auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	login, refresh := entries[0], entries[1]
+	if login.Event != eventLogin || login.Outcome != auditSuccess || login.Alias != "prod" || login.Username != "me@acme.com" || !login.Time.Equal(now) || login.PID != os.Getpid() {
+		t.Errorf("unexpected login entry %+v", login)
+	}
+	if refresh.Outcome != auditFailure || !strings.Contains(refresh.Error, "invalid_grant") {
+		t.Errorf("unexpected refresh entry %+v", refresh)
+	}
+}
+
+func TestRecordAuditDisabled(t *testing.T) {
+	dir := t.TempDir()
+	old := auditLogPath
+	t.Cleanup(func() { auditLogPath = old })
+
+	off := false
+	setupAuditLog(rootCmd, dir, &Config{AuditLog: &off})
+	recordAudit(newAuditEntry(eventLogin, &StoredOrg{Alias: "prod"}, nil))
+	if _, err := os.Stat(filepath.Join(dir, auditFileName)); !os.IsNotExist(err) {
+		t.Errorf("audit log written with audit_log off: %v", err)
+	}
+
+	setupAuditLog(rootCmd, dir, &Config{})
+	if auditLogPath != filepath.Join(dir, auditFileName) {
+		t.Errorf("auditLogPath = %q", auditLogPath)
+	}
+}
+
+func TestReadAuditFilters(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), auditFileName)
+	for i, e := range []auditEntry{
+		{Event: eventLogin, Alias: "prod"},
+		{Event: eventTokenRead, Alias: "prod"},
+		{Event: eventRefresh, Alias: "dev"},
+		{Event: eventRefresh, Alias: "prod"},
+		{Event: eventRevoke, Alias: "prod"},
+	} {
+		e.Time, e.Outcome = start.Add(time.Duration(i)*time.Hour), auditSuccess
+		if err := appendAudit(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n\n")
+	f.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tt := range map[string]struct {
+		filter auditFilter
+		want   []string
+	}{
+		"all":   {auditFilter{}, []string{"login prod", "token-read prod", "refresh dev", "refresh prod", "revoke prod"}},
+		"alias": {auditFilter{alias: "dev"}, []string{"refresh dev"}},
+		"event": {auditFilter{event: eventRefresh}, []string{"refresh dev", "refresh prod"}},
+		"since": {auditFilter{since: start.Add(3 * time.Hour)}, []string{"refresh prod", "revoke prod"}},
+		"limit": {auditFilter{alias: "prod", limit: 2}, []string{"refresh prod", "revoke prod"}},
+	} {
+		entries, err := readAudit(bytes.NewReader(data), tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Event+" "+e.Alias)
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%s: got %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAuditEntries(t *testing.T) {
+	var buf bytes.Buffer
+	writeAuditEntries(&buf, nil, false)
+	if buf.String() != "No audit log entries\n" {
+		t.Errorf("empty output = %q", buf.String())
+	}
+
+	buf.Reset()
+	writeAuditEntries(&buf, []auditEntry{
+		{Time: time.Now(), Event: eventLogin, Alias: "prod", Command: "sfdc-go-auth-cli login", PID: 42, User: "menno", Outcome: auditSuccess},
+		{Time: time.Now(), Event: eventRefresh, Alias: "dev", PID: 43, Outcome: auditFailure, Error: "invalid_grant"},
+	}, false)
+	out := buf.String()
+	for _, want := range []string{"EVENT", "login", "sfdc-go-auth-cli login", "42", "menno", "success", "failure: invalid_grant"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+}
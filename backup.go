@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	backupFormat        = "sfdc-auth-backup"
+	backupFormatVersion = 1
+	backupPassphraseEnv = "SFDC_AUTH_BACKUP_PASSPHRASE"
+
+	// scrypt parameters recommended for interactive use
+	backupScryptN = 1 << 15
+	backupScryptR = 8
+	backupScryptP = 1
+	// backupScryptMaxCost caps 128*N*R*P, the bytes scrypt needs times its
+	// parallelism, for backups read from disk: 256 MiB, eight times the
+	// cost of the parameters above
+	backupScryptMaxCost = 256 << 20
+	backupKeyLen        = 32
+	backupSaltLen       = 16
+)
+
+// backupArchive is the plaintext content of a backup
+type backupArchive struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Config    *Config      `json:"config"`
+	Orgs      []*StoredOrg `json:"orgs"`
+}
+
+// backupEnvelope is the encrypted on-disk form of a backup. The archive is
+// sealed with AES-256-GCM using a key derived from the passphrase via scrypt.
+type backupEnvelope struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+var (
+	flagBackupOut    string
+	flagRestoreIn    string
+	flagRestoreForce bool
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write an encrypted backup of the token store",
+	Long: `Write an encrypted archive of the config and every org in the token store,
+for migrating to a new machine or recovering long-lived refresh tokens.
+
+The passphrase is prompted for, or read from ` + backupPassphraseEnv + `.`,
+	Args: cobra.NoArgs,
+	Run:  runBackup,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore orgs from an encrypted backup",
+	Long: `Restore the orgs in an encrypted backup into the token store. Orgs whose
+alias already exists are skipped unless --force is given.
+
+The passphrase is prompted for, or read from ` + backupPassphraseEnv + `.`,
+	Args: cobra.NoArgs,
+	Run:  runRestore,
+}
+
+func init() {
+	// -o is taken by the global --output flag
+	backupCmd.Flags().StringVar(&flagBackupOut, "out", "", "Path of the encrypted backup file to write")
+	_ = backupCmd.MarkFlagRequired("out")
+
+	restoreCmd.Flags().StringVarP(&flagRestoreIn, "in", "i", "", "Path of the encrypted backup file to read")
+	restoreCmd.Flags().BoolVarP(&flagRestoreForce, "force", "f", false, "Overwrite orgs that already exist in the token store")
+	_ = restoreCmd.MarkFlagRequired("in")
+
+	rootCmd.AddCommand(backupCmd, restoreCmd)
+}
+
+func runBackup(cmd *cobra.Command, args []string) {
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	passphrase, err := readBackupPassphrase(true)
+	if err != nil {
+		log.Fatalf("Error reading passphrase: %v", err)
+	}
+	defer wipeBytes(passphrase)
+
+	count, err := writeBackup(store, cfg, flagBackupOut, passphrase)
+	if err != nil {
+		log.Fatalf("Error writing backup: %v", err)
+	}
+	infof("Backed up %d org(s) to %s", count, flagBackupOut)
+}
+
+func runRestore(cmd *cobra.Command, args []string) {
+	data, err := os.ReadFile(flagRestoreIn)
+	if err != nil {
+		log.Fatalf("Error reading backup: %v", err)
+	}
+
+	passphrase, err := readBackupPassphrase(false)
+	if err != nil {
+		log.Fatalf("Error reading passphrase: %v", err)
+	}
+	defer wipeBytes(passphrase)
+
+	archive, err := decryptBackup(data, passphrase)
+	if err != nil {
+		log.Fatalf("Error decrypting backup: %v", err)
+	}
+
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	restored, skipped, err := restoreBackup(store, archive, flagRestoreForce)
+	if err != nil {
+		log.Fatalf("Error restoring backup: %v", err)
+	}
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	if err := restoreConfig(dir, archive.Config); err != nil {
+		log.Fatalf("Error restoring config: %v", err)
+	}
+
+	if skipped > 0 {
+		infof("Restored %d org(s) from %s (skipped %d existing, use --force to overwrite)", restored, flagRestoreIn, skipped)
+	} else {
+		infof("Restored %d org(s) from %s", restored, flagRestoreIn)
+	}
+}
+
+// writeBackup encrypts every org in the store plus the config to path
+func writeBackup(store TokenStore, cfg *Config, path string, passphrase []byte) (int, error) {
+	orgs, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	archive := &backupArchive{
+		Version:   backupFormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Config:    cfg,
+		Orgs:      orgs,
+	}
+	data, err := encryptBackup(archive, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return 0, fmt.Errorf("error writing backup file: %v", err)
+	}
+	return len(orgs), nil
+}
+
+// restoreBackup puts the archived orgs into the store, keeping existing
+// aliases unless force is set
+func restoreBackup(store TokenStore, archive *backupArchive, force bool) (int, int, error) {
+	restored, skipped := 0, 0
+	for _, org := range archive.Orgs {
+		if !force {
+			if _, err := store.Get(org.Alias); err == nil {
+				skipped++
+				continue
+			} else if !errors.Is(err, errOrgNotFound) {
+				return restored, skipped, err
+			}
+		}
+		if err := store.Put(org); err != nil {
+			return restored, skipped, err
+		}
+		restored++
+	}
+	return restored, skipped, nil
+}
+
+// restoreConfig writes the archived config unless one already exists
+func restoreConfig(dir string, cfg *Config) error {
+	if cfg == nil {
+		return nil
+	}
+	path := filepath.Join(dir, configFileName)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return saveConfig(dir, cfg)
+}
+
+func encryptBackup(archive *backupArchive, passphrase []byte) ([]byte, error) {
+	plaintext, err := json.Marshal(archive)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding backup: %v", err)
+	}
+
+	salt := make([]byte, backupSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %v", err)
+	}
+	aead, err := newBackupCipher(passphrase, salt, backupScryptN, backupScryptR, backupScryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+
+	envelope := backupEnvelope{
+		Format:  backupFormat,
+		Version: backupFormatVersion,
+		KDF:     "scrypt",
+		N:       backupScryptN,
+		R:       backupScryptR,
+		P:       backupScryptP,
+		Salt:    salt,
+		Nonce:   nonce,
+	}
+	envelope.Ciphertext = aead.Seal(nil, nonce, plaintext, envelope.additionalData())
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+func decryptBackup(data, passphrase []byte) (*backupArchive, error) {
+	var envelope backupEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("not a valid backup file: %v", err)
+	}
+	if envelope.Format != backupFormat {
+		return nil, fmt.Errorf("not a valid backup file: unexpected format %q", envelope.Format)
+	}
+	if envelope.Version > backupFormatVersion {
+		return nil, fmt.Errorf("backup version %d is newer than this release supports", envelope.Version)
+	}
+	if envelope.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", envelope.KDF)
+	}
+	// Refuse parameters that would take unbounded time or memory to derive
+	if envelope.N <= 0 || envelope.R <= 0 || envelope.P <= 0 ||
+		envelope.N > backupScryptMaxCost/128/envelope.R/envelope.P {
+		return nil, fmt.Errorf("not a valid backup file: excessive key derivation parameters")
+	}
+
+	aead, err := newBackupCipher(passphrase, envelope.Salt, envelope.N, envelope.R, envelope.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("not a valid backup file: bad nonce")
+	}
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, envelope.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted backup")
+	}
+
+	var archive backupArchive
+	if err := json.Unmarshal(plaintext, &archive); err != nil {
+		return nil, fmt.Errorf("error decoding backup: %v", err)
+	}
+	return &archive, nil
+}
+
+// additionalData binds the envelope header to the ciphertext so the KDF
+// parameters cannot be tampered with
+func (e *backupEnvelope) additionalData() []byte {
+	return fmt.Appendf(nil, "%s:%d:%s:%d:%d:%d", e.Format, e.Version, e.KDF, e.N, e.R, e.P)
+}
+
+func newBackupCipher(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, backupKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// readBackupPassphrase reads the passphrase from the environment or prompts
+// for it, asking twice when creating a new backup
+func readBackupPassphrase(confirm bool) ([]byte, error) {
+	if env := os.Getenv(backupPassphraseEnv); env != "" {
+		return []byte(env), nil
+	}
+
+	passphrase, err := promptHidden(tr(msgPromptBackupPassphrase, nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+
+	if confirm {
+		again, err := promptHidden(tr(msgConfirmBackupPassphrase, nil))
+		defer wipeBytes(again)
+		if err != nil {
+			wipeBytes(passphrase)
+			return nil, err
+		}
+		if !bytes.Equal(again, passphrase) {
+			wipeBytes(passphrase)
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
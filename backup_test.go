@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupEncryptDecrypt(t *testing.T) {
+	archive := &backupArchive{
+		Version:   backupFormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Config:    &Config{Store: storeTypeSQLite},
+		Orgs:      []*StoredOrg{{Alias: "prod", RefreshToken: "secret_refresh"}},
+	}
+
+	data, err := encryptBackup(archive, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("encryptBackup failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("secret_refresh")) {
+		t.Error("Backup must not contain plaintext tokens")
+	}
+
+	got, err := decryptBackup(data, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("decryptBackup failed: %v", err)
+	}
+	if len(got.Orgs) != 1 || got.Orgs[0].RefreshToken != "secret_refresh" {
+		t.Errorf("Unexpected orgs after round trip: %+v", got.Orgs)
+	}
+	if got.Config == nil || got.Config.Store != storeTypeSQLite {
+		t.Errorf("Expected config to survive round trip, got %+v", got.Config)
+	}
+
+	if _, err := decryptBackup(data, []byte("wrong")); err == nil {
+		t.Error("Expected error decrypting with the wrong passphrase")
+	}
+}
+
+func TestBackupRejectsTampering(t *testing.T) {
+	data, err := encryptBackup(&backupArchive{Version: backupFormatVersion}, []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope backupEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	envelope.R = 4
+	tampered, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptBackup(tampered, []byte("pass")); err == nil {
+		t.Error("Expected error when the envelope header is modified")
+	}
+
+	if _, err := decryptBackup([]byte(`{"format": "other"}`), []byte("pass")); err == nil {
+		t.Error("Expected error for a file that is not a backup")
+	}
+
+	// A header asking for 1 GiB of scrypt memory is refused before deriving
+	envelope.N, envelope.R = 1<<20, 8
+	oversized, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptBackup(oversized, []byte("pass")); err == nil || !strings.Contains(err.Error(), "excessive key derivation parameters") {
+		t.Errorf("Expected oversized scrypt parameters to be refused, got %v", err)
+	}
+}
+
+func TestWriteAndRestoreBackup(t *testing.T) {
+	source, err := openTokenStore(storeTypeFile, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	for _, alias := range []string{"prod", "uat"} {
+		if err := source.Put(&StoredOrg{Alias: alias, RefreshToken: alias + "_refresh"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.enc")
+	count, err := writeBackup(source, &Config{}, path, []byte("pass"))
+	if err != nil {
+		t.Fatalf("writeBackup failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 orgs backed up, got %d", count)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Backup file should exist with 0600 permissions: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := decryptBackup(data, []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := openTokenStore(storeTypeFile, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	if err := target.Put(&StoredOrg{Alias: "prod", RefreshToken: "newer_refresh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, skipped, err := restoreBackup(target, archive, false)
+	if err != nil {
+		t.Fatalf("restoreBackup failed: %v", err)
+	}
+	if restored != 1 || skipped != 1 {
+		t.Errorf("Expected 1 restored and 1 skipped, got %d and %d", restored, skipped)
+	}
+	if org, _ := target.Get("prod"); org.RefreshToken != "newer_refresh" {
+		t.Error("Existing org should not be overwritten without force")
+	}
+
+	if _, _, err := restoreBackup(target, archive, true); err != nil {
+		t.Fatal(err)
+	}
+	if org, _ := target.Get("prod"); org.RefreshToken != "prod_refresh" {
+		t.Error("Existing org should be overwritten with force")
+	}
+}
+
+func TestRestoreConfigKeepsExisting(t *testing.T) {
+	dir := t.TempDir()
+	if err := restoreConfig(dir, &Config{Store: storeTypeBolt}); err != nil {
+		t.Fatalf("restoreConfig failed: %v", err)
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil || cfg.Store != storeTypeBolt {
+		t.Fatalf("Expected restored config with bolt store, got %+v (%v)", cfg, err)
+	}
+
+	if err := restoreConfig(dir, &Config{Store: storeTypeSQLite}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := loadConfig(dir); cfg.Store != storeTypeBolt {
+		t.Error("An existing config should not be overwritten")
+	}
+}
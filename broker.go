@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultBrokerListen      = ":9443"
+	defaultBrokerGroupsClaim = "groups"
+)
+
+var (
+	flagBrokerListen      string
+	flagBrokerPolicy      string
+	flagBrokerTLSCert     string
+	flagBrokerTLSKey      string
+	flagBrokerClientCA    string
+	flagBrokerOIDCIssuer  string
+	flagBrokerOIDCAud     string
+	flagBrokerGroupsClaim string
+)
+
+var brokerCmd = &cobra.Command{
+	Use:   "broker",
+	Short: "Run a shared token broker with per-org access rules",
+	Long: `Run a central token broker for a team. The broker holds the Connected App
+credentials and refresh tokens in its token store and hands out freshly
+refreshed access tokens to callers the policy file allows.
+
+Callers authenticate with a client certificate signed by --client-ca (mTLS),
+with an OIDC ID token from --oidc-issuer sent as a bearer token, or both.
+
+Endpoints:
+  GET  /v1/orgs                 orgs the caller may use (no tokens)
+  POST /v1/orgs/{alias}/token   refresh and return a new access token`,
+	Args: cobra.NoArgs,
+	Run:  runBroker,
+}
+
+func init() {
+	brokerCmd.Flags().StringVar(&flagBrokerListen, "listen", defaultBrokerListen, "Address to listen on")
+	brokerCmd.Flags().StringVar(&flagBrokerPolicy, "policy", "", "Path of the JSON access policy")
+	brokerCmd.Flags().StringVar(&flagBrokerTLSCert, "tls-cert", "", "Server certificate (PEM)")
+	brokerCmd.Flags().StringVar(&flagBrokerTLSKey, "tls-key", "", "Server private key (PEM)")
+	brokerCmd.Flags().StringVar(&flagBrokerClientCA, "client-ca", "", "CA bundle for verifying client certificates (enables mTLS)")
+	brokerCmd.Flags().StringVar(&flagBrokerOIDCIssuer, "oidc-issuer", "", "OIDC issuer whose ID tokens are accepted")
+	brokerCmd.Flags().StringVar(&flagBrokerOIDCAud, "oidc-audience", "", "Audience (client ID) the ID tokens must be issued for")
+	brokerCmd.Flags().StringVar(&flagBrokerGroupsClaim, "oidc-groups-claim", defaultBrokerGroupsClaim, "ID token claim listing the caller's groups")
+	_ = brokerCmd.MarkFlagRequired("policy")
+	_ = brokerCmd.MarkFlagRequired("tls-cert")
+	_ = brokerCmd.MarkFlagRequired("tls-key")
+
+	rootCmd.AddCommand(brokerCmd)
+}
+
+// brokerPolicy is the broker's access policy file
+type brokerPolicy struct {
+	// Apps maps a Connected App client ID to where its secret comes from
+	Apps  map[string]brokerApp `json:"apps"`
+	Rules []brokerRule         `json:"rules"`
+}
+
+type brokerApp struct {
+	ClientSecretEnv string `json:"client_secret_env"`
+}
+
+// brokerRule grants the listed subjects and groups access to orgs whose
+// alias matches one of the Orgs patterns (path.Match syntax, "*" for all)
+type brokerRule struct {
+	Subjects []string `json:"subjects"`
+	Groups   []string `json:"groups"`
+	Orgs     []string `json:"orgs"`
+}
+
+// brokerIdentity is an authenticated caller
+type brokerIdentity struct {
+	Subject string
+	Groups  []string
+	Method  string
+}
+
+// brokerServer issues access tokens to authenticated, authorised callers
+type brokerServer struct {
+	store        TokenStore
+	policy       *brokerPolicy
+	oidc         *oidcVerifier
+	groupsClaim  string
+	clientSecret func(clientID string) *secret
+	refresh      func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error)
+
+	// mu serialises refreshes, so requests arriving together for an org
+	// each refresh with the token the one before saved, and none revokes a
+	// refresh token another is still using
+	mu sync.Mutex
+}
+
+func runBroker(cmd *cobra.Command, args []string) {
+	if flagBrokerClientCA == "" && flagBrokerOIDCIssuer == "" {
+		log.Fatal("Error: configure at least one of --client-ca or --oidc-issuer")
+	}
+	if flagBrokerOIDCIssuer != "" && flagBrokerOIDCAud == "" {
+		log.Fatal("Error: --oidc-audience is required with --oidc-issuer")
+	}
+
+	policy, err := loadBrokerPolicy(flagBrokerPolicy)
+	if err != nil {
+		log.Fatalf("Error loading policy: %v", err)
+	}
+	tlsConfig, err := brokerTLSConfig(flagBrokerClientCA, flagBrokerOIDCIssuer != "")
+	if err != nil {
+		log.Fatalf("Error configuring TLS: %v", err)
+	}
+
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	broker := &brokerServer{
+		store:        store,
+		policy:       policy,
+		groupsClaim:  flagBrokerGroupsClaim,
+		clientSecret: policy.clientSecret,
+		refresh:      refreshAccessToken,
+	}
+	if flagBrokerOIDCIssuer != "" {
+		broker.oidc = newOIDCVerifier(flagBrokerOIDCIssuer, flagBrokerOIDCAud)
+	}
+
+	server := &http.Server{
+		Addr:              flagBrokerListen,
+		Handler:           broker.routes(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(scrubWriter{w: os.Stderr}, "", log.LstdFlags),
+	}
+
+	ctx := cmd.Context()
+	go func() {
+		defer handlePanic()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	infof("Token broker listening on https://%s", flagBrokerListen)
+	if err := server.ListenAndServeTLS(flagBrokerTLSCert, flagBrokerTLSKey); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+func loadBrokerPolicy(policyPath string) (*brokerPolicy, error) {
+	raw, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %v", err)
+	}
+	policy := &brokerPolicy{}
+	if err := json.Unmarshal(raw, policy); err != nil {
+		return nil, fmt.Errorf("error decoding policy file: %v", err)
+	}
+	for i, rule := range policy.Rules {
+		for _, pattern := range rule.Orgs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid org pattern %q", i+1, pattern)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// brokerTLSConfig requires client certificates when mTLS is the only way to
+// authenticate, and accepts them optionally alongside OIDC
+func brokerTLSConfig(clientCA string, oidc bool) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCA == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(clientCA)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCA)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if oidc {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// allows reports whether the caller may obtain tokens for alias
+func (p *brokerPolicy) allows(id *brokerIdentity, alias string) bool {
+	for _, rule := range p.Rules {
+		if !rule.matchesIdentity(id) {
+			continue
+		}
+		for _, pattern := range rule.Orgs {
+			if ok, _ := path.Match(pattern, alias); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r brokerRule) matchesIdentity(id *brokerIdentity) bool {
+	for _, subject := range r.Subjects {
+		if subject == "*" || subject == id.Subject {
+			return true
+		}
+	}
+	for _, group := range r.Groups {
+		if containsString(id.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientSecret looks up the secret for a Connected App from the environment
+// variable the policy names; apps without an entry refresh without a secret
+func (p *brokerPolicy) clientSecret(clientID string) *secret {
+	app, ok := p.Apps[clientID]
+	if !ok || app.ClientSecretEnv == "" {
+		return nil
+	}
+	return newSecret([]byte(os.Getenv(app.ClientSecretEnv)))
+}
+
+func (b *brokerServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/orgs", b.handleListOrgs)
+	mux.HandleFunc("POST /v1/orgs/{alias}/token", b.handleIssueToken)
+	return mux
+}
+
+// issueToken refreshes the org's access token and saves it, returning the
+// HTTP status to answer with on failure
+func (b *brokerServer) issueToken(alias string) (*StoredOrg, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// An allowed pattern can match an alias that does not exist; answer the
+	// same way so callers cannot probe which aliases are stored
+	org, err := b.store.Get(alias)
+	if errors.Is(err, errOrgNotFound) {
+		return nil, http.StatusForbidden, fmt.Errorf("access to org %q denied", alias)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error reading org: %v", err)
+	}
+
+	clientSecret := b.clientSecret(org.ClientID)
+	resp, err := b.refresh(org, clientSecret)
+	clientSecret.Wipe()
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("error refreshing token: %v", err)
+	}
+	previous := *org
+	applyRefresh(org, resp)
+	// Save so a rotated refresh token is not lost
+	if err := saveRefresh(b.store, org); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	revokeSuperseded(&previous, org)
+	return org, http.StatusOK, nil
+}
+
+// audit records a token issued, or denied, to a caller
+func (b *brokerServer) audit(org *StoredOrg, id *brokerIdentity, err error) {
+	entry := newAuditEntry(eventTokenRead, org, err)
+	entry.Caller = id.Subject + " (" + id.Method + ")"
+	recordAudit(entry)
+}
+
+// identify authenticates the caller by client certificate or OIDC bearer
+// token. A presented bearer token must be valid even if a certificate is too.
+func (b *brokerServer) identify(r *http.Request) (*brokerIdentity, error) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if b.oidc == nil {
+			return nil, fmt.Errorf("bearer tokens are not accepted by this broker")
+		}
+		claims, err := b.oidc.Verify(bearer)
+		if err != nil {
+			return nil, err
+		}
+		if claims.Subject == "" {
+			return nil, fmt.Errorf("token has no subject")
+		}
+		return &brokerIdentity{Subject: claims.Subject, Groups: claimStrings(claims.Raw[b.groupsClaim]), Method: "oidc"}, nil
+	}
+
+	// Only chains verified against --client-ca count
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		if cert.Subject.CommonName == "" {
+			return nil, fmt.Errorf("client certificate has no common name")
+		}
+		return &brokerIdentity{Subject: cert.Subject.CommonName, Groups: cert.Subject.OrganizationalUnit, Method: "mtls"}, nil
+	}
+	return nil, fmt.Errorf("no client certificate or bearer token presented")
+}
+
+func (b *brokerServer) handleListOrgs(w http.ResponseWriter, r *http.Request) {
+	id, err := b.identify(r)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	orgs, err := b.store.List()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("error listing orgs: %v", err))
+		return
+	}
+	result := []apiOrg{}
+	for _, org := range orgs {
+		if b.policy.allows(id, org.Alias) {
+			result = append(result, newAPIOrg(org))
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, result)
+}
+
+func (b *brokerServer) handleIssueToken(w http.ResponseWriter, r *http.Request) {
+	id, err := b.identify(r)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	alias := r.PathValue("alias")
+	if !b.policy.allows(id, alias) {
+		log.Printf("broker: denied %s (%s) access to %q", id.Subject, id.Method, alias)
+		b.audit(&StoredOrg{Alias: alias}, id, errors.New("access denied"))
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("access to org %q denied", alias))
+		return
+	}
+	org, status, err := b.issueToken(alias)
+	if err != nil {
+		writeAPIError(w, status, err.Error())
+		return
+	}
+
+	log.Printf("broker: issued a token for %q to %s (%s)", alias, id.Subject, id.Method)
+	b.audit(org, id, nil)
+	writeAPIJSON(w, http.StatusOK, apiToken{AccessToken: org.AccessToken, InstanceURL: org.InstanceURL, IssuedAt: org.IssuedAt})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testBrokerPolicy = &brokerPolicy{
+	Apps: map[string]brokerApp{"app1": {ClientSecretEnv: "TEST_BROKER_APP1_SECRET"}},
+	Rules: []brokerRule{
+		{Subjects: []string{"alice"}, Orgs: []string{"*"}},
+		{Groups: []string{"integration"}, Orgs: []string{"uat-*"}},
+	},
+}
+
+func newTestBroker(t *testing.T, iss *testIssuer) *brokerServer {
+	t.Helper()
+	store := newTestStore(t, "prod", "uat-1")
+	for _, alias := range []string{"prod", "uat-1"} {
+		org, _ := store.Get(alias)
+		org.ClientID = "app1"
+		if err := store.Put(org); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEST_BROKER_APP1_SECRET", "app1-secret")
+	return &brokerServer{
+		store:        store,
+		policy:       testBrokerPolicy,
+		oidc:         newOIDCVerifier(iss.server.URL, "broker"),
+		groupsClaim:  defaultBrokerGroupsClaim,
+		clientSecret: testBrokerPolicy.clientSecret,
+		refresh: func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+			if string(clientSecret.Bytes()) != "app1-secret" {
+				return nil, fmt.Errorf("wrong client secret")
+			}
+			return &SalesforceOAuthResponse{AccessToken: "fresh_" + org.Alias, RefreshToken: "rotated_" + org.Alias}, nil
+		},
+	}
+}
+
+func brokerRequest(t *testing.T, b *brokerServer, method, path, bearer string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	b.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBrokerPolicyAllows(t *testing.T) {
+	alice := &brokerIdentity{Subject: "alice"}
+	bot := &brokerIdentity{Subject: "ci-bot", Groups: []string{"integration"}}
+	nobody := &brokerIdentity{Subject: "bob", Groups: []string{"sales"}}
+
+	tests := []struct {
+		id    *brokerIdentity
+		alias string
+		want  bool
+	}{
+		{alice, "prod", true},
+		{bot, "uat-1", true},
+		{bot, "prod", false},
+		{nobody, "uat-1", false},
+	}
+	for _, tt := range tests {
+		if got := testBrokerPolicy.allows(tt.id, tt.alias); got != tt.want {
+			t.Errorf("allows(%s, %s) = %t, want %t", tt.id.Subject, tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestBrokerIssueToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	b := newTestBroker(t, iss)
+	revoker := withFakeRevoker(t)
+
+	claims := iss.claims("ci-bot")
+	claims["groups"] = []string{"integration"}
+	bot := iss.sign(t, "key1", claims)
+
+	rec := brokerRequest(t, b, "POST", "/v1/orgs/uat-1/token", bot)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var token apiToken
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "fresh_uat-1" {
+		t.Errorf("Unexpected access token %q", token.AccessToken)
+	}
+	// The rotated refresh token is kept
+	if org, _ := b.store.Get("uat-1"); org.RefreshToken != "rotated_uat-1" {
+		t.Errorf("Rotated refresh token not saved: %q", org.RefreshToken)
+	}
+	if len(revoker.revoked) != 1 || revoker.revoked[0] != "uat-1_refresh" {
+		t.Errorf("Expected the superseded refresh token to be revoked, got %v", revoker.revoked)
+	}
+
+	if rec := brokerRequest(t, b, "POST", "/v1/orgs/prod/token", bot); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an org outside the policy, got %d", rec.Code)
+	}
+	if rec := brokerRequest(t, b, "POST", "/v1/orgs/uat-1/token", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", rec.Code)
+	}
+	if rec := brokerRequest(t, b, "POST", "/v1/orgs/uat-1/token", "garbage"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid token, got %d", rec.Code)
+	}
+}
+
+func TestBrokerIssueTokenConcurrently(t *testing.T) {
+	iss := newTestIssuer(t)
+	b := newTestBroker(t, iss)
+	revoker := withFakeRevoker(t)
+
+	// Each refresh rotates the refresh token, and fails on a superseded one
+	// as Salesforce would once it has been revoked
+	var mu sync.Mutex
+	rotations := 0
+	b.refresh = func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+		// Long enough for requests to overlap if they are not serialised
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		if want := fmt.Sprintf("rotated_%d", rotations); rotations > 0 && org.RefreshToken != want {
+			return nil, fmt.Errorf("refreshed with %q, want %q", org.RefreshToken, want)
+		}
+		rotations++
+		return &SalesforceOAuthResponse{AccessToken: fmt.Sprintf("fresh_%d", rotations), RefreshToken: fmt.Sprintf("rotated_%d", rotations)}, nil
+	}
+
+	alice := iss.sign(t, "key1", iss.claims("alice"))
+	var wg sync.WaitGroup
+	codes := make(chan int, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- brokerRequest(t, b, "POST", "/v1/orgs/prod/token", alice).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Expected every request to succeed, got %d", code)
+		}
+	}
+	if org, _ := b.store.Get("prod"); org.RefreshToken != "rotated_8" {
+		t.Errorf("Expected the last rotated refresh token to be saved, got %q", org.RefreshToken)
+	}
+	if len(revoker.revoked) != 8 {
+		t.Errorf("Expected each superseded refresh token to be revoked once, got %v", revoker.revoked)
+	}
+}
+
+func TestBrokerListOrgs(t *testing.T) {
+	iss := newTestIssuer(t)
+	b := newTestBroker(t, iss)
+
+	rec := brokerRequest(t, b, "GET", "/v1/orgs", iss.sign(t, "key1", iss.claims("alice")))
+	var orgs []apiOrg
+	if err := json.Unmarshal(rec.Body.Bytes(), &orgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 2 {
+		t.Errorf("Expected alice to see both orgs, got %+v", orgs)
+	}
+
+	rec = brokerRequest(t, b, "GET", "/v1/orgs", iss.sign(t, "key1", iss.claims("bob")))
+	if err := json.Unmarshal(rec.Body.Bytes(), &orgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 0 {
+		t.Errorf("Expected bob to see no orgs, got %+v", orgs)
+	}
+}
+
+func TestBrokerClientCertificateIdentity(t *testing.T) {
+	b := &brokerServer{}
+	req := httptest.NewRequest("GET", "/v1/orgs", nil)
+	if _, err := b.identify(req); err == nil {
+		t.Error("Expected an error without credentials")
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci-bot", OrganizationalUnit: []string{"integration"}}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	id, err := b.identify(req)
+	if err != nil {
+		t.Fatalf("identify failed: %v", err)
+	}
+	if id.Subject != "ci-bot" || id.Method != "mtls" || !containsString(id.Groups, "integration") {
+		t.Errorf("Unexpected identity %+v", id)
+	}
+
+	// Unverified certificates are ignored
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if _, err := b.identify(req); err == nil {
+		t.Error("Expected an unverified certificate to be rejected")
+	}
+}
+
+func TestLoadBrokerPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"rules":[{"subjects":["alice"],"orgs":["[bad"]}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBrokerPolicy(path); err == nil {
+		t.Error("Expected an invalid org pattern to be rejected")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+var flagNoBrowser bool
+
+// systemBrowser opens URLs in the user's default browser
+type systemBrowser struct{}
+
+func (systemBrowser) Open(url string) error {
+	// Over SSH or on a headless Linux box there is nothing to open; the
+	// printed URL is all the user needs
+	if runtime.GOOS == "linux" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return nil
+	}
+	name, args, err := browserCommand(runtime.GOOS, url)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the launcher without waiting on the browser itself
+	go cmd.Wait()
+	return nil
+}
+
+// browserCommand is the launcher for the default browser on goos
+func browserCommand(goos, url string) (string, []string, error) {
+	switch goos {
+	case "darwin":
+		return "open", []string{url}, nil
+	case "windows":
+		// rundll32 hands the URL to the default handler without going
+		// through cmd.exe, which would treat & in the query as a separator
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return "xdg-open", []string{url}, nil
+	}
+	return "", nil, fmt.Errorf("don't know how to open a browser on %s", goos)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	const target = "https://login.salesforce.com/services/oauth2/authorize?client_id=x&state=y"
+	tests := []struct {
+		goos string
+		name string
+		args []string
+	}{
+		{"darwin", "open", []string{target}},
+		{"linux", "xdg-open", []string{target}},
+		{"windows", "rundll32", []string{"url.dll,FileProtocolHandler", target}},
+	}
+	for _, tt := range tests {
+		name, args, err := browserCommand(tt.goos, target)
+		if err != nil {
+			t.Errorf("browserCommand(%s): %v", tt.goos, err)
+			continue
+		}
+		if name != tt.name || len(args) != len(tt.args) || args[len(args)-1] != target || args[0] != tt.args[0] {
+			t.Errorf("browserCommand(%s) = %s %v, want %s %v", tt.goos, name, args, tt.name, tt.args)
+		}
+	}
+
+	if _, _, err := browserCommand("plan9", target); err == nil {
+		t.Error("Expected an unsupported OS to be rejected")
+	}
+}
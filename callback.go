@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	defaultCallbackHost = "localhost"
+	defaultCallbackPath = "/callback"
+	containerEnv        = "SFDC_AUTH_CONTAINER"
+)
+
+// --callback-host and --callback-path, the parts of the default redirect URI
+// a Connected App may have registered differently
+var (
+	flagCallbackHost = defaultCallbackHost
+	flagCallbackPath = defaultCallbackPath
+)
+
+// callbackConfig is where the callback server listens and the redirect URI
+// sent to Salesforce. They differ when the CLI runs behind a port mapping,
+// e.g. binding 0.0.0.0:8080 in a container that the browser reaches as
+// localhost:8080.
+type callbackConfig struct {
+	Listen      string
+	RedirectURI string
+	Path        string
+
+	// TLS is set when the callback is served over HTTPS; Fingerprint is that
+	// of a generated self-signed certificate
+	TLS         *tls.Config
+	Fingerprint string
+}
+
+// resolveCallback works out the callback listen address and advertised
+// redirect URI from --port, --bind, --redirect-uri (or --callback-host and
+// --callback-path), --container and the TLS flags
+func resolveCallback(portFlag, bind, redirect string, container bool) (*callbackConfig, error) {
+	useTLS := callbackTLSEnabled()
+	if redirect == "" {
+		scheme := "http"
+		if useTLS {
+			scheme = "https"
+		}
+		redirect = callbackRedirectURI(scheme, flagCallbackHost, portFlag, flagCallbackPath)
+	}
+	u, err := url.Parse(redirect)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid redirect URI %q", redirect)
+	}
+	if useTLS && u.Scheme != "https" {
+		return nil, fmt.Errorf("the callback is served over HTTPS, so the redirect URI %q must use https", redirect)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	if bind == "" {
+		// Listen on the advertised port unless told otherwise; containers must
+		// listen on every interface for the published port to reach us
+		listenPort := u.Port()
+		if listenPort == "" {
+			listenPort = portFlag
+		}
+		bind = ":" + listenPort
+		if container {
+			bind = "0.0.0.0:" + listenPort
+		}
+	}
+	if _, _, err := net.SplitHostPort(bind); err != nil {
+		return nil, fmt.Errorf("invalid bind address %q: %v", bind, err)
+	}
+
+	cfg := &callbackConfig{Listen: bind, RedirectURI: redirect, Path: path}
+	if useTLS {
+		if cfg.TLS, cfg.Fingerprint, err = callbackTLSConfig(flagTLSCert, flagTLSKey, u.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// callbackRedirectURI builds the redirect URI for a callback server on host
+// and port
+func callbackRedirectURI(scheme, host, port, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + path
+}
+
+// inContainer reports whether container defaults were requested through the
+// environment, which the Docker image sets
+func inContainer() bool {
+	v := os.Getenv(containerEnv)
+	return v != "" && v != "0" && v != "false"
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestResolveCallback(t *testing.T) {
+	tests := []struct {
+		name                string
+		port, bind, uri     string
+		container           bool
+		listen, redirect, p string
+	}{
+		{"defaults", "8080", "", "", false, ":8080", "http://localhost:8080/callback", "/callback"},
+		{"custom port", "9090", "", "", false, ":9090", "http://localhost:9090/callback", "/callback"},
+		{"container", "8080", "", "", true, "0.0.0.0:8080", "http://localhost:8080/callback", "/callback"},
+		{"mapped port", "8080", "0.0.0.0:8080", "http://localhost:18080/callback", true, "0.0.0.0:8080", "http://localhost:18080/callback", "/callback"},
+		{"port from redirect", "8080", "", "http://localhost:7777/oauth/done", false, ":7777", "http://localhost:7777/oauth/done", "/oauth/done"},
+	}
+	for _, tt := range tests {
+		cfg, err := resolveCallback(tt.port, tt.bind, tt.uri, tt.container)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if cfg.Listen != tt.listen || cfg.RedirectURI != tt.redirect || cfg.Path != tt.p {
+			t.Errorf("%s: got %+v", tt.name, cfg)
+		}
+	}
+}
+
+func TestResolveCallbackHostAndPath(t *testing.T) {
+	defer func() { flagCallbackHost, flagCallbackPath = defaultCallbackHost, defaultCallbackPath }()
+
+	flagCallbackHost, flagCallbackPath = "127.0.0.1", "oauth/done"
+	cfg, err := resolveCallback("7777", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":7777" || cfg.RedirectURI != "http://127.0.0.1:7777/oauth/done" || cfg.Path != "/oauth/done" {
+		t.Errorf("Unexpected callback %+v", cfg)
+	}
+
+	flagCallbackHost = "::1"
+	if got := callbackRedirectURI("http", flagCallbackHost, "8080", "/cb"); got != "http://[::1]:8080/cb" {
+		t.Errorf("Expected an IPv6 host in brackets, got %q", got)
+	}
+}
+
+func TestResolveCallbackInvalid(t *testing.T) {
+	if _, err := resolveCallback("8080", "", "localhost:8080/callback", false); err == nil {
+		t.Error("Expected a redirect URI without a scheme to be rejected")
+	}
+	if _, err := resolveCallback("8080", "0.0.0.0", "", false); err == nil {
+		t.Error("Expected a bind address without a port to be rejected")
+	}
+}
+
+func TestInContainer(t *testing.T) {
+	t.Setenv(containerEnv, "1")
+	if !inContainer() {
+		t.Error("Expected container mode from the environment")
+	}
+	t.Setenv(containerEnv, "false")
+	if inContainer() {
+		t.Error("Expected container mode to be off")
+	}
+}
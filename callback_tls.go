@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// --callback-tls, --tls-cert and --tls-key, for Connected Apps that only
+// accept https://localhost callback URLs
+var (
+	flagCallbackTLS bool
+	flagTLSCert     string
+	flagTLSKey      string
+)
+
+// selfSignedLifetime bounds how long a generated callback certificate is
+// valid; it only has to outlive one login
+const selfSignedLifetime = 24 * time.Hour
+
+// callbackTLSEnabled reports whether the callback is served over HTTPS
+func callbackTLSEnabled() bool {
+	return flagCallbackTLS || flagTLSCert != "" || flagTLSKey != ""
+}
+
+// callbackTLSConfig loads the certificate given with --tls-cert and
+// --tls-key, or generates an ephemeral self-signed one for host. It returns
+// the SHA-256 fingerprint of a generated certificate so the user can check
+// it when the browser warns about it.
+func callbackTLSConfig(certFile, keyFile, host string) (*tls.Config, string, error) {
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, "", fmt.Errorf("--tls-cert and --tls-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("error loading callback certificate: %v", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, "", nil
+	}
+
+	cert, err := selfSignedCertificate(host, time.Now())
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating callback certificate: %v", err)
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, formatFingerprint(sum[:]), nil
+}
+
+// selfSignedCertificate issues a short-lived certificate for host and the
+// loopback names, with a key that only lives in memory
+func selfSignedCertificate(host string, now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"sfdc-auth callback"}},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(selfSignedLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !ip.IsLoopback() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	} else if host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// formatFingerprint renders a digest the way browsers show it, AB:CD:...
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
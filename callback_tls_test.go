@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func withCallbackTLS(t *testing.T, cert, key string) {
+	t.Helper()
+	flagCallbackTLS, flagTLSCert, flagTLSKey = true, cert, key
+	t.Cleanup(func() { flagCallbackTLS, flagTLSCert, flagTLSKey = false, "", "" })
+}
+
+func TestResolveCallbackTLS(t *testing.T) {
+	withCallbackTLS(t, "", "")
+
+	cfg, err := resolveCallback("8443", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedirectURI != "https://localhost:8443/callback" {
+		t.Errorf("Expected an https redirect URI, got %q", cfg.RedirectURI)
+	}
+	if cfg.TLS == nil || cfg.Fingerprint == "" {
+		t.Fatalf("Expected a generated certificate, got %+v", cfg)
+	}
+	leaf, err := x509.ParseCertificate(cfg.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("Expected the certificate to cover %s: %v", host, err)
+		}
+	}
+
+	if _, err := resolveCallback("8443", "", "http://localhost:8443/callback", false); err == nil {
+		t.Error("Expected an http redirect URI to be rejected with TLS")
+	}
+}
+
+func TestSelfSignedCertificateHosts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cert, err := selfSignedCertificate("callback.test", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("callback.test"); err != nil {
+		t.Errorf("Expected the certificate to cover the redirect host: %v", err)
+	}
+	if !leaf.NotAfter.Equal(now.Add(selfSignedLifetime)) {
+		t.Errorf("Unexpected expiry %v", leaf.NotAfter)
+	}
+}
+
+func TestCallbackTLSFromFiles(t *testing.T) {
+	cert, err := selfSignedCertificate("localhost", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, fingerprint, err := callbackTLSConfig(certFile, keyFile, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != "" {
+		t.Errorf("Expected no fingerprint for a given certificate, got %q", fingerprint)
+	}
+	if string(cfg.Certificates[0].Certificate[0]) != string(cert.Certificate[0]) {
+		t.Error("Expected the certificate from --tls-cert")
+	}
+
+	if _, _, err := callbackTLSConfig(certFile, "", "localhost"); err == nil {
+		t.Error("Expected --tls-cert without --tls-key to be rejected")
+	}
+	if _, _, err := callbackTLSConfig(filepath.Join(dir, "missing.pem"), keyFile, "localhost"); err == nil {
+		t.Error("Expected a missing certificate file to be rejected")
+	}
+}
+
+func TestCallbackServedOverTLS(t *testing.T) {
+	cfg, _, err := callbackTLSConfig("", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(tls.NewListener(listener, cfg))
+	defer server.Close()
+
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/callback")
+	if err != nil {
+		t.Fatalf("Expected the self-signed certificate to verify: %v", err)
+	}
+	resp.Body.Close()
+}
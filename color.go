@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ANSI colour codes used for levelled output
+const (
+	colorGreen     = "32"
+	colorYellow    = "33"
+	colorRed       = "31"
+	colorBoldRed   = "1;31"
+	colorResetCode = "\x1b[0m"
+)
+
+var flagNoColor bool
+
+// useColor reports whether ANSI colours should be written to f
+func useColor(f *os.File) bool {
+	if flagNoColor {
+		return false
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// colorize wraps text in the ANSI colour code when color is set
+func colorize(code, text string, color bool) string {
+	if !color || code == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + colorResetCode
+}
+
+func colorLevel(level expiryLevel, text string, color bool) string {
+	codes := map[expiryLevel]string{
+		expiryOK:       colorGreen,
+		expiryWarning:  colorYellow,
+		expiryCritical: colorRed,
+		expiryExpired:  colorBoldRed,
+	}
+	return colorize(codes[level], text, color)
+}
+
+// successf prints a success message to stderr, marked with a green tick,
+// unless --quiet is set
+func successf(format string, args ...interface{}) {
+	if !flagQuiet {
+		fmt.Fprintln(os.Stderr, colorize(colorGreen, "✓ "+fmt.Sprintf(format, args...), useColor(os.Stderr)))
+	}
+}
+
+// levelWriter colours log lines by their level: "Warning:" lines yellow and
+// "Error" lines red. The log package writes each entry in a single call.
+type levelWriter struct {
+	w     io.Writer
+	color func() bool
+}
+
+func (l levelWriter) Write(p []byte) (int, error) {
+	if !l.color() {
+		return l.w.Write(p)
+	}
+	var b bytes.Buffer
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line == "" {
+			continue
+		}
+		text := strings.TrimSuffix(line, "\n")
+		b.WriteString(colorize(logLineColor(text), text, true))
+		b.WriteString(line[len(text):])
+	}
+	if _, err := l.w.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logLineColor picks the colour for a log line from its message
+func logLineColor(line string) string {
+	line = logMessage(line)
+	switch {
+	case strings.HasPrefix(line, "Warning:"):
+		return colorYellow
+	case strings.HasPrefix(line, "Error"):
+		return colorRed
+	}
+	return ""
+}
+
+// logMessage is a log line without the date and time prefix
+func logMessage(line string) string {
+	if fields := strings.SplitN(line, " ", 3); len(fields) == 3 && strings.Count(fields[0], "/") == 2 && strings.Count(fields[1], ":") == 2 {
+		return fields[2]
+	}
+	return line
+}
+
+// newLogWriter returns the log output: scrubbed, coloured when stderr is a
+// terminal, and reporting "Error" lines to telemetry
+func newLogWriter() io.Writer {
+	return telemetryLogWriter{w: levelWriter{w: scrubWriter{w: os.Stderr}, color: func() bool { return useColor(os.Stderr) }}}
+}
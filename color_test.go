@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestLevelWriter(t *testing.T) {
+	var buf bytes.Buffer
+	color := true
+	logger := log.New(levelWriter{w: &buf, color: func() bool { return color }}, "", log.LstdFlags)
+
+	logger.Printf("Warning: could not open browser")
+	logger.Printf("Error: no such org")
+	logger.Printf("Server listening")
+	out := buf.String()
+	for _, want := range []string{
+		"\x1b[33m", "Warning: could not open browser\x1b[0m\n",
+		"\x1b[31m", "Error: no such org\x1b[0m\n",
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("output is missing %q:\n%q", want, out)
+		}
+	}
+	if bytes.Count(buf.Bytes(), []byte("\x1b[")) != 4 {
+		t.Errorf("plain lines should not be coloured:\n%q", out)
+	}
+
+	buf.Reset()
+	color = false
+	logger.Printf("Warning: plain")
+	if bytes.Contains(buf.Bytes(), []byte("\x1b[")) {
+		t.Errorf("coloured output without colour: %q", buf.String())
+	}
+}
+
+func TestLogLineColor(t *testing.T) {
+	for line, want := range map[string]string{
+		"2026/10/14 09:30:00 Warning: expiring soon": colorYellow,
+		"2026/10/14 09:30:00 Error reading config":   colorRed,
+		"Error: no prefix":                           colorRed,
+		"2026/10/14 09:30:00 Callback received":      "",
+		"Token refreshed; Warning: not a prefix":     "",
+	} {
+		if got := logLineColor(line); got != want {
+			t.Errorf("logLineColor(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestUseColorDisabled(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if useColor(f) {
+		t.Error("useColor is true for a file")
+	}
+
+	flagNoColor = true
+	t.Cleanup(func() { flagNoColor = false })
+	if useColor(os.Stderr) {
+		t.Error("useColor is true with --no-color")
+	}
+	if got := colorLevel(expiryWarning, "warning", useColor(os.Stderr)); got != "warning" {
+		t.Errorf("colorLevel = %q with --no-color", got)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	configFileName = "config.json"
+	// profileEnv selects a profile when --profile is not given
+	profileEnv = "SFDC_AUTH_PROFILE"
+)
+
+// defaultOrg is the default_org setting in effect for this run
+var defaultOrg string
+
+// Config holds persistent settings read from config.json in the config
+// directory. Command-line flags always take precedence over these values.
+type Config struct {
+	Store      string `json:"store,omitempty"`
+	SyncRemote string `json:"sync_remote,omitempty"`
+	// VaultPath is the default for --vault-path
+	VaultPath string `json:"vault_path,omitempty"`
+	// AzureVaultURL is the default for --azure-vault-url
+	AzureVaultURL string `json:"azure_vault_url,omitempty"`
+
+	// ClientID, Domain and Scopes are the defaults for the flags of the
+	// same name, on every command that has them
+	ClientID string   `json:"client_id,omitempty"`
+	Domain   string   `json:"domain,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// SuccessPage and SuccessRedirect are the defaults for --success-page
+	// and --success-redirect, for a branded page after every login
+	SuccessPage     string `json:"success_page,omitempty"`
+	SuccessRedirect string `json:"success_redirect,omitempty"`
+
+	// DefaultOrg is the alias used by commands on a stored org when --alias
+	// is not given, set with "org use"
+	DefaultOrg string `json:"default_org,omitempty"`
+
+	// Expiry settings, as Go durations such as "2h" or "15m"
+	SessionTimeout string `json:"session_timeout,omitempty"`
+	ExpiryWarning  string `json:"expiry_warning,omitempty"`
+	ExpiryCritical string `json:"expiry_critical,omitempty"`
+
+	// RevokeSuperseded turns off revoking refresh tokens replaced by rotation
+	// or a new login when set to false
+	RevokeSuperseded *bool `json:"revoke_superseded,omitempty"`
+
+	// MaintenanceWait is the default for --maintenance-wait, and CheckTrust
+	// looks orgs in maintenance up on Salesforce Trust
+	MaintenanceWait string `json:"maintenance_wait,omitempty"`
+	CheckTrust      *bool  `json:"check_trust,omitempty"`
+
+	// Webhooks are told about logins, refreshes and revocations
+	Webhooks []webhookConfig `json:"webhooks,omitempty"`
+
+	// AuditLog turns off the audit log when set to false
+	AuditLog *bool `json:"audit_log,omitempty"`
+
+	// Telemetry is set by "telemetry enable" and "telemetry disable"; it is
+	// only read from the top level, not from profiles
+	Telemetry *bool `json:"telemetry,omitempty"`
+
+	// Profiles are named sets of settings selected with --profile; anything
+	// a profile leaves out comes from the top level
+	Profiles map[string]*Config `json:"profiles,omitempty"`
+}
+
+// loadConfig reads the config file in dir, returning an empty config if the
+// file does not exist
+func loadConfig(dir string) (*Config, error) {
+	cfg := &Config{}
+
+	raw, err := os.ReadFile(filepath.Join(dir, configFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("error decoding config file: %v", err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes cfg to the config file in dir
+func saveConfig(dir string, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error creating config directory: %v", err)
+	}
+	return os.WriteFile(filepath.Join(dir, configFileName), append(data, '\n'), 0600)
+}
+
+// loadProfileConfig reads the config file in dir with the named profile, if
+// any, applied over the top-level settings
+func loadProfileConfig(dir, profile string) (*Config, error) {
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.withProfile(profile)
+}
+
+// withProfile returns the settings in effect for the named profile. Keep this
+// in step with the fields of Config.
+func (c *Config) withProfile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("profile %q not found in %s", name, configFileName)
+	}
+
+	merged := *c
+	merged.Profiles = nil
+	overlay := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	overlay(&merged.Store, p.Store)
+	overlay(&merged.SyncRemote, p.SyncRemote)
+	overlay(&merged.VaultPath, p.VaultPath)
+	overlay(&merged.AzureVaultURL, p.AzureVaultURL)
+	overlay(&merged.ClientID, p.ClientID)
+	overlay(&merged.Domain, p.Domain)
+	if len(p.Scopes) > 0 {
+		merged.Scopes = p.Scopes
+	}
+	overlay(&merged.SuccessPage, p.SuccessPage)
+	overlay(&merged.SuccessRedirect, p.SuccessRedirect)
+	overlay(&merged.DefaultOrg, p.DefaultOrg)
+	overlay(&merged.SessionTimeout, p.SessionTimeout)
+	overlay(&merged.ExpiryWarning, p.ExpiryWarning)
+	overlay(&merged.ExpiryCritical, p.ExpiryCritical)
+	if p.RevokeSuperseded != nil {
+		merged.RevokeSuperseded = p.RevokeSuperseded
+	}
+	overlay(&merged.MaintenanceWait, p.MaintenanceWait)
+	if p.CheckTrust != nil {
+		merged.CheckTrust = p.CheckTrust
+	}
+	if len(p.Webhooks) > 0 {
+		merged.Webhooks = p.Webhooks
+	}
+	if p.AuditLog != nil {
+		merged.AuditLog = p.AuditLog
+	}
+	return &merged, nil
+}
+
+// applyConfig fills in flags the user did not set explicitly from the config
+// file
+func applyConfig(cmd *cobra.Command, cfg *Config) {
+	if cfg.Store != "" && !cmd.Flags().Changed("store") {
+		flagStore = cfg.Store
+	}
+	if cfg.VaultPath != "" && !cmd.Flags().Changed("vault-path") {
+		flagVaultPath = cfg.VaultPath
+	}
+	if cfg.AzureVaultURL != "" && !cmd.Flags().Changed("azure-vault-url") {
+		flagAzureVaultURL = cfg.AzureVaultURL
+	}
+	// A flag given on the command line also overrides the config default of
+	// the flag it excludes
+	for _, d := range []struct{ flag, value, excludes string }{
+		{"client-id", cfg.ClientID, ""},
+		{"domain", cfg.Domain, ""},
+		{"scopes", strings.Join(cfg.Scopes, ","), ""},
+		{"success-page", cfg.SuccessPage, "success-redirect"},
+		{"success-redirect", cfg.SuccessRedirect, "success-page"},
+	} {
+		flag := cmd.Flags().Lookup(d.flag)
+		if d.value == "" || flag == nil || flag.Changed || (d.excludes != "" && cmd.Flags().Changed(d.excludes)) {
+			continue
+		}
+		if err := cmd.Flags().Set(d.flag, d.value); err != nil {
+			log.Printf("Warning: ignoring invalid %s %q in %s: %v", strings.ReplaceAll(d.flag, "-", "_"), d.value, configFileName, err)
+		}
+	}
+	defaultOrg = cfg.DefaultOrg
+	if cfg.RevokeSuperseded != nil {
+		revokeSupersededTokens = *cfg.RevokeSuperseded
+	}
+	if cfg.MaintenanceWait != "" && !cmd.Flags().Changed("maintenance-wait") {
+		if wait, err := time.ParseDuration(cfg.MaintenanceWait); err == nil {
+			flagMaintenanceWait = wait
+		} else {
+			log.Printf("Warning: ignoring invalid maintenance_wait %q in %s", cfg.MaintenanceWait, configFileName)
+		}
+	}
+	if cfg.CheckTrust != nil {
+		checkTrustStatus = *cfg.CheckTrust
+	}
+	webhooks = cfg.Webhooks
+	if err := checkWebhooks(webhooks); err != nil {
+		log.Printf("Warning: ignoring webhooks in %s: %v", configFileName, err)
+		webhooks = nil
+	}
+	sessionTimeout = defaultSessionTimeout
+	if cfg.SessionTimeout != "" {
+		if timeout, err := time.ParseDuration(cfg.SessionTimeout); err == nil && timeout > 0 {
+			sessionTimeout = timeout
+		} else {
+			log.Printf("Warning: ignoring invalid session_timeout %q in %s", cfg.SessionTimeout, configFileName)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLoadConfigMissing(t *testing.T) {
+	cfg, err := loadConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("Missing config should not be an error: %v", err)
+	}
+	if cfg.Store != "" {
+		t.Errorf("Expected empty store in default config, got %s", cfg.Store)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(dir); err == nil {
+		t.Error("Expected error for invalid config file")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	originalStore := flagStore
+	defer func() { flagStore = originalStore }()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(`{"store": "bolt"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&flagStore, "store", storeTypeFile, "")
+
+	applyConfig(cmd, cfg)
+	if flagStore != storeTypeBolt {
+		t.Errorf("Expected store from config %s, got %s", storeTypeBolt, flagStore)
+	}
+
+	// An explicit flag wins over the config file
+	if err := cmd.Flags().Set("store", storeTypeSQLite); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(cmd, cfg)
+	if flagStore != storeTypeSQLite {
+		t.Errorf("Expected explicit store flag %s to win, got %s", storeTypeSQLite, flagStore)
+	}
+}
+
+func TestApplyConfigRevokeSuperseded(t *testing.T) {
+	defer func() { revokeSupersededTokens = true }()
+
+	disabled := false
+	applyConfig(&cobra.Command{}, &Config{RevokeSuperseded: &disabled})
+	if revokeSupersededTokens {
+		t.Error("Expected revoking superseded tokens to be turned off")
+	}
+}
+
+func TestApplyConfigWebhooks(t *testing.T) {
+	defer func() { webhooks = nil }()
+
+	hooks := []webhookConfig{{URL: "https://audit.acme.com/hook", Events: []string{eventLogin}}}
+	applyConfig(&cobra.Command{}, &Config{Webhooks: hooks})
+	if len(webhooks) != 1 || webhooks[0].URL != hooks[0].URL {
+		t.Errorf("Expected the configured webhooks, got %+v", webhooks)
+	}
+
+	applyConfig(&cobra.Command{}, &Config{Webhooks: []webhookConfig{{URL: "ftp://audit.acme.com"}}})
+	if webhooks != nil {
+		t.Errorf("Expected invalid webhooks to be ignored, got %+v", webhooks)
+	}
+}
+
+func TestConfigWithProfile(t *testing.T) {
+	cfg := &Config{
+		Store:         storeTypeFile,
+		ExpiryWarning: "15m",
+		Profiles: map[string]*Config{
+			"staging": {Store: storeTypeSQLite},
+		},
+	}
+
+	same, err := cfg.withProfile("")
+	if err != nil || same != cfg {
+		t.Errorf("No profile should return the config as is")
+	}
+
+	staging, err := cfg.withProfile("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staging.Store != storeTypeSQLite {
+		t.Errorf("Expected the profile's store, got %q", staging.Store)
+	}
+	if staging.ExpiryWarning != "15m" {
+		t.Errorf("Expected top-level settings to carry over, got %q", staging.ExpiryWarning)
+	}
+	if cfg.Store != storeTypeFile {
+		t.Error("Applying a profile should not modify the config")
+	}
+
+	if _, err := cfg.withProfile("missing"); err == nil {
+		t.Error("Expected an unknown profile to be rejected")
+	}
+}
+
+func TestApplyConfigLoginDefaults(t *testing.T) {
+	cfg := &Config{
+		ClientID: "3MVG9-top",
+		Domain:   "acme.my.salesforce.com",
+		Profiles: map[string]*Config{
+			"staging": {ClientID: "3MVG9-staging", Scopes: []string{"api", "refresh_token"}},
+		},
+	}
+	staging, err := cfg.withProfile("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var clientID, domain string
+	var scopes []string
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&clientID, "client-id", "", "")
+	cmd.Flags().StringVar(&domain, "domain", defaultSalesforceDomain, "")
+	cmd.Flags().StringSliceVar(&scopes, "scopes", nil, "")
+
+	applyConfig(cmd, staging)
+	if clientID != "3MVG9-staging" {
+		t.Errorf("client-id = %q, want the profile's", clientID)
+	}
+	if domain != "acme.my.salesforce.com" {
+		t.Errorf("domain = %q, want the top-level one carried over", domain)
+	}
+	if strings.Join(scopes, " ") != "api refresh_token" {
+		t.Errorf("scopes = %v, want the profile's", scopes)
+	}
+
+	// An explicit flag wins, and commands without the flags are left alone
+	explicit := &cobra.Command{}
+	explicit.Flags().StringVar(&clientID, "client-id", "", "")
+	explicit.Flags().Set("client-id", "3MVG9-flag")
+	applyConfig(explicit, staging)
+	if clientID != "3MVG9-flag" {
+		t.Errorf("client-id = %q, want the explicit flag", clientID)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// debugBodyLimit caps how much of a request or error response body --debug
+// prints
+const debugBodyLimit = 4 << 10
+
+// --debug, the most detailed diagnostic level; it implies --verbose
+var flagDebug bool
+
+// debugf prints a diagnostic message to stderr when --debug is set. Like
+// verbosef it goes through the scrubber.
+func debugf(format string, args ...interface{}) {
+	if flagDebug {
+		fmt.Fprintf(scrubWriter{w: os.Stderr}, "debug: "+format+"\n", args...)
+	}
+}
+
+// debugTransport logs every HTTP request with --debug: method and URL, the
+// form fields sent, the response status and how long it took, and the body
+// of error responses, which is where Salesforce explains a misconfigured
+// Connected App. Credentials are masked by the scrubber.
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	debugf("%s %s", req.Method, req.URL)
+	if isFormRequest(req) {
+		// A RoundTripper must not modify the caller's request
+		req = req.Clone(req.Context())
+		if body := peekBody(&req.Body); body != "" {
+			debugf("  form: %s", body)
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		debugf("  failed after %s: %v", elapsed, err)
+		return nil, err
+	}
+	debugf("  %s in %s", resp.Status, elapsed)
+	if resp.StatusCode >= 400 {
+		if body := peekBody(&resp.Body); body != "" {
+			debugf("  body: %s", body)
+		}
+	}
+	return resp, nil
+}
+
+// setupDebugTransport wraps the default transport in a debugTransport with
+// --debug. It runs after setupProxy and setupHAR, so replayed exchanges are
+// logged too.
+func setupDebugTransport() {
+	if !flagDebug {
+		return
+	}
+	if _, ok := http.DefaultTransport.(*debugTransport); !ok {
+		http.DefaultTransport = &debugTransport{base: http.DefaultTransport}
+	}
+}
+
+func isFormRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
+
+// peekBody reads up to debugBodyLimit of a body and puts it back, so the
+// request can still be sent or the response read in full
+func peekBody(body *io.ReadCloser) string {
+	if *body == nil || *body == http.NoBody {
+		return ""
+	}
+	head, err := io.ReadAll(io.LimitReader(*body, debugBodyLimit))
+	*body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), *body), *body}
+	if err != nil {
+		return ""
+	}
+	text := string(head)
+	if len(head) == debugBodyLimit {
+		text += "..."
+	}
+	return text
+}
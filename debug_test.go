@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStderr returns what fn writes to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = original }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestDebugTransport(t *testing.T) {
+	defer func() { flagDebug = false }()
+	flagDebug = true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_secret") != "hunter2" {
+			t.Errorf("Expected the form to reach the server intact, got %v", r.Form)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"redirect_uri_mismatch","error_description":"redirect_uri must match configuration"}`))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &debugTransport{base: http.DefaultTransport}}
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {"aPrxSecretCode"}, "client_secret": {"hunter2"}}
+	var body []byte
+	out := captureStderr(t, func() {
+		resp, err := client.Post(server.URL+"/services/oauth2/token", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ = io.ReadAll(resp.Body)
+	})
+
+	for _, want := range []string{"debug: POST " + server.URL + "/services/oauth2/token", "grant_type=authorization_code", "400 Bad Request in ", "redirect_uri_mismatch"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the debug output:\n%s", want, out)
+		}
+	}
+	for _, secret := range []string{"hunter2", "aPrxSecretCode"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %q to be masked:\n%s", secret, out)
+		}
+	}
+	if !bytes.Contains(body, []byte("redirect_uri_mismatch")) {
+		t.Errorf("Expected the response body to be readable after logging, got %q", body)
+	}
+}
+
+func TestDebugImpliesVerbose(t *testing.T) {
+	defer func() { flagDebug, flagVerbose, flagQuiet = false, false, false }()
+
+	flagDebug = true
+	if err := checkOutputFlags(); err != nil || !flagVerbose {
+		t.Errorf("Expected --debug to turn on --verbose (%v)", err)
+	}
+	flagQuiet = true
+	if err := checkOutputFlags(); err == nil {
+		t.Error("Expected --quiet with --debug to be rejected")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	deviceGrant = "device"
+
+	// deviceSlowDown is added to the polling interval when Salesforce asks
+	// the client to slow down (RFC 8628 section 3.5)
+	deviceSlowDown = 5 * time.Second
+)
+
+var (
+	flagDeviceClientID string
+	flagDeviceDomain   string
+	flagDeviceTimeout  time.Duration
+
+	deviceSleep = time.Sleep
+)
+
+var deviceCmd = &cobra.Command{
+	Use:   "device",
+	Short: "Log in with the OAuth device flow, for machines without a browser",
+	Long: `Log in on a machine that has no browser and cannot receive a localhost
+callback, such as a remote server. The verification URL and a user code are
+printed, with the URL as a QR code to scan when stderr is a terminal; open
+the URL on any other device, enter the code and approve the app. Once
+approved, the tokens are printed and the org saved to the token store like a
+browser login.
+
+The Connected App must have "Enable for Device Flow" checked.`,
+	Args: cobra.NoArgs,
+	Run:  runDevice,
+}
+
+func init() {
+	deviceCmd.Flags().StringVarP(&flagDeviceClientID, "client-id", "c", "", "Salesforce Client ID (Consumer Key)")
+	deviceCmd.Flags().StringVarP(&flagDeviceDomain, "domain", "d", defaultSalesforceDomain, "Salesforce domain (e.g., company.my.salesforce.com)")
+	deviceCmd.Flags().StringSliceVar(&flagScopes, "scopes", nil, "OAuth scopes to request, repeated or comma-separated (default: api refresh_token)")
+	deviceCmd.Flags().StringVarP(&flagAlias, "alias", "a", "", "Alias to save the org under in the token store (defaults to the org ID)")
+	deviceCmd.Flags().DurationVar(&flagDeviceTimeout, "timeout", 10*time.Minute, "Give up if the code is not approved within this long")
+	deviceCmd.Flags().BoolVar(&flagNoQR, "no-qr", false, "Don't draw the verification URL as a QR code")
+	_ = deviceCmd.MarkFlagRequired("client-id")
+
+	rootCmd.AddCommand(deviceCmd)
+}
+
+// deviceAuthorization is the token endpoint's answer to a device code request
+type deviceAuthorization struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	Interval        int    `json:"interval"`
+}
+
+func runDevice(cmd *cobra.Command, args []string) {
+	clientID = flagDeviceClientID
+	tokenURL := getSalesforceTokenURL(flagDeviceDomain)
+
+	auth, err := requestDeviceCode(tokenURL, clientID)
+	if err != nil {
+		failLogin(err)
+	}
+	// Shown even with --quiet, which would otherwise leave nothing to act
+	// on, and on stderr so stdout stays the token output
+	fmt.Fprintf(os.Stderr, "To log in, open %s and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	if !flagNoQR && useColor(os.Stderr) {
+		fmt.Fprintln(os.Stderr, "\nOr scan this code with your phone:")
+		if err := writeQRCode(os.Stderr, auth.VerificationURI); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	tokenResponse, err := pollDeviceToken(tokenURL, clientID, auth, flagDeviceTimeout)
+	if err != nil {
+		failLogin(err)
+	}
+	completeLogin(flagDeviceDomain, tokenResponse, nil)
+}
+
+// requestDeviceCode starts the device flow, returning the code to poll with
+// and the code the user enters
+func requestDeviceCode(tokenURL, clientID string) (*deviceAuthorization, error) {
+	data := url.Values{}
+	data.Set("response_type", "device_code")
+	data.Set("client_id", clientID)
+	data.Set("scope", requestedScope("api refresh_token"))
+
+	verbosef("POST %s (response_type=device_code)", tokenURL)
+	resp, err := http.PostForm(tokenURL, data)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting device code: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readOAuthError(resp)
+	}
+
+	var auth deviceAuthorization
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return nil, fmt.Errorf("error decoding device code response: %v", err)
+	}
+	if auth.DeviceCode == "" || auth.UserCode == "" || auth.VerificationURI == "" {
+		return nil, fmt.Errorf("incomplete device code response")
+	}
+	return &auth, nil
+}
+
+// pollDeviceToken polls the token endpoint at the interval Salesforce asked
+// for until the user approves the request, denies it or timeout passes
+func pollDeviceToken(tokenURL, clientID string, auth *deviceAuthorization, timeout time.Duration) (*SalesforceOAuthResponse, error) {
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	data := url.Values{}
+	data.Set("grant_type", deviceGrant)
+	data.Set("client_id", clientID)
+	data.Set("code", auth.DeviceCode)
+
+	var waited time.Duration
+	for {
+		if waited+interval > timeout {
+			return nil, fmt.Errorf("the code was not approved within %s", timeout)
+		}
+		deviceSleep(interval)
+		waited += interval
+
+		resp, err := postTokenRequest(tokenURL, data, nil)
+		var oauthErr *oauthError
+		if err == nil || !errors.As(err, &oauthErr) {
+			return resp, err
+		}
+		switch oauthErr.Code {
+		case "authorization_pending":
+			verbosef("Waiting for the code to be approved")
+		case "slow_down":
+			interval += deviceSlowDown
+		default:
+			return nil, err
+		}
+	}
+}
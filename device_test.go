@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("response_type") == "device_code" {
+			w.Write([]byte(`{"device_code": "device-123", "user_code": "ABCD1234", "verification_uri": "https://login.salesforce.com/setup/connect", "interval": 5}`))
+			return
+		}
+		if r.FormValue("grant_type") != deviceGrant || r.FormValue("code") != "device-123" {
+			t.Errorf("Unexpected poll %v", r.Form)
+		}
+		polls++
+		switch polls {
+		case 1:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "authorization_pending", "error_description": "pending"}`))
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "slow_down", "error_description": "slow down"}`))
+		default:
+			w.Write([]byte(`{"access_token": "access", "refresh_token": "refresh", "instance_url": "https://na1.salesforce.com"}`))
+		}
+	}))
+	defer server.Close()
+
+	originalSleep := deviceSleep
+	defer func() { deviceSleep = originalSleep }()
+	var slept []time.Duration
+	deviceSleep = func(d time.Duration) { slept = append(slept, d) }
+
+	auth, err := requestDeviceCode(server.URL, "client")
+	if err != nil {
+		t.Fatalf("requestDeviceCode: %v", err)
+	}
+	if auth.UserCode != "ABCD1234" {
+		t.Errorf("Unexpected user code %q", auth.UserCode)
+	}
+	resp, err := pollDeviceToken(server.URL, "client", auth, time.Minute)
+	if err != nil {
+		t.Fatalf("pollDeviceToken: %v", err)
+	}
+	if resp.RefreshToken != "refresh" {
+		t.Errorf("Unexpected token response %+v", resp)
+	}
+	want := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second}
+	if len(slept) != len(want) || slept[0] != want[0] || slept[1] != want[1] || slept[2] != want[2] {
+		t.Errorf("Expected polling at %v, got %v", want, slept)
+	}
+}
+
+func TestDeviceFlowDeniedAndTimeout(t *testing.T) {
+	denied := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		if denied {
+			w.Write([]byte(`{"error": "access_denied", "error_description": "end-user denied authorization"}`))
+		} else {
+			w.Write([]byte(`{"error": "authorization_pending"}`))
+		}
+	}))
+	defer server.Close()
+
+	originalSleep := deviceSleep
+	defer func() { deviceSleep = originalSleep }()
+	deviceSleep = func(time.Duration) {}
+
+	auth := &deviceAuthorization{DeviceCode: "device-123", Interval: 5}
+	if _, err := pollDeviceToken(server.URL, "client", auth, time.Minute); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("Expected the denial to be reported, got %v", err)
+	}
+	denied = false
+	if _, err := pollDeviceToken(server.URL, "client", auth, time.Minute); err == nil || !strings.Contains(err.Error(), "not approved") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
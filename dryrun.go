@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// flagDryRun prints what a login would send instead of running it
+var flagDryRun bool
+
+// placeholders in the token request of a dry run
+const (
+	dryRunCodePlaceholder = "<authorization code>"
+	dryRunMasked          = "[REDACTED]"
+)
+
+// dryRunPlan is what a login would send, for debugging Connected App
+// settings without starting the callback server or calling Salesforce
+type dryRunPlan struct {
+	Grant            string         `json:"grant"`
+	ClientID         string         `json:"client_id"`
+	RedirectURI      string         `json:"redirect_uri"`
+	CallbackListen   string         `json:"callback_listen"`
+	Scopes           []string       `json:"scopes"`
+	PKCE             bool           `json:"pkce"`
+	AuthorizationURL string         `json:"authorization_url"`
+	TokenRequest     *dryRunRequest `json:"token_request,omitempty"`
+	Notes            []string       `json:"notes,omitempty"`
+}
+
+// dryRunRequest is a token request with its secrets masked
+type dryRunRequest struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+// newDryRunPlan works out the authorization URL and token request of a
+// login. It generates the state, nonce and PKCE verifier as a real login
+// would, but the verifier and client secret are masked.
+func newDryRunPlan(deps *oauthDeps, callback *callbackConfig, domain string, clientSecret *secret) (*dryRunPlan, error) {
+	if err := newAuthSession(); err != nil {
+		return nil, err
+	}
+	plan := &dryRunPlan{
+		Grant:            flagGrant,
+		ClientID:         clientID,
+		RedirectURI:      callback.RedirectURI,
+		CallbackListen:   callback.Listen,
+		Scopes:           strings.Fields(authorizeScope()),
+		PKCE:             codeVerifier != "",
+		AuthorizationURL: deps.AuthURL.AuthURL(domain, clientID, callback.RedirectURI, state),
+	}
+	plan.Notes = append(plan.Notes, fmt.Sprintf("The Connected App's Callback URL must be exactly %s.", callback.RedirectURI))
+	if flagGrant == grantImplicit {
+		plan.Notes = append(plan.Notes, "The user-agent flow returns the tokens in the redirect, so no token request is sent.")
+		return plan, nil
+	}
+
+	// The form is encoded as postTokenRequest would, with the values only
+	// known after the callback, or secret, appended as placeholders
+	data := url.Values{}
+	data.Set("grant_type", codeGrantType())
+	data.Set("client_id", clientID)
+	data.Set("redirect_uri", callback.RedirectURI)
+	body := data.Encode() + "&code=" + dryRunCodePlaceholder
+	if plan.PKCE {
+		body += "&code_verifier=" + dryRunMasked
+	}
+	if !clientSecret.Empty() {
+		body += "&client_secret=" + dryRunMasked
+	} else {
+		plan.Notes = append(plan.Notes, `No client secret is sent, so the Connected App must not have "Require Secret for Web Server Flow" checked.`)
+	}
+	if !plan.PKCE {
+		plan.Notes = append(plan.Notes, "PKCE is off (--pkce=false); the Connected App must not require it.")
+	}
+	plan.TokenRequest = &dryRunRequest{
+		Method:      "POST",
+		URL:         getSalesforceTokenURL(domain),
+		ContentType: "application/x-www-form-urlencoded",
+		Body:        body,
+	}
+	return plan, nil
+}
+
+// runDryRun prints the plan of a login and exits without starting it
+func runDryRun(callback *callbackConfig, domain string, clientSecret *secret) error {
+	if clientID == "" {
+		return fmt.Errorf("--dry-run needs a client ID (--client-id, SFDC_CLIENT_ID or \"client_id\" in %s)", configFileName)
+	}
+	plan, err := newDryRunPlan(authDeps, callback, domain, clientSecret)
+	if err != nil {
+		return err
+	}
+	if outputFormat(outputText) == outputJSON {
+		return writeJSON(plan)
+	}
+	writeDryRunPlan(os.Stdout, plan)
+	return nil
+}
+
+func writeDryRunPlan(out io.Writer, plan *dryRunPlan) {
+	pkce := "off"
+	if plan.PKCE {
+		pkce = "S256"
+	}
+	fmt.Fprintf(out, "Grant:            %s\n", plan.Grant)
+	fmt.Fprintf(out, "Client ID:        %s\n", plan.ClientID)
+	fmt.Fprintf(out, "Redirect URI:     %s\n", plan.RedirectURI)
+	fmt.Fprintf(out, "Callback server:  %s (not started)\n", plan.CallbackListen)
+	fmt.Fprintf(out, "Scopes:           %s\n", strings.Join(plan.Scopes, " "))
+	fmt.Fprintf(out, "PKCE:             %s\n", pkce)
+	fmt.Fprintf(out, "\nAuthorization URL:\n%s\n", plan.AuthorizationURL)
+	if req := plan.TokenRequest; req != nil {
+		fmt.Fprintf(out, "\nToken request:\n%s %s\nContent-Type: %s\n\n%s\n", req.Method, req.URL, req.ContentType, req.Body)
+	}
+	if len(plan.Notes) > 0 {
+		fmt.Fprintln(out, "\nNotes:")
+		for _, note := range plan.Notes {
+			fmt.Fprintf(out, "  - %s\n", note)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func withClientID(t *testing.T, id string) {
+	t.Helper()
+	original := clientID
+	clientID = id
+	t.Cleanup(func() { clientID = original })
+}
+
+func TestDryRunPlan(t *testing.T) {
+	withGrant(t, grantAuthorizationCode)
+	withClientID(t, "3MVG9client")
+	callback := &callbackConfig{Listen: ":8080", RedirectURI: "http://localhost:8080/callback", Path: "/callback"}
+
+	plan, err := newDryRunPlan(&oauthDeps{AuthURL: salesforceAuthURL{}}, callback, "acme.my.salesforce.com", newSecret([]byte("hunter2")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(plan.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if u.Host != "acme.my.salesforce.com" || query.Get("client_id") != "3MVG9client" || query.Get("redirect_uri") != callback.RedirectURI || query.Get("code_challenge") != codeChallenge(codeVerifier) {
+		t.Errorf("unexpected authorization URL %s", plan.AuthorizationURL)
+	}
+	if !plan.PKCE || strings.Join(plan.Scopes, " ") != query.Get("scope") {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	req := plan.TokenRequest
+	if req == nil || req.URL != "https://acme.my.salesforce.com/services/oauth2/token" {
+		t.Fatalf("unexpected token request %+v", req)
+	}
+	if strings.Contains(req.Body, "hunter2") || strings.Contains(req.Body, codeVerifier) {
+		t.Errorf("token request shows a secret: %s", req.Body)
+	}
+	for _, want := range []string{"grant_type=authorization_code", "code=" + dryRunCodePlaceholder, "code_verifier=" + dryRunMasked, "client_secret=" + dryRunMasked, "redirect_uri=" + url.QueryEscape(callback.RedirectURI)} {
+		if !strings.Contains(req.Body, want) {
+			t.Errorf("token request is missing %q: %s", want, req.Body)
+		}
+	}
+
+	var buf bytes.Buffer
+	writeDryRunPlan(&buf, plan)
+	for _, want := range []string{"Redirect URI:     http://localhost:8080/callback", "Authorization URL:\n" + plan.AuthorizationURL, "POST https://acme.my.salesforce.com/services/oauth2/token", "Callback URL must be exactly"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestDryRunPlanWithoutSecret(t *testing.T) {
+	withGrant(t, grantAuthorizationCode)
+	withClientID(t, "3MVG9client")
+	callback := &callbackConfig{Listen: ":8080", RedirectURI: "http://localhost:8080/callback"}
+
+	plan, err := newDryRunPlan(&oauthDeps{AuthURL: salesforceAuthURL{}}, callback, "login.salesforce.com", newSecret(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plan.TokenRequest.Body, "client_secret") {
+		t.Errorf("token request has a client secret: %s", plan.TokenRequest.Body)
+	}
+	if !strings.Contains(strings.Join(plan.Notes, "\n"), "Require Secret for Web Server Flow") {
+		t.Errorf("missing note about the secret: %v", plan.Notes)
+	}
+}
+
+func TestDryRunPlanImplicit(t *testing.T) {
+	withGrant(t, grantImplicit)
+	withClientID(t, "3MVG9client")
+	callback := &callbackConfig{Listen: ":8080", RedirectURI: "http://localhost:8080/callback"}
+
+	plan, err := newDryRunPlan(&oauthDeps{AuthURL: salesforceAuthURL{}}, callback, "login.salesforce.com", newSecret(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.TokenRequest != nil {
+		t.Errorf("implicit flow has a token request %+v", plan.TokenRequest)
+	}
+	if !strings.Contains(plan.AuthorizationURL, "response_type=token") {
+		t.Errorf("unexpected authorization URL %s", plan.AuthorizationURL)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// credentialEnv maps flags to the environment variables that supply them,
+// so CI systems can inject credentials without putting them on the command
+// line. An explicit flag wins over the environment.
+var credentialEnv = []struct {
+	flag string
+	env  string
+}{
+	{"client-id", "SFDC_CLIENT_ID"},
+	{"client-secret", "SFDC_CLIENT_SECRET"},
+	{"domain", "SFDC_DOMAIN"},
+	{"refresh-token", "SFDC_REFRESH_TOKEN"},
+}
+
+// applyCredentialEnv fills in the credential flags of cmd that were not
+// given from the environment. Empty variables are ignored.
+func applyCredentialEnv(cmd *cobra.Command) error {
+	for _, c := range credentialEnv {
+		flag := cmd.Flags().Lookup(c.flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		value := os.Getenv(c.env)
+		if value == "" {
+			continue
+		}
+		if err := cmd.Flags().Set(c.flag, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", c.env, err)
+		}
+		verbosef("Using --%s from %s", c.flag, c.env)
+	}
+	return nil
+}
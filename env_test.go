@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestApplyCredentialEnv(t *testing.T) {
+	var id, secret, domain string
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&id, "client-id", "", "")
+	cmd.Flags().StringVar(&secret, "client-secret", "", "")
+	cmd.Flags().StringVar(&domain, "domain", defaultSalesforceDomain, "")
+
+	t.Setenv("SFDC_CLIENT_ID", "3MVG9env")
+	t.Setenv("SFDC_CLIENT_SECRET", "")
+	t.Setenv("SFDC_DOMAIN", "acme.my.salesforce.com")
+	t.Setenv("SFDC_REFRESH_TOKEN", "5Aep861")
+	if err := cmd.Flags().Set("client-id", "3MVG9flag"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command has no --refresh-token, so SFDC_REFRESH_TOKEN is ignored
+	if err := applyCredentialEnv(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if id != "3MVG9flag" {
+		t.Errorf("Expected the explicit flag to win, got %q", id)
+	}
+	if domain != "acme.my.salesforce.com" {
+		t.Errorf("Expected the domain from the environment, got %q", domain)
+	}
+	if secret != "" || cmd.Flags().Changed("client-secret") {
+		t.Error("An empty variable should leave the flag alone")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// --environment presets and the login hosts they stand for
+const (
+	environmentProd    = "prod"
+	environmentSandbox = "sandbox"
+	environmentCustom  = "custom"
+
+	sandboxSalesforceDomain = "test.salesforce.com"
+)
+
+var environments = []string{environmentProd, environmentSandbox, environmentCustom}
+
+var (
+	// --sandbox, short for --environment sandbox
+	flagSandbox bool
+	// --environment, the kind of org to log in to
+	flagEnvironment string
+)
+
+// applyEnvironment sets the --domain of cmd from --sandbox or --environment.
+// It runs before the environment and config.json are applied, so a preset
+// given on the command line wins over SFDC_DOMAIN and "domain".
+func applyEnvironment(cmd *cobra.Command) error {
+	env, err := selectedEnvironment()
+	if err != nil || env == "" {
+		return err
+	}
+	domain := cmd.Flags().Lookup("domain")
+	if domain == nil {
+		return nil
+	}
+
+	var host string
+	switch env {
+	case environmentProd:
+		host = defaultSalesforceDomain
+	case environmentSandbox:
+		host = sandboxSalesforceDomain
+	case environmentCustom:
+		// The domain comes from --domain, SFDC_DOMAIN or config.json, and is
+		// checked once they have been applied
+		return nil
+	}
+	if domain.Changed {
+		return fmt.Errorf("--domain cannot be used with --environment %s (use --environment %s)", env, environmentCustom)
+	}
+	if err := cmd.Flags().Set("domain", host); err != nil {
+		return err
+	}
+	verbosef("Using --domain %s for the %s environment", host, env)
+	return nil
+}
+
+// checkEnvironmentDomain makes sure --environment custom ended up with a
+// domain of its own
+func checkEnvironmentDomain(cmd *cobra.Command) error {
+	env, err := selectedEnvironment()
+	if err != nil || env != environmentCustom {
+		return err
+	}
+	domain := cmd.Flags().Lookup("domain")
+	if domain != nil && !domain.Changed {
+		return fmt.Errorf("--environment %s needs --domain (or SFDC_DOMAIN, or \"domain\" in %s), e.g. acme.my.salesforce.com", environmentCustom, configFileName)
+	}
+	return nil
+}
+
+// selectedEnvironment is the preset picked with --environment or --sandbox,
+// or "" for none
+func selectedEnvironment() (string, error) {
+	env := flagEnvironment
+	if flagSandbox {
+		if env != "" && env != environmentSandbox {
+			return "", fmt.Errorf("--sandbox cannot be used with --environment %s", env)
+		}
+		env = environmentSandbox
+	}
+	if env != "" && !containsString(environments, env) {
+		return "", fmt.Errorf("unknown environment %q (use %s)", env, strings.Join(environments, ", "))
+	}
+	return env, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func withEnvironmentFlags(t *testing.T, sandbox bool, env string) {
+	t.Helper()
+	oldSandbox, oldEnv := flagSandbox, flagEnvironment
+	flagSandbox, flagEnvironment = sandbox, env
+	t.Cleanup(func() { flagSandbox, flagEnvironment = oldSandbox, oldEnv })
+}
+
+func newDomainCommand(domain *string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(domain, "domain", defaultSalesforceDomain, "")
+	return cmd
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	tests := []struct {
+		sandbox bool
+		env     string
+		want    string
+	}{
+		{false, "", defaultSalesforceDomain},
+		{true, "", sandboxSalesforceDomain},
+		{false, environmentSandbox, sandboxSalesforceDomain},
+		{true, environmentSandbox, sandboxSalesforceDomain},
+		{false, environmentProd, defaultSalesforceDomain},
+	}
+	for _, tt := range tests {
+		withEnvironmentFlags(t, tt.sandbox, tt.env)
+		var domain string
+		if err := applyEnvironment(newDomainCommand(&domain)); err != nil {
+			t.Errorf("applyEnvironment(sandbox=%v, %q) failed: %v", tt.sandbox, tt.env, err)
+			continue
+		}
+		if domain != tt.want {
+			t.Errorf("applyEnvironment(sandbox=%v, %q) domain = %q, want %q", tt.sandbox, tt.env, domain, tt.want)
+		}
+	}
+}
+
+func TestApplyEnvironmentBeatsConfig(t *testing.T) {
+	withEnvironmentFlags(t, true, "")
+	var domain string
+	cmd := newDomainCommand(&domain)
+	if err := applyEnvironment(cmd); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(cmd, &Config{Domain: "acme.my.salesforce.com"})
+	if domain != sandboxSalesforceDomain {
+		t.Errorf("domain = %q, want --sandbox to win over config.json", domain)
+	}
+}
+
+func TestApplyEnvironmentErrors(t *testing.T) {
+	var domain string
+
+	withEnvironmentFlags(t, true, environmentProd)
+	if err := applyEnvironment(newDomainCommand(&domain)); err == nil || !strings.Contains(err.Error(), "--sandbox cannot be used") {
+		t.Errorf("--sandbox --environment prod error = %v", err)
+	}
+
+	withEnvironmentFlags(t, false, "staging")
+	if err := applyEnvironment(newDomainCommand(&domain)); err == nil || !strings.Contains(err.Error(), "unknown environment") {
+		t.Errorf("unknown environment error = %v", err)
+	}
+
+	withEnvironmentFlags(t, true, "")
+	cmd := newDomainCommand(&domain)
+	cmd.Flags().Set("domain", "acme.my.salesforce.com")
+	if err := applyEnvironment(cmd); err == nil || !strings.Contains(err.Error(), "--domain cannot be used") {
+		t.Errorf("--sandbox --domain error = %v", err)
+	}
+}
+
+func TestCheckEnvironmentDomainCustom(t *testing.T) {
+	withEnvironmentFlags(t, false, environmentCustom)
+	var domain string
+
+	cmd := newDomainCommand(&domain)
+	if err := applyEnvironment(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEnvironmentDomain(cmd); err == nil || !strings.Contains(err.Error(), "needs --domain") {
+		t.Errorf("--environment custom without a domain error = %v", err)
+	}
+
+	cmd = newDomainCommand(&domain)
+	applyConfig(cmd, &Config{Domain: "acme.my.salesforce.com"})
+	if err := checkEnvironmentDomain(cmd); err != nil {
+		t.Errorf("--environment custom with a domain from config.json = %v", err)
+	}
+
+	// Commands without --domain have nothing to check
+	if err := checkEnvironmentDomain(&cobra.Command{}); err != nil {
+		t.Errorf("checkEnvironmentDomain without --domain = %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Salesforce does not say when an access token expires; it lasts as long as
+	// the org's session timeout, which defaults to two hours
+	defaultSessionTimeout = 2 * time.Hour
+	defaultExpiryWarning  = 15 * time.Minute
+	defaultExpiryCritical = 5 * time.Minute
+)
+
+// sessionTimeout is the session_timeout setting in effect for this run
+var sessionTimeout = defaultSessionTimeout
+
+// setExpiry fills in when the access token in r expires: expiresIn seconds
+// from now when Salesforce said, or else the session timeout after it was
+// issued. It is left out when neither is known.
+func (r *TokenResponse) setExpiry(issued time.Time, expiresIn int64, now time.Time) {
+	var expiresAt time.Time
+	switch {
+	case expiresIn > 0:
+		expiresAt = now.Add(time.Duration(expiresIn) * time.Second)
+	case !issued.IsZero():
+		expiresAt = issued.Add(sessionTimeout)
+	default:
+		return
+	}
+	expiresAt = expiresAt.UTC().Truncate(time.Second)
+	r.ExpiresAt = &expiresAt
+	r.ExpiresIn = max(int64(expiresAt.Sub(now)/time.Second), 0)
+}
+
+// expiryLevel classifies how close a token is to expiring
+type expiryLevel string
+
+const (
+	expiryOK       expiryLevel = "ok"
+	expiryWarning  expiryLevel = "warning"
+	expiryCritical expiryLevel = "critical"
+	expiryExpired  expiryLevel = "expired"
+)
+
+// expiryThresholds say how long tokens last and when to start warning
+type expiryThresholds struct {
+	Session  time.Duration
+	Warning  time.Duration
+	Critical time.Duration
+}
+
+// loadExpiryThresholds reads the thresholds from config, using the defaults
+// for anything not set
+func loadExpiryThresholds(cfg *Config) (*expiryThresholds, error) {
+	t := &expiryThresholds{Session: defaultSessionTimeout, Warning: defaultExpiryWarning, Critical: defaultExpiryCritical}
+	for _, setting := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"session_timeout", cfg.SessionTimeout, &t.Session},
+		{"expiry_warning", cfg.ExpiryWarning, &t.Warning},
+		{"expiry_critical", cfg.ExpiryCritical, &t.Critical},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(setting.value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s %q in config", setting.name, setting.value)
+		}
+		*setting.dest = d
+	}
+	return t, t.validate()
+}
+
+func (t *expiryThresholds) validate() error {
+	if t.Critical > t.Warning {
+		return fmt.Errorf("expiry critical threshold %s is longer than the warning threshold %s", t.Critical, t.Warning)
+	}
+	return nil
+}
+
+// expiresAt estimates when the org's access token stops working
+func (t *expiryThresholds) expiresAt(org *StoredOrg) time.Time {
+	issued := org.IssuedAt
+	if issued.IsZero() {
+		issued = org.UpdatedAt
+	}
+	return issued.Add(t.Session)
+}
+
+// level classifies the org's token at now
+func (t *expiryThresholds) level(org *StoredOrg, now time.Time) expiryLevel {
+	remaining := t.expiresAt(org).Sub(now)
+	switch {
+	case remaining <= 0:
+		return expiryExpired
+	case remaining <= t.Critical:
+		return expiryCritical
+	case remaining <= t.Warning:
+		return expiryWarning
+	}
+	return expiryOK
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadExpiryThresholds(t *testing.T) {
+	thresholds, err := loadExpiryThresholds(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thresholds.Session != defaultSessionTimeout || thresholds.Warning != defaultExpiryWarning || thresholds.Critical != defaultExpiryCritical {
+		t.Errorf("Unexpected defaults %+v", thresholds)
+	}
+
+	thresholds, err = loadExpiryThresholds(&Config{SessionTimeout: "8h", ExpiryWarning: "30m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thresholds.Session != 8*time.Hour || thresholds.Warning != 30*time.Minute {
+		t.Errorf("Config not applied: %+v", thresholds)
+	}
+
+	for _, cfg := range []*Config{{SessionTimeout: "two hours"}, {ExpiryWarning: "-5m"}, {ExpiryWarning: "1m", ExpiryCritical: "10m"}} {
+		if _, err := loadExpiryThresholds(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestExpiryLevel(t *testing.T) {
+	thresholds := &expiryThresholds{Session: 2 * time.Hour, Warning: 15 * time.Minute, Critical: 5 * time.Minute}
+	issued := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	org := &StoredOrg{IssuedAt: issued}
+
+	tests := []struct {
+		elapsed time.Duration
+		want    expiryLevel
+	}{
+		{time.Hour, expiryOK},
+		{110 * time.Minute, expiryWarning},
+		{116 * time.Minute, expiryCritical},
+		{2 * time.Hour, expiryExpired},
+	}
+	for _, tt := range tests {
+		if got := thresholds.level(org, issued.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("After %s: got %s, want %s", tt.elapsed, got, tt.want)
+		}
+	}
+
+	// Orgs saved without issued_at fall back to when they were saved
+	if got := thresholds.expiresAt(&StoredOrg{UpdatedAt: issued}); !got.Equal(issued.Add(2 * time.Hour)) {
+		t.Errorf("Unexpected fallback expiry %v", got)
+	}
+}
+
+func TestValidationPassed(t *testing.T) {
+	warning := []orgExpiry{{Level: expiryOK}, {Level: expiryWarning}}
+	expired := []orgExpiry{{Level: expiryExpired}}
+
+	if !validationPassed(warning, false) {
+		t.Error("Warnings should pass without --strict")
+	}
+	if validationPassed(warning, true) {
+		t.Error("Warnings should fail with --strict")
+	}
+	if validationPassed(expired, false) {
+		t.Error("Expired tokens should always fail")
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	results := []orgExpiry{
+		{Org: &StoredOrg{Alias: "prod", Username: "me@example.com", OrgName: "Acme", InstanceName: "NA42"}, ExpiresAt: now.Add(90 * time.Minute), Level: expiryOK},
+		{Org: &StoredOrg{Alias: "dev"}, ExpiresAt: now.Add(-10 * time.Minute), Level: expiryExpired},
+	}
+
+	var out bytes.Buffer
+	writeStatus(&out, results, now, false)
+	for _, want := range []string{"prod", "Acme", "NA42", "in 1h30m", "ok", "10m ago", "expired"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Status output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Error("Colour codes written with colour disabled")
+	}
+
+	out.Reset()
+	writeStatus(&out, results, now, true)
+	if !strings.Contains(out.String(), "\x1b[1;31mexpired\x1b[0m") {
+		t.Errorf("Expected expired state in red:\n%q", out.String())
+	}
+}
+
+func TestSetExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	old := sessionTimeout
+	sessionTimeout = time.Hour
+	t.Cleanup(func() { sessionTimeout = old })
+
+	for _, tt := range []struct {
+		name      string
+		issued    time.Time
+		expiresIn int64
+		wantAt    time.Time
+		wantIn    int64
+	}{
+		{"session timeout", now.Add(-15 * time.Minute), 0, now.Add(45 * time.Minute), 2700},
+		{"expires_in wins", now.Add(-15 * time.Minute), 7200, now.Add(2 * time.Hour), 7200},
+		{"expired", now.Add(-2 * time.Hour), 0, now.Add(-time.Hour), 0},
+	} {
+		var r TokenResponse
+		r.setExpiry(tt.issued, tt.expiresIn, now)
+		if r.ExpiresAt == nil || !r.ExpiresAt.Equal(tt.wantAt) || r.ExpiresIn != tt.wantIn {
+			t.Errorf("%s: expiry = %v, %d; want %v, %d", tt.name, r.ExpiresAt, r.ExpiresIn, tt.wantAt, tt.wantIn)
+		}
+	}
+
+	var r TokenResponse
+	r.setExpiry(time.Time{}, 0, now)
+	if r.ExpiresAt != nil || r.ExpiresIn != 0 {
+		t.Errorf("expiry set without issued_at or expires_in: %v, %d", r.ExpiresAt, r.ExpiresIn)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	flagFilter   string
+	outputFilter jsonFilter
+)
+
+// filterStep is one step of a --filter path: an object key, an array index,
+// or every element ("[]")
+type filterStep struct {
+	key     string
+	index   int
+	isIndex bool
+	iterate bool
+}
+
+// jsonFilter is a parsed --filter expression, a subset of jq paths:
+// ".", ".key", ".a.b", ".[0]", ".[-1]", ".[]", `.["odd key"]` and
+// combinations such as ".orgs[].alias"
+type jsonFilter []filterStep
+
+func parseFilter(expr string) (jsonFilter, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, ".") {
+		return nil, fmt.Errorf("invalid filter %q: must start with \".\"", expr)
+	}
+
+	filter := jsonFilter{}
+	for pos := 0; pos < len(expr); {
+		switch expr[pos] {
+		case '.':
+			pos++
+			start := pos
+			for pos < len(expr) && isFilterIdentChar(expr[pos]) {
+				pos++
+			}
+			if pos > start {
+				filter = append(filter, filterStep{key: expr[start:pos]})
+			} else if pos < len(expr) && expr[pos] != '[' {
+				return nil, fmt.Errorf("invalid filter %q: unexpected %q at %d", expr, expr[pos], pos)
+			}
+		case '[':
+			end := strings.IndexByte(expr[pos:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid filter %q: missing \"]\"", expr)
+			}
+			step, err := parseBracketStep(expr[pos+1 : pos+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter %q: %v", expr, err)
+			}
+			filter = append(filter, step)
+			pos += end + 1
+		default:
+			return nil, fmt.Errorf("invalid filter %q: unexpected %q at %d", expr, expr[pos], pos)
+		}
+	}
+	return filter, nil
+}
+
+func parseBracketStep(inner string) (filterStep, error) {
+	inner = strings.TrimSpace(inner)
+	if inner == "" {
+		return filterStep{iterate: true}, nil
+	}
+	if strings.HasPrefix(inner, `"`) {
+		key, err := strconv.Unquote(inner)
+		if err != nil {
+			return filterStep{}, fmt.Errorf("bad key %s", inner)
+		}
+		return filterStep{key: key}, nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return filterStep{}, fmt.Errorf("bad index %q", inner)
+	}
+	return filterStep{index: index, isIndex: true}, nil
+}
+
+func isFilterIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// apply evaluates the filter against a decoded JSON document. Like jq, a
+// missing key yields null, while indexing the wrong type is an error.
+func (f jsonFilter) apply(doc interface{}) ([]interface{}, error) {
+	values := []interface{}{doc}
+	for _, step := range f {
+		var next []interface{}
+		for _, v := range values {
+			out, err := step.apply(v)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func (s filterStep) apply(v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return []interface{}{nil}, nil
+	}
+	switch {
+	case s.iterate:
+		switch v := v.(type) {
+		case []interface{}:
+			return v, nil
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			out := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				out = append(out, v[key])
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("cannot iterate over %s", jsonTypeName(v))
+	case s.isIndex:
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %s with a number", jsonTypeName(v))
+		}
+		index := s.index
+		if index < 0 {
+			index += len(list)
+		}
+		if index < 0 || index >= len(list) {
+			return []interface{}{nil}, nil
+		}
+		return []interface{}{list[index]}, nil
+	default:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %s with %q", jsonTypeName(v), s.key)
+		}
+		return []interface{}{object[s.key]}, nil
+	}
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return "number"
+}
+
+// filterJSON applies outputFilter to encoded JSON. Strings are printed raw,
+// so a single token can be captured without quotes; everything else stays
+// JSON, one result per line.
+func filterJSON(data []byte, indent bool) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding output for --filter: %v", err)
+	}
+	results, err := outputFilter.apply(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error applying --filter: %v", err)
+	}
+
+	var out []byte
+	for _, result := range results {
+		if s, ok := result.(string); ok {
+			out = append(out, s...)
+		} else {
+			var encoded []byte
+			if indent {
+				encoded, err = json.MarshalIndent(result, "", "  ")
+			} else {
+				encoded, err = json.Marshal(result)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling JSON: %v", err)
+			}
+			out = append(out, encoded...)
+		}
+		out = append(out, '\n')
+	}
+	return out, nil
+}
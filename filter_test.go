@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFilterJSON(t *testing.T) {
+	defer func() { outputFilter = nil }()
+
+	doc := []byte(`{"access_token":"00D!abc","instance_url":"https://na1.salesforce.com","issued":1700000000,
+		"orgs":[{"alias":"prod","sandbox":false},{"alias":"uat","sandbox":true}],"odd key":{"x":1}}`)
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{".access_token", "00D!abc\n"},
+		{".issued", "1700000000\n"},
+		{".orgs[1].alias", "uat\n"},
+		{".orgs[-1].sandbox", "true\n"},
+		{".orgs[].alias", "prod\nuat\n"},
+		{".orgs.[0].alias", "prod\n"},
+		{`.["odd key"]`, "{\"x\":1}\n"},
+		{".missing", "null\n"},
+		{".orgs[5]", "null\n"},
+		{".orgs[0]", "{\"alias\":\"prod\",\"sandbox\":false}\n"},
+	}
+	for _, tt := range tests {
+		filter, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.filter, err)
+			continue
+		}
+		outputFilter = filter
+		got, err := filterJSON(doc, false)
+		if err != nil {
+			t.Errorf("%s: %v", tt.filter, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+
+	outputFilter, _ = parseFilter(".access_token.length")
+	if _, err := filterJSON(doc, false); err == nil {
+		t.Error("Expected indexing a string to fail")
+	}
+}
+
+func TestParseFilterRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "access_token", ".a b", ".[1", ".[x]", `.["unterminated]`, ".a|.b"} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestFilterImpliesJSON(t *testing.T) {
+	defer func() { flagFilter, flagOutput, outputFilter = "", "", nil }()
+
+	flagFilter = ".instance_url"
+	if err := checkOutputFlags(); err != nil {
+		t.Fatal(err)
+	}
+	if got := outputFormat(outputText); got != outputJSON {
+		t.Errorf("Expected --filter to select JSON output, got %q", got)
+	}
+
+	flagOutput = outputText
+	if err := checkOutputFlags(); err == nil {
+		t.Error("Expected --filter with --output text to be rejected")
+	}
+	flagOutput = outputSfdxURL
+	if err := checkOutputFlags(); err == nil {
+		t.Error("Expected --filter with --output sfdx-url to be rejected")
+	}
+	flagOutput = outputYAML
+	if err := checkOutputFlags(); err == nil {
+		t.Error("Expected --filter with --output yaml to be rejected")
+	}
+	flagOutput = outputJSONCompact
+	if err := checkOutputFlags(); err != nil {
+		t.Errorf("Expected --filter with --output json-compact to be accepted: %v", err)
+	}
+	flagOutput = ""
+
+	data, err := formatTokenResponse(&TokenResponse{AccessToken: "access", InstanceURL: "https://na1.salesforce.com"}, outputJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "https://na1.salesforce.com\n" {
+		t.Errorf("Unexpected filtered output %q", data)
+	}
+}
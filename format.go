@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts every variable name in --output env, so a saved file
+// feeds straight back into the SFDC_* credential variables
+const envPrefix = "SFDC_"
+
+// outputFormatter re-encodes a JSON document in another --output format
+type outputFormatter func(data []byte) ([]byte, error)
+
+// outputFormatters are the formats built from a result's JSON encoding, so
+// each one carries exactly the fields the JSON would
+var outputFormatters = map[string]outputFormatter{
+	outputYAML:        jsonToYAML,
+	outputEnv:         jsonToEnv,
+	outputTable:       jsonToTable,
+	outputShellFormat: jsonToShell,
+}
+
+// formatOutput renders v, newline-terminated, in a structured --output
+// format. Like marshalOutput, the result may hold tokens.
+func formatOutput(v interface{}, format string) ([]byte, error) {
+	formatter, ok := outputFormatters[format]
+	if !ok {
+		return marshalOutput(v, format != outputJSONCompact)
+	}
+	data, err := marshalOutput(v, false)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(data)
+	return formatter(data)
+}
+
+// parseJSONNode reads a JSON document as YAML, which keeps object keys in
+// their JSON order
+func parseJSONNode(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding JSON output: %v", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, fmt.Errorf("error decoding JSON output: not a single document")
+	}
+	return doc.Content[0], nil
+}
+
+func jsonToYAML(data []byte) ([]byte, error) {
+	node, err := parseJSONNode(data)
+	if err != nil {
+		return nil, err
+	}
+	clearStyle(node)
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// clearStyle drops the flow and quoting styles JSON parses with, so the
+// encoder picks plain block YAML
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
+// outputField is one leaf of a result, named by its path of JSON keys
+type outputField struct {
+	path  []string
+	value string
+}
+
+// flattenNode lists the scalar leaves of node in document order. Array
+// elements are named by their index; null leaves are empty.
+func flattenNode(node *yaml.Node, path []string, fields []outputField) []outputField {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fields = flattenNode(node.Content[i+1], append(path[:len(path):len(path)], node.Content[i].Value), fields)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			fields = flattenNode(child, append(path[:len(path):len(path)], strconv.Itoa(i)), fields)
+		}
+	case yaml.ScalarNode:
+		value := node.Value
+		if node.Tag == "!!null" {
+			value = ""
+		}
+		if len(path) == 0 {
+			path = []string{"value"}
+		}
+		fields = append(fields, outputField{path: path, value: value})
+	}
+	return fields
+}
+
+func flattenJSON(data []byte) ([]outputField, error) {
+	node, err := parseJSONNode(data)
+	if err != nil {
+		return nil, err
+	}
+	return flattenNode(node, nil, nil), nil
+}
+
+// jsonToEnv prints KEY=value lines in the dotenv style read by docker
+// --env-file and most .env loaders. Values that need it are double-quoted.
+func jsonToEnv(data []byte) ([]byte, error) {
+	fields, err := flattenJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, f := range fields {
+		out = fmt.Appendf(out, "%s=%s\n", envName(envPrefix, f.path), envValue(f.value))
+	}
+	return out, nil
+}
+
+// envName turns a key path into a variable name: access_token becomes
+// SFDC_ACCESS_TOKEN
+func envName(prefix string, path []string) string {
+	name := strings.ToUpper(strings.Join(path, "_"))
+	return prefix + strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func envValue(value string) string {
+	if strings.IndexFunc(value, needsEnvQuote) < 0 {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+func needsEnvQuote(r rune) bool {
+	return r <= ' ' || r > '~' || strings.ContainsRune(`"'\$#=`+"`", r)
+}
+
+// jsonToTable prints a FIELD/VALUE table for reading at a terminal
+func jsonToTable(data []byte) ([]byte, error) {
+	fields, err := flattenJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tVALUE")
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s\t%s\n", strings.Join(f.path, "."), orDash(f.value))
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
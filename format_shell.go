@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// shellPrefix starts the variables set by --output shell, the names the
+	// sf CLI and most Salesforce tooling read
+	shellPrefix = "SF_"
+
+	shellBash       = "bash"
+	shellZsh        = "zsh"
+	shellFish       = "fish"
+	shellPowerShell = "powershell"
+)
+
+// --shell, the dialect of --output shell
+var flagShell string
+
+// checkShellFlag rejects an unknown --shell
+func checkShellFlag() error {
+	switch flagShell {
+	case "", shellBash, shellZsh, shellFish, shellPowerShell:
+		return nil
+	}
+	return fmt.Errorf("unknown shell %q (use %s, %s, %s or %s)", flagShell, shellBash, shellZsh, shellFish, shellPowerShell)
+}
+
+// outputShell is the dialect to print in: --shell, or the login shell from
+// $SHELL. Windows without $SHELL (not Git Bash or WSL) means PowerShell.
+func outputShell() string {
+	if flagShell != "" {
+		return flagShell
+	}
+	if name := filepath.Base(os.Getenv("SHELL")); name == shellFish || name == shellZsh {
+		return name
+	}
+	if runtime.GOOS == "windows" && os.Getenv("SHELL") == "" {
+		return shellPowerShell
+	}
+	return shellBash
+}
+
+// jsonToShell prints one statement per field that sets it as an exported
+// variable, for eval "$(sfdc-auth -q -o shell)"
+func jsonToShell(data []byte) ([]byte, error) {
+	fields, err := flattenJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	shell := outputShell()
+	var out []byte
+	for _, f := range fields {
+		out = append(out, shellExport(shell, envName(shellPrefix, f.path), f.value)...)
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+// shellExport sets name to value in shell. Values are always single-quoted,
+// so nothing in a token is expanded.
+func shellExport(shell, name, value string) string {
+	switch shell {
+	case shellFish:
+		// Inside fish single quotes only \ and ' are special
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+		return "set -gx " + name + " '" + quoted + "';"
+	case shellPowerShell:
+		return "$env:" + name + " = '" + strings.ReplaceAll(value, "'", "''") + "'"
+	default:
+		return "export " + name + "='" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+}
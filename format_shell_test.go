@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellExport(t *testing.T) {
+	value := `it's $HOME \n`
+	tests := []struct {
+		shell, want string
+	}{
+		{shellBash, `export SF_X='it'\''s $HOME \n'`},
+		{shellZsh, `export SF_X='it'\''s $HOME \n'`},
+		{shellFish, `set -gx SF_X 'it\'s $HOME \\n';`},
+		{shellPowerShell, `$env:SF_X = 'it''s $HOME \n'`},
+	}
+	for _, tt := range tests {
+		if got := shellExport(tt.shell, "SF_X", value); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.shell, tt.want, got)
+		}
+	}
+}
+
+func TestFormatOutputShell(t *testing.T) {
+	defer func() { flagShell = "" }()
+	flagShell = shellBash
+
+	data, err := formatTokenResponse(&TokenResponse{AccessToken: "00D!AQ", RefreshToken: "5Aep", InstanceURL: "https://na1.salesforce.com"}, outputShellFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "export SF_ACCESS_TOKEN='00D!AQ'\n" +
+		"export SF_REFRESH_TOKEN='5Aep'\n" +
+		"export SF_INSTANCE_URL='https://na1.salesforce.com'\n"
+	if string(data) != want {
+		t.Errorf("Expected %q, got %q", want, data)
+	}
+}
+
+// TestShellExportEval checks that bash reads the exported value back
+// unchanged, if bash is installed
+func TestShellExportEval(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	value := `a'b"c $(echo no) \ !`
+	out, err := exec.Command(bash, "-c", shellExport(shellBash, "SF_X", value)+`; printf %s "$SF_X"`).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != value {
+		t.Errorf("Expected %q back, got %q", value, out)
+	}
+}
+
+func TestOutputShell(t *testing.T) {
+	defer func() { flagShell = "" }()
+
+	t.Setenv("SHELL", "/usr/bin/fish")
+	if got := outputShell(); got != shellFish {
+		t.Errorf("Expected fish from $SHELL, got %q", got)
+	}
+	flagShell = shellPowerShell
+	if got := outputShell(); got != shellPowerShell {
+		t.Errorf("Expected --shell to win, got %q", got)
+	}
+
+	flagShell = "tcsh"
+	if err := checkShellFlag(); err == nil {
+		t.Error("Expected an unknown shell to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var formatTestResult = &TokenResponse{
+	AccessToken:  "00D000000000001!AQ",
+	RefreshToken: "5Aep861",
+	InstanceURL:  "https://na1.salesforce.com",
+	Scope:        "api refresh_token",
+}
+
+func TestFormatOutputJSONCompact(t *testing.T) {
+	data, err := formatTokenResponse(formatTestResult, outputJSONCompact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"access_token":"00D000000000001!AQ","refresh_token":"5Aep861","instance_url":"https://na1.salesforce.com","scope":"api refresh_token"}` + "\n"
+	if string(data) != want {
+		t.Errorf("Unexpected compact JSON %q", data)
+	}
+}
+
+func TestFormatOutputYAML(t *testing.T) {
+	data, err := formatOutput(map[string]interface{}{"flag": "true", "count": 2, "none": nil}, outputYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "count: 2\nflag: \"true\"\nnone: null\n"
+	if string(data) != want {
+		t.Errorf("Expected %q, got %q", want, data)
+	}
+
+	data, err = formatTokenResponse(formatTestResult, outputYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded TokenResponse
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "access_token: ") || decoded.Scope != formatTestResult.Scope {
+		t.Errorf("Expected the fields in JSON order, got %q", data)
+	}
+}
+
+func TestFormatOutputEnv(t *testing.T) {
+	data, err := formatTokenResponse(formatTestResult, outputEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SFDC_ACCESS_TOKEN=00D000000000001!AQ\n" +
+		"SFDC_REFRESH_TOKEN=5Aep861\n" +
+		"SFDC_INSTANCE_URL=https://na1.salesforce.com\n" +
+		"SFDC_SCOPE=\"api refresh_token\"\n"
+	if string(data) != want {
+		t.Errorf("Expected %q, got %q", want, data)
+	}
+
+	data, err = formatOutput(map[string]interface{}{"session": map[string]string{"cookie-sid": "a$b"}}, outputEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "SFDC_SESSION_COOKIE_SID=\"a$b\"\n" {
+		t.Errorf("Expected nested keys joined and the value quoted, got %q", data)
+	}
+}
+
+func TestFormatOutputTable(t *testing.T) {
+	data, err := formatTokenResponse(&TokenResponse{AccessToken: "access", InstanceURL: "https://na1.salesforce.com"}, outputTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "FIELD          VALUE\n" +
+		"access_token   access\n" +
+		"refresh_token  -\n" +
+		"instance_url   https://na1.salesforce.com\n"
+	if string(data) != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, data)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateManPages(t *testing.T) {
+	dir := t.TempDir()
+	if err := generateManPages(rootCmd, dir); err != nil {
+		t.Fatalf("generateManPages failed: %v", err)
+	}
+
+	for _, name := range []string{"sfdc-auth.1", "sfdc-auth-serve.1", "sfdc-auth-sync-push.1"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be generated: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), `.TH "SFDC-AUTH" "1"`) {
+			t.Errorf("%s has an unexpected header", name)
+		}
+	}
+}
+
+func TestGenerateDocs(t *testing.T) {
+	for format, name := range map[string]string{docsFormatMarkdown: "sfdc-auth_serve.md", docsFormatReST: "sfdc-auth_serve.rst"} {
+		dir := t.TempDir()
+		if err := generateDocs(rootCmd, format, dir); err != nil {
+			t.Fatalf("generateDocs(%s) failed: %v", format, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be generated: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), "--listen") {
+			t.Errorf("%s does not document the --listen flag", name)
+		}
+	}
+
+	if err := generateDocs(rootCmd, "html", t.TempDir()); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
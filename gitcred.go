@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var flagGitCredentialAlias string
+
+var gitCredentialCmd = &cobra.Command{
+	Use:   "git-credential <get|store|erase>",
+	Short: "Act as a git credential helper that answers with an org's access token",
+	Long: `Implement git's credential helper protocol, so git can authenticate to
+repositories behind gateways that accept Salesforce access tokens. git runs
+the helper itself; configure it for the gateway's host, for example:
+
+  git config --global credential.https://git.example.com.helper \
+    "!sfdc-auth git-credential --alias prod"
+
+"get" answers with the org's username and access token, refreshing and saving
+the token first if it has expired or is about to (see "expiry_critical" in
+config.json). "erase", which git sends when the gateway rejects the token,
+refreshes it so the next attempt gets a new one. "store" does nothing, since
+the token store already keeps the token.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"get", "store", "erase"},
+	Run:       runGitCredential,
+}
+
+func init() {
+	gitCredentialCmd.Flags().StringVarP(&flagGitCredentialAlias, "alias", "a", "", "Alias of the stored org (default: the default org)")
+
+	rootCmd.AddCommand(gitCredentialCmd)
+}
+
+func runGitCredential(cmd *cobra.Command, args []string) {
+	// git ignores actions it does not know a helper for, and so must we
+	action := args[0]
+	if action != "get" && action != "erase" {
+		io.Copy(io.Discard, os.Stdin)
+		return
+	}
+
+	alias := flagGitCredentialAlias
+	if alias == "" {
+		alias = defaultOrg
+	}
+	if alias == "" {
+		log.Fatalf("Error: no org given (use --alias, or set a default with \"org use\")")
+	}
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadProfileConfig(dir, flagProfile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	expiry, err := loadExpiryThresholds(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	vendor := &tokenVendor{store: store, refresh: refreshAccessToken, expiry: expiry, now: authDeps.Clock.Now}
+	if err := gitCredential(vendor, alias, action, os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// gitCredential answers one credential helper request read from in
+func gitCredential(v *tokenVendor, alias, action string, in io.Reader, out io.Writer) error {
+	request, err := readGitCredentialRequest(in)
+	if err != nil {
+		return fmt.Errorf("error reading credential request: %v", err)
+	}
+
+	switch action {
+	case "get":
+		org, err := v.validToken(alias)
+		if errors.Is(err, errOrgNotFound) {
+			return fmt.Errorf("org %q not found in the token store", alias)
+		}
+		if err != nil {
+			return err
+		}
+		return writeGitCredential(out, org, v.expiry)
+	case "erase":
+		// Only a rejected token that is still the stored one needs replacing;
+		// anything else was rejected for reasons a refresh will not fix
+		org, err := v.get(alias)
+		if err != nil || request["password"] != org.AccessToken || org.RefreshToken == "" {
+			return nil
+		}
+		verbosef("git rejected the access token for %q, refreshing", alias)
+		if _, err := v.refreshToken(alias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readGitCredentialRequest reads the key=value lines git sends, up to a
+// blank line or the end of input
+func readGitCredentialRequest(in io.Reader) (map[string]string, error) {
+	request := map[string]string{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		request[key] = value
+	}
+	return request, scanner.Err()
+}
+
+// writeGitCredential answers a get with the org's username and access token,
+// and when the token is expected to expire so git does not reuse a cached
+// copy past it
+func writeGitCredential(out io.Writer, org *StoredOrg, expiry *expiryThresholds) error {
+	if strings.ContainsAny(org.AccessToken, "\n\x00") || strings.ContainsAny(org.Username, "\n\x00") {
+		return fmt.Errorf("stored credentials for %q cannot be passed to git", org.Alias)
+	}
+	var b strings.Builder
+	if org.Username != "" {
+		fmt.Fprintf(&b, "username=%s\n", org.Username)
+	}
+	fmt.Fprintf(&b, "password=%s\n", org.AccessToken)
+	if expiry != nil {
+		fmt.Fprintf(&b, "password_expiry_utc=%d\n", expiry.expiresAt(org).Unix())
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadGitCredentialRequest(t *testing.T) {
+	in := strings.NewReader("protocol=https\nhost=git.example.com\npassword=a=b\n\nignored=1\n")
+	request, err := readGitCredentialRequest(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request["host"] != "git.example.com" || request["password"] != "a=b" {
+		t.Errorf("request = %v", request)
+	}
+	if _, ok := request["ignored"]; ok {
+		t.Error("read past the blank line")
+	}
+
+	if _, err := readGitCredentialRequest(strings.NewReader("no-equals\n")); err == nil {
+		t.Error("readGitCredentialRequest accepted a line without =")
+	}
+}
+
+func TestGitCredentialGet(t *testing.T) {
+	withQuiet(t)
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	v := newTestVendor(t)
+	v.expiry = &expiryThresholds{Session: 2 * time.Hour, Warning: 15 * time.Minute, Critical: 5 * time.Minute}
+	v.now = func() time.Time { return now }
+	if err := v.store.Put(&StoredOrg{Alias: "prod", Username: "me@example.com", AccessToken: "fresh_access", RefreshToken: "prod_refresh", IssuedAt: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := gitCredential(v, "prod", "get", strings.NewReader("protocol=https\nhost=git.example.com\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("username=me@example.com\npassword=fresh_access\npassword_expiry_utc=%d\n", now.Add(time.Hour).Unix())
+	if out.String() != want {
+		t.Errorf("get wrote %q, want %q", out.String(), want)
+	}
+
+	// An expired token is refreshed before it is handed out
+	if err := v.store.Put(&StoredOrg{Alias: "prod", AccessToken: "stale_access", RefreshToken: "prod_refresh", IssuedAt: now.Add(-3 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := gitCredential(v, "prod", "get", strings.NewReader(""), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "password=refreshed_prod\n") {
+		t.Errorf("get wrote %q, want the refreshed token", out.String())
+	}
+
+	if err := gitCredential(v, "missing", "get", strings.NewReader(""), &out); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("get for a missing org error = %v", err)
+	}
+}
+
+func TestGitCredentialErase(t *testing.T) {
+	withQuiet(t)
+	v := newTestVendor(t)
+	if err := v.store.Put(&StoredOrg{Alias: "prod", AccessToken: "rejected_access", RefreshToken: "prod_refresh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A password that is not the stored token leaves the org alone
+	if err := gitCredential(v, "prod", "erase", strings.NewReader("password=other\n"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if org, _ := v.store.Get("prod"); org.AccessToken != "rejected_access" {
+		t.Errorf("AccessToken = %q after erasing another password", org.AccessToken)
+	}
+
+	if err := gitCredential(v, "prod", "erase", strings.NewReader("password=rejected_access\n"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if org, _ := v.store.Get("prod"); org.AccessToken != "refreshed_prod" {
+		t.Errorf("AccessToken = %q after erase, want refreshed_prod", org.AccessToken)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// --github-actions, hand tokens to later steps of a GitHub Actions job
+// instead of printing them
+var flagGitHubActions bool
+
+// githubPublicFields are the token output fields that are not secret, so
+// they are left unmasked in the job log. Everything else is masked.
+var githubPublicFields = []string{
+	"instance_url",
+	"scope",
+	"expires_at",
+	"expires_in",
+	"sidCookieName",
+	"lightning_domain",
+	"visualforce_domain",
+	"content_domain",
+	"id_token_claims",
+}
+
+// checkGitHubActionsFlags rejects --github-actions combinations whose token
+// output it cannot pass on
+func checkGitHubActionsFlags() error {
+	if !flagGitHubActions {
+		return nil
+	}
+	if flagOut != "" {
+		return fmt.Errorf("--github-actions cannot be used with --out")
+	}
+	switch flagOutput {
+	case "", outputJSON, outputJSONCompact, outputSfdxURL:
+		return nil
+	}
+	return fmt.Errorf("--github-actions cannot be used with --output %s", flagOutput)
+}
+
+// writeGitHubActions masks every secret in a command's token output, then
+// appends each field to $GITHUB_OUTPUT as a step output and to $GITHUB_ENV
+// as an SFDC_* variable. Nothing secret is printed.
+func writeGitHubActions(stdout io.Writer, output []byte) error {
+	outputFile, envFile := os.Getenv("GITHUB_OUTPUT"), os.Getenv("GITHUB_ENV")
+	if outputFile == "" || envFile == "" {
+		return fmt.Errorf("--github-actions needs GITHUB_OUTPUT and GITHUB_ENV, which are only set inside a GitHub Actions job")
+	}
+	fields, err := githubActionsFields(output)
+	if err != nil {
+		return err
+	}
+
+	// Masks are registered before the values reach any file, so a later
+	// step that echoes them shows *** instead
+	for _, f := range fields {
+		if f.value != "" && !isGitHubPublicField(f.path) {
+			for _, line := range strings.Split(f.value, "\n") {
+				if line != "" {
+					fmt.Fprintf(stdout, "::add-mask::%s\n", escapeGitHubCommand(line))
+				}
+			}
+		}
+	}
+
+	var outputs, env []byte
+	defer func() {
+		wipeBytes(outputs)
+		wipeBytes(env)
+	}()
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		name := envName("", f.path)
+		if outputs, err = appendGitHubFileCommand(outputs, strings.ToLower(name), f.value); err != nil {
+			return err
+		}
+		if env, err = appendGitHubFileCommand(env, envPrefix+name, f.value); err != nil {
+			return err
+		}
+		names = append(names, strings.ToLower(name))
+	}
+	if err := appendFile(outputFile, outputs); err != nil {
+		return err
+	}
+	if err := appendFile(envFile, env); err != nil {
+		return err
+	}
+	infof("Set step outputs %s, and the matching %s* environment variables", strings.Join(names, ", "), envPrefix)
+	return nil
+}
+
+// githubActionsFields lists the fields of JSON token output, or treats an
+// SFDX auth URL as the single field sfdx_auth_url. A lone value picked out
+// with --filter is named "value", as in --output env.
+func githubActionsFields(output []byte) ([]outputField, error) {
+	trimmed := bytes.TrimSpace(output)
+	if bytes.HasPrefix(trimmed, []byte("force://")) {
+		return []outputField{{path: []string{"sfdx_auth_url"}, value: string(trimmed)}}, nil
+	}
+	return flattenJSON(trimmed)
+}
+
+func isGitHubPublicField(path []string) bool {
+	return containsString(githubPublicFields, path[0])
+}
+
+// appendGitHubFileCommand adds name=value in the heredoc form GitHub reads
+// from $GITHUB_OUTPUT and $GITHUB_ENV, with a random delimiter so a value
+// cannot end it early and set other variables
+func appendGitHubFileCommand(out []byte, name, value string) ([]byte, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("error generating delimiter: %v", err)
+	}
+	delimiter := "ghadelimiter_" + hex.EncodeToString(raw)
+	if strings.Contains(value, delimiter) {
+		return nil, fmt.Errorf("value of %s contains its delimiter", name)
+	}
+	return fmt.Appendf(out, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter), nil
+}
+
+// escapeGitHubCommand escapes a workflow command's data the way the
+// Actions toolkit does
+func escapeGitHubCommand(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %v", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// withGitHubActions points GITHUB_OUTPUT and GITHUB_ENV at temporary files
+// and returns their paths
+func withGitHubActions(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	outputFile, envFile := filepath.Join(dir, "output"), filepath.Join(dir, "env")
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+	t.Setenv("GITHUB_ENV", envFile)
+	return outputFile, envFile
+}
+
+// readGitHubFileCommands parses name<<delimiter heredocs back into values
+func readGitHubFileCommands(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	re := regexp.MustCompile(`(?s)([^\n<]+)<<(ghadelimiter_[0-9a-f]+)\n(.*?)\n(ghadelimiter_[0-9a-f]+)\n`)
+	for _, m := range re.FindAllStringSubmatch(string(data), -1) {
+		if m[2] != m[4] {
+			t.Fatalf("mismatched delimiters in %q", m[0])
+		}
+		values[m[1]] = m[3]
+	}
+	return values
+}
+
+func TestWriteGitHubActions(t *testing.T) {
+	withQuiet(t)
+	outputFile, envFile := withGitHubActions(t)
+
+	var stdout bytes.Buffer
+	output := []byte(`{"access_token":"00D!secret","refresh_token":"5Aep861","instance_url":"https://na1.salesforce.com"}` + "\n")
+	if err := writeGitHubActions(&stdout, output); err != nil {
+		t.Fatal(err)
+	}
+
+	masks := stdout.String()
+	for _, secret := range []string{"00D!secret", "5Aep861"} {
+		if !strings.Contains(masks, "::add-mask::"+secret+"\n") {
+			t.Errorf("stdout %q does not mask %q", masks, secret)
+		}
+	}
+	if strings.Contains(masks, "na1.salesforce.com") {
+		t.Errorf("stdout %q masks the instance URL", masks)
+	}
+
+	outputs := readGitHubFileCommands(t, outputFile)
+	if outputs["access_token"] != "00D!secret" || outputs["instance_url"] != "https://na1.salesforce.com" {
+		t.Errorf("GITHUB_OUTPUT = %v", outputs)
+	}
+	env := readGitHubFileCommands(t, envFile)
+	if env["SFDC_ACCESS_TOKEN"] != "00D!secret" || env["SFDC_REFRESH_TOKEN"] != "5Aep861" {
+		t.Errorf("GITHUB_ENV = %v", env)
+	}
+}
+
+func TestWriteGitHubActionsSfdxURL(t *testing.T) {
+	withQuiet(t)
+	outputFile, _ := withGitHubActions(t)
+
+	var stdout bytes.Buffer
+	url := "force://PlatformCLI::5Aep861@example.my.salesforce.com"
+	if err := writeGitHubActions(&stdout, []byte(url+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "::add-mask::"+url+"\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	if got := readGitHubFileCommands(t, outputFile)["sfdx_auth_url"]; got != url {
+		t.Errorf("sfdx_auth_url = %q, want %q", got, url)
+	}
+}
+
+func TestWriteGitHubActionsErrors(t *testing.T) {
+	withQuiet(t)
+	t.Setenv("GITHUB_OUTPUT", "")
+	t.Setenv("GITHUB_ENV", "")
+	if err := writeGitHubActions(&bytes.Buffer{}, []byte(`{"access_token":"x"}`)); err == nil {
+		t.Error("writeGitHubActions outside a job succeeded")
+	}
+
+}
+
+func TestWriteGitHubActionsFilteredValue(t *testing.T) {
+	withQuiet(t)
+	_, envFile := withGitHubActions(t)
+
+	var stdout bytes.Buffer
+	if err := writeGitHubActions(&stdout, []byte(`"00D!secret"`+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "::add-mask::00D!secret\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	if got := readGitHubFileCommands(t, envFile)["SFDC_VALUE"]; got != "00D!secret" {
+		t.Errorf("SFDC_VALUE = %q", got)
+	}
+}
+
+func TestEscapeGitHubCommand(t *testing.T) {
+	if got := escapeGitHubCommand("50%\r\nx"); got != "50%25%0D%0Ax" {
+		t.Errorf("escapeGitHubCommand = %q", got)
+	}
+}
+
+func TestCheckGitHubActionsFlags(t *testing.T) {
+	defer func() { flagGitHubActions, flagOut, flagOutput = false, "", "" }()
+	flagGitHubActions = true
+
+	flagOutput = outputYAML
+	if err := checkGitHubActionsFlags(); err == nil {
+		t.Error("--github-actions with --output yaml was accepted")
+	}
+	flagOutput = outputSfdxURL
+	if err := checkGitHubActionsFlags(); err != nil {
+		t.Errorf("--github-actions with --output sfdx-url: %v", err)
+	}
+	flagOutput, flagOut = "", "tokens.json"
+	if err := checkGitHubActionsFlags(); err == nil {
+		t.Error("--github-actions with --out was accepted")
+	}
+}
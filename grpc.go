@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/credpb"
+)
+
+const grpcSocketName = "grpc.sock"
+
+var (
+	flagGRPCSocket       string
+	flagGRPCAllowUIDs    []uint
+	flagGRPCClientSecret string
+)
+
+var grpcCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "Serve stored org tokens over gRPC on a Unix socket",
+	Long: `Serve the token store as the sfdcauth.credentials.v1.CredentialService gRPC
+service on a Unix domain socket. The service definition is in
+pkg/credpb/credentials.proto.
+
+RPCs:
+  GetToken  a valid access token, refreshed first if it has expired or is
+            about to
+  Refresh   refresh the access token and save it
+  ListOrgs  list stored orgs (no tokens)
+  Revoke    revoke an org's tokens and remove it, as logout does
+
+Every connection is authorized by the user ID of the process on the other end
+of the socket, which the kernel reports. Only the user running the server is
+allowed unless --allow-uid lists others; they also need access to the socket's
+directory, so put it somewhere shared with --socket. Peer credentials are
+supported on Linux and macOS.`,
+	Args: cobra.NoArgs,
+	Run:  runGRPC,
+}
+
+func init() {
+	grpcCmd.Flags().StringVar(&flagGRPCSocket, "socket", "", "Unix socket to listen on (default: "+grpcSocketName+" in the config directory)")
+	grpcCmd.Flags().UintSliceVar(&flagGRPCAllowUIDs, "allow-uid", nil, "User IDs allowed to call the service, comma-separated (default: the user running the server)")
+	grpcCmd.Flags().StringVarP(&flagGRPCClientSecret, "client-secret", "s", "", "Client secret to send when refreshing, if the Connected App requires one")
+
+	rootCmd.AddCommand(grpcCmd)
+}
+
+// credentialServer implements the CredentialService from a token vendor
+type credentialServer struct {
+	credpb.UnimplementedCredentialServiceServer
+	vendor *tokenVendor
+}
+
+func runGRPC(cmd *cobra.Command, args []string) {
+	clientSecret := newSecret([]byte(flagGRPCClientSecret))
+	flagGRPCClientSecret = ""
+	defer clientSecret.Wipe()
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadProfileConfig(dir, flagProfile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	expiry, err := loadExpiryThresholds(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	socket := flagGRPCSocket
+	if socket == "" {
+		socket = filepath.Join(dir, grpcSocketName)
+	}
+	allowed := make([]uint32, 0, len(flagGRPCAllowUIDs)+1)
+	for _, uid := range flagGRPCAllowUIDs {
+		allowed = append(allowed, uint32(uid))
+	}
+	if len(allowed) == 0 {
+		allowed = append(allowed, uint32(os.Getuid()))
+	}
+
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	listener, err := listenUnixSocket(socket, len(flagGRPCAllowUIDs) > 0)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer os.Remove(socket)
+
+	vendor := &tokenVendor{store: store, clientSecret: clientSecret, refresh: refreshAccessToken, expiry: expiry, now: authDeps.Clock.Now}
+	server := newGRPCServer(vendor, allowed)
+
+	// Ctrl-C stops the server; calls in flight get to finish
+	ctx := cmd.Context()
+	go func() {
+		defer handlePanic()
+		vendor.watchExpiry(ctx)
+	}()
+	go func() {
+		defer handlePanic()
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			server.Stop()
+		}
+	}()
+
+	infof("Serving the %s token store over gRPC on %s", flagStore, socket)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// newGRPCServer returns a gRPC server vending tokens to peers whose user ID
+// is in allowed
+func newGRPCServer(vendor *tokenVendor, allowed []uint32) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.Creds(peerCredentials{}),
+		grpc.UnaryInterceptor(authorizePeer(allowed)),
+	)
+	credpb.RegisterCredentialServiceServer(server, &credentialServer{vendor: vendor})
+	return server
+}
+
+// listenUnixSocket listens on path, replacing a socket left behind by a
+// server that exited without cleaning up. The socket is only accessible to
+// its owner unless shared is set.
+func listenUnixSocket(path string, shared bool) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another server is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %v", err)
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %v", path, err)
+	}
+	mode := os.FileMode(0600)
+	if shared {
+		// Callers are authorized by their peer credentials, not file modes
+		mode = 0666
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error setting socket permissions: %v", err)
+	}
+	return listener, nil
+}
+
+// peerAuthInfo identifies the process on the other end of a Unix socket
+type peerAuthInfo struct {
+	credentials.CommonAuthInfo
+	UID uint32
+	PID int32
+}
+
+func (peerAuthInfo) AuthType() string { return "unix-peer" }
+
+// peerCredentials is a server-only transport security that reads the
+// connecting process's credentials from the socket; Unix sockets never
+// leave the machine, so there is nothing to encrypt
+type peerCredentials struct{}
+
+func (peerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("peer credentials are server-side only")
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil, fmt.Errorf("peer credentials need a Unix socket, got %T", conn)
+	}
+	uid, pid, err := unixPeerCredentials(unixConn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading peer credentials: %v", err)
+	}
+	return conn, peerAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity}, UID: uid, PID: pid}, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "unix-peer"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials { return c }
+
+func (peerCredentials) OverrideServerName(string) error { return nil }
+
+// authorizePeer rejects calls from peers whose user ID is not in allowed
+func authorizePeer(allowed []uint32) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "no peer credentials")
+		}
+		auth, ok := p.AuthInfo.(peerAuthInfo)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "no peer credentials")
+		}
+		for _, uid := range allowed {
+			if auth.UID == uid {
+				verbosef("gRPC %s from uid %d (pid %d)", info.FullMethod, auth.UID, auth.PID)
+				return handler(ctx, req)
+			}
+		}
+		log.Printf("Denied gRPC %s from uid %d (pid %d)", info.FullMethod, auth.UID, auth.PID)
+		return nil, status.Errorf(codes.PermissionDenied, "uid %d is not allowed", auth.UID)
+	}
+}
+
+func (s *credentialServer) GetToken(ctx context.Context, req *credpb.GetTokenRequest) (*credpb.Token, error) {
+	org, err := s.vendor.validToken(req.GetAlias())
+	if err != nil {
+		return nil, vendorStatus(req.GetAlias(), err)
+	}
+	return newPBToken(org), nil
+}
+
+func (s *credentialServer) Refresh(ctx context.Context, req *credpb.RefreshRequest) (*credpb.Token, error) {
+	org, err := s.vendor.refreshToken(req.GetAlias())
+	if err != nil {
+		return nil, vendorStatus(req.GetAlias(), err)
+	}
+	return newPBToken(org), nil
+}
+
+func (s *credentialServer) ListOrgs(ctx context.Context, req *credpb.ListOrgsRequest) (*credpb.ListOrgsResponse, error) {
+	orgs, err := s.vendor.store.List()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error listing orgs: %v", err)
+	}
+	resp := &credpb.ListOrgsResponse{Orgs: make([]*credpb.Org, 0, len(orgs))}
+	for _, org := range orgs {
+		resp.Orgs = append(resp.Orgs, &credpb.Org{
+			Alias:       org.Alias,
+			OrgId:       org.OrgID,
+			UserId:      org.UserID,
+			Username:    org.Username,
+			InstanceUrl: org.InstanceURL,
+			IsSandbox:   org.IsSandbox,
+			UpdatedAt:   timestamppb.New(org.UpdatedAt),
+		})
+	}
+	return resp, nil
+}
+
+func (s *credentialServer) Revoke(ctx context.Context, req *credpb.RevokeRequest) (*credpb.RevokeResponse, error) {
+	// A refused revocation keeps the org, so report it as a precondition
+	// the caller can override with force
+	if err := s.vendor.revoke(req.GetAlias(), req.GetForce()); err != nil {
+		if errors.Is(err, errOrgNotFound) {
+			return nil, vendorStatus(req.GetAlias(), err)
+		}
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &credpb.RevokeResponse{}, nil
+}
+
+// vendorStatus maps a token vendor error to a gRPC status
+func vendorStatus(alias string, err error) error {
+	switch {
+	case errors.Is(err, errOrgNotFound):
+		return status.Errorf(codes.NotFound, "org %q not found", alias)
+	case errors.Is(err, errRefreshFailed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func newPBToken(org *StoredOrg) *credpb.Token {
+	return &credpb.Token{AccessToken: org.AccessToken, InstanceUrl: org.InstanceURL, IssuedAt: timestamppb.New(org.IssuedAt)}
+}
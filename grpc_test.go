@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/credpb"
+)
+
+// newTestGRPCClient serves a test vendor on a temporary socket, allowing
+// only the given user IDs
+func newTestGRPCClient(t *testing.T, allowed []uint32) (*tokenVendor, credpb.CredentialServiceClient) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, grpcSocketName)
+	listener, err := listenUnixSocket(socket, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vendor := newTestVendor(t)
+	server := newGRPCServer(vendor, allowed)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return vendor, credpb.NewCredentialServiceClient(conn)
+}
+
+func TestGRPCCredentialService(t *testing.T) {
+	withQuiet(t)
+	withFakeRevoker(t)
+	vendor, client := newTestGRPCClient(t, []uint32{uint32(os.Getuid())})
+	ctx := context.Background()
+
+	list, err := client.ListOrgs(ctx, &credpb.ListOrgsRequest{})
+	if err != nil {
+		t.Fatalf("ListOrgs: %v", err)
+	}
+	if len(list.GetOrgs()) != 2 || list.GetOrgs()[0].GetAlias() != "dev" {
+		t.Errorf("ListOrgs = %v, want dev and prod", list.GetOrgs())
+	}
+
+	if err := vendor.store.Put(&StoredOrg{Alias: "prod", AccessToken: "prod_access", RefreshToken: "prod_refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := client.GetToken(ctx, &credpb.GetTokenRequest{Alias: "prod"})
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if token.GetAccessToken() != "prod_access" {
+		t.Errorf("GetToken access token = %q, want prod_access", token.GetAccessToken())
+	}
+
+	token, err = client.Refresh(ctx, &credpb.RefreshRequest{Alias: "prod"})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if token.GetAccessToken() != "refreshed_prod" {
+		t.Errorf("Refresh access token = %q, want refreshed_prod", token.GetAccessToken())
+	}
+
+	if _, err := client.Revoke(ctx, &credpb.RevokeRequest{Alias: "prod"}); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := vendor.store.Get("prod"); err == nil {
+		t.Error("prod is still stored after Revoke")
+	}
+}
+
+func TestGRPCErrorCodes(t *testing.T) {
+	withQuiet(t)
+	_, client := newTestGRPCClient(t, []uint32{uint32(os.Getuid())})
+	ctx := context.Background()
+
+	_, err := client.GetToken(ctx, &credpb.GetTokenRequest{Alias: "missing"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("GetToken(missing) code = %v, want NotFound", got)
+	}
+	_, err = client.Refresh(ctx, &credpb.RefreshRequest{Alias: "dev"})
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("Refresh(dev) code = %v, want Unavailable", got)
+	}
+}
+
+func TestGRPCDeniesOtherUsers(t *testing.T) {
+	withQuiet(t)
+	_, client := newTestGRPCClient(t, []uint32{uint32(os.Getuid()) + 1})
+
+	_, err := client.ListOrgs(context.Background(), &credpb.ListOrgsRequest{})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("ListOrgs from another uid code = %v, want PermissionDenied", got)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, grpcSocketName)
+
+	listener, err := listenUnixSocket(socket, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+	if _, err := listenUnixSocket(socket, false); err == nil {
+		t.Error("listening twice on a live socket succeeded")
+	}
+	listener.Close()
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnixSocket(file, false); err == nil {
+		t.Error("listening on a regular file succeeded")
+	}
+}
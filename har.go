@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	flagRecord string
+	flagReplay string
+)
+
+// redactedHeaders carry credentials in full and are never written to a HAR
+var redactedHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/), limited to the
+// fields this tool fills in
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+
+	// Custom fields, which HAR prefixes with an underscore. _error is set
+	// when no response came back, with status 0 as browsers record it.
+	Error string  `json:"_error,omitempty"`
+	TLS   *harTLS `json:"_tls,omitempty"`
+}
+
+// harTLS describes the certificate the server presented, so a proxy that
+// re-signs traffic shows up as an unexpected issuer
+type harTLS struct {
+	Version    string `json:"version"`
+	ServerName string `json:"serverName,omitempty"`
+	Subject    string `json:"subject,omitempty"`
+	Issuer     string `json:"issuer,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harNameVal `json:"headers"`
+	QueryString []harNameVal `json:"queryString"`
+	Cookies     []harNameVal `json:"cookies"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harNameVal `json:"headers"`
+	Cookies     []harNameVal `json:"cookies"`
+	Content     harContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// setupHAR wraps the default transport to record to --record or answer from
+// --replay. It runs after setupProxy so recordings go through the proxy.
+func setupHAR() error {
+	switch {
+	case flagRecord != "" && flagReplay != "":
+		return fmt.Errorf("--record and --replay cannot be used together")
+	case flagRecord != "":
+		http.DefaultTransport = &recordingTransport{base: http.DefaultTransport, path: flagRecord}
+	case flagReplay != "":
+		replay, err := loadReplay(flagReplay)
+		if err != nil {
+			return err
+		}
+		http.DefaultTransport = replay
+	}
+	return nil
+}
+
+// recordingTransport passes requests on and appends each exchange, with
+// secrets scrubbed, to a HAR file. The file is rewritten after every entry
+// so a trace survives the command exiting early. A path ending in .jsonl is
+// written as JSON Lines instead, one entry per line appended as it happens.
+// Requests that fail without a response, such as on a TLS or proxy error,
+// are recorded too.
+type recordingTransport struct {
+	base http.RoundTripper
+	path string
+
+	mu  sync.Mutex
+	har harFile
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if r.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	var serverAddr string
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			serverAddr = info.Conn.RemoteAddr().String()
+		},
+	}))
+
+	started := time.Now()
+	entry := harEntry{
+		StartedDateTime: started.UTC(),
+		Request: harRequest{
+			Method:      r.Method,
+			URL:         scrubSecrets(r.URL.String()),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(r.Header),
+			QueryString: []harNameVal{},
+			Cookies:     []harNameVal{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+	}
+	if scrubbed, err := url.Parse(entry.Request.URL); err == nil {
+		for name, values := range scrubbed.Query() {
+			for _, v := range values {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameVal{Name: name, Value: v})
+			}
+		}
+	}
+	if r.Body != nil {
+		entry.Request.PostData = &harPostData{MimeType: r.Header.Get("Content-Type"), Text: scrubSecrets(string(reqBody))}
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	var respBody []byte
+	if err == nil {
+		respBody, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	}
+	elapsed := float64(time.Since(started).Microseconds()) / 1000
+	entry.Time, entry.Timings = elapsed, harTimings{Wait: elapsed}
+	entry.ServerIPAddress = serverIP(serverAddr)
+	if err != nil {
+		entry.Response = harResponse{HTTPVersion: "HTTP/1.1", Headers: []harNameVal{}, Cookies: []harNameVal{}, HeadersSize: -1, BodySize: -1}
+		entry.Error = scrubSecrets(err.Error())
+		if werr := t.append(entry); werr != nil {
+			return nil, fmt.Errorf("error writing %s: %v", t.path, werr)
+		}
+		return nil, err
+	}
+
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: "HTTP/1.1",
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harNameVal{},
+		Content:     harContent{Size: len(respBody), MimeType: resp.Header.Get("Content-Type"), Text: scrubSecrets(string(respBody))},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(respBody),
+	}
+	entry.TLS = newHARTLS(resp.TLS)
+	if err := t.append(entry); err != nil {
+		return nil, fmt.Errorf("error writing %s: %v", t.path, err)
+	}
+	return resp, nil
+}
+
+// serverIP is the address part of a connection's remote address
+func serverIP(addr string) string {
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		return strings.Trim(addr[:i], "[]")
+	}
+	return addr
+}
+
+func newHARTLS(state *tls.ConnectionState) *harTLS {
+	if state == nil {
+		return nil
+	}
+	info := &harTLS{Version: tls.VersionName(state.Version), ServerName: state.ServerName}
+	if len(state.PeerCertificates) > 0 {
+		info.Subject = state.PeerCertificates[0].Subject.String()
+		info.Issuer = state.PeerCertificates[0].Issuer.String()
+	}
+	return info
+}
+
+// isJSONLTrace reports whether a --record or --replay path is JSON Lines
+func isJSONLTrace(path string) bool {
+	return strings.HasSuffix(path, ".jsonl")
+}
+
+func (t *recordingTransport) append(entry harEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if isJSONLTrace(t.path) {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	t.har.Log.Version = "1.2"
+	t.har.Log.Creator = harCreator{Name: "sfdc-auth", Version: "1"}
+	t.har.Log.Entries = append(t.har.Log.Entries, entry)
+	data, err := json.MarshalIndent(t.har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, append(data, '\n'), 0600)
+}
+
+func harHeaders(h http.Header) []harNameVal {
+	out := []harNameVal{}
+	for name, values := range h {
+		for _, v := range values {
+			if redactedHeaders[strings.ToLower(name)] {
+				v = "[REDACTED]"
+			}
+			out = append(out, harNameVal{Name: name, Value: scrubSecrets(v)})
+		}
+	}
+	return out
+}
+
+// replayTransport answers requests from a HAR file without touching the
+// network. Requests are matched on method and scrubbed URL, each recorded
+// entry being used once, in order.
+type replayTransport struct {
+	mu      sync.Mutex
+	entries []harEntry
+	used    []bool
+}
+
+func loadReplay(path string) (*replayTransport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay file: %v", err)
+	}
+	var har harFile
+	if isJSONLTrace(path) {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for n := 1; scanner.Scan(); n++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var entry harEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				return nil, fmt.Errorf("error parsing line %d of replay file %s: %v", n, path, err)
+			}
+			har.Log.Entries = append(har.Log.Entries, entry)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading replay file: %v", err)
+		}
+	} else if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("error parsing replay file %s: %v", path, err)
+	}
+	return &replayTransport{entries: har.Log.Entries, used: make([]bool, len(har.Log.Entries))}, nil
+}
+
+func (t *replayTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+	target := scrubSecrets(r.URL.String())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, entry := range t.entries {
+		if t.used[i] || entry.Request.Method != r.Method || entry.Request.URL != target {
+			continue
+		}
+		t.used[i] = true
+		verbosef("Replaying %s %s", r.Method, target)
+		if entry.Error != "" {
+			return nil, fmt.Errorf("%s (replayed)", entry.Error)
+		}
+
+		header := http.Header{}
+		for _, h := range entry.Response.Headers {
+			header.Add(h.Name, h.Value)
+		}
+		body := entry.Response.Content.Text
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+			StatusCode:    entry.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       r,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s", r.Method, target)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplayRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "sid=00D000000000001!secretsession")
+		w.Write([]byte(`{"access_token": "00D000000000001!freshtoken", "instance_url": "https://na1.salesforce.com"}`))
+	}))
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	path := filepath.Join(t.TempDir(), "session.har")
+	http.DefaultTransport = &recordingTransport{base: rewriteTransport{target: server.URL, base: original}, path: path}
+
+	org := &StoredOrg{Alias: "prod", ClientID: "client", RefreshToken: "5Aep861refreshtokenvalue0123456789", Domain: "login.example.com"}
+	if _, err := refreshAccessToken(org, nil); err != nil {
+		t.Fatalf("Recording refresh failed: %v", err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"freshtoken", "secretsession", "refreshtokenvalue"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("Recording contains the secret %q:\n%s", leaked, data)
+		}
+	}
+
+	// The recording answers the same request with the network gone
+	replay, err := loadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	http.DefaultTransport = replay
+	resp, err := refreshAccessToken(org, nil)
+	if err != nil {
+		t.Fatalf("Replayed refresh failed: %v", err)
+	}
+	if resp.InstanceURL != "https://na1.salesforce.com" || resp.AccessToken != "[REDACTED]" {
+		t.Errorf("Unexpected replayed response %+v", resp)
+	}
+
+	// Each entry is used once
+	if _, err := refreshAccessToken(org, nil); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("Expected the exhausted recording to fail, got %v", err)
+	}
+}
+
+func TestSetupHARRejectsBoth(t *testing.T) {
+	defer func() { flagRecord, flagReplay = "", "" }()
+	flagRecord, flagReplay = "a.har", "b.har"
+	if err := setupHAR(); err == nil {
+		t.Error("Expected --record with --replay to be rejected")
+	}
+}
+
+func TestRecordJSONLTrace(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"expired access/refresh token"}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	recorder := &recordingTransport{base: server.Client().Transport, path: path}
+	client := &http.Client{Transport: recorder}
+	resp, err := client.PostForm(server.URL+"/services/oauth2/token", map[string][]string{"grant_type": {"refresh_token"}, "refresh_token": {"5Aep861refreshtokenvalue0123456789"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// A request that never gets a response is recorded with its error
+	server.Close()
+	if _, err := client.Get(server.URL + "/services/oauth2/userinfo"); err == nil {
+		t.Fatal("request to a closed server succeeded")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []harEntry
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var entry harEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		if strings.Contains(scanner.Text(), "refreshtokenvalue") {
+			t.Errorf("trace contains the refresh token: %s", scanner.Text())
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	token := entries[0]
+	if token.Response.Status != http.StatusBadRequest || !strings.Contains(token.Response.Content.Text, "invalid_grant") || token.ServerIPAddress != "127.0.0.1" {
+		t.Errorf("unexpected token entry %+v", token)
+	}
+	if token.TLS == nil || token.TLS.Version == "" || token.TLS.Issuer == "" {
+		t.Errorf("token entry is missing the TLS details: %+v", token.TLS)
+	}
+	if failed := entries[1]; failed.Response.Status != 0 || failed.Error == "" {
+		t.Errorf("unexpected failed entry %+v", failed)
+	}
+
+	// The failure replays as an error
+	replay, err := loadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&http.Client{Transport: replay}).Get(server.URL + "/services/oauth2/userinfo"); err == nil || !strings.Contains(err.Error(), "replayed") {
+		t.Errorf("replayed failure = %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import "fmt"
+
+// HybridSession holds the session IDs the hybrid app token flow returns
+// alongside the tokens, for apps that embed Salesforce web content and need
+// to set its cookies themselves
+type HybridSession struct {
+	SidCookieName     string `json:"sidCookieName,omitempty"`
+	ClientSid         string `json:"cookie-sid_Client,omitempty"`
+	ClientSrc         string `json:"cookie-clientSrc,omitempty"`
+	LightningDomain   string `json:"lightning_domain,omitempty"`
+	LightningSid      string `json:"lightning_sid,omitempty"`
+	VisualforceDomain string `json:"visualforce_domain,omitempty"`
+	VisualforceSid    string `json:"visualforce_sid,omitempty"`
+	ContentDomain     string `json:"content_domain,omitempty"`
+	ContentSid        string `json:"content_sid,omitempty"`
+	CSRFToken         string `json:"csrf_token,omitempty"`
+}
+
+// hybridScope asks for a hybrid refresh token and sessions for each of the
+// web content domains
+const hybridScope = "full refresh_token hybrid_refresh web lightning visualforce content"
+
+func authorizeResponseType() string {
+	switch flagGrant {
+	case grantHybrid:
+		return "hybrid_auth_code"
+	case grantImplicit:
+		return "token"
+	}
+	return "code"
+}
+
+func authorizeScope() string {
+	scope := requestedScope("full refresh_token")
+	if flagGrant == grantHybrid {
+		scope = requestedScope(hybridScope)
+	}
+	if flagOIDC {
+		scope = withOpenIDScope(scope)
+	}
+	return scope
+}
+
+func codeGrantType() string {
+	if flagGrant == grantHybrid {
+		return "hybrid_auth_code"
+	}
+	return "authorization_code"
+}
+
+// refreshGrantType uses the hybrid refresh grant for orgs that logged in
+// with the hybrid flow, so each refresh also returns fresh session IDs
+func refreshGrantType(org *StoredOrg) string {
+	if org.Hybrid {
+		return "hybrid_refresh"
+	}
+	return "refresh_token"
+}
+
+// appendText adds the session values that were returned to text output
+func (h *HybridSession) appendText(out []byte) []byte {
+	fields := []struct{ name, value string }{
+		{"sid_cookie_name", h.SidCookieName},
+		{"cookie_sid_client", h.ClientSid},
+		{"cookie_client_src", h.ClientSrc},
+		{"lightning_domain", h.LightningDomain},
+		{"lightning_sid", h.LightningSid},
+		{"visualforce_domain", h.VisualforceDomain},
+		{"visualforce_sid", h.VisualforceSid},
+		{"content_domain", h.ContentDomain},
+		{"content_sid", h.ContentSid},
+		{"csrf_token", h.CSRFToken},
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			out = fmt.Appendf(out, "%s: %s\n", f.name, f.value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func withGrant(t *testing.T, grant string) {
+	t.Helper()
+	original := flagGrant
+	flagGrant = grant
+	t.Cleanup(func() { flagGrant = original })
+}
+
+func TestHybridAuthURL(t *testing.T) {
+	withGrant(t, grantHybrid)
+
+	u, err := url.Parse(salesforceAuthURL{}.AuthURL("login.salesforce.com", "client", "http://localhost:8080/callback", "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("response_type") != "hybrid_auth_code" {
+		t.Errorf("Unexpected response_type %q", query.Get("response_type"))
+	}
+	if !strings.Contains(query.Get("scope"), "hybrid_refresh") {
+		t.Errorf("Expected the hybrid_refresh scope, got %q", query.Get("scope"))
+	}
+	if codeGrantType() != "hybrid_auth_code" {
+		t.Errorf("Unexpected code grant %q", codeGrantType())
+	}
+}
+
+func TestRefreshGrantType(t *testing.T) {
+	if got := refreshGrantType(&StoredOrg{}); got != "refresh_token" {
+		t.Errorf("Unexpected grant %q", got)
+	}
+	if got := refreshGrantType(&StoredOrg{Hybrid: true}); got != "hybrid_refresh" {
+		t.Errorf("Unexpected grant %q", got)
+	}
+}
+
+func TestHybridSessionOutput(t *testing.T) {
+	var resp SalesforceOAuthResponse
+	raw := `{"access_token": "access", "sidCookieName": "sid", "lightning_domain": "acme.lightning.force.com", "lightning_sid": "lsid", "csrf_token": "csrf"}`
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.LightningSid != "lsid" || resp.SidCookieName != "sid" {
+		t.Fatalf("Hybrid session not decoded: %+v", resp.HybridSession)
+	}
+
+	result := &TokenResponse{AccessToken: resp.AccessToken, HybridSession: &resp.HybridSession}
+	data, err := formatTokenResponse(result, outputJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]string
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["lightning_sid"] != "lsid" || fields["csrf_token"] != "csrf" {
+		t.Errorf("Expected the session values in JSON output: %s", data)
+	}
+	if _, ok := fields["content_sid"]; ok {
+		t.Error("Values that were not returned should be left out")
+	}
+
+	data, err = formatTokenResponse(result, outputText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "lightning_sid: lsid\n") {
+		t.Errorf("Expected the session values in text output: %q", data)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"embed"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// Translations live in locales/active.<lang>.json. To add or update them:
+//
+//	make i18n-extract   # refresh locales/active.en.json from the messages below
+//	make i18n-merge     # write translate.<lang>.json files with what is missing
+//
+// then translate the new entries and merge them back into active.<lang>.json
+// (see the README).
+
+//go:embed locales/active.*.json
+var localeFS embed.FS
+
+const langEnv = "SFDC_AUTH_LANG"
+
+var flagLang string
+
+var (
+	msgBanner = &i18n.Message{
+		ID:    "Banner",
+		Other: "Salesforce OAuth2 Authentication CLI",
+	}
+	msgPromptClientID = &i18n.Message{
+		ID:    "PromptClientID",
+		Other: "Enter Salesforce Client ID: ",
+	}
+	msgPromptClientSecret = &i18n.Message{
+		ID:    "PromptClientSecret",
+		Other: "Enter Salesforce Client Secret: ",
+	}
+	msgPromptClientSecretOptional = &i18n.Message{
+		ID:    "PromptClientSecretOptional",
+		Other: "Enter Salesforce Client Secret (leave empty if the app does not require one): ",
+	}
+	msgStartingServer = &i18n.Message{
+		ID:    "StartingServer",
+		Other: "Starting local server on {{.Address}} for OAuth callback...",
+	}
+	msgOpenAuthURL = &i18n.Message{
+		ID:    "OpenAuthURL",
+		Other: "Please open the following URL in your browser to authenticate:",
+	}
+	msgWaitingForCallback = &i18n.Message{
+		ID:    "WaitingForCallback",
+		Other: "Waiting for OAuth callback...",
+	}
+	msgExchangingCode = &i18n.Message{
+		ID:    "ExchangingCode",
+		Other: "Exchanging the authorization code for tokens...",
+	}
+	msgPasteRedirectURL = &i18n.Message{
+		ID:    "PasteRedirectURL",
+		Other: "After logging in, paste the URL your browser was redirected to (or just its code parameter): ",
+	}
+	msgAuthSuccessful = &i18n.Message{
+		ID:    "AuthSuccessful",
+		Other: "Authentication successful!",
+	}
+	msgCloseWindow = &i18n.Message{
+		ID:    "CloseWindow",
+		Other: "You can close this window and return to your terminal.",
+	}
+	msgSavedOrg = &i18n.Message{
+		ID:    "SavedOrg",
+		Other: `Saved org as "{{.Alias}}" in the {{.Store}} token store`,
+	}
+	msgPromptPassword = &i18n.Message{
+		ID:    "PromptPassword",
+		Other: "Enter Salesforce password: ",
+	}
+	msgPromptSecurityToken = &i18n.Message{
+		ID:    "PromptSecurityToken",
+		Other: "Enter security token (leave empty if your IP address is trusted): ",
+	}
+	msgPromptBackupPassphrase = &i18n.Message{
+		ID:    "PromptBackupPassphrase",
+		Other: "Enter backup passphrase: ",
+	}
+	msgConfirmBackupPassphrase = &i18n.Message{
+		ID:    "ConfirmBackupPassphrase",
+		Other: "Confirm backup passphrase: ",
+	}
+	msgConfirmRelogin = &i18n.Message{
+		ID:    "ConfirmRelogin",
+		Other: `The refresh token for "{{.Alias}}" is no longer valid. Log in again now? [Y/n] `,
+	}
+)
+
+var (
+	localizerOnce sync.Once
+	localizer     *i18n.Localizer
+)
+
+// tr returns msg in the user's language, filling in its template fields from
+// data. Messages without a translation fall back to English.
+func tr(msg *i18n.Message, data map[string]interface{}) string {
+	localizerOnce.Do(func() {
+		localizer = newLocalizer(detectLocale(flagLang, os.Getenv))
+	})
+	text, err := localizer.Localize(&i18n.LocalizeConfig{DefaultMessage: msg, TemplateData: data})
+	if err != nil {
+		return msg.Other
+	}
+	return text
+}
+
+// banner returns the localized title with a matching underline
+func banner() string {
+	title := tr(msgBanner, nil)
+	return title + "\n" + strings.Repeat("=", utf8.RuneCountInString(title))
+}
+
+func newLocalizer(lang string) *i18n.Localizer {
+	bundle := i18n.NewBundle(language.English)
+	entries, _ := localeFS.ReadDir("locales")
+	for _, entry := range entries {
+		// A broken catalog only costs that language its translations
+		_, _ = bundle.LoadMessageFileFS(localeFS, path.Join("locales", entry.Name()))
+	}
+	return i18n.NewLocalizer(bundle, lang)
+}
+
+// detectLocale picks the language from --lang, SFDC_AUTH_LANG or the POSIX
+// locale variables, turning values like de_DE.UTF-8 into BCP 47 tags
+func detectLocale(flag string, getenv func(string) string) string {
+	candidates := []string{flag, getenv(langEnv), getenv("LC_ALL"), getenv("LC_MESSAGES"), getenv("LANG")}
+	for _, value := range candidates {
+		if value == "" {
+			continue
+		}
+		if i := strings.IndexAny(value, ".@"); i >= 0 {
+			value = value[:i]
+		}
+		if value == "C" || value == "POSIX" {
+			return "en"
+		}
+		return strings.ReplaceAll(value, "_", "-")
+	}
+	return "en"
+}
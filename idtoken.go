@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+var (
+	// flagOIDC requests the openid scope and verifies the ID token that
+	// comes back (--oidc)
+	flagOIDC bool
+
+	// nonce is sent with the authorization request of the login in progress
+	// and must come back in its ID token
+	nonce string
+)
+
+// idTokenIssuer is the issuer Salesforce signs ID tokens as for a login
+// domain, which is also where its discovery document and JWKS are served
+var idTokenIssuer = func(domain string) string {
+	return "https://" + domain
+}
+
+// idTokenClaims are the claims of a verified ID token included in the
+// login output
+type idTokenClaims struct {
+	Subject           string   `json:"sub"`
+	Issuer            string   `json:"iss"`
+	Audience          []string `json:"aud"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+}
+
+// withOpenIDScope adds openid to a scope parameter that lacks it
+func withOpenIDScope(scope string) string {
+	for _, s := range strings.Fields(scope) {
+		if s == "openid" {
+			return scope
+		}
+	}
+	return strings.TrimSpace(scope + " openid")
+}
+
+// verifyIDToken checks an ID token's signature against the login domain's
+// JWKS, that it was issued by that domain for this client and has not
+// expired, and that it carries the nonce of this login if one was sent
+func verifyIDToken(domain, audience, expectedNonce, raw string) (*idTokenClaims, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("no id_token in the token response; check that the Connected App allows the openid scope")
+	}
+	claims, err := newOIDCVerifier(idTokenIssuer(domain), audience).Verify(raw)
+	if err != nil {
+		return nil, err
+	}
+	if expectedNonce != "" {
+		got, _ := claims.Raw["nonce"].(string)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(expectedNonce)) != 1 {
+			return nil, fmt.Errorf("ID token nonce does not match the login request")
+		}
+	}
+
+	result := &idTokenClaims{
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}
+	if iat, ok := claims.Raw["iat"].(float64); ok {
+		result.IssuedAt = int64(iat)
+	}
+	result.Name, _ = claims.Raw["name"].(string)
+	result.PreferredUsername, _ = claims.Raw["preferred_username"].(string)
+	result.Email, _ = claims.Raw["email"].(string)
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withTestIssuerDomain points ID token verification at a test issuer
+func withTestIssuerDomain(t *testing.T, iss *testIssuer) {
+	t.Helper()
+	original := idTokenIssuer
+	idTokenIssuer = func(string) string { return iss.server.URL }
+	t.Cleanup(func() { idTokenIssuer = original })
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	withTestIssuerDomain(t, iss)
+
+	claims := iss.claims("https://login.salesforce.com/id/00Dxx/005xx")
+	claims["aud"] = "client-id"
+	claims["iat"] = 1700000000
+	claims["preferred_username"] = "pat@example.com"
+	claims["email"] = "pat@example.com"
+	claims["nonce"] = "n-0S6"
+
+	got, err := verifyIDToken("login.salesforce.com", "client-id", "n-0S6", iss.sign(t, "key1", claims))
+	if err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+	if got.Subject != "https://login.salesforce.com/id/00Dxx/005xx" || got.Issuer != iss.server.URL {
+		t.Errorf("Unexpected subject or issuer: %+v", got)
+	}
+	if len(got.Audience) != 1 || got.Audience[0] != "client-id" || got.IssuedAt != 1700000000 || got.PreferredUsername != "pat@example.com" {
+		t.Errorf("Unexpected claims: %+v", got)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	iss := newTestIssuer(t)
+	withTestIssuerDomain(t, iss)
+
+	if _, err := verifyIDToken("login.salesforce.com", "client-id", "", ""); err == nil || !strings.Contains(err.Error(), "no id_token") {
+		t.Errorf("Expected an error for a missing ID token, got %v", err)
+	}
+	// iss.claims issues tokens for the audience "broker"
+	if _, err := verifyIDToken("login.salesforce.com", "client-id", "", iss.sign(t, "key1", iss.claims("alice"))); err == nil {
+		t.Error("Expected an ID token for another client to be rejected")
+	}
+}
+
+func TestVerifyIDTokenChecksNonce(t *testing.T) {
+	iss := newTestIssuer(t)
+	withTestIssuerDomain(t, iss)
+
+	claims := iss.claims("alice")
+	claims["nonce"] = "n-0S6"
+	token := iss.sign(t, "key1", claims)
+	if _, err := verifyIDToken("login.salesforce.com", "broker", "n-0S6", token); err != nil {
+		t.Errorf("Expected the matching nonce to be accepted, got %v", err)
+	}
+	if _, err := verifyIDToken("login.salesforce.com", "broker", "other", token); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("Expected a replayed ID token to be rejected, got %v", err)
+	}
+	// A token without a nonce cannot be tied to this login either
+	if _, err := verifyIDToken("login.salesforce.com", "broker", "n-0S6", iss.sign(t, "key1", iss.claims("alice"))); err == nil {
+		t.Error("Expected an ID token without a nonce to be rejected")
+	}
+}
+
+func TestAuthURLSendsNonce(t *testing.T) {
+	original := nonce
+	t.Cleanup(func() { nonce = original })
+	nonce = "n-0S6"
+
+	u, err := url.Parse(salesforceAuthURL{}.AuthURL("login.salesforce.com", "3MVG9", "http://localhost:8080/callback", "xyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("nonce"); got != "n-0S6" {
+		t.Errorf("Expected the nonce in the authorization URL, got %q", got)
+	}
+}
+
+func TestAuthorizeScopeWithOIDC(t *testing.T) {
+	originalOIDC, originalScopes, originalGrant := flagOIDC, flagScopes, flagGrant
+	t.Cleanup(func() { flagOIDC, flagScopes, flagGrant = originalOIDC, originalScopes, originalGrant })
+	flagGrant = grantAuthorizationCode
+
+	flagOIDC = true
+	if got := authorizeScope(); got != "full refresh_token openid" {
+		t.Errorf("Expected openid to be added, got %q", got)
+	}
+	flagScopes = []string{"openid,api"}
+	if got := authorizeScope(); got != "openid api" {
+		t.Errorf("Expected openid to be requested once, got %q", got)
+	}
+	flagOIDC, flagScopes = false, nil
+	if got := authorizeScope(); got != "full refresh_token" {
+		t.Errorf("Expected no openid without --oidc, got %q", got)
+	}
+}
+
+func TestFormatTokenResponseWithIDToken(t *testing.T) {
+	result := &TokenResponse{
+		AccessToken:   "access",
+		InstanceURL:   "https://example.my.salesforce.com",
+		IDToken:       "header.claims.sig",
+		IDTokenClaims: &idTokenClaims{Subject: "https://login.salesforce.com/id/00Dxx/005xx", Audience: []string{"client-id"}},
+	}
+	text, err := formatTokenResponse(result, outputText)
+	if err != nil || !strings.Contains(string(text), "id_token: header.claims.sig\nid_token_sub: https://login.salesforce.com/id/00Dxx/005xx\n") {
+		t.Errorf("Unexpected text output %q (%v)", text, err)
+	}
+	out, err := formatTokenResponse(result, outputJSON)
+	if err != nil || !strings.Contains(string(out), `"id_token_claims": {`) || !strings.Contains(string(out), `"sub": "https://login.salesforce.com/id/00Dxx/005xx"`) {
+		t.Errorf("Unexpected JSON output %s (%v)", out, err)
+	}
+}
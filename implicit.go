@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// implicitToken is the token captured by the user-agent flow's callback
+var implicitToken *SalesforceOAuthResponse
+
+// implicitShimPage is served at the callback in the user-agent flow. The
+// tokens arrive in the URL fragment, which browsers never send to the
+// server, so the page posts the fragment back to the same path.
+const implicitShimPage = `<html>
+	<body>
+		<h2 id="status">Completing sign-in...</h2>
+		<script>
+			var params = window.location.hash.substring(1);
+			history.replaceState(null, "", window.location.pathname);
+			fetch(window.location.pathname, {
+				method: "POST",
+				headers: {"Content-Type": "application/x-www-form-urlencoded"},
+				body: params
+			}).then(function (resp) {
+				document.getElementById("status").textContent = resp.ok
+					? "Authentication Successful! You can close this window and return to your terminal."
+					: "OAuth error occurred. Check your terminal.";
+			});
+		</script>
+	</body>
+</html>
+`
+
+// handleImplicitCallback serves the shim page on GET and reads the tokens
+// it posts back
+func handleImplicitCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Query().Get("error") == "" {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := w.Write([]byte(implicitShimPage)); err != nil {
+			log.Printf("Warning: error writing response: %v", err)
+		}
+		return
+	}
+
+	defer func() {
+		serverDone <- true
+	}()
+
+	// Errors may come in the query, as for the web server flow, or in the
+	// posted fragment
+	if err := r.ParseForm(); err != nil {
+		authError = "Invalid callback request"
+		http.Error(w, "Invalid callback request", http.StatusBadRequest)
+		return
+	}
+	if errorParam := r.Form.Get("error"); errorParam != "" {
+		authOAuthError = &oauthError{Code: errorParam, Description: r.Form.Get("error_description")}
+		authError = authOAuthError.Error()
+		http.Error(w, "OAuth error occurred. Check your terminal.", http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("state") != state {
+		authError = "Invalid state parameter"
+		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("access_token") == "" {
+		authError = "No access token received"
+		http.Error(w, "No access token received", http.StatusBadRequest)
+		return
+	}
+
+	implicitToken = &SalesforceOAuthResponse{
+		AccessToken:  r.PostForm.Get("access_token"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		InstanceURL:  r.PostForm.Get("instance_url"),
+		ID:           r.PostForm.Get("id"),
+		TokenType:    r.PostForm.Get("token_type"),
+		IssuedAt:     r.PostForm.Get("issued_at"),
+		Signature:    r.PostForm.Get("signature"),
+		Scope:        r.PostForm.Get("scope"),
+		IDToken:      r.PostForm.Get("id_token"),
+	}
+	implicitToken.ExpiresIn, _ = strconv.ParseInt(r.PostForm.Get("expires_in"), 10, 64)
+	w.WriteHeader(http.StatusNoContent)
+}
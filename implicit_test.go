@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeUserAgent plays the browser in the user-agent flow: it loads the shim
+// page and posts the fragment back as the page's script would
+type fakeUserAgent struct {
+	fragment url.Values
+	done     chan error
+}
+
+func (f *fakeUserAgent) Open(authURL string) error {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return err
+	}
+	params := u.Query()
+	if params.Get("response_type") != "token" {
+		return fmt.Errorf("unexpected response_type %q", params.Get("response_type"))
+	}
+	fragment := url.Values{"state": {params.Get("state")}}
+	for k, v := range f.fragment {
+		fragment[k] = v
+	}
+	callback := params.Get("redirect_uri")
+
+	go func() {
+		f.done <- func() error {
+			resp, err := http.Get(callback)
+			if err != nil {
+				return err
+			}
+			page, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !strings.Contains(string(page), "window.location.hash") {
+				return fmt.Errorf("callback did not serve the shim page")
+			}
+			resp, err = http.PostForm(callback, fragment)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				return fmt.Errorf("posting the fragment returned status %d", resp.StatusCode)
+			}
+			return nil
+		}()
+	}()
+	return nil
+}
+
+func TestRunAuthFlowImplicit(t *testing.T) {
+	withQuiet(t)
+	withGrant(t, grantImplicit)
+	browser := &fakeUserAgent{
+		fragment: url.Values{"access_token": {"access"}, "instance_url": {"https://na1.salesforce.com"}, "issued_at": {"1700000000000"}},
+		done:     make(chan error, 1),
+	}
+	exchanger := &fakeExchanger{}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	resp, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil)
+	if err != nil {
+		t.Fatalf("runAuthFlow failed: %v", err)
+	}
+	if err := <-browser.done; err != nil {
+		t.Errorf("Browser failed: %v", err)
+	}
+	if resp.AccessToken != "access" || resp.InstanceURL != "https://na1.salesforce.com" {
+		t.Errorf("Unexpected token response %+v", resp)
+	}
+	if exchanger.code != "" {
+		t.Error("No code should be exchanged in the user-agent flow")
+	}
+}
+
+func TestRunAuthFlowImplicitBadState(t *testing.T) {
+	withQuiet(t)
+	withGrant(t, grantImplicit)
+	browser := &fakeUserAgent{fragment: url.Values{"access_token": {"access"}, "state": {"forged"}}, done: make(chan error, 1)}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: &fakeExchanger{}, Clock: systemClock{}, Browser: browser}
+
+	_, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil)
+	<-browser.done
+	if err == nil || !strings.Contains(err.Error(), "Invalid state") {
+		t.Errorf("Expected an invalid state error, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	// stdin is shared by every prompt, so input piped in for one prompt is
+	// not lost in the buffer of another
+	stdin   = bufio.NewReader(os.Stdin)
+	stdinFd = int(os.Stdin.Fd())
+
+	// stdinIsTerminal reports whether prompts are answered at a terminal
+	// rather than piped in
+	stdinIsTerminal = func() bool { return term.IsTerminal(stdinFd) }
+)
+
+// Control characters handled while reading hidden input in raw mode
+const (
+	keyInterrupt = 0x03 // Ctrl-C
+	keyEOF       = 0x04 // Ctrl-D
+	keyBackspace = 0x08
+	keyDelete    = 0x7f
+)
+
+// stdinSecretFlag is the value of a secret flag that reads it from stdin
+const stdinSecretFlag = "-"
+
+// maxStdinSecret bounds what is read from stdin for a secret flag
+const maxStdinSecret = 64 << 10
+
+// pemBegin starts a multi-line secret, which is read up to a pemEnd line
+const (
+	pemBegin = "-----BEGIN "
+	pemEnd   = "-----END "
+)
+
+// promptLine prompts for a value that is shown as it is typed
+func promptLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptHidden prompts for a secret without echoing it. The terminal is put
+// in raw mode, which works the same on Unix and Windows consoles; piped
+// input is read a line at a time. Either way, a pasted PEM block is read to
+// its end line rather than stopping at the first. The caller wipes the
+// result.
+func promptHidden(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if !stdinIsTerminal() {
+		return readHiddenInput(stdin)
+	}
+	state, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the terminal: %v", err)
+	}
+	value, err := readHiddenInput(stdin)
+	term.Restore(stdinFd, state)
+	fmt.Fprintln(os.Stderr) // New line after hidden input
+	return value, err
+}
+
+// readHiddenInput reads a secret up to the end of the line, or of a PEM
+// block that starts on it, trimmed of surrounding space. \r, as a raw
+// terminal sends for Enter, \n and \r\n all end a line.
+func readHiddenInput(r *bufio.Reader) ([]byte, error) {
+	var value []byte
+	lineStart, afterCR := 0, false
+read:
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF || (err == nil && c == keyEOF) {
+			if len(value) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			wipeBytes(value)
+			return nil, err
+		}
+		if c == '\n' && afterCR {
+			afterCR = false
+			continue
+		}
+		afterCR = c == '\r'
+
+		switch c {
+		case keyInterrupt:
+			wipeBytes(value)
+			return nil, errCancelled
+		case '\r', '\n':
+			multiLine := bytes.HasPrefix(bytes.TrimSpace(value), []byte(pemBegin))
+			if !multiLine || bytes.HasPrefix(bytes.TrimSpace(value[lineStart:]), []byte(pemEnd)) {
+				// Leave nothing of a \r\n for the next prompt, without
+				// waiting on a terminal that only sent \r
+				if c == '\r' && r.Buffered() > 0 {
+					if next, _ := r.Peek(1); next[0] == '\n' {
+						r.ReadByte()
+					}
+				}
+				break read
+			}
+			value = appendHiddenByte(value, '\n')
+			lineStart = len(value)
+		case keyBackspace, keyDelete:
+			if line := value[lineStart:]; len(line) > 0 {
+				// Remove the last UTF-8 character, not just its last byte
+				n := len(line) - 1
+				for n > 0 && line[n]&0xc0 == 0x80 {
+					n--
+				}
+				wipeBytes(line[n:])
+				value = value[:lineStart+n]
+			}
+		default:
+			value = appendHiddenByte(value, c)
+		}
+	}
+
+	trimmed := append([]byte(nil), bytes.TrimSpace(value)...)
+	wipeBytes(value)
+	return trimmed, nil
+}
+
+// appendHiddenByte appends c, wiping the old buffer when it has to grow so
+// no partial copies of the secret are left behind
+func appendHiddenByte(value []byte, c byte) []byte {
+	if len(value) == cap(value) {
+		grown := make([]byte, len(value), 2*cap(value)+64)
+		copy(grown, value)
+		wipeBytes(value)
+		value = grown
+	}
+	return append(value, c)
+}
+
+// resolveStdinSecrets reads the secret flag of cmd given as -, such as
+// --client-secret -, from piped stdin, so a password manager can hand it
+// over without it showing up in process listings. Stdin can only supply one
+// of them.
+func resolveStdinSecrets(cmd *cobra.Command) error {
+	name := ""
+	for _, flag := range secretFlags {
+		if f := cmd.Flags().Lookup(flag); f != nil && f.Changed && f.Value.String() == stdinSecretFlag {
+			if name != "" {
+				return fmt.Errorf("only one of --%s and --%s can be read from stdin", name, flag)
+			}
+			name = flag
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	if stdinIsTerminal() {
+		return fmt.Errorf("--%s - reads the value from stdin, which is a terminal; pipe it in, e.g. op read ... | sfdc-auth --%s -", name, name)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(stdin, maxStdinSecret))
+	defer wipeBytes(raw)
+	if err != nil {
+		return fmt.Errorf("error reading --%s from stdin: %v", name, err)
+	}
+	value := bytes.TrimSpace(raw)
+	if len(value) == 0 {
+		return fmt.Errorf("no value for --%s on stdin", name)
+	}
+	if err := cmd.Flags().Set(name, string(value)); err != nil {
+		return fmt.Errorf("invalid --%s from stdin: %v", name, err)
+	}
+	verbosef("Using --%s from stdin", name)
+	return nil
+}
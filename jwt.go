@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	jwtBearerGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	// Salesforce accepts assertions that expire within five minutes
+	jwtAssertionLifetime = 3 * time.Minute
+)
+
+var (
+	flagJWTKeyFile  string
+	flagJWTUsername string
+	flagJWTClientID string
+	flagJWTAudience string
+	flagJWTDomain   string
+)
+
+var jwtCmd = &cobra.Command{
+	Use:   "jwt",
+	Short: "Log in with the OAuth 2.0 JWT bearer flow",
+	Long: `Log in without a browser by signing a JWT with the private key whose
+certificate is uploaded to the Connected App, and exchanging it at the token
+endpoint. The user must be pre-authorized for the app (by profile or
+permission set). Prints the same output as the web server flow and saves the
+org to the token store.
+
+The audience is https://login.salesforce.com, or https://test.salesforce.com
+when --domain is test.salesforce.com.`,
+	Args: cobra.NoArgs,
+	Run:  runJWT,
+}
+
+func init() {
+	jwtCmd.Flags().StringVar(&flagJWTKeyFile, "key-file", "", "PEM file with the RSA private key to sign the JWT with")
+	jwtCmd.Flags().StringVarP(&flagJWTUsername, "username", "u", "", "Username to log in as (the JWT subject)")
+	jwtCmd.Flags().StringVarP(&flagJWTClientID, "client-id", "c", "", "Salesforce Client ID (Consumer Key)")
+	jwtCmd.Flags().StringVar(&flagJWTAudience, "audience", "", "JWT audience (default: from --domain)")
+	jwtCmd.Flags().StringVarP(&flagJWTDomain, "domain", "d", defaultSalesforceDomain, "Salesforce domain to request the token from")
+	jwtCmd.Flags().StringVarP(&flagAlias, "alias", "a", "", "Alias to save the org under in the token store (defaults to the org ID)")
+	_ = jwtCmd.MarkFlagRequired("key-file")
+	_ = jwtCmd.MarkFlagRequired("username")
+	_ = jwtCmd.MarkFlagRequired("client-id")
+
+	rootCmd.AddCommand(jwtCmd)
+}
+
+func runJWT(cmd *cobra.Command, args []string) {
+	key, err := loadRSAPrivateKey(flagJWTKeyFile)
+	if err != nil {
+		log.Fatalf("Error reading private key: %v", err)
+	}
+	clientID = flagJWTClientID
+	audience := flagJWTAudience
+	if audience == "" {
+		audience = jwtAudience(flagJWTDomain)
+	}
+
+	tokenResponse, err := exchangeJWTBearer(flagJWTDomain, clientID, flagJWTUsername, audience, key)
+	if err != nil {
+		failLogin(err)
+	}
+	completeLogin(flagJWTDomain, tokenResponse, nil)
+}
+
+// jwtAudience is the audience Salesforce expects for assertions sent to
+// domain: the sandbox login host for sandboxes, production otherwise
+func jwtAudience(domain string) string {
+	if domain == sandboxSalesforceDomain {
+		return "https://" + sandboxSalesforceDomain
+	}
+	return "https://login.salesforce.com"
+}
+
+// exchangeJWTBearer signs an assertion for username and trades it for an
+// access token. The flow issues no refresh token.
+func exchangeJWTBearer(domain, clientID, username, audience string, key *rsa.PrivateKey) (*SalesforceOAuthResponse, error) {
+	assertion, err := signJWTAssertion(key, clientID, username, audience, authDeps.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	data := url.Values{}
+	data.Set("grant_type", jwtBearerGrant)
+	data.Set("assertion", assertion)
+
+	return withMaintenanceRetry("", func() (*SalesforceOAuthResponse, error) {
+		return postTokenRequest(getSalesforceTokenURL(domain), data, nil)
+	})
+}
+
+// signJWTAssertion builds an RS256 JWT with the claims Salesforce requires
+func signJWTAssertion(key *rsa.PrivateKey, clientID, username, audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": clientID,
+		"sub": username,
+		"aud": audience,
+		"exp": now.Add(jwtAssertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing JWT: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// loadRSAPrivateKey reads an unencrypted PKCS #1 or PKCS #8 RSA key
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(data)
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	defer wipeBytes(block.Bytes)
+	if strings.Contains(block.Type, "ENCRYPTED") {
+		return nil, fmt.Errorf("encrypted private keys are not supported; decrypt it with openssl first")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("the JWT bearer flow needs an RSA key")
+		}
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExchangeJWTBearer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "server.key")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadRSAPrivateKey(keyFile)
+	if err != nil {
+		t.Fatalf("loadRSAPrivateKey: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != jwtBearerGrant {
+			t.Errorf("Unexpected grant_type %q", r.FormValue("grant_type"))
+		}
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("Malformed assertion %q", r.FormValue("assertion"))
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if err := verifyJWTSignature("RS256", &key.PublicKey, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+			t.Errorf("Assertion signature: %v", err)
+		}
+		claims, err := parseJWTClaims(parts[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Issuer != "client" || claims.Subject != "ci@example.com" || claims.Audience[0] != "https://test.salesforce.com" {
+			t.Errorf("Unexpected claims %+v", claims)
+		}
+		if !claims.ExpiresAt.After(time.Now()) || claims.ExpiresAt.After(time.Now().Add(5*time.Minute)) {
+			t.Errorf("Expiry %v should be within five minutes", claims.ExpiresAt)
+		}
+		w.Write([]byte(`{"access_token": "access", "instance_url": "https://cs42.salesforce.com", "id": "https://test.salesforce.com/id/00Dxx0000001gEREAY/005xx000001SwiUAAS"}`))
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	resp, err := exchangeJWTBearer("test.salesforce.com", "client", "ci@example.com", jwtAudience("test.salesforce.com"), loaded)
+	if err != nil {
+		t.Fatalf("exchangeJWTBearer: %v", err)
+	}
+	if resp.AccessToken != "access" || resp.RefreshToken != "" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestLoadRSAPrivateKeyRejectsOthers(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "key.txt")
+	os.WriteFile(notPEM, []byte("not a key"), 0600)
+	encrypted := filepath.Join(dir, "encrypted.key")
+	os.WriteFile(encrypted, pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{1}}), 0600)
+
+	for _, path := range []string{notPEM, encrypted, filepath.Join(dir, "missing.key")} {
+		if _, err := loadRSAPrivateKey(path); err == nil {
+			t.Errorf("Expected %s to be rejected", filepath.Base(path))
+		}
+	}
+}
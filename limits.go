@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// dailyAPIRequests is the limit most jobs run into first, so it is shown
+// ahead of the rest
+const dailyAPIRequests = "DailyApiRequests"
+
+var limitsCmd = &cobra.Command{
+	Use:   "limits [alias]",
+	Short: "Show a stored org's API and other limits",
+	Long: `Call the org's /limits resource with the stored token and print how many
+daily API requests remain, followed by every other org limit with its
+maximum and what is left. Without an alias the default org is used.
+
+The access token is refreshed and saved if it has expired, so this is also a
+quick check that a stored org still works.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runLimits,
+}
+
+func init() {
+	rootCmd.AddCommand(limitsCmd)
+}
+
+// orgLimit is one entry of the /limits resource
+type orgLimit struct {
+	Name      string `json:"name"`
+	Max       int64  `json:"max"`
+	Remaining int64  `json:"remaining"`
+}
+
+func (l orgLimit) used() int64 { return l.Max - l.Remaining }
+
+func runLimits(cmd *cobra.Command, args []string) {
+	alias := ""
+	if len(args) == 1 {
+		alias = args[0]
+	}
+	store, org, err := useStoredOrg(alias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	limits, err := fetchLimits(func(path string, out interface{}) error { return orgGetJSON(store, org, path, out) })
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if outputFormat(outputText) == outputJSON {
+		if err := writeJSON(limits); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+		return
+	}
+	writeLimits(os.Stdout, limits)
+}
+
+// fetchLimits reads the org's limits, DailyApiRequests first and the rest
+// by name
+func fetchLimits(get func(path string, out interface{}) error) ([]orgLimit, error) {
+	var raw map[string]struct {
+		Max       int64 `json:"Max"`
+		Remaining int64 `json:"Remaining"`
+	}
+	if err := get("/services/data/"+salesforceAPIVersion+"/limits", &raw); err != nil {
+		return nil, fmt.Errorf("error fetching limits: %v", err)
+	}
+	limits := make([]orgLimit, 0, len(raw))
+	for name, l := range raw {
+		limits = append(limits, orgLimit{Name: name, Max: l.Max, Remaining: l.Remaining})
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		if (limits[i].Name == dailyAPIRequests) != (limits[j].Name == dailyAPIRequests) {
+			return limits[i].Name == dailyAPIRequests
+		}
+		return limits[i].Name < limits[j].Name
+	})
+	return limits, nil
+}
+
+func writeLimits(out io.Writer, limits []orgLimit) {
+	if len(limits) > 0 && limits[0].Name == dailyAPIRequests {
+		fmt.Fprintf(out, "Daily API requests: %d of %d remaining\n\n", limits[0].Remaining, limits[0].Max)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LIMIT\tUSED\tMAX\tREMAINING")
+	for _, l := range limits {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", l.Name, l.used(), l.Max, l.Remaining)
+	}
+	w.Flush()
+}
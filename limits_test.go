@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/data/"+salesforceAPIVersion+"/limits" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+			"DataStorageMB": {"Max": 5, "Remaining": 4},
+			"DailyApiRequests": {"Max": 15000, "Remaining": 14250, "Ant Migration Tool": {"Max": 0, "Remaining": 0}},
+			"ConcurrentAsyncGetReportInstances": {"Max": 200, "Remaining": 200}
+		}`))
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{InstanceURL: server.URL, AccessToken: "access"}
+	limits, err := fetchLimits(func(path string, out interface{}) error { return getOrgJSON(org, path, out) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 3 || limits[0].Name != dailyAPIRequests || limits[1].Name != "ConcurrentAsyncGetReportInstances" || limits[2].Name != "DataStorageMB" {
+		t.Fatalf("Unexpected limits %+v", limits)
+	}
+	if limits[0].Max != 15000 || limits[0].Remaining != 14250 || limits[0].used() != 750 {
+		t.Errorf("Unexpected API request limit %+v", limits[0])
+	}
+}
+
+func TestFetchLimitsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{InstanceURL: server.URL, AccessToken: "access"}
+	if _, err := fetchLimits(func(path string, out interface{}) error { return getOrgJSON(org, path, out) }); err == nil {
+		t.Error("Expected an error when the limits cannot be read")
+	}
+}
+
+func TestWriteLimits(t *testing.T) {
+	var out bytes.Buffer
+	writeLimits(&out, []orgLimit{
+		{Name: dailyAPIRequests, Max: 15000, Remaining: 14250},
+		{Name: "DataStorageMB", Max: 5, Remaining: 4},
+	})
+	got := out.String()
+	if !strings.HasPrefix(got, "Daily API requests: 14250 of 15000 remaining\n\n") {
+		t.Errorf("Expected the daily API requests first, got %q", got)
+	}
+	if !strings.Contains(got, "DailyApiRequests  750   15000  14250") || !strings.Contains(got, "DataStorageMB     1     5      4") {
+		t.Errorf("Unexpected table %q", got)
+	}
+}
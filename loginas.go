@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var flagLoginAsAlias string
+
+var loginAsCmd = &cobra.Command{
+	Use:   "login-as <username|userId>",
+	Short: "Print a URL that logs an admin in as another user",
+	Long: `Look up a user in the org saved under --alias and print a URL that opens
+a browser session as that user, using the admin's stored session.
+
+The admin needs "Login As" access to the user: either the org allows
+administrators to log in as any user, or the user has granted access.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runLoginAs,
+}
+
+func init() {
+	loginAsCmd.Flags().StringVarP(&flagLoginAsAlias, "alias", "a", "", "Alias of the admin's stored org (default: the default org)")
+
+	rootCmd.AddCommand(loginAsCmd)
+}
+
+// orgUser is the part of a User record needed to log in as them
+type orgUser struct {
+	ID       string `json:"Id"`
+	Username string `json:"Username"`
+	Name     string `json:"Name"`
+}
+
+func runLoginAs(cmd *cobra.Command, args []string) {
+	store, org, err := useStoredOrg(flagLoginAsAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	user, err := findOrgUser(store, org, args[0])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	loginURL, err := loginAsURL(org, user.ID)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if outputFormat(outputText) == outputJSON {
+		result := struct {
+			URL      string `json:"url"`
+			UserID   string `json:"user_id"`
+			Username string `json:"username"`
+		}{loginURL, user.ID, user.Username}
+		if err := writeJSON(result); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+	} else {
+		infof("Logging in as %s (%s)", user.Name, user.Username)
+		fmt.Println(loginURL)
+	}
+	if err := authDeps.Browser.Open(loginURL); err != nil {
+		log.Printf("Warning: could not open browser: %v", err)
+	}
+}
+
+// findOrgUser resolves a username or user ID to an active user
+func findOrgUser(store TokenStore, org *StoredOrg, who string) (*orgUser, error) {
+	field := "Username"
+	if isUserID(who) {
+		field = "Id"
+	}
+	soql := fmt.Sprintf("SELECT Id, Username, Name FROM User WHERE %s = '%s' AND IsActive = true", field, escapeSOQL(who))
+
+	var result struct {
+		Records []orgUser `json:"records"`
+	}
+	query := "/services/data/" + salesforceAPIVersion + "/query?q=" + url.QueryEscape(soql)
+	if err := orgGetJSON(store, org, query, &result); err != nil {
+		return nil, fmt.Errorf("error looking up user: %v", err)
+	}
+	if len(result.Records) == 0 {
+		return nil, fmt.Errorf("no active user %q in org %q", who, org.Alias)
+	}
+	return &result.Records[0], nil
+}
+
+// loginAsURL builds a frontdoor URL that starts a session with the admin's
+// access token and continues to the Login As servlet for the user
+func loginAsURL(org *StoredOrg, userID string) (string, error) {
+	if org.OrgID == "" {
+		return "", fmt.Errorf("org %q has no org ID recorded", org.Alias)
+	}
+	su := url.Values{}
+	su.Set("oid", org.OrgID)
+	su.Set("suorgadminid", userID)
+	su.Set("retURL", "/")
+	su.Set("targetURL", "/")
+
+	return frontdoorURL(org, "/servlet/servlet.su?"+su.Encode()), nil
+}
+
+// isUserID reports whether s looks like a 15 or 18 character User ID
+func isUserID(s string) bool {
+	return (len(s) == 15 || len(s) == 18) && strings.HasPrefix(s, "005") && !strings.ContainsAny(s, "@.")
+}
+
+// escapeSOQL escapes a value for a single-quoted SOQL string literal
+func escapeSOQL(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
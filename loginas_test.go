@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoginAsURL(t *testing.T) {
+	org := &StoredOrg{Alias: "prod", OrgID: "00Dorg", AccessToken: "admin-session", InstanceURL: "https://acme.my.salesforce.com/"}
+	raw, err := loginAsURL(org, "005target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "acme.my.salesforce.com" || u.Path != "/secur/frontdoor.jsp" || u.Query().Get("sid") != "admin-session" {
+		t.Errorf("Unexpected frontdoor URL %s", raw)
+	}
+	ret, err := url.Parse(u.Query().Get("retURL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Path != "/servlet/servlet.su" || ret.Query().Get("oid") != "00Dorg" || ret.Query().Get("suorgadminid") != "005target" {
+		t.Errorf("Unexpected Login As URL %s", ret)
+	}
+
+	if _, err := loginAsURL(&StoredOrg{Alias: "bare"}, "005target"); err == nil {
+		t.Error("Expected an org without an org ID to be rejected")
+	}
+}
+
+func TestFindOrgUser(t *testing.T) {
+	var soql string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		soql = r.URL.Query().Get("q")
+		w.Write([]byte(`{"records": [{"Id": "005000000000001AAA", "Username": "o'neil@acme.com", "Name": "Pat O'Neil"}]}`))
+	}))
+	defer server.Close()
+
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	org := &StoredOrg{Alias: "prod", AccessToken: "access", InstanceURL: server.URL}
+
+	user, err := findOrgUser(store, org, "o'neil@acme.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "005000000000001AAA" {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if !strings.Contains(soql, `Username = 'o\'neil@acme.com'`) {
+		t.Errorf("Username not escaped in query %q", soql)
+	}
+
+	if _, err := findOrgUser(store, org, "005000000000001AAA"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(soql, "Id = '005000000000001AAA'") {
+		t.Errorf("Expected a lookup by ID, got %q", soql)
+	}
+}
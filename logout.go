@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var flagLogoutForce bool
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout [alias]",
+	Short: "Revoke a stored org's tokens and remove it from the token store",
+	Long: `Revoke the refresh and access tokens of a stored org at its
+/services/oauth2/revoke endpoint, then remove the org from the token store.
+Without an alias the default org set with "org use" is logged out.
+
+Tokens that have already expired or been revoked are not an error. If the
+refresh token cannot be revoked, for example because the org is unreachable,
+the org is kept so logout can be retried; --force removes it anyway.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runLogout,
+}
+
+func init() {
+	logoutCmd.Flags().BoolVarP(&flagLogoutForce, "force", "f", false, "Remove the org from the token store even if revoking fails")
+
+	rootCmd.AddCommand(logoutCmd)
+}
+
+func runLogout(cmd *cobra.Command, args []string) {
+	alias := ""
+	if len(args) == 1 {
+		alias = args[0]
+	}
+	store, org, err := openStoredOrg(alias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	if err := logoutOrg(store, org, flagLogoutForce); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	infof("Logged out of %q", org.Alias)
+}
+
+// logoutOrg revokes the org's tokens and deletes it from the store. The
+// refresh token is revoked first since that also ends every session issued
+// from it; only a failure to revoke it keeps the org, unless force is set.
+// The outcome is audited.
+func logoutOrg(store TokenStore, org *StoredOrg, force bool) error {
+	err := revokeOrg(store, org, force)
+	recordAuthEvent(eventRevoke, org, err)
+	return err
+}
+
+func revokeOrg(store TokenStore, org *StoredOrg, force bool) error {
+	domain := refreshDomain(org)
+	if org.RefreshToken != "" {
+		if err := authDeps.Revoker.Revoke(domain, org.RefreshToken); err != nil && !isTokenAlreadyInvalid(err) {
+			if !force {
+				return fmt.Errorf("could not revoke the refresh token for %q, so it was kept (use --force to remove it anyway): %v", org.Alias, err)
+			}
+			log.Printf("Warning: could not revoke the refresh token for %q: %v", org.Alias, err)
+		}
+	}
+	if org.AccessToken != "" {
+		if err := authDeps.Revoker.Revoke(domain, org.AccessToken); err != nil && !isTokenAlreadyInvalid(err) {
+			log.Printf("Warning: could not revoke the access token for %q: %v", org.Alias, err)
+		}
+	}
+	if err := store.Delete(org.Alias); err != nil {
+		return fmt.Errorf("error removing org %q from the token store: %v", org.Alias, err)
+	}
+	return nil
+}
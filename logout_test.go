@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLogoutOrg(t *testing.T) {
+	revoker := withFakeRevoker(t)
+	store, err := openTokenStore(storeTypeFile, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	org := &StoredOrg{Alias: "prod", Domain: "acme.my.salesforce.com", AccessToken: "access1", RefreshToken: "refresh1"}
+	if err := store.Put(org); err != nil {
+		t.Fatal(err)
+	}
+
+	// A revoke that fails for another reason than an invalid token keeps
+	// the org so logout can be retried
+	revoker.err = errors.New("connection refused")
+	if err := logoutOrg(store, org, false); err == nil {
+		t.Fatal("Expected logout to fail when the refresh token cannot be revoked")
+	}
+	if _, err := store.Get("prod"); err != nil {
+		t.Errorf("Expected the org to be kept, got %v", err)
+	}
+
+	// Tokens that are already invalid are as good as revoked
+	revoker.revoked, revoker.err = nil, &revokeStatusError{Status: 400}
+	if err := logoutOrg(store, org, false); err != nil {
+		t.Fatalf("logoutOrg failed: %v", err)
+	}
+	if len(revoker.revoked) != 2 || revoker.revoked[0] != "refresh1" || revoker.revoked[1] != "access1" {
+		t.Errorf("Expected the refresh then the access token to be revoked, got %v", revoker.revoked)
+	}
+	if _, err := store.Get("prod"); !errors.Is(err, errOrgNotFound) {
+		t.Errorf("Expected the org to be removed, got %v", err)
+	}
+
+	if err := store.Put(org); err != nil {
+		t.Fatal(err)
+	}
+	revoker.err = errors.New("connection refused")
+	if err := logoutOrg(store, org, true); err != nil {
+		t.Fatalf("logoutOrg with force failed: %v", err)
+	}
+	if _, err := store.Get("prod"); !errors.Is(err, errOrgNotFound) {
+		t.Errorf("Expected --force to remove the org, got %v", err)
+	}
+}
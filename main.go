@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
@@ -11,12 +10,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
-	"syscall"
 	"time"
 
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 // TokenResponse represents the JSON response structure
@@ -24,6 +21,20 @@ type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	InstanceURL  string `json:"instance_url"`
+	// Scope is the space-separated list of scopes the token was granted
+	Scope string `json:"scope,omitempty"`
+
+	// ExpiresAt is when the access token expires and ExpiresIn the seconds
+	// left until then, from expires_in or the org's session timeout
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn int64      `json:"expires_in,omitempty"`
+
+	// IDToken and its claims are only set with --oidc
+	IDToken       string         `json:"id_token,omitempty"`
+	IDTokenClaims *idTokenClaims `json:"id_token_claims,omitempty"`
+
+	// Session cookies returned by the hybrid flow
+	*HybridSession
 }
 
 // SalesforceOAuthResponse represents the OAuth response from Salesforce
@@ -35,6 +46,19 @@ type SalesforceOAuthResponse struct {
 	TokenType    string `json:"token_type"`
 	IssuedAt     string `json:"issued_at"`
 	Signature    string `json:"signature"`
+	Scope        string `json:"scope"`
+
+	// IssuedTokenType is only returned by token exchange grants
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+
+	// ExpiresIn is the token lifetime in seconds. Salesforce only returns it
+	// for some grants; otherwise a token lasts the org's session timeout.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+
+	// IDToken is returned when the openid scope was granted
+	IDToken string `json:"id_token,omitempty"`
+
+	HybridSession
 }
 
 const (
@@ -43,14 +67,15 @@ const (
 )
 
 var (
-	authCode     string
-	authError    string
-	serverDone   = make(chan bool)
-	clientID     string
-	clientSecret string
-	state        string
-	redirectURI  string
-	port         string
+	authCode  string
+	authError string
+	// authOAuthError is set when Salesforce redirects back with an error
+	authOAuthError *oauthError
+	serverDone     = make(chan bool)
+	clientID       string
+	state          string
+	redirectURI    string
+	port           string
 
 	// CLI flags
 	flagClientID     string
@@ -58,6 +83,11 @@ var (
 	flagPort         string
 	flagDomain       string
 	flagQuiet        bool
+	flagStore        string
+	flagAlias        string
+	flagBind         string
+	flagRedirectURI  string
+	flagContainer    bool
 )
 
 var rootCmd = &cobra.Command{
@@ -65,7 +95,9 @@ var rootCmd = &cobra.Command{
 	Short: "Salesforce OAuth2 Authentication CLI",
 	Long: `A command-line tool that authenticates with Salesforce using OAuth2
 and returns access tokens, refresh tokens, and instance URLs in JSON format.`,
-	Run: runAuth,
+	PersistentPreRun:  loadSettings,
+	PersistentPostRun: reportCommandSuccess,
+	Run:               runAuth,
 }
 
 func init() {
@@ -74,140 +106,401 @@ func init() {
 	redirectURI = "http://localhost:" + defaultPort + "/callback"
 
 	rootCmd.Flags().StringVarP(&flagClientID, "client-id", "c", "", "Salesforce Client ID (Consumer Key)")
-	rootCmd.Flags().StringVarP(&flagClientSecret, "client-secret", "s", "", "Salesforce Client Secret (Consumer Secret)")
+	rootCmd.Flags().StringVarP(&flagClientSecret, "client-secret", "s", "", "Salesforce Client Secret (Consumer Secret); - reads it from stdin")
 	rootCmd.Flags().StringVarP(&flagPort, "port", "p", defaultPort, "Port for OAuth callback server")
 	rootCmd.Flags().StringVarP(&flagDomain, "domain", "d", defaultSalesforceDomain, "Salesforce domain (e.g., company.my.salesforce.com)")
-	rootCmd.Flags().BoolVarP(&flagQuiet, "quiet", "q", false, "Suppress informational output")
+	rootCmd.PersistentFlags().BoolVarP(&flagQuiet, "quiet", "q", false, "Suppress informational output")
+	rootCmd.PersistentFlags().BoolVarP(&flagVerbose, "verbose", "v", false, "Print diagnostic output to stderr")
+	rootCmd.PersistentFlags().BoolVar(&flagNoColor, "no-color", false, "Don't colour output (also set by NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&flagDebug, "debug", false, "Also log every HTTP request, its status and timing, with credentials masked (implies --verbose)")
+	rootCmd.PersistentFlags().StringVarP(&flagOutput, "output", "o", "", "Output format for results: json, text, or for tokens json-compact, yaml, env, shell, table and sfdx-url")
+	rootCmd.PersistentFlags().BoolVar(&flagTokenOnly, "token-only", false, "Print only the access token, for $(...) (with a login, refresh or --grant asset-token)")
+	rootCmd.PersistentFlags().StringVar(&flagOut, "out", "", "Write token output to this file (mode 0600) instead of stdout")
+	rootCmd.PersistentFlags().BoolVar(&flagGitHubActions, "github-actions", false, "Mask tokens and write them to $GITHUB_OUTPUT and $GITHUB_ENV instead of printing them")
+	rootCmd.PersistentFlags().StringVar(&flagShell, "shell", "", "Shell for --output shell: bash, zsh, fish or powershell (default: from $SHELL)")
+	rootCmd.PersistentFlags().StringVar(&flagFilter, "filter", "", "Extract from the JSON output with a jq-style path (e.g. .access_token)")
+	rootCmd.PersistentFlags().BoolVar(&flagSandbox, "sandbox", false, "Log in to a sandbox, at "+sandboxSalesforceDomain+" (short for --environment sandbox)")
+	rootCmd.PersistentFlags().StringVar(&flagEnvironment, "environment", "", "Kind of org, setting --domain: prod ("+defaultSalesforceDomain+"), sandbox ("+sandboxSalesforceDomain+") or custom (give --domain)")
+	rootCmd.PersistentFlags().StringVar(&flagProfile, "profile", "", "Named profile from config.json to use (default: from "+profileEnv+")")
+	rootCmd.PersistentFlags().StringVar(&flagLang, "lang", "", "Language for prompts and messages (default: from "+langEnv+" or the system locale)")
+	rootCmd.PersistentFlags().DurationVar(&flagMaintenanceWait, "maintenance-wait", 0, "Keep retrying for this long while the org is in maintenance (e.g. 30m)")
+	rootCmd.PersistentFlags().IntVar(&flagRetries, "retries", defaultRetries, "Times to retry a token request after a network error, 429 or 5xx response, or an API request after a 429")
+	rootCmd.PersistentFlags().DurationVar(&flagRetryBackoff, "retry-backoff", defaultRetryBackoff, "Delay before the first retry, doubled for each retry after it")
+	rootCmd.PersistentFlags().StringVar(&flagProxy, "proxy", "", "Proxy URL for all requests, instead of HTTPS_PROXY/HTTP_PROXY (NO_PROXY still applies)")
+	rootCmd.PersistentFlags().StringVar(&flagCABundle, "ca-bundle", "", "PEM file of extra CA certificates to trust, e.g. a TLS-intercepting proxy's (default: from "+caBundleEnv+")")
+	rootCmd.PersistentFlags().BoolVar(&flagInsecureSkipVerify, "insecure-skip-verify", false, "Do not verify TLS certificates (unsafe; prefer --ca-bundle)")
+	rootCmd.MarkFlagsMutuallyExclusive("ca-bundle", "insecure-skip-verify")
+	rootCmd.PersistentFlags().StringVar(&flagProxyAuth, "proxy-auth", "", "Proxy authentication: basic, ntlm or negotiate (default: from "+proxyAuthEnv+")")
+	rootCmd.PersistentFlags().StringVar(&flagRecord, "record", "", "Record all HTTP exchanges, secrets scrubbed, to this HAR file (or JSON Lines file, if it ends in .jsonl)")
+	rootCmd.PersistentFlags().StringVar(&flagReplay, "replay", "", "Answer HTTP requests from this HAR or .jsonl file instead of the network")
+	rootCmd.PersistentFlags().BoolVar(&flagNoBrowser, "no-browser", false, "Only print URLs to open instead of launching the default browser")
+	rootCmd.PersistentFlags().StringVar(&flagStore, "store", storeTypeFile, "Token store backend (file, sqlite, bolt, keychain, vault, azure-keyvault, none)")
+	rootCmd.PersistentFlags().StringVar(&flagVaultPath, "vault-path", "", "Vault KV v2 path to keep orgs under with --store vault (e.g. secret/data/sfdc/prod)")
+	rootCmd.PersistentFlags().StringVar(&flagVaultAuth, "vault-auth", "", "Vault auth method, token or approle (default: token if one is set)")
+	rootCmd.PersistentFlags().StringVar(&flagAzureVaultURL, "azure-vault-url", "", "Azure Key Vault to keep orgs in with --store azure-keyvault (e.g. https://my-vault.vault.azure.net)")
+	rootCmd.PersistentFlags().StringVar(&flagOPRefreshToken, "op-refresh-token", "", "1Password field to save new refresh tokens to, as op://vault/item/field")
+	rootCmd.Flags().StringVarP(&flagAlias, "alias", "a", "", "Alias to save the org under in the token store (defaults to the org ID)")
+	rootCmd.Flags().StringVar(&flagBind, "bind", "", "Address for the callback server to listen on (defaults to the redirect URI's port)")
+	rootCmd.Flags().StringVar(&flagRedirectURI, "redirect-uri", "", "Redirect URI to advertise to Salesforce (defaults to http://localhost:<port>/callback)")
+	rootCmd.Flags().StringVar(&flagCallbackHost, "callback-host", defaultCallbackHost, "Host of the default redirect URI (e.g. 127.0.0.1)")
+	rootCmd.Flags().StringVar(&flagCallbackPath, "callback-path", defaultCallbackPath, "Path of the default redirect URI (e.g. /oauth/done)")
+	rootCmd.Flags().BoolVar(&flagCallbackTLS, "callback-tls", false, "Serve the callback over HTTPS with a generated self-signed certificate")
+	rootCmd.Flags().StringVar(&flagTLSCert, "tls-cert", "", "PEM certificate to serve the HTTPS callback with, instead of a generated one")
+	rootCmd.Flags().StringVar(&flagTLSKey, "tls-key", "", "PEM private key for --tls-cert")
+	rootCmd.Flags().StringVar(&flagSuccessPage, "success-page", "", "HTML template for the page shown in the browser after logging in")
+	rootCmd.Flags().StringVar(&flagSuccessRedirect, "success-redirect", "", "Send the browser to this URL after logging in, instead of showing the success page")
+	rootCmd.MarkFlagsMutuallyExclusive("success-page", "success-redirect")
+	rootCmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+	rootCmd.MarkFlagsMutuallyExclusive("redirect-uri", "callback-host")
+	rootCmd.MarkFlagsMutuallyExclusive("redirect-uri", "callback-path")
+	rootCmd.Flags().StringVar(&flagGrant, "grant", grantAuthorizationCode, "OAuth flow to run (authorization-code, hybrid, implicit, asset-token)")
+	rootCmd.Flags().StringSliceVar(&flagScopes, "scopes", nil, "OAuth scopes to request, repeated or comma-separated (default: full refresh_token)")
+	rootCmd.Flags().BoolVar(&flagOIDC, "oidc", false, "Request the openid scope and verify and output the ID token")
+	rootCmd.Flags().BoolVar(&flagPKCE, "pkce", true, "Use PKCE (S256) with the authorization-code grant")
+	rootCmd.Flags().StringVar(&flagActorTokenFile, "actor-token-file", "", "File holding the actor token JWT describing the asset (with --grant asset-token)")
+	rootCmd.Flags().StringVar(&flagRegisterSfdx, "register-sfdx", "", "Register the org with the sf CLI under this alias, in ~/.sfdx")
+	rootCmd.Flags().BoolVar(&flagSetDefaultSfOrg, "set-default-sf-org", false, "Set the org as target-org in the sf CLI project's .sf/config.json")
+	rootCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Print the authorization URL and token request a login would send, secrets masked, without running it")
+	rootCmd.Flags().BoolVar(&flagManual, "manual", false, "Paste the redirect URL or code back in instead of running the callback server")
+	rootCmd.Flags().BoolVar(&flagContainer, "container", false, "Container defaults: listen on 0.0.0.0, advertise localhost, never open a browser (also set by "+containerEnv+")")
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	defer handlePanic()
+	log.SetOutput(newLogWriter())
+	stop := watchSignals()
+	defer stop()
+	addPluginCommands(rootCmd, os.Getenv("PATH"))
+
+	if err := rootCmd.ExecuteContext(runCtx); err != nil {
 		log.Fatal(err)
 	}
 }
 
 func runAuth(cmd *cobra.Command, args []string) {
-	if !flagQuiet {
-		fmt.Println("Salesforce OAuth2 Authentication CLI")
-		fmt.Println("====================================")
+	if err := checkGrant(flagGrant); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if flagGrant == grantAssetToken {
+		if flagDryRun {
+			log.Fatalf("Error: --dry-run cannot be used with --grant %s", grantAssetToken)
+		}
+		runAssetTokenGrant()
+		return
 	}
 
-	// Use flag values if provided, otherwise prompt
-	clientID = flagClientID
-	clientSecret = flagClientSecret
+	if !flagQuiet && !flagDryRun {
+		fmt.Fprintln(os.Stderr, banner())
+	}
 
-	if clientID == "" || clientSecret == "" {
-		if err := getClientCredentials(); err != nil {
+	// Use flag values if provided, otherwise prompt. The secret is only held
+	// in a wipeable buffer for the duration of the flow.
+	clientID = flagClientID
+	clientSecret := newSecret([]byte(flagClientSecret))
+	flagClientSecret = ""
+	defer func() { clientSecret.Wipe() }()
+
+	// An explicitly empty --client-secret means the app needs none (PKCE)
+	noSecret := pkceEnabled() && cmd.Flags().Changed("client-secret")
+	if !flagDryRun && (clientID == "" || (clientSecret.Empty() && !noSecret)) {
+		clientSecret.Wipe()
+		var err error
+		if clientSecret, err = getClientCredentials(); err != nil {
 			log.Fatalf("Error getting client credentials: %v", err)
 		}
 	}
 
-	// Update port if specified
-	if flagPort != defaultPort {
-		port = ":" + flagPort
-		redirectURI = "http://localhost:" + flagPort + "/callback"
+	// Work out where to listen and which redirect URI to advertise; behind a
+	// port mapping these differ
+	if !cmd.Flags().Changed("container") && inContainer() {
+		flagContainer = true
 	}
+	callback, err := resolveCallback(flagPort, flagBind, flagRedirectURI, flagContainer)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	port = callback.Listen
+	redirectURI = callback.RedirectURI
 
 	// Use domain flag (defaults to login.salesforce.com)
 	domain := flagDomain
 
-	// Generate state parameter for security
-	state = generateState()
+	if flagDryRun {
+		if err := runDryRun(callback, domain, clientSecret); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
 
-	// Start local server for OAuth callback
-	server := &http.Server{Addr: port}
-	http.HandleFunc("/callback", handleCallback)
+	tokenResponse, err := runAuthFlow(cmd.Context(), authDeps, callback, domain, clientSecret)
+	if err != nil {
+		clientSecret.Wipe()
+		failLogin(err)
+	}
+	completeLogin(domain, tokenResponse, clientSecret)
+}
 
-	go func() {
-		if !flagQuiet {
-			fmt.Printf("Starting local server on %s for OAuth callback...\n", port)
-		}
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
+// failLogin reports a failed login with any Connected App policy guidance
+// and exits, with exitMaintenance if the org is in maintenance and
+// exitCancelled after Ctrl-C
+func failLogin(err error) {
+	recordAuthEvent(eventLogin, &StoredOrg{Alias: flagAlias}, err)
+	if isCancelled(err) {
+		exitOnCancel()
+	}
+	msg := fmt.Sprintf("Authentication failed: %v", err)
+	if steps := policyGuidance(err); steps != "" {
+		msg += "\n\n" + steps
+	}
+	if isMaintenanceError(err) {
+		log.Print(msg)
+		os.Exit(exitMaintenance)
+	}
+	log.Fatal(msg)
+}
 
-	// Give server time to start
-	time.Sleep(100 * time.Millisecond)
+// completeLogin saves a successful login to the token store and prints the
+// tokens, whichever flow produced them. The client secret, nil if the flow
+// has none, only goes into --output sfdx-url.
+func completeLogin(domain string, tokenResponse *SalesforceOAuthResponse, clientSecret *secret) {
+	// Output the result as JSON unless text was asked for
+	result := TokenResponse{
+		AccessToken:  tokenResponse.AccessToken,
+		RefreshToken: tokenResponse.RefreshToken,
+		InstanceURL:  tokenResponse.InstanceURL,
+		Scope:        tokenResponse.Scope,
+	}
+	issued, _ := parseIssuedAt(tokenResponse.IssuedAt)
+	result.setExpiry(issued, tokenResponse.ExpiresIn, authDeps.Clock.Now())
+	if flagGrant == grantHybrid {
+		result.HybridSession = &tokenResponse.HybridSession
+	}
+	if flagOIDC {
+		claims, err := verifyIDToken(domain, clientID, nonce, tokenResponse.IDToken)
+		if err != nil {
+			log.Fatalf("Error verifying ID token: %v", err)
+		}
+		result.IDToken, result.IDTokenClaims = tokenResponse.IDToken, claims
+	}
 
-	// Build authorization URL
-	authURL := buildAuthURL(domain)
-	if !flagQuiet {
-		fmt.Printf("\nPlease open the following URL in your browser to authenticate:\n%s\n", authURL)
-		fmt.Println("\nWaiting for OAuth callback...")
+	var output []byte
+	var err error
+	if format := outputFormat(outputJSON); format == outputSfdxURL {
+		output, err = sfdxAuthURL(clientID, clientSecret, tokenResponse.RefreshToken, tokenResponse.InstanceURL)
+	} else {
+		output, err = formatTokenResponse(&result, format)
+	}
+	if err != nil {
+		log.Fatalf("Error formatting output: %v", err)
 	}
 
-	// Wait for callback
-	<-serverDone
+	org := newStoredOrg(flagAlias, domain, tokenResponse)
+	enriched := false
+	if callbackOrg != nil && callbackOrg.AccessToken == org.AccessToken {
+		// The success page already looked the org up
+		org, enriched = callbackOrg, true
+	}
+	if !enriched && (flagStore != storeTypeNone || flagSetDefaultSfOrg || flagRegisterSfdx != "") {
+		if err := enrichOrg(org); err != nil {
+			log.Printf("Warning: could not fetch org details: %v", err)
+		}
+	}
 
-	// Shutdown server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+	// Persist the org so later runs can reuse the refresh token
+	if flagStore != storeTypeNone {
+		// StoredOrg holds the client secret as a string, which cannot be
+		// wiped: this copy is the known exception to keeping secrets in
+		// wipeable buffers, so it is made only for the write and dropped
+		// from the org straight after
+		if storeKeepsClientSecret() && !clientSecret.Empty() {
+			org.ClientSecret = string(clientSecret.Bytes())
+		}
+		err := saveToStore(org)
+		org.ClientSecret = ""
+		if err != nil {
+			log.Printf("Warning: could not save org to token store: %v", err)
+		}
+	}
+	if err := writeOPRefreshToken(tokenResponse.RefreshToken); err != nil {
+		log.Printf("Warning: could not save the refresh token to 1Password: %v", err)
+	}
+	recordAuthEvent(eventLogin, org, nil)
+	if flagRegisterSfdx != "" {
+		if err := registerSfdxOrg(org, clientSecret, flagRegisterSfdx); err != nil {
+			log.Printf("Warning: could not register the org with the sf CLI: %v", err)
+		}
+	}
+	if flagSetDefaultSfOrg {
+		if err := setDefaultSfOrg(org); err != nil {
+			log.Printf("Warning: could not set the sf CLI target org: %v", err)
+		}
 	}
 
-	if authError != "" {
-		log.Fatalf("OAuth error: %s", authError)
+	successf("%s", tr(msgAuthSuccessful, nil))
+	if err := writeTokenOutput(output); err != nil {
+		log.Fatalf("Error writing output: %v", err)
 	}
+}
 
-	if authCode == "" {
-		log.Fatal("No authorization code received")
+// formatTokenResponse renders the login result, newline-terminated, into a
+// buffer the caller wipes once it is written
+func formatTokenResponse(result *TokenResponse, format string) ([]byte, error) {
+	if flagTokenOnly {
+		return tokenOnlyOutput(result.AccessToken), nil
+	}
+	if format == outputText {
+		out := fmt.Appendf(nil, "access_token: %s\nrefresh_token: %s\ninstance_url: %s\n", result.AccessToken, result.RefreshToken, result.InstanceURL)
+		if result.Scope != "" {
+			out = fmt.Appendf(out, "scope: %s\n", result.Scope)
+		}
+		if result.ExpiresAt != nil {
+			out = fmt.Appendf(out, "expires_at: %s\nexpires_in: %d\n", result.ExpiresAt.Format(time.RFC3339), result.ExpiresIn)
+		}
+		if result.IDTokenClaims != nil {
+			out = fmt.Appendf(out, "id_token: %s\nid_token_sub: %s\n", result.IDToken, result.IDTokenClaims.Subject)
+		}
+		if result.HybridSession != nil {
+			out = result.HybridSession.appendText(out)
+		}
+		return out, nil
 	}
+	return formatOutput(result, format)
+}
 
-	// Exchange authorization code for tokens
-	tokenResponse, err := exchangeCodeForTokens(authCode, domain)
+// loadSettings checks the global flags and applies config.json before any
+// command runs
+func loadSettings(cmd *cobra.Command, args []string) {
+	if err := checkOutputFlags(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := checkRetryFlags(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := setupProxy(); err != nil {
+		log.Fatalf("Error configuring proxy: %v", err)
+	}
+	if err := setupTLS(); err != nil {
+		log.Fatalf("Error configuring TLS: %v", err)
+	}
+	if err := setupHAR(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	setupDebugTransport()
+	setupCancelTransport()
+	if flagNoBrowser {
+		authDeps.Browser = manualBrowser{}
+	}
+	if err := applyEnvironment(cmd); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := applyCredentialEnv(cmd); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := resolveStdinSecrets(cmd); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := resolveSecretReferences(cmd); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if flagProfile == "" {
+		flagProfile = os.Getenv(profileEnv)
+	}
+	dir, err := defaultStoreDir()
 	if err != nil {
-		log.Fatalf("Error exchanging code for tokens: %v", err)
+		return
+	}
+	cfg, err := loadProfileConfig(dir, flagProfile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	verbosef("Using config directory %s", dir)
+	if flagProfile != "" {
+		verbosef("Using profile %q", flagProfile)
 	}
+	applyConfig(cmd, cfg)
+	setupAuditLog(cmd, dir, cfg)
+	setupTelemetry(cmd, cfg)
+	if err := checkEnvironmentDomain(cmd); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
 
-	// Output the result as JSON
-	result := TokenResponse{
-		AccessToken:  tokenResponse.AccessToken,
-		RefreshToken: tokenResponse.RefreshToken,
-		InstanceURL:  tokenResponse.InstanceURL,
+// openConfiguredStore opens the token store selected by --store or config.json
+func openConfiguredStore() (TokenStore, error) {
+	if flagStore == storeTypeNone {
+		return nil, fmt.Errorf("no token store configured (--store %s)", storeTypeNone)
 	}
+	dir, err := defaultStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	verbosef("Opening the %s token store in %s", flagStore, dir)
+	return openTokenStore(flagStore, dir)
+}
 
-	jsonOutput, err := json.MarshalIndent(result, "", "  ")
+// storeKeepsClientSecret reports whether the configured store saves the
+// client secret with each org, as the vault and Azure Key Vault stores do so
+// refreshes need not ask for it
+func storeKeepsClientSecret() bool {
+	return flagStore == storeTypeVault || flagStore == storeTypeAzure
+}
+
+func saveToStore(org *StoredOrg) error {
+	store, err := openConfiguredStore()
 	if err != nil {
-		log.Fatalf("Error marshaling JSON: %v", err)
+		return err
 	}
+	defer store.Close()
 
-	if !flagQuiet {
-		fmt.Println("\nAuthentication successful!")
+	// Logging in again replaces the user's previous refresh token
+	previous, err := placeOrg(store, org, flagAlias != "")
+	if err != nil {
+		return err
+	}
+	if previous != nil && (previous.OrgID != org.OrgID || previous.UserID != org.UserID) {
+		log.Printf("Warning: replacing %q, which was saved for a different org or user", org.Alias)
 	}
-	fmt.Println(string(jsonOutput))
+	if err := store.Put(org); err != nil {
+		return err
+	}
+	infof("%s", tr(msgSavedOrg, map[string]interface{}{"Alias": org.Alias, "Store": flagStore}))
+	revokeSuperseded(previous, org)
+	return nil
 }
 
-func getClientCredentials() error {
-	reader := bufio.NewReader(os.Stdin)
-
+func getClientCredentials() (*secret, error) {
 	// Get Client ID
-	fmt.Print("Enter Salesforce Client ID: ")
-	clientIDInput, err := reader.ReadString('\n')
+	input, err := promptLine(tr(msgPromptClientID, nil))
 	if err != nil {
-		return fmt.Errorf("error reading client ID: %v", err)
+		return nil, fmt.Errorf("error reading client ID: %v", err)
 	}
-	clientID = strings.TrimSpace(clientIDInput)
+	clientID = input
 
 	if clientID == "" {
-		return fmt.Errorf("client ID cannot be empty")
+		return nil, fmt.Errorf("client ID cannot be empty")
 	}
 
-	// Get Client Secret (hidden input)
-	fmt.Print("Enter Salesforce Client Secret: ")
-	clientSecretBytes, err := term.ReadPassword(int(syscall.Stdin))
+	return readClientSecret()
+}
+
+// readClientSecret prompts for the client secret without echoing it
+func readClientSecret() (*secret, error) {
+	prompt := tr(msgPromptClientSecret, nil)
+	if pkceEnabled() {
+		prompt = tr(msgPromptClientSecretOptional, nil)
+	}
+	value, err := promptHidden(prompt)
 	if err != nil {
-		return fmt.Errorf("error reading client secret: %v", err)
+		return nil, fmt.Errorf("error reading client secret: %v", err)
 	}
-	clientSecret = strings.TrimSpace(string(clientSecretBytes))
-	fmt.Println() // New line after hidden input
+	clientSecret := newSecret(value)
 
-	if clientSecret == "" {
-		return fmt.Errorf("client secret cannot be empty")
+	// With PKCE the Connected App may not require a secret at all
+	if clientSecret.Empty() && !pkceEnabled() {
+		return nil, fmt.Errorf("client secret cannot be empty")
 	}
 
-	return nil
+	return clientSecret, nil
 }
 
 func generateState() string {
@@ -222,32 +515,30 @@ func generateState() string {
 }
 
 func getSalesforceAuthURL(domain string) string {
-	return fmt.Sprintf("https://%s/services/oauth2/authorize", domain)
+	return sfauth.AuthorizeEndpoint(domain)
 }
 
 func getSalesforceTokenURL(domain string) string {
-	return fmt.Sprintf("https://%s/services/oauth2/token", domain)
+	return sfauth.TokenEndpoint(domain)
 }
 
 func buildAuthURL(domain string) string {
-	params := url.Values{}
-	params.Add("response_type", "code")
-	params.Add("client_id", clientID)
-	params.Add("redirect_uri", redirectURI)
-	params.Add("state", state)
-	params.Add("scope", "full refresh_token")
-
-	return getSalesforceAuthURL(domain) + "?" + params.Encode()
+	return authDeps.AuthURL.AuthURL(domain, clientID, redirectURI, state)
 }
 
 func handleCallback(w http.ResponseWriter, r *http.Request) {
+	signalled := false
 	defer func() {
-		serverDone <- true
+		if !signalled {
+			serverDone <- true
+		}
 	}()
+	debugf("Callback %s", r.URL)
 
 	// Check for error parameter
 	if errorParam := r.URL.Query().Get("error"); errorParam != "" {
-		authError = fmt.Sprintf("%s: %s", errorParam, r.URL.Query().Get("error_description"))
+		authOAuthError = &oauthError{Code: errorParam, Description: r.URL.Query().Get("error_description")}
+		authError = authOAuthError.Error()
 		http.Error(w, "OAuth error occurred. Check your terminal.", http.StatusBadRequest)
 		return
 	}
@@ -268,47 +559,83 @@ func handleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Send success response
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(`
-		<html>
-			<body>
-				<h2>Authentication Successful!</h2>
-				<p>You can close this window and return to your terminal.</p>
-			</body>
-		</html>
-	`)); err != nil {
-		log.Printf("Error writing response: %v", err)
+	// Hold the response until the code has been exchanged, so the page can
+	// say who logged in, or that the exchange failed
+	results := callbackResult
+	signalled = true
+	serverDone <- true
+	select {
+	case data := <-results:
+		if data == nil {
+			http.Error(w, "Authentication failed. Check your terminal.", http.StatusBadGateway)
+			return
+		}
+		writeSuccessPage(w, r, data)
+	case <-time.After(callbackPageTimeout):
+		writeSuccessPage(w, r, newSuccessPageData())
 	}
 }
 
-func exchangeCodeForTokens(code, domain string) (*SalesforceOAuthResponse, error) {
-	data := url.Values{}
-	data.Set("grant_type", "authorization_code")
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("redirect_uri", redirectURI)
-	data.Set("code", code)
-
-	resp, err := http.PostForm(getSalesforceTokenURL(domain), data)
-	if err != nil {
-		return nil, fmt.Errorf("error making token request: %v", err)
+// exchangeCodeForTokens trades the authorization code for tokens with
+// sfauth.ExchangeCode
+func exchangeCodeForTokens(code, domain string, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	req := sfauth.CodeExchange{
+		GrantType:    codeGrantType(),
+		ClientID:     clientID,
+		ClientSecret: clientSecret.Bytes(),
+		RedirectURI:  redirectURI,
+		Code:         code,
+		CodeVerifier: codeVerifier,
 	}
-	defer func() {
-		if resp != nil && resp.Body != nil {
-			resp.Body.Close()
-		}
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token request failed with status: %d", resp.StatusCode)
-	}
+	// The instance is not known until the exchange succeeds
+	return withMaintenanceRetry("", func() (*SalesforceOAuthResponse, error) {
+		return sendToken(getSalesforceTokenURL(domain), req.GrantType, func(ctx context.Context) (*sfauth.Token, error) {
+			return sfauth.ExchangeCode(ctx, nil, domain, req)
+		})
+	})
+}
 
-	var tokenResp SalesforceOAuthResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, fmt.Errorf("error decoding token response: %v", err)
+// postTokenRequest sends a grant to the token endpoint, appending the client
+// secret when one is given
+func postTokenRequest(tokenURL string, data url.Values, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	// The secret is escaped straight into a pre-sized body that is wiped once
+	// the request has been sent
+	encoded := data.Encode()
+	body := make([]byte, 0, sfauth.FormBodyLen(encoded, "client_secret", clientSecret.Bytes()))
+	body = append(body, encoded...)
+	if !clientSecret.Empty() {
+		body = sfauth.AppendFormValue(body, "client_secret", clientSecret.Bytes())
 	}
+	defer wipeBytes(body)
 
-	return &tokenResp, nil
+	return postTokenBody(tokenURL, data.Get("grant_type"), body)
+}
+
+// postTokenBody posts an encoded form to the token endpoint with
+// sfauth.PostToken, for grants that append secrets of their own to the form
+func postTokenBody(tokenURL, grantType string, body []byte) (*SalesforceOAuthResponse, error) {
+	return sendToken(tokenURL, grantType, func(ctx context.Context) (*sfauth.Token, error) {
+		return sfauth.PostToken(ctx, nil, tokenURL, body)
+	})
+}
+
+// sendToken makes a token request through pkg/sfauth, retrying transient
+// failures with withRetry. The whole response is decoded, so fields
+// sfauth.Token has no place for, such as those of a hybrid session, are kept.
+func sendToken(tokenURL, grantType string, send func(ctx context.Context) (*sfauth.Token, error)) (*SalesforceOAuthResponse, error) {
+	return withRetry(func() (*SalesforceOAuthResponse, error) {
+		verbosef("POST %s (grant_type=%s)", tokenURL, grantType)
+		token, err := send(runCtx)
+		if err != nil {
+			return nil, err
+		}
+		defer wipeBytes(token.Raw)
+
+		var tokenResp SalesforceOAuthResponse
+		if err := json.Unmarshal(token.Raw, &tokenResp); err != nil {
+			return nil, fmt.Errorf("error decoding token response: %v", err)
+		}
+		return &tokenResp, nil
+	})
 }
@@ -242,7 +242,8 @@ func TestCLIFlags(t *testing.T) {
 		t.Error("domain flag should be defined")
 	}
 
-	quietFlag := flags.Lookup("quiet")
+	// --quiet is a persistent flag shared by every subcommand
+	quietFlag := rootCmd.PersistentFlags().Lookup("quiet")
 	if quietFlag == nil {
 		t.Error("quiet flag should be defined")
 	}
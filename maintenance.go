@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// exitMaintenance is the exit status when an org stays in maintenance,
+// EX_TEMPFAIL from sysexits.h, so scripts can tell it from a real failure
+const exitMaintenance = 75
+
+var (
+	flagMaintenanceWait time.Duration
+
+	// checkTrustStatus looks up the instance on Salesforce Trust when an org
+	// appears to be in maintenance ("check_trust" in config.json)
+	checkTrustStatus bool
+
+	// maintenanceSchedule is how long to wait before each retry; the last
+	// delay repeats. Sandbox refreshes and maintenance windows last minutes
+	// to hours, so it backs off much further than a transient error would.
+	maintenanceSchedule = []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 5 * time.Minute}
+	maintenanceSleep    = time.Sleep
+
+	trustStatusURL = "https://api.status.salesforce.com/v1/instances/%s/status"
+	trustClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+// isMaintenanceError reports whether a token endpoint failure looks like the
+// org being unavailable for maintenance or a sandbox refresh
+func isMaintenanceError(err error) bool {
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		return false
+	}
+	if oauthErr.Status == http.StatusServiceUnavailable {
+		return true
+	}
+	text := strings.ToLower(oauthErr.Code + " " + oauthErr.Description)
+	return strings.Contains(text, "unavailable") || strings.Contains(text, "maintenance")
+}
+
+// withMaintenanceRetry runs a token request, retrying on the maintenance
+// schedule while the org is unavailable for up to --maintenance-wait. The
+// instance, when known, is looked up on Trust if check_trust is set.
+func withMaintenanceRetry(instance string, call func() (*SalesforceOAuthResponse, error)) (*SalesforceOAuthResponse, error) {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		resp, err := call()
+		if err == nil || !isMaintenanceError(err) {
+			return resp, err
+		}
+
+		reason := "org appears to be in maintenance"
+		if checkTrustStatus && instance != "" {
+			if status, trustErr := trustStatus(instance); trustErr == nil {
+				reason += fmt.Sprintf(" (Trust status for %s: %s)", instance, status)
+			} else {
+				verbosef("Could not check Trust status for %s: %v", instance, trustErr)
+			}
+		}
+
+		delay := maintenanceSchedule[min(attempt, len(maintenanceSchedule)-1)]
+		if waited+delay > flagMaintenanceWait {
+			return nil, fmt.Errorf("%s: %w", reason, err)
+		}
+		infof("The %s; retrying in %s", reason, delay)
+		maintenanceSleep(delay)
+		waited += delay
+	}
+}
+
+// trustStatus returns the current Trust status of an instance, such as OK
+// or MAINTENANCE_CORE
+func trustStatus(instance string) (string, error) {
+	resp, err := trustClient.Get(fmt.Sprintf(trustStatusURL, url.PathEscape(instance)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("trust status request failed with status: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding trust status: %v", err)
+	}
+	return body.Status, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFakeSleep records maintenance retry delays instead of sleeping
+func withFakeSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var slept []time.Duration
+	originalSleep, originalWait := maintenanceSleep, flagMaintenanceWait
+	maintenanceSleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { maintenanceSleep, flagMaintenanceWait = originalSleep, originalWait })
+	return &slept
+}
+
+func TestIsMaintenanceError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&oauthError{Status: http.StatusServiceUnavailable}, true},
+		{&oauthError{Status: http.StatusBadRequest, Code: "server_error", Description: "Server unavailable"}, true},
+		{fmt.Errorf("wrapped: %w", &oauthError{Status: http.StatusServiceUnavailable}), true},
+		{&oauthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "expired access/refresh token"}, false},
+		{errors.New("error making token request: connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isMaintenanceError(tt.err); got != tt.want {
+			t.Errorf("isMaintenanceError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithMaintenanceRetry(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeSleep(t)
+	flagMaintenanceWait = 5 * time.Minute
+
+	calls := 0
+	resp, err := withMaintenanceRetry("", func() (*SalesforceOAuthResponse, error) {
+		calls++
+		if calls < 3 {
+			return nil, &oauthError{Status: http.StatusServiceUnavailable}
+		}
+		return &SalesforceOAuthResponse{AccessToken: "access"}, nil
+	})
+	if err != nil || resp.AccessToken != "access" {
+		t.Fatalf("Expected success after retrying, got %v", err)
+	}
+	if len(*slept) != 2 || (*slept)[0] != maintenanceSchedule[0] || (*slept)[1] != maintenanceSchedule[1] {
+		t.Errorf("Unexpected retry delays %v", *slept)
+	}
+}
+
+func TestWithMaintenanceRetryGivesUp(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeSleep(t)
+	flagMaintenanceWait = 0
+
+	calls := 0
+	_, err := withMaintenanceRetry("", func() (*SalesforceOAuthResponse, error) {
+		calls++
+		return nil, &oauthError{Status: http.StatusServiceUnavailable}
+	})
+	if calls != 1 || len(*slept) != 0 {
+		t.Errorf("Expected no retries without --maintenance-wait, got %d calls", calls)
+	}
+	if !isMaintenanceError(err) || !strings.Contains(err.Error(), "maintenance") {
+		t.Errorf("Expected a maintenance error, got %v", err)
+	}
+
+	// Other errors are returned straight away
+	calls = 0
+	flagMaintenanceWait = time.Hour
+	_, err = withMaintenanceRetry("", func() (*SalesforceOAuthResponse, error) {
+		calls++
+		return nil, &oauthError{Status: http.StatusBadRequest, Code: "invalid_grant"}
+	})
+	if calls != 1 || isMaintenanceError(err) {
+		t.Errorf("Expected a single call for a non-maintenance error, got %d calls (%v)", calls, err)
+	}
+}
+
+func TestMaintenanceTrustStatus(t *testing.T) {
+	withQuiet(t)
+	withFakeSleep(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/instances/CS42/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"key": "CS42", "status": "MAINTENANCE_CORE"}`))
+	}))
+	defer server.Close()
+
+	originalURL, originalCheck := trustStatusURL, checkTrustStatus
+	defer func() { trustStatusURL, checkTrustStatus = originalURL, originalCheck }()
+	trustStatusURL = server.URL + "/v1/instances/%s/status"
+	checkTrustStatus = true
+
+	_, err := withMaintenanceRetry("CS42", func() (*SalesforceOAuthResponse, error) {
+		return nil, &oauthError{Status: http.StatusServiceUnavailable}
+	})
+	if err == nil || !strings.Contains(err.Error(), "MAINTENANCE_CORE") {
+		t.Errorf("Expected the Trust status in the error, got %v", err)
+	}
+}
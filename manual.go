@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var flagManual bool
+
+// runManualFlow is the web server flow without the callback server: the
+// user logs in in any browser and pastes back the URL they were redirected
+// to, which need not load
+func runManualFlow(deps *oauthDeps, callback *callbackConfig, domain string, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	if flagGrant == grantImplicit {
+		return nil, fmt.Errorf("--manual does not support the %s grant", grantImplicit)
+	}
+
+	authURL := deps.AuthURL.AuthURL(domain, clientID, callback.RedirectURI, state)
+	// Shown even with --quiet, since the user has to act on it, and on
+	// stderr so stdout stays the token output
+	fmt.Fprintf(os.Stderr, "%s\n%s\n\n", tr(msgOpenAuthURL, nil), authURL)
+	if !flagContainer {
+		if err := deps.Browser.Open(authURL); err != nil {
+			log.Printf("Warning: could not open browser: %v", err)
+		}
+	}
+
+	// Through the shared stdin reader, which may already hold a redirect
+	// piped in after the answers to earlier prompts
+	line, err := promptLine(tr(msgPasteRedirectURL, nil))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the redirect URL: %v", err)
+	}
+	code, err := parseManualRedirect(line, state)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenResponse, err := deps.Exchanger.Exchange(domain, code, clientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging code for tokens: %v", err)
+	}
+	return tokenResponse, nil
+}
+
+// parseManualRedirect takes the pasted redirect URL, or its bare code, and
+// returns the authorization code. A full URL has its state checked like the
+// callback server does.
+func parseManualRedirect(input, expectedState string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("no authorization code received")
+	}
+	if !strings.Contains(input, "?") {
+		// Codes are copied from the address bar still percent-encoded
+		if code, err := url.QueryUnescape(input); err == nil {
+			return code, nil
+		}
+		return input, nil
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL: %v", err)
+	}
+	query := u.Query()
+	if errorParam := query.Get("error"); errorParam != "" {
+		return "", fmt.Errorf("OAuth error: %w", &oauthError{Code: errorParam, Description: query.Get("error_description")})
+	}
+	if query.Get("state") != expectedState {
+		return "", fmt.Errorf("invalid state parameter")
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no authorization code received")
+	}
+	return code, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseManualRedirect(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"http://localhost:8080/callback?code=aPrx%3D%3D&state=s1\n", "aPrx=="},
+		{"  aPrx%3D%3D  ", "aPrx=="},
+		{"aPrx==", "aPrx=="},
+	}
+	for _, tt := range tests {
+		got, err := parseManualRedirect(tt.input, "s1")
+		if err != nil || got != tt.want {
+			t.Errorf("parseManualRedirect(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{
+		"",
+		"http://localhost:8080/callback?code=aPrx&state=forged",
+		"http://localhost:8080/callback?state=s1",
+	} {
+		if _, err := parseManualRedirect(input, "s1"); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+
+	_, err := parseManualRedirect("http://localhost:8080/callback?error=access_denied&error_description=end-user+denied+authorization&state=s1", "s1")
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "access_denied" {
+		t.Errorf("Expected the OAuth error to be returned, got %v", err)
+	}
+}
+
+// The redirect is read from the same buffered stdin as the credential prompts
+// before it, so piping all the answers in at once works
+func TestRunAuthFlowManualPipedAfterPrompts(t *testing.T) {
+	withQuiet(t)
+	withGrant(t, grantAuthorizationCode)
+	flagManual = true
+	withStdin(t, "3MVG9client\n\nthe-code\n")
+	originalClientID, originalPKCE := clientID, flagPKCE
+	flagPKCE = true
+	defer func() { flagManual, clientID, flagPKCE = false, originalClientID, originalPKCE }()
+
+	clientSecret, err := getClientCredentials()
+	if err != nil || clientID != "3MVG9client" || !clientSecret.Empty() {
+		t.Fatalf("getClientCredentials = %q, %v", clientID, err)
+	}
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access"}}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: manualBrowser{}}
+	if _, err := runAuthFlow(context.Background(), deps, &callbackConfig{Listen: "192.0.2.1:1", RedirectURI: "http://localhost:8080/callback", Path: "/callback"}, "login.salesforce.com", clientSecret); err != nil {
+		t.Fatalf("runAuthFlow failed: %v", err)
+	}
+	if exchanger.code != "the-code" {
+		t.Errorf("Expected the piped code to be exchanged, got %q", exchanger.code)
+	}
+}
+
+func TestRunAuthFlowManual(t *testing.T) {
+	withQuiet(t)
+	flagManual = true
+	withStdin(t, "the%2Bcode%3D%3D\n")
+	defer func() { flagManual = false }()
+
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access", RefreshToken: "refresh"}}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: manualBrowser{}}
+
+	// The callback address is left unbound: no server is started
+	resp, err := runAuthFlow(context.Background(), deps, &callbackConfig{Listen: "192.0.2.1:1", RedirectURI: "http://localhost:8080/callback", Path: "/callback"}, "login.salesforce.com", nil)
+	if err != nil {
+		t.Fatalf("runAuthFlow failed: %v", err)
+	}
+	if resp.AccessToken != "access" || exchanger.code != "the+code==" {
+		t.Errorf("Unexpected exchange of code %q", exchanger.code)
+	}
+	if !strings.Contains(deps.AuthURL.(*fakeAuthURL).url, "redirect_uri=http%3A%2F%2Flocalhost%3A8080%2Fcallback") {
+		t.Errorf("Expected the configured redirect URI in %s", deps.AuthURL.(*fakeAuthURL).url)
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultMockListen = "127.0.0.1:8443"
+
+// The org and user every mock login belongs to
+const (
+	mockOrgID    = "00D000000000MOCKAA"
+	mockUserID   = "005000000000MOCKAA"
+	mockUsername = "mock.user@example.com"
+)
+
+// Endpoints of the mock server that --delay and --fail apply to. "refresh"
+// is the token endpoint for refresh_token grants only.
+var mockEndpoints = []string{"authorize", "token", "refresh", "userinfo", "query", "revoke"}
+
+var (
+	flagMockListen   string
+	flagMockCertFile string
+	flagMockUsername string
+	flagMockDelays   []string
+	flagMockFailures []string
+)
+
+var mockServerCmd = &cobra.Command{
+	Use:   "mock-server",
+	Short: "Run a mock Salesforce OAuth server for offline testing",
+	Long: `Serve the Salesforce OAuth endpoints from memory over HTTPS, so this tool
+and scripts built on it can be tested without a real org or network access.
+
+Endpoints:
+  GET  /services/oauth2/authorize        approves at once and redirects back
+                                         with a code (or, for
+                                         response_type=token, the token)
+  POST /services/oauth2/token            authorization_code (checking PKCE),
+                                         refresh_token, password,
+                                         client_credentials and JWT bearer
+                                         grants
+  GET  /services/oauth2/userinfo         the mock user
+  GET  /services/data/{version}/query    the mock Organization record
+  POST /services/oauth2/revoke           revokes an access or refresh token
+
+Any client ID and credentials are accepted. Codes, access tokens and refresh
+tokens are kept until they are used, revoked or the server stops.
+
+--delay and --fail change how an endpoint answers, and may be repeated:
+  --delay 2s                   delay every response
+  --delay token=5s             delay one endpoint
+  --fail refresh=invalid_grant answer with an OAuth error
+  --fail userinfo=503          answer with an HTTP status
+  --fail refresh=429           rate limit, with Retry-After: 1
+The endpoints are ` + strings.Join(mockEndpoints, ", ") + `; "refresh" is
+the token endpoint for refresh_token grants only.
+
+The certificate is generated when the server starts. Write it out with
+--cert-file and pass it to --ca-bundle, then log in against the server:
+
+  sfdc-go-auth-cli mock-server --cert-file /tmp/mock.pem &
+  sfdc-go-auth-cli login --domain 127.0.0.1:8443 --ca-bundle /tmp/mock.pem`,
+	Args: cobra.NoArgs,
+	Run:  runMockServer,
+}
+
+func init() {
+	mockServerCmd.Flags().StringVar(&flagMockListen, "listen", defaultMockListen, "Address to listen on")
+	mockServerCmd.Flags().StringVar(&flagMockCertFile, "cert-file", "", "Write the server's certificate to this file, for --ca-bundle")
+	mockServerCmd.Flags().StringVar(&flagMockUsername, "username", mockUsername, "Username of the mock user")
+	mockServerCmd.Flags().StringArrayVar(&flagMockDelays, "delay", nil, "Delay responses, as [endpoint=]duration (repeatable)")
+	mockServerCmd.Flags().StringArrayVar(&flagMockFailures, "fail", nil, "Make an endpoint fail, as endpoint=error or endpoint=status (repeatable)")
+
+	rootCmd.AddCommand(mockServerCmd)
+}
+
+// mockBehavior is how one endpoint answers
+type mockBehavior struct {
+	delay time.Duration
+	// fail is an OAuth error code or an HTTP status; empty succeeds
+	fail string
+}
+
+// parseMockBehaviors reads --delay and --fail into behaviours by endpoint.
+// A delay without an endpoint applies to all of them.
+func parseMockBehaviors(delays, failures []string) (map[string]mockBehavior, error) {
+	behaviors := map[string]mockBehavior{}
+	for _, d := range delays {
+		endpoint, value, ok := strings.Cut(d, "=")
+		if !ok {
+			endpoint, value = "", d
+		}
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid --delay %q: want [endpoint=]duration, e.g. token=2s", d)
+		}
+		targets := []string{endpoint}
+		if endpoint == "" {
+			targets = mockEndpoints
+		} else if !containsString(mockEndpoints, endpoint) {
+			return nil, fmt.Errorf("unknown endpoint %q in --delay (use %s)", endpoint, strings.Join(mockEndpoints, ", "))
+		}
+		for _, target := range targets {
+			b := behaviors[target]
+			b.delay = delay
+			behaviors[target] = b
+		}
+	}
+	for _, f := range failures {
+		endpoint, value, ok := strings.Cut(f, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid --fail %q: want endpoint=error, e.g. refresh=invalid_grant", f)
+		}
+		if !containsString(mockEndpoints, endpoint) {
+			return nil, fmt.Errorf("unknown endpoint %q in --fail (use %s)", endpoint, strings.Join(mockEndpoints, ", "))
+		}
+		if status, err := strconv.Atoi(value); err == nil && (status < 400 || status > 599) {
+			return nil, fmt.Errorf("invalid --fail %q: an HTTP status must be 4xx or 5xx", f)
+		}
+		b := behaviors[endpoint]
+		b.fail = value
+		behaviors[endpoint] = b
+	}
+	return behaviors, nil
+}
+
+// mockCode is an authorization code waiting to be exchanged
+type mockCode struct {
+	clientID, redirectURI, challenge, scope string
+}
+
+// mockServer is an in-memory Salesforce login endpoint and org
+type mockServer struct {
+	// baseURL is where the server is reached, used as the instance URL
+	baseURL   string
+	username  string
+	behaviors map[string]mockBehavior
+	now       func() time.Time
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+	// access maps each live access token to the refresh token it came
+	// from, if any
+	access  map[string]string
+	refresh map[string]bool
+}
+
+func newMockServer(baseURL, username string, behaviors map[string]mockBehavior) *mockServer {
+	return &mockServer{
+		baseURL:   baseURL,
+		username:  username,
+		behaviors: behaviors,
+		now:       time.Now,
+		codes:     map[string]mockCode{},
+		access:    map[string]string{},
+		refresh:   map[string]bool{},
+	}
+}
+
+func runMockServer(cmd *cobra.Command, args []string) {
+	behaviors, err := parseMockBehaviors(flagMockDelays, flagMockFailures)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	host, _, err := net.SplitHostPort(flagMockListen)
+	if err != nil {
+		log.Fatalf("Error: invalid listen address %q: %v", flagMockListen, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	cert, err := selfSignedCertificate(host, time.Now())
+	if err != nil {
+		log.Fatalf("Error generating certificate: %v", err)
+	}
+	if flagMockCertFile != "" {
+		block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+		if err := os.WriteFile(flagMockCertFile, block, 0644); err != nil {
+			log.Fatalf("Error writing certificate: %v", err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", flagMockListen)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", flagMockListen, err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	domain := net.JoinHostPort(host, port)
+	mock := newMockServer("https://"+domain, flagMockUsername, behaviors)
+	server := &http.Server{
+		Handler:           mock.routes(),
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(scrubWriter{w: os.Stderr}, "", log.LstdFlags),
+	}
+
+	ctx := cmd.Context()
+	go func() {
+		defer handlePanic()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	infof("Mock Salesforce listening on %s", mock.baseURL)
+	if flagMockCertFile != "" {
+		infof("Log in with: --domain %s --ca-bundle %s", domain, flagMockCertFile)
+	} else {
+		infof("Log in with: --domain %s (add --cert-file to trust the certificate with --ca-bundle)", domain)
+	}
+	if err := server.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+func (m *mockServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /services/oauth2/authorize", m.handleAuthorize)
+	mux.HandleFunc("POST /services/oauth2/token", m.handleToken)
+	mux.HandleFunc("GET /services/oauth2/userinfo", m.handleUserinfo)
+	mux.HandleFunc("GET /services/data/{version}/query", m.handleQuery)
+	mux.HandleFunc("POST /services/oauth2/revoke", m.handleRevoke)
+	return mux
+}
+
+// wait applies an endpoint's --delay, returning false if the client gave
+// up first
+func (m *mockServer) wait(r *http.Request, endpoint string) bool {
+	delay := m.behaviors[endpoint].delay
+	if delay <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(delay):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// failed answers with an endpoint's --fail, if it has one
+func (m *mockServer) failed(w http.ResponseWriter, endpoint string) bool {
+	fail := m.behaviors[endpoint].fail
+	if fail == "" {
+		return false
+	}
+	if status, err := strconv.Atoi(fail); err == nil {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeMockError(w, status, "server_error", http.StatusText(status))
+	} else {
+		writeMockError(w, http.StatusBadRequest, fail, "mock failure")
+	}
+	return true
+}
+
+func (m *mockServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" || query.Get("client_id") == "" {
+		http.Error(w, "invalid_request: client_id and redirect_uri are required", http.StatusBadRequest)
+		return
+	}
+	if !m.wait(r, "authorize") {
+		return
+	}
+
+	params := url.Values{}
+	if state := query.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	fail := m.behaviors["authorize"].fail
+	switch {
+	case fail != "":
+		if _, err := strconv.Atoi(fail); err == nil {
+			m.failed(w, "authorize")
+			return
+		}
+		// Authorization errors go back to the callback, as when the user
+		// denies access
+		params.Set("error", fail)
+		params.Set("error_description", "mock failure")
+		redirect.RawQuery = params.Encode()
+	case query.Get("response_type") == "code":
+		params.Set("code", m.newCode(mockCode{
+			clientID:    query.Get("client_id"),
+			redirectURI: query.Get("redirect_uri"),
+			challenge:   query.Get("code_challenge"),
+			scope:       query.Get("scope"),
+		}))
+		redirect.RawQuery = params.Encode()
+	case query.Get("response_type") == "token":
+		token := m.issue(false, query.Get("scope"))
+		for _, key := range []string{"access_token", "instance_url", "id", "issued_at", "signature", "token_type", "scope"} {
+			if value, ok := token[key].(string); ok && value != "" {
+				params.Set(key, value)
+			}
+		}
+		redirect.Fragment = params.Encode()
+	default:
+		params.Set("error", "unsupported_response_type")
+		params.Set("error_description", "response type not supported")
+		redirect.RawQuery = params.Encode()
+	}
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *mockServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeMockError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return
+	}
+	grant := r.PostForm.Get("grant_type")
+	endpoint := "token"
+	if grant == "refresh_token" {
+		endpoint = "refresh"
+	}
+	if !m.wait(r, endpoint) || m.failed(w, endpoint) {
+		return
+	}
+	// A refresh_token grant fails as set for the token endpoint too
+	if endpoint == "refresh" && m.failed(w, "token") {
+		return
+	}
+
+	switch grant {
+	case "authorization_code":
+		code, ok := m.takeCode(r.PostForm.Get("code"))
+		switch {
+		case !ok:
+			writeMockError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+		case code.clientID != r.PostForm.Get("client_id") || code.redirectURI != r.PostForm.Get("redirect_uri"):
+			writeMockError(w, http.StatusBadRequest, "invalid_grant", "client_id or redirect_uri mismatch")
+		case code.challenge != "" && codeChallenge(r.PostForm.Get("code_verifier")) != code.challenge:
+			writeMockError(w, http.StatusBadRequest, "invalid_grant", "invalid code verifier")
+		default:
+			writeAPIJSON(w, http.StatusOK, m.issue(true, code.scope))
+		}
+	case "refresh_token":
+		token, ok := m.refreshToken(r.PostForm.Get("refresh_token"))
+		if !ok {
+			writeMockError(w, http.StatusBadRequest, "invalid_grant", "expired access/refresh token")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, token)
+	case "password", "client_credentials", jwtBearerGrant:
+		writeAPIJSON(w, http.StatusOK, m.issue(false, ""))
+	default:
+		writeMockError(w, http.StatusBadRequest, "unsupported_grant_type", "grant type not supported")
+	}
+}
+
+func (m *mockServer) handleUserinfo(w http.ResponseWriter, r *http.Request) {
+	if !m.wait(r, "userinfo") || m.failed(w, "userinfo") || !m.authorized(w, r) {
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":                m.identityURL(),
+		"user_id":            mockUserID,
+		"organization_id":    mockOrgID,
+		"preferred_username": m.username,
+		"name":               "Mock User",
+		"email":              m.username,
+		"email_verified":     true,
+		"zoneinfo":           "Europe/London",
+		"locale":             "en_GB",
+		"user_type":          "STANDARD",
+	})
+}
+
+// handleQuery answers any query with the mock Organization, which is all
+// the CLI queries when it logs in
+func (m *mockServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if !m.wait(r, "query") || m.failed(w, "query") || !m.authorized(w, r) {
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+		"totalSize": 1,
+		"done":      true,
+		"records": []map[string]interface{}{{
+			"attributes":       map[string]string{"type": "Organization"},
+			"Name":             "Mock Org",
+			"OrganizationType": "Developer Edition",
+			"InstanceName":     "MOCK1",
+			"IsSandbox":        false,
+		}},
+	})
+}
+
+func (m *mockServer) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !m.wait(r, "revoke") || m.failed(w, "revoke") {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeMockError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return
+	}
+	if !m.revoke(r.PostForm.Get("token")) {
+		writeMockError(w, http.StatusBadRequest, "invalid_token", "invalid token")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorized checks the request's bearer token, answering the way the REST
+// API does when it is not a live access token
+func (m *mockServer) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	m.mu.Lock()
+	_, ok := m.access[token]
+	m.mu.Unlock()
+	if !ok {
+		writeAPIJSON(w, http.StatusUnauthorized, []map[string]string{{"message": "Session expired or invalid", "errorCode": "INVALID_SESSION_ID"}})
+	}
+	return ok
+}
+
+func (m *mockServer) identityURL() string {
+	return m.baseURL + "/id/" + mockOrgID + "/" + mockUserID
+}
+
+func (m *mockServer) newCode(code mockCode) string {
+	value := mockSecret("aPrx")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[value] = code
+	return value
+}
+
+// takeCode returns an authorization code's request and forgets it, as codes
+// can only be exchanged once
+func (m *mockServer) takeCode(value string) (mockCode, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[value]
+	delete(m.codes, value)
+	return code, ok
+}
+
+// issue returns a token response for a new access token, and a refresh
+// token with it if withRefresh is set
+func (m *mockServer) issue(withRefresh bool, scope string) map[string]interface{} {
+	refresh := ""
+	if withRefresh {
+		refresh = mockSecret("5Aep861")
+		m.mu.Lock()
+		m.refresh[refresh] = true
+		m.mu.Unlock()
+	}
+	return m.accessTokenResponse(refresh, scope)
+}
+
+// refreshToken issues an access token from a live refresh token
+func (m *mockServer) refreshToken(refresh string) (map[string]interface{}, bool) {
+	m.mu.Lock()
+	ok := m.refresh[refresh]
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	token := m.accessTokenResponse(refresh, "")
+	// Salesforce does not rotate the refresh token
+	delete(token, "refresh_token")
+	return token, true
+}
+
+func (m *mockServer) accessTokenResponse(refresh, scope string) map[string]interface{} {
+	access := mockOrgID[:15] + "!" + mockSecret("")
+	m.mu.Lock()
+	m.access[access] = refresh
+	m.mu.Unlock()
+	if scope == "" {
+		scope = "api refresh_token"
+	}
+	token := map[string]interface{}{
+		"access_token": access,
+		"instance_url": m.baseURL,
+		"id":           m.identityURL(),
+		"token_type":   "Bearer",
+		"issued_at":    strconv.FormatInt(m.now().UnixMilli(), 10),
+		"signature":    mockSecret(""),
+		"scope":        scope,
+	}
+	if refresh != "" {
+		token["refresh_token"] = refresh
+	}
+	return token
+}
+
+// revoke ends an access token, or a refresh token and every access token
+// issued from it
+func (m *mockServer) revoke(token string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.access[token]; ok {
+		delete(m.access, token)
+		return true
+	}
+	if !m.refresh[token] {
+		return false
+	}
+	delete(m.refresh, token)
+	for access, refresh := range m.access {
+		if refresh == token {
+			delete(m.access, access)
+		}
+	}
+	return true
+}
+
+// mockSecret returns a random token value with a prefix
+func mockSecret(prefix string) string {
+	value, err := generateSessionToken()
+	if err != nil {
+		log.Fatalf("Error generating token: %v", err)
+	}
+	return prefix + string(value)
+}
+
+// writeMockError answers with an OAuth error body, as Salesforce does
+func writeMockError(w http.ResponseWriter, status int, code, description string) {
+	writeAPIJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startMockServer runs a mock server over TLS and points the default
+// transport at it, as --ca-bundle would
+func startMockServer(t *testing.T, behaviors map[string]mockBehavior) (*mockServer, string) {
+	t.Helper()
+	mock := newMockServer("", mockUsername, behaviors)
+	server := httptest.NewTLSServer(mock.routes())
+	t.Cleanup(server.Close)
+	mock.baseURL = server.URL
+
+	original := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = original })
+	return mock, strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestMockServerLogin(t *testing.T) {
+	mock, domain := startMockServer(t, nil)
+
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL := mock.baseURL + "/services/oauth2/authorize?" + url.Values{
+		"response_type":  {"code"},
+		"client_id":      {"testapp"},
+		"redirect_uri":   {"http://localhost:8080/callback"},
+		"state":          {"s1"},
+		"code_challenge": {codeChallenge(verifier)},
+	}.Encode()
+	client := &http.Client{
+		Transport:     http.DefaultTransport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound || callback.Host != "localhost:8080" || callback.Query().Get("state") != "s1" {
+		t.Fatalf("authorize answered %d, Location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	code := callback.Query().Get("code")
+
+	exchange := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "client_id": {"testapp"}, "redirect_uri": {"http://localhost:8080/callback"}}
+	exchange.Set("code_verifier", "wrong")
+	if _, err := postTokenRequest(getSalesforceTokenURL(domain), exchange, nil); err == nil {
+		t.Fatal("exchange with the wrong code verifier succeeded")
+	}
+	// The failed exchange used up the code
+	exchange.Set("code_verifier", verifier)
+	if _, err := postTokenRequest(getSalesforceTokenURL(domain), exchange, nil); err == nil {
+		t.Fatal("code exchanged twice")
+	}
+
+	resp, err = client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, _ = url.Parse(resp.Header.Get("Location"))
+	exchange.Set("code", callback.Query().Get("code"))
+	token, err := postTokenRequest(getSalesforceTokenURL(domain), exchange, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	org := newStoredOrg("mock", domain, token)
+	if org.OrgID != mockOrgID || org.UserID != mockUserID || org.InstanceURL != mock.baseURL || org.RefreshToken == "" || org.IssuedAt.IsZero() {
+		t.Fatalf("unexpected org %+v", org)
+	}
+
+	if err := enrichOrg(org); err != nil {
+		t.Fatalf("enrichOrg: %v", err)
+	}
+	if org.Username != mockUsername || org.OrgName != "Mock Org" {
+		t.Errorf("unexpected org details %+v", org)
+	}
+
+	refreshed, err := postTokenRequest(getSalesforceTokenURL(domain), url.Values{"grant_type": {"refresh_token"}, "refresh_token": {org.RefreshToken}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.AccessToken == "" || refreshed.AccessToken == org.AccessToken || refreshed.RefreshToken != "" {
+		t.Errorf("unexpected refresh response %+v", refreshed)
+	}
+
+	// Revoking the refresh token ends the sessions issued from it
+	if err := revokeToken(domain, org.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := getOrgJSON(&StoredOrg{Alias: "mock", InstanceURL: mock.baseURL, AccessToken: refreshed.AccessToken}, "/services/oauth2/userinfo", &struct{}{}); err == nil {
+		t.Error("access token still works after its refresh token was revoked")
+	}
+	_, err = postTokenRequest(getSalesforceTokenURL(domain), url.Values{"grant_type": {"refresh_token"}, "refresh_token": {org.RefreshToken}}, nil)
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Errorf("refresh with a revoked token = %v, want invalid_grant", err)
+	}
+	if err := revokeToken(domain, org.RefreshToken); err == nil {
+		t.Error("revoking an unknown token succeeded")
+	}
+}
+
+func TestMockServerFailures(t *testing.T) {
+	behaviors, err := parseMockBehaviors(nil, []string{"refresh=invalid_grant", "userinfo=503", "authorize=access_denied"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, domain := startMockServer(t, behaviors)
+
+	token, err := postTokenRequest(getSalesforceTokenURL(domain), url.Values{"grant_type": {"password"}, "username": {mockUsername}, "password": {"pw"}}, nil)
+	if err != nil {
+		t.Fatalf("password grant: %v", err)
+	}
+	_, err = postTokenRequest(getSalesforceTokenURL(domain), url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"anything"}}, nil)
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Errorf("refresh = %v, want invalid_grant", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/services/oauth2/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	rec := httptest.NewRecorder()
+	mock.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("userinfo answered %d, want 503", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mock.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/services/oauth2/authorize?response_type=code&client_id=app&state=s1&redirect_uri=http://localhost:8080/callback", nil))
+	callback, _ := url.Parse(rec.Header().Get("Location"))
+	if q := callback.Query(); q.Get("error") != "access_denied" || q.Get("state") != "s1" || q.Get("code") != "" {
+		t.Errorf("authorize redirected to %q", rec.Header().Get("Location"))
+	}
+}
+
+func TestMockServerImplicit(t *testing.T) {
+	mock := newMockServer("https://127.0.0.1:8443", mockUsername, nil)
+	rec := httptest.NewRecorder()
+	mock.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/services/oauth2/authorize?response_type=token&client_id=app&state=s1&redirect_uri=http://localhost:8080/callback", nil))
+	callback, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment, _ := url.ParseQuery(callback.Fragment)
+	if fragment.Get("access_token") == "" || fragment.Get("instance_url") != mock.baseURL || fragment.Get("state") != "s1" || fragment.Get("refresh_token") != "" {
+		t.Errorf("unexpected fragment %q", callback.Fragment)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/services/data/v60.0/query?q=SELECT+Name+FROM+Organization", nil)
+	req.Header.Set("Authorization", "Bearer "+fragment.Get("access_token"))
+	rec = httptest.NewRecorder()
+	mock.routes().ServeHTTP(rec, req)
+	var result struct {
+		Records []struct{ Name string } `json:"records"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || rec.Code != http.StatusOK || len(result.Records) != 1 {
+		t.Errorf("query answered %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMockServerDelay(t *testing.T) {
+	mock := newMockServer("https://127.0.0.1:8443", mockUsername, map[string]mockBehavior{"token": {delay: 50 * time.Millisecond}})
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/services/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	mock.routes().ServeHTTP(rec, req)
+	if time.Since(start) < 50*time.Millisecond || rec.Code != http.StatusOK {
+		t.Errorf("token answered %d after %v", rec.Code, time.Since(start))
+	}
+}
+
+func TestParseMockBehaviors(t *testing.T) {
+	behaviors, err := parseMockBehaviors([]string{"1s", "token=3s"}, []string{"revoke=400", "refresh=invalid_grant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if behaviors["userinfo"].delay != time.Second || behaviors["token"].delay != 3*time.Second {
+		t.Errorf("unexpected delays %+v", behaviors)
+	}
+	if behaviors["revoke"].fail != "400" || behaviors["refresh"].fail != "invalid_grant" || behaviors["token"].fail != "" {
+		t.Errorf("unexpected failures %+v", behaviors)
+	}
+
+	for _, bad := range [][2][]string{
+		{{"soon"}, nil},
+		{{"login=1s"}, nil},
+		{nil, {"token"}},
+		{nil, {"login=invalid_grant"}},
+		{nil, {"token=200"}},
+	} {
+		if _, err := parseMockBehaviors(bad[0], bad[1]); err == nil {
+			t.Errorf("parseMockBehaviors(%q, %q) should fail", bad[0], bad[1])
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+)
+
+// authURLBuilder builds the URL the user is sent to in order to log in
+type authURLBuilder interface {
+	AuthURL(domain, clientID, redirectURI, state string) string
+}
+
+// tokenExchanger trades an authorization code for tokens
+type tokenExchanger interface {
+	Exchange(domain, code string, clientSecret *secret) (*SalesforceOAuthResponse, error)
+}
+
+// clock tells the time stamped on stored tokens
+type clock interface {
+	Now() time.Time
+}
+
+// browserOpener sends the user to the authorization URL
+type browserOpener interface {
+	Open(url string) error
+}
+
+// tokenRevoker revokes a token at the org's revoke endpoint
+type tokenRevoker interface {
+	Revoke(domain, token string) error
+}
+
+// oauthDeps are the collaborators of the login flow. Commands use authDeps;
+// tests swap in fakes to run the flow without reaching Salesforce.
+type oauthDeps struct {
+	AuthURL   authURLBuilder
+	Exchanger tokenExchanger
+	Clock     clock
+	Browser   browserOpener
+	Revoker   tokenRevoker
+}
+
+var authDeps = newOAuthDeps()
+
+func newOAuthDeps() *oauthDeps {
+	return &oauthDeps{
+		AuthURL:   salesforceAuthURL{},
+		Exchanger: salesforceExchanger{},
+		Clock:     systemClock{},
+		Browser:   systemBrowser{},
+		Revoker:   salesforceRevoker{},
+	}
+}
+
+// salesforceAuthURL builds web server flow authorization URLs
+type salesforceAuthURL struct{}
+
+func (salesforceAuthURL) AuthURL(domain, clientID, redirectURI, state string) string {
+	params := sfauth.AuthParams{
+		ClientID:     clientID,
+		RedirectURI:  redirectURI,
+		State:        state,
+		Scope:        authorizeScope(),
+		ResponseType: authorizeResponseType(),
+	}
+	if codeVerifier != "" {
+		params.CodeChallenge = codeChallenge(codeVerifier)
+	}
+	params.Nonce = nonce
+	return sfauth.BuildAuthURL(domain, params)
+}
+
+// salesforceExchanger posts to the Salesforce token endpoint
+type salesforceExchanger struct{}
+
+func (salesforceExchanger) Exchange(domain, code string, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	return exchangeCodeForTokens(code, domain, clientSecret)
+}
+
+// salesforceRevoker posts to the Salesforce revoke endpoint
+type salesforceRevoker struct{}
+
+func (salesforceRevoker) Revoke(domain, token string) error {
+	return revokeToken(domain, token)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// manualBrowser leaves opening the printed URL to the user (--no-browser)
+type manualBrowser struct{}
+
+func (manualBrowser) Open(string) error { return nil }
+
+// newAuthSession resets the state of the login in progress and generates
+// the state, nonce and PKCE verifier of its authorization request
+func newAuthSession() error {
+	state = generateState()
+	authCode, authError, authOAuthError, implicitToken, codeVerifier = "", "", nil, nil, ""
+	callbackResult, callbackOrg = make(chan *successPageData, 1), nil
+	n, err := sfauth.NewNonce()
+	if err != nil {
+		return err
+	}
+	nonce = n
+	if pkceEnabled() {
+		verifier, err := generateCodeVerifier()
+		if err != nil {
+			return err
+		}
+		codeVerifier = verifier
+	}
+	return nil
+}
+
+// runAuthFlow runs the web server flow: it serves the callback, sends the
+// user to the authorization URL and exchanges the code it receives. With
+// --manual the code is pasted in instead. Cancelling ctx shuts the callback
+// server down and returns errCancelled.
+func runAuthFlow(ctx context.Context, deps *oauthDeps, callback *callbackConfig, domain string, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	if err := newAuthSession(); err != nil {
+		return nil, err
+	}
+	if flagManual {
+		return runManualFlow(deps, callback, domain, clientSecret)
+	}
+	if err := checkSuccessRedirect(flagSuccessRedirect); err != nil {
+		return nil, err
+	}
+	page, err := loadSuccessPage(flagSuccessPage)
+	if err != nil {
+		return nil, err
+	}
+	successPage = page
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", callback.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("error starting callback server: %v", err)
+	}
+	if callback.TLS != nil {
+		listener = tls.NewListener(listener, callback.TLS)
+		if callback.Fingerprint != "" {
+			infof("The callback uses a self-signed certificate; accept it in the browser if its SHA-256 fingerprint is\n%s", callback.Fingerprint)
+		}
+	}
+
+	// net/http recovers handler panics itself and logs them, so route its
+	// error log through the scrubber as well
+	mux := http.NewServeMux()
+	if flagGrant == grantImplicit {
+		mux.HandleFunc(callback.Path, handleImplicitCallback)
+	} else {
+		mux.HandleFunc(callback.Path, handleCallback)
+	}
+	server := &http.Server{Handler: mux, ErrorLog: log.New(scrubWriter{w: os.Stderr}, "", log.LstdFlags)}
+
+	go func() {
+		defer handlePanic()
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Callback server error: %v", err)
+		}
+	}()
+	// Starting the server, waiting for the callback and, unless the
+	// user-agent flow hands over the tokens, exchanging the code
+	steps := 3
+	if flagGrant == grantImplicit {
+		steps = 2
+	}
+	progress := startProgress(steps)
+	starting := tr(msgStartingServer, map[string]interface{}{"Address": callback.Listen})
+	if progress != nil {
+		progress.Done(starting)
+	} else {
+		infof("%s", starting)
+	}
+
+	authURL := deps.AuthURL.AuthURL(domain, clientID, callback.RedirectURI, state)
+	if !flagQuiet {
+		fmt.Fprintf(os.Stderr, "\n%s\n%s\n\n", tr(msgOpenAuthURL, nil), authURL)
+	}
+	if !flagContainer {
+		if err := deps.Browser.Open(authURL); err != nil {
+			log.Printf("Warning: could not open browser: %v", err)
+		}
+	}
+	if progress != nil {
+		progress.Step(tr(msgWaitingForCallback, nil))
+	} else {
+		infof("%s", tr(msgWaitingForCallback, nil))
+	}
+
+	// Wait for callback
+	cancelled := false
+	select {
+	case <-serverDone:
+		verbosef("Received OAuth callback")
+	case <-ctx.Done():
+		cancelled = true
+	}
+	received := !cancelled && authError == ""
+
+	// The callback request waits for the exchange, so it happens before the
+	// server is shut down
+	var tokenResponse *SalesforceOAuthResponse
+	var exchangeErr error
+	if received && flagGrant != grantImplicit && authCode != "" {
+		progress.Step(tr(msgExchangingCode, nil))
+		tokenResponse, exchangeErr = deps.Exchanger.Exchange(domain, authCode, clientSecret)
+		if exchangeErr != nil {
+			callbackResult <- nil
+		} else {
+			callbackResult <- successPageFor(domain, tokenResponse)
+		}
+		received = exchangeErr == nil
+	}
+	progress.Stop(received)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	if cancelled {
+		return nil, errCancelled
+	}
+
+	if authOAuthError != nil {
+		return nil, fmt.Errorf("OAuth error: %w", authOAuthError)
+	}
+	if authError != "" {
+		return nil, fmt.Errorf("OAuth error: %s", authError)
+	}
+	if flagGrant == grantImplicit {
+		// The user-agent flow hands over the tokens directly
+		return implicitToken, nil
+	}
+	if authCode == "" {
+		return nil, fmt.Errorf("no authorization code received")
+	}
+
+	if exchangeErr != nil {
+		return nil, fmt.Errorf("error exchanging code for tokens: %v", exchangeErr)
+	}
+	return tokenResponse, nil
+}
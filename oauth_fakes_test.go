@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAuthURL returns the real URL shape so fakeBrowser can find the
+// redirect URI and state, and records what it was asked for
+type fakeAuthURL struct {
+	domain string
+	url    string
+}
+
+func (f *fakeAuthURL) AuthURL(domain, clientID, redirectURI, state string) string {
+	f.domain = domain
+	f.url = salesforceAuthURL{}.AuthURL(domain, clientID, redirectURI, state)
+	return f.url
+}
+
+// fakeExchanger returns a canned response and records the code it was given
+type fakeExchanger struct {
+	mu     sync.Mutex
+	code   string
+	secret string
+	resp   *SalesforceOAuthResponse
+	err    error
+}
+
+func (f *fakeExchanger) Exchange(domain, code string, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.code = code
+	f.secret = string(clientSecret.Bytes())
+	return f.resp, f.err
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f fakeClock) Now() time.Time { return f.now }
+
+// fakeBrowser plays the part of the user and Salesforce: it follows the
+// authorization URL straight to the callback with the given query
+type fakeBrowser struct {
+	query url.Values
+	done  chan error
+}
+
+func newFakeBrowser(query url.Values) *fakeBrowser {
+	return &fakeBrowser{query: query, done: make(chan error, 1)}
+}
+
+func (f *fakeBrowser) Open(authURL string) error {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return err
+	}
+	params := u.Query()
+	query := url.Values{}
+	for k, v := range f.query {
+		query[k] = v
+	}
+	if _, ok := query["state"]; !ok {
+		query.Set("state", params.Get("state"))
+	}
+	callback := params.Get("redirect_uri") + "?" + query.Encode()
+
+	// The callback handler does not return until the flow has read its
+	// result, so the request cannot be made synchronously
+	go func() {
+		resp, err := http.Get(callback)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("callback returned status %d", resp.StatusCode)
+			}
+		}
+		f.done <- err
+	}()
+	return nil
+}
+
+// fakeRevoker records revoked tokens
+type fakeRevoker struct {
+	mu      sync.Mutex
+	revoked []string
+	err     error
+}
+
+func (f *fakeRevoker) Revoke(domain, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked = append(f.revoked, token)
+	return f.err
+}
+
+// withFakeRevoker swaps the revoker for the duration of a test
+func withFakeRevoker(t *testing.T) *fakeRevoker {
+	t.Helper()
+	original := authDeps
+	deps := *authDeps
+	revoker := &fakeRevoker{}
+	deps.Revoker = revoker
+	authDeps = &deps
+	t.Cleanup(func() { authDeps = original })
+	return revoker
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCallback(t *testing.T) *callbackConfig {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return &callbackConfig{Listen: addr, RedirectURI: "http://" + addr + "/callback", Path: "/callback"}
+}
+
+func withQuiet(t *testing.T) {
+	t.Helper()
+	original := flagQuiet
+	flagQuiet = true
+	t.Cleanup(func() { flagQuiet = original })
+}
+
+func TestRunAuthFlow(t *testing.T) {
+	withQuiet(t)
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access", RefreshToken: "refresh"}}
+	browser := newFakeBrowser(url.Values{"code": {"the-code"}})
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	resp, err := runAuthFlow(context.Background(), deps, testCallback(t), "test.salesforce.com", newSecret([]byte("secret")))
+	if err != nil {
+		t.Fatalf("runAuthFlow failed: %v", err)
+	}
+	if err := <-browser.done; err != nil {
+		t.Errorf("Callback request failed: %v", err)
+	}
+	if resp.AccessToken != "access" {
+		t.Errorf("Unexpected access token %q", resp.AccessToken)
+	}
+	if exchanger.code != "the-code" || exchanger.secret != "secret" {
+		t.Errorf("Exchanger got code %q secret %q", exchanger.code, exchanger.secret)
+	}
+	if deps.AuthURL.(*fakeAuthURL).domain != "test.salesforce.com" {
+		t.Error("Authorization URL not built for the requested domain")
+	}
+}
+
+func TestRunAuthFlowRejectsBadState(t *testing.T) {
+	withQuiet(t)
+	exchanger := &fakeExchanger{}
+	browser := newFakeBrowser(url.Values{"code": {"the-code"}, "state": {"forged"}})
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	_, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil)
+	if err == nil || !strings.Contains(err.Error(), "Invalid state") {
+		t.Errorf("Expected an invalid state error, got %v", err)
+	}
+	<-browser.done
+	if exchanger.code != "" {
+		t.Error("Code should not be exchanged after a state mismatch")
+	}
+}
+
+func TestRunAuthFlowOAuthError(t *testing.T) {
+	withQuiet(t)
+	browser := newFakeBrowser(url.Values{"error": {"access_denied"}, "error_description": {"end-user denied authorization"}})
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: &fakeExchanger{}, Clock: systemClock{}, Browser: browser}
+
+	_, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil)
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("Expected an access_denied error, got %v", err)
+	}
+	<-browser.done
+}
+
+func TestRunAuthFlowPolicyError(t *testing.T) {
+	withQuiet(t)
+	browser := newFakeBrowser(url.Values{"error": {"OAUTH_APP_BLOCKED"}, "error_description": {"this app is blocked by admin"}})
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: &fakeExchanger{}, Clock: systemClock{}, Browser: browser}
+
+	_, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil)
+	<-browser.done
+	if policyGuidance(err) == "" {
+		t.Errorf("Expected guidance for a blocked app, got error %v", err)
+	}
+}
+
+func TestNewStoredOrgUsesClock(t *testing.T) {
+	original := authDeps
+	defer func() { authDeps = original }()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	authDeps = &oauthDeps{Clock: fakeClock{now: now}}
+
+	org := newStoredOrg("prod", "login.salesforce.com", &SalesforceOAuthResponse{})
+	if !org.UpdatedAt.Equal(now) {
+		t.Errorf("Expected UpdatedAt %v, got %v", now, org.UpdatedAt)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIssuer is a fake OIDC provider publishing a single RSA key
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": iss.server.URL, "jwks_uri": iss.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func (iss *testIssuer) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (iss *testIssuer) claims(sub string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": iss.server.URL,
+		"sub": sub,
+		"aud": "broker",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	iss := newTestIssuer(t)
+	v := newOIDCVerifier(iss.server.URL, "broker")
+
+	claims, err := v.Verify(iss.sign(t, "key1", iss.claims("alice")))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.Subject != "alice" {
+		t.Errorf("Unexpected subject %q", claims.Subject)
+	}
+}
+
+func TestOIDCVerifyRejects(t *testing.T) {
+	iss := newTestIssuer(t)
+	v := newOIDCVerifier(iss.server.URL, "broker")
+
+	expired := iss.claims("alice")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAud := iss.claims("alice")
+	wrongAud["aud"] = "someone-else"
+	wrongIss := iss.claims("alice")
+	wrongIss["iss"] = "https://evil.example.com"
+
+	valid := iss.sign(t, "key1", iss.claims("alice"))
+	parts := strings.Split(valid, ".")
+	tamperedClaims, _ := json.Marshal(iss.claims("mallory"))
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(tamperedClaims) + "." + parts[2]
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key1"}`)) + "." + parts[1] + "."
+
+	tests := map[string]string{
+		"expired":        iss.sign(t, "key1", expired),
+		"wrong audience": iss.sign(t, "key1", wrongAud),
+		"wrong issuer":   iss.sign(t, "key1", wrongIss),
+		"unknown key":    iss.sign(t, "key2", iss.claims("alice")),
+		"tampered":       tampered,
+		"alg none":       unsigned,
+		"malformed":      "not-a-jwt",
+	}
+	for name, token := range tests {
+		if _, err := v.Verify(token); err == nil {
+			t.Errorf("%s: expected verification to fail", name)
+		}
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	if got := claimStrings("a"); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Unexpected %v", got)
+	}
+	if got := claimStrings([]interface{}{"a", 1, "b"}); len(got) != 2 || got[1] != "b" {
+		t.Errorf("Unexpected %v", got)
+	}
+	if got := claimStrings(nil); got != nil {
+		t.Errorf("Unexpected %v", got)
+	}
+}
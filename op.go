@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const opReferencePrefix = "op://"
+
+// opCommand is the 1Password CLI binary
+var opCommand = "op"
+
+// --op-refresh-token, a 1Password field to keep the refresh token in
+var flagOPRefreshToken string
+
+// secretFlags are the flags that may be given as op:// secret references,
+// or as - to read them from stdin
+var secretFlags = []string{"client-secret", "refresh-token"}
+
+// opReference is a parsed op://vault/item/[section/]field reference
+type opReference struct {
+	vault, item, section, field string
+}
+
+func parseOPReference(ref string) (*opReference, error) {
+	rest, ok := strings.CutPrefix(ref, opReferencePrefix)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a 1Password reference (op://vault/item/field)", ref)
+	}
+	parts := strings.Split(rest, "/")
+	for _, p := range parts {
+		if p == "" {
+			parts = nil
+			break
+		}
+	}
+	switch len(parts) {
+	case 3:
+		return &opReference{vault: parts[0], item: parts[1], field: parts[2]}, nil
+	case 4:
+		return &opReference{vault: parts[0], item: parts[1], section: parts[2], field: parts[3]}, nil
+	}
+	return nil, fmt.Errorf("%q is not a 1Password reference (op://vault/item/field)", ref)
+}
+
+// resolveSecretReferences replaces op:// references given for the secret
+// flags of cmd, directly or through the environment, with the values the
+// 1Password CLI reads for them
+func resolveSecretReferences(cmd *cobra.Command) error {
+	for _, name := range secretFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || !strings.HasPrefix(flag.Value.String(), opReferencePrefix) {
+			continue
+		}
+		ref := flag.Value.String()
+		value, err := opRead(ref)
+		if err != nil {
+			return fmt.Errorf("error resolving --%s: %v", name, err)
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid --%s from %s: %v", name, ref, err)
+		}
+		verbosef("Using --%s from %s", name, ref)
+	}
+	return nil
+}
+
+// op runs the 1Password CLI, which takes care of signing in, with stdin as
+// its input
+func op(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(opCommand, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("op %s failed: %v: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("op %s failed: %v", args[0], err)
+	}
+	return out, nil
+}
+
+func opRead(ref string) (string, error) {
+	if _, err := parseOPReference(ref); err != nil {
+		return "", err
+	}
+	out, err := op(nil, "read", "--no-newline", ref)
+	if err != nil {
+		return "", err
+	}
+	defer wipeBytes(out)
+	return string(out), nil
+}
+
+// writeOPRefreshToken saves token in the field named by --op-refresh-token.
+// The item is edited through a JSON template on stdin, so the token never
+// shows up in op's command line.
+func writeOPRefreshToken(token string) error {
+	if flagOPRefreshToken == "" || token == "" {
+		return nil
+	}
+	ref, err := parseOPReference(flagOPRefreshToken)
+	if err != nil {
+		return err
+	}
+	raw, err := op(nil, "item", "get", ref.item, "--vault", ref.vault, "--format", "json")
+	if err != nil {
+		return err
+	}
+	defer wipeBytes(raw)
+
+	// Decoded loosely, so every part of the item op does not need changing
+	// goes back as it came
+	var item map[string]interface{}
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return fmt.Errorf("error decoding 1Password item: %v", err)
+	}
+	fields, _ := item["fields"].([]interface{})
+	var target map[string]interface{}
+	for _, f := range fields {
+		field, ok := f.(map[string]interface{})
+		if ok && ref.matches(field) {
+			target = field
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("item %q in vault %q has no field %q; add it in 1Password first", ref.item, ref.vault, ref.field)
+	}
+	target["value"] = token
+
+	template, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("error encoding 1Password item: %v", err)
+	}
+	defer wipeBytes(template)
+	id, _ := item["id"].(string)
+	if id == "" {
+		id = ref.item
+	}
+	out, err := op(template, "item", "edit", id, "--vault", ref.vault, "--format", "json")
+	wipeBytes(out)
+	if err != nil {
+		return err
+	}
+	verbosef("Saved the refresh token to %s", flagOPRefreshToken)
+	return nil
+}
+
+// matches reports whether an item field is the one the reference names, by
+// label or ID
+func (r *opReference) matches(field map[string]interface{}) bool {
+	if field["label"] != r.field && field["id"] != r.field {
+		return false
+	}
+	if r.section == "" {
+		return true
+	}
+	section, _ := field["section"].(map[string]interface{})
+	return section != nil && (section["label"] == r.section || section["id"] == r.section)
+}
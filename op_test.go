@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// fakeOPScript stands in for the 1Password CLI: it reads one secret, and
+// gets and edits the item kept in $OP_FAKE_ITEM
+const fakeOPScript = `#!/bin/sh
+case "$1" in
+read)
+	[ "$3" = "op://CI/Salesforce/client secret" ] || { echo "[ERROR] could not read secret $3" >&2; exit 1; }
+	printf %s "resolved-secret" ;;
+item)
+	case "$2" in
+	get) cat "$OP_FAKE_ITEM" ;;
+	edit) cat > "$OP_FAKE_ITEM.new" && mv "$OP_FAKE_ITEM.new" "$OP_FAKE_ITEM" && cat "$OP_FAKE_ITEM" ;;
+	esac ;;
+esac
+`
+
+const fakeOPItem = `{
+  "id": "abc123",
+  "title": "Salesforce",
+  "vault": {"id": "v1", "name": "CI"},
+  "sections": [{"id": "s1", "label": "prod"}],
+  "fields": [
+    {"id": "username", "type": "STRING", "label": "username", "value": "ci@example.com"},
+    {"id": "f1", "type": "CONCEALED", "label": "refresh token", "value": "old"},
+    {"id": "f2", "type": "CONCEALED", "label": "refresh token", "section": {"id": "s1", "label": "prod"}, "value": "old"}
+  ]
+}`
+
+// withFakeOP puts a fake op on the PATH and returns the item file it edits
+func withFakeOP(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake op is a shell script")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "op"), []byte(fakeOPScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	item := filepath.Join(dir, "item.json")
+	if err := os.WriteFile(item, []byte(fakeOPItem), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("OP_FAKE_ITEM", item)
+	return item
+}
+
+func withOPRefreshToken(t *testing.T, ref string) {
+	t.Helper()
+	old := flagOPRefreshToken
+	flagOPRefreshToken = ref
+	t.Cleanup(func() { flagOPRefreshToken = old })
+}
+
+func TestParseOPReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want *opReference
+	}{
+		{"op://CI/Salesforce/password", &opReference{vault: "CI", item: "Salesforce", field: "password"}},
+		{"op://CI/Salesforce/prod/refresh token", &opReference{vault: "CI", item: "Salesforce", section: "prod", field: "refresh token"}},
+		{"op://CI/Salesforce", nil},
+		{"op://CI//password", nil},
+		{"op://a/b/c/d/e", nil},
+		{"vault/item/field", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseOPReference(tt.ref)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseOPReference(%q) = %+v, want an error", tt.ref, got)
+			}
+			continue
+		}
+		if err != nil || *got != *tt.want {
+			t.Errorf("parseOPReference(%q) = %+v, %v; want %+v", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveSecretReferences(t *testing.T) {
+	withFakeOP(t)
+	var secret, clientID string
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringVar(&secret, "client-secret", "", "")
+	cmd.Flags().StringVar(&clientID, "client-id", "", "")
+
+	cmd.Flags().Set("client-secret", "op://CI/Salesforce/client secret")
+	cmd.Flags().Set("client-id", "op://CI/Salesforce/client id")
+	if err := resolveSecretReferences(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if secret != "resolved-secret" {
+		t.Errorf("client-secret = %q, want the value op read", secret)
+	}
+	if clientID != "op://CI/Salesforce/client id" {
+		t.Errorf("client-id = %q, want it left alone", clientID)
+	}
+
+	cmd.Flags().Set("client-secret", "op://CI/Salesforce/missing")
+	err := resolveSecretReferences(cmd)
+	if err == nil || !strings.Contains(err.Error(), "could not read secret") {
+		t.Errorf("resolving a missing secret error = %v", err)
+	}
+}
+
+func TestWriteOPRefreshToken(t *testing.T) {
+	item := withFakeOP(t)
+
+	readFields := func() []map[string]interface{} {
+		t.Helper()
+		raw, err := os.ReadFile(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Title  string                   `json:"title"`
+			Fields []map[string]interface{} `json:"fields"`
+		}
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "Salesforce" {
+			t.Errorf("item title = %q, want the rest of the item kept", got.Title)
+		}
+		return got.Fields
+	}
+
+	withOPRefreshToken(t, "op://CI/Salesforce/prod/refresh token")
+	if err := writeOPRefreshToken("new-refresh"); err != nil {
+		t.Fatal(err)
+	}
+	fields := readFields()
+	if fields[2]["value"] != "new-refresh" || fields[1]["value"] != "old" {
+		t.Errorf("fields after write = %v, want only the prod section's refresh token set", fields)
+	}
+
+	withOPRefreshToken(t, "op://CI/Salesforce/f1")
+	if err := writeOPRefreshToken("by-id"); err != nil {
+		t.Fatal(err)
+	}
+	if fields := readFields(); fields[1]["value"] != "by-id" {
+		t.Errorf("field f1 = %v, want it matched by ID", fields[1]["value"])
+	}
+
+	withOPRefreshToken(t, "op://CI/Salesforce/api key")
+	if err := writeOPRefreshToken("x"); err == nil || !strings.Contains(err.Error(), "no field") {
+		t.Errorf("writing a missing field error = %v", err)
+	}
+}
+
+func TestWriteOPRefreshTokenDisabled(t *testing.T) {
+	withOPRefreshToken(t, "")
+	old := opCommand
+	opCommand = "/nonexistent/op"
+	defer func() { opCommand = old }()
+
+	if err := writeOPRefreshToken("token"); err != nil {
+		t.Errorf("writeOPRefreshToken without --op-refresh-token = %v, want nothing run", err)
+	}
+}
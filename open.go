@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagOpenAlias string
+	flagOpenPath  string
+)
+
+var openCmd = &cobra.Command{
+	Use:   "open",
+	Short: "Open a stored org in the browser",
+	Long: `Print a frontdoor.jsp URL that starts a browser session in the org saved
+under --alias (or the default org) with its stored access token, and open it.
+--path picks the page to land on, such as /lightning/setup/SetupOneHome/home.
+
+The access token is checked first and refreshed if it has expired. It needs
+the "full" or "web" scope for Salesforce to accept it as a session.`,
+	Args: cobra.NoArgs,
+	Run:  runOpen,
+}
+
+func init() {
+	openCmd.Flags().StringVarP(&flagOpenAlias, "alias", "a", "", "Alias of the stored org (default: the default org)")
+	openCmd.Flags().StringVarP(&flagOpenPath, "path", "p", "", "Page to open, relative to the instance (e.g. /lightning/o/Account/list)")
+
+	rootCmd.AddCommand(openCmd)
+}
+
+func runOpen(cmd *cobra.Command, args []string) {
+	if err := checkOpenPath(flagOpenPath); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	store, org, err := useStoredOrg(flagOpenAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	// frontdoor.jsp sends an expired session to the login page, so make sure
+	// the token still works before handing it over
+	var userinfo struct{}
+	if err := orgGetJSON(store, org, "/services/oauth2/userinfo", &userinfo); err != nil {
+		log.Fatalf("Error checking the org's session: %v", err)
+	}
+	openURL := frontdoorURL(org, flagOpenPath)
+
+	if outputFormat(outputText) == outputJSON {
+		result := struct {
+			URL         string `json:"url"`
+			InstanceURL string `json:"instance_url"`
+		}{openURL, org.InstanceURL}
+		if err := writeJSON(result); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+	} else {
+		infof("Opening %s", org.Alias)
+		fmt.Println(openURL)
+	}
+	if err := authDeps.Browser.Open(openURL); err != nil {
+		log.Printf("Warning: could not open browser: %v", err)
+	}
+}
+
+// checkOpenPath only accepts paths on the org's own instance
+func checkOpenPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return fmt.Errorf("--path must be a path on the instance starting with /, got %q", path)
+	}
+	return nil
+}
+
+// frontdoorURL builds a URL that starts a browser session with the org's
+// access token and continues to retURL, or the home page when it is empty
+func frontdoorURL(org *StoredOrg, retURL string) string {
+	params := url.Values{}
+	params.Set("sid", org.AccessToken)
+	if retURL != "" {
+		params.Set("retURL", retURL)
+	}
+	return strings.TrimSuffix(org.InstanceURL, "/") + "/secur/frontdoor.jsp?" + params.Encode()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFrontdoorURL(t *testing.T) {
+	org := &StoredOrg{AccessToken: "00D!session", InstanceURL: "https://acme.my.salesforce.com/"}
+	u, err := url.Parse(frontdoorURL(org, "/lightning/o/Account/list?filterName=Recent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "acme.my.salesforce.com" || u.Path != "/secur/frontdoor.jsp" {
+		t.Errorf("Unexpected frontdoor URL %s", u)
+	}
+	if q := u.Query(); q.Get("sid") != "00D!session" || q.Get("retURL") != "/lightning/o/Account/list?filterName=Recent" {
+		t.Errorf("Unexpected parameters %v", q)
+	}
+
+	u, err = url.Parse(frontdoorURL(org, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := u.Query()["retURL"]; ok {
+		t.Errorf("Expected no retURL without --path, got %s", u)
+	}
+}
+
+func TestCheckOpenPath(t *testing.T) {
+	for _, path := range []string{"", "/", "/lightning/setup/SetupOneHome/home"} {
+		if err := checkOpenPath(path); err != nil {
+			t.Errorf("checkOpenPath(%q): %v", path, err)
+		}
+	}
+	for _, path := range []string{"lightning/page/home", "https://evil.example.com/", "//evil.example.com/"} {
+		if err := checkOpenPath(path); err == nil {
+			t.Errorf("Expected checkOpenPath(%q) to fail", path)
+		}
+	}
+}
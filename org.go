@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var orgCmd = &cobra.Command{
+	Use:   "org",
+	Short: "List stored orgs and pick the default org",
+}
+
+var orgListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored orgs with their instance and token freshness",
+	Long: `List every org in the token store with its user, instance URL and when its
+access token expires. The default org is marked with "*".`,
+	Args: cobra.NoArgs,
+	Run:  runOrgList,
+}
+
+var orgUseCmd = &cobra.Command{
+	Use:   "use <alias>",
+	Short: "Set the default org",
+	Long: `Set the org used by refresh, whoami, export, logout, wait, login-as, open,
+limits, query, api, git-credential and streaming when no alias is given. The
+default is saved as "default_org" in config.json, in the profile selected
+with --profile if there is one.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runOrgUse,
+}
+
+func init() {
+	orgCmd.AddCommand(orgListCmd, orgUseCmd)
+	rootCmd.AddCommand(orgCmd)
+}
+
+// orgListJSON is the --output json form of an org list entry
+type orgListJSON struct {
+	Alias       string      `json:"alias"`
+	Username    string      `json:"username,omitempty"`
+	InstanceURL string      `json:"instance_url"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	State       expiryLevel `json:"state"`
+	Default     bool        `json:"default"`
+}
+
+func runOrgList(cmd *cobra.Command, args []string) {
+	thresholds, orgs := openExpiryCheck(nil)
+	now := authDeps.Clock.Now()
+	results := checkExpiry(thresholds, orgs, now)
+	if outputFormat(outputText) == outputJSON {
+		out := make([]orgListJSON, 0, len(results))
+		for _, r := range results {
+			out = append(out, orgListJSON{
+				Alias:       r.Org.Alias,
+				Username:    r.Org.Username,
+				InstanceURL: r.Org.InstanceURL,
+				ExpiresAt:   r.ExpiresAt,
+				State:       r.Level,
+				Default:     r.Org.Alias == defaultOrg,
+			})
+		}
+		if err := writeJSON(out); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+		return
+	}
+	writeOrgList(os.Stdout, results, defaultOrg, now, useColor(os.Stdout))
+}
+
+func writeOrgList(out io.Writer, results []orgExpiry, defaultAlias string, now time.Time, color bool) {
+	if len(results) == 0 {
+		fmt.Fprintln(out, "No orgs in the token store")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ALIAS\tUSER\tINSTANCE URL\tEXPIRES\tSTATE")
+	for _, r := range results {
+		marker := "  "
+		if r.Org.Alias == defaultAlias {
+			marker = "* "
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\n", marker, r.Org.Alias, orDash(orgUserLabel(r.Org)), orDash(r.Org.InstanceURL), describeExpiry(r.ExpiresAt, now), colorLevel(r.Level, string(r.Level), color))
+	}
+	w.Flush()
+}
+
+func runOrgUse(cmd *cobra.Command, args []string) {
+	store, org, err := openStoredOrg(args[0])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	store.Close()
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	if err := setDefaultOrg(dir, flagProfile, org.Alias); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	infof("Default org set to %q", org.Alias)
+}
+
+// setDefaultOrg records alias as the default org in config.json, in the
+// named profile if one is given
+func setDefaultOrg(dir, profile, alias string) error {
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		cfg.DefaultOrg = alias
+	} else {
+		p, ok := cfg.Profiles[profile]
+		if !ok || p == nil {
+			return fmt.Errorf("profile %q not found in %s", profile, configFileName)
+		}
+		p.DefaultOrg = alias
+	}
+	return saveConfig(dir, cfg)
+}
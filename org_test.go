@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteOrgList(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	results := []orgExpiry{
+		{Org: &StoredOrg{Alias: "dev", InstanceURL: "https://acme--dev.sandbox.my.salesforce.com"}, ExpiresAt: now.Add(-10 * time.Minute), Level: expiryExpired},
+		{Org: &StoredOrg{Alias: "prod", Username: "me@example.com", InstanceURL: "https://acme.my.salesforce.com"}, ExpiresAt: now.Add(90 * time.Minute), Level: expiryOK},
+	}
+
+	var out bytes.Buffer
+	writeOrgList(&out, results, "prod", now, false)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and two rows:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[1], "  dev") || !strings.Contains(lines[1], "10m ago") {
+		t.Errorf("Unexpected row for dev: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "* prod") || !strings.Contains(lines[2], "https://acme.my.salesforce.com") || !strings.Contains(lines[2], "in 1h30m") {
+		t.Errorf("Expected prod marked as the default: %q", lines[2])
+	}
+}
+
+func TestSetDefaultOrg(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(`{"store": "bolt", "profiles": {"team": {"store": "sqlite"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setDefaultOrg(dir, "", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setDefaultOrg(dir, "team", "shared"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setDefaultOrg(dir, "missing", "prod"); err == nil {
+		t.Error("Expected an unknown profile to be rejected")
+	}
+
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DefaultOrg != "prod" || cfg.Store != storeTypeBolt {
+		t.Errorf("Unexpected top-level config %+v", cfg)
+	}
+	team, err := cfg.withProfile("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.DefaultOrg != "shared" || team.Store != storeTypeSQLite {
+		t.Errorf("Unexpected profile config %+v", team)
+	}
+}
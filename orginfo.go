@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// salesforceAPIVersion is the REST API version used for org queries
+const salesforceAPIVersion = "v60.0"
+
+const organizationQuery = "SELECT Name, OrganizationType, InstanceName, IsSandbox FROM Organization"
+
+var orgInfoClient = &http.Client{Timeout: 15 * time.Second}
+
+// enrichOrg fills in the user's identity details and the org's name,
+// edition and instance so stored orgs can be told apart by more than their
+// alias
+func enrichOrg(org *StoredOrg) error {
+	var userinfo struct {
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+		Email             string `json:"email"`
+		Picture           string `json:"picture"`
+	}
+	if err := getOrgJSON(org, "/services/oauth2/userinfo", &userinfo); err != nil {
+		return fmt.Errorf("error fetching user info: %v", err)
+	}
+
+	var result struct {
+		Records []struct {
+			Name             string `json:"Name"`
+			OrganizationType string `json:"OrganizationType"`
+			InstanceName     string `json:"InstanceName"`
+			IsSandbox        bool   `json:"IsSandbox"`
+		} `json:"records"`
+	}
+	query := "/services/data/" + salesforceAPIVersion + "/query?q=" + url.QueryEscape(organizationQuery)
+	if err := getOrgJSON(org, query, &result); err != nil {
+		return fmt.Errorf("error querying organization: %v", err)
+	}
+	if len(result.Records) != 1 {
+		return fmt.Errorf("organization query returned %d records", len(result.Records))
+	}
+
+	record := result.Records[0]
+	if userinfo.PreferredUsername != "" {
+		org.Username = userinfo.PreferredUsername
+	}
+	org.DisplayName = userinfo.Name
+	org.Email = userinfo.Email
+	org.PhotoURL = userinfo.Picture
+	org.OrgName = record.Name
+	org.Edition = record.OrganizationType
+	org.InstanceName = record.InstanceName
+	org.IsSandbox = record.IsSandbox
+	return nil
+}
+
+// getOrgJSON sends an authenticated GET for path on the org's instance
+func getOrgJSON(org *StoredOrg, path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(org.InstanceURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+org.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	verbosef("GET %s", req.URL)
+	resp, err := doWithRateLimitRetry(orgInfoClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &apiStatusError{Status: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// orgUserLabel names the org's user for listings: the display name and
+// username when both are known
+func orgUserLabel(org *StoredOrg) string {
+	username := org.Username
+	if username == "" {
+		username = org.UserID
+	}
+	if org.DisplayName == "" {
+		return username
+	}
+	return fmt.Sprintf("%s <%s>", org.DisplayName, username)
+}
+
+// orgEdition describes the org's edition, marking sandboxes
+func orgEdition(org *StoredOrg) string {
+	if org.IsSandbox {
+		if org.Edition == "" {
+			return "sandbox"
+		}
+		return org.Edition + " (sandbox)"
+	}
+	return org.Edition
+}
+
+// orgInstance names the instance the org runs on, falling back to its URL
+// for orgs saved before the instance was recorded
+func orgInstance(org *StoredOrg) string {
+	if org.InstanceName != "" {
+		return org.InstanceName
+	}
+	return org.InstanceURL
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnrichOrg(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/services/oauth2/userinfo":
+			w.Write([]byte(`{"preferred_username": "me@example.com.uat", "name": "Pat Smith", "email": "pat@example.com", "picture": "https://acme.file.force.com/profilephoto/005/F"}`))
+		case "/services/data/" + salesforceAPIVersion + "/query":
+			if r.URL.Query().Get("q") != organizationQuery {
+				t.Errorf("Unexpected query %q", r.URL.Query().Get("q"))
+			}
+			w.Write([]byte(`{"records": [{"Name": "Acme", "OrganizationType": "Enterprise Edition", "InstanceName": "CS42", "IsSandbox": true}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{Alias: "uat", InstanceURL: server.URL + "/", AccessToken: "access"}
+	if err := enrichOrg(org); err != nil {
+		t.Fatal(err)
+	}
+	if org.Username != "me@example.com.uat" || org.OrgName != "Acme" || org.InstanceName != "CS42" {
+		t.Errorf("Unexpected org details %+v", org)
+	}
+	if org.DisplayName != "Pat Smith" || org.Email != "pat@example.com" || org.PhotoURL == "" {
+		t.Errorf("Unexpected identity details %+v", org)
+	}
+	if got := orgUserLabel(org); got != "Pat Smith <me@example.com.uat>" {
+		t.Errorf("Unexpected user label %q", got)
+	}
+	if got := orgEdition(org); got != "Enterprise Edition (sandbox)" {
+		t.Errorf("Unexpected edition %q", got)
+	}
+
+	org.AccessToken = "expired"
+	if err := enrichOrg(org); err == nil {
+		t.Error("Expected a rejected access token to fail")
+	}
+}
+
+func TestOrgInstanceFallback(t *testing.T) {
+	org := &StoredOrg{InstanceURL: "https://acme.my.salesforce.com"}
+	if got := orgInstance(org); got != org.InstanceURL {
+		t.Errorf("Expected the instance URL for orgs without an instance name, got %q", got)
+	}
+	if got := orgEdition(org); got != "" {
+		t.Errorf("Expected no edition, got %q", got)
+	}
+	org.UserID = "005000000000001AAA"
+	if got := orgUserLabel(org); got != org.UserID {
+		t.Errorf("Expected the user ID without a username, got %q", got)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var orgSwitchCmd = &cobra.Command{
+	Use:   "switch",
+	Short: "Pick the default org from a list in the terminal",
+	Long: `Show the stored orgs with their user, instance URL and token freshness, and
+pick the default org with the arrow keys and Enter, as "org use" would.
+
+From the list, r refreshes the highlighted org's access token, o opens it in
+the browser and l logs out of it. q or Esc leaves without changing the
+default.`,
+	Args: cobra.NoArgs,
+	Run:  runOrgSwitch,
+}
+
+func init() {
+	orgCmd.AddCommand(orgSwitchCmd)
+}
+
+// pickerKey is a key press in the org picker
+type pickerKey int
+
+const (
+	keyOther pickerKey = iota
+	keyUp
+	keyDown
+	keyEnter
+	keyQuit
+	keyRefresh
+	keyOpen
+	keyLogout
+	keyYes
+)
+
+// readPickerKey reads one key press from a terminal in raw mode
+func readPickerKey(r *bufio.Reader) (pickerKey, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return keyOther, err
+	}
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case 'q', 3: // 3 is Ctrl-C
+		return keyQuit, nil
+	case 'k':
+		return keyUp, nil
+	case 'j':
+		return keyDown, nil
+	case 'r':
+		return keyRefresh, nil
+	case 'o':
+		return keyOpen, nil
+	case 'l':
+		return keyLogout, nil
+	case 'y', 'Y':
+		return keyYes, nil
+	case 0x1b:
+		// An arrow key is ESC [ A; ESC on its own is a quit
+		if r.Buffered() == 0 {
+			return keyQuit, nil
+		}
+		if next, _ := r.ReadByte(); next != '[' && next != 'O' {
+			return keyOther, nil
+		}
+		switch code, _ := r.ReadByte(); code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+	}
+	return keyOther, nil
+}
+
+// pickerActions are the quick actions on the highlighted org
+type pickerActions struct {
+	refresh func(*StoredOrg) error
+	open    func(*StoredOrg) error
+	logout  func(*StoredOrg) error
+}
+
+// orgPicker is the state of the org switch list
+type orgPicker struct {
+	orgs         []orgExpiry
+	thresholds   *expiryThresholds
+	defaultAlias string
+	cursor       int
+	status       string
+	now          time.Time
+	color        bool
+}
+
+func newOrgPicker(results []orgExpiry, thresholds *expiryThresholds, defaultAlias string, now time.Time, color bool) *orgPicker {
+	p := &orgPicker{orgs: results, thresholds: thresholds, defaultAlias: defaultAlias, now: now, color: color}
+	for i, r := range results {
+		if r.Org.Alias == defaultAlias {
+			p.cursor = i
+		}
+	}
+	return p
+}
+
+// move moves the highlight, wrapping around at either end
+func (p *orgPicker) move(delta int) {
+	if len(p.orgs) > 0 {
+		p.cursor = (p.cursor + delta + len(p.orgs)) % len(p.orgs)
+	}
+}
+
+// render draws the list, highlighting the current org. It writes "\r\n"
+// line endings for a terminal in raw mode.
+func (p *orgPicker) render(out io.Writer) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "    ALIAS\tUSER\tINSTANCE URL\tEXPIRES\tSTATE")
+	for i, r := range p.orgs {
+		cursor, marker := "  ", "  "
+		if i == p.cursor {
+			cursor = "› "
+		}
+		if r.Org.Alias == p.defaultAlias {
+			marker = "* "
+		}
+		fmt.Fprintf(w, "%s%s%s\t%s\t%s\t%s\t%s\n", cursor, marker, r.Org.Alias, orDash(orgUserLabel(r.Org)), orDash(r.Org.InstanceURL), describeExpiry(r.ExpiresAt, p.now), colorLevel(r.Level, string(r.Level), p.color))
+	}
+	w.Flush()
+
+	fmt.Fprint(out, "\x1b[H\x1b[2J")
+	for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if i-1 == p.cursor && p.color {
+			line = "\x1b[7m" + line + colorResetCode
+		}
+		fmt.Fprint(out, line+"\r\n")
+	}
+	fmt.Fprint(out, "\r\n↑/↓ move  enter set default  r refresh  o open  l log out  q quit\r\n")
+	if p.status != "" {
+		fmt.Fprint(out, "\r\n"+p.status+"\r\n")
+	}
+}
+
+// run shows the picker until an org is chosen, returning its alias, or the
+// user quits, returning ""
+func (p *orgPicker) run(keys *bufio.Reader, out io.Writer, actions pickerActions) (string, error) {
+	for {
+		if len(p.orgs) == 0 {
+			return "", nil
+		}
+		p.render(out)
+		key, err := readPickerKey(keys)
+		if err != nil {
+			return "", err
+		}
+		current := p.orgs[p.cursor]
+		p.status = ""
+		switch key {
+		case keyUp:
+			p.move(-1)
+		case keyDown:
+			p.move(1)
+		case keyEnter:
+			return current.Org.Alias, nil
+		case keyQuit:
+			return "", nil
+		case keyRefresh:
+			if err := actions.refresh(current.Org); err != nil {
+				p.status = colorize(colorRed, fmt.Sprintf("Error: %v", err), p.color)
+				break
+			}
+			p.orgs[p.cursor] = orgExpiry{Org: current.Org, ExpiresAt: p.thresholds.expiresAt(current.Org), Level: p.thresholds.level(current.Org, p.now)}
+			p.status = fmt.Sprintf("Refreshed %q", current.Org.Alias)
+		case keyOpen:
+			if err := actions.open(current.Org); err != nil {
+				p.status = colorize(colorRed, fmt.Sprintf("Error: %v", err), p.color)
+				break
+			}
+			p.status = fmt.Sprintf("Opened %q in the browser", current.Org.Alias)
+		case keyLogout:
+			p.status = fmt.Sprintf("Log out of %q? [y/N]", current.Org.Alias)
+			p.render(out)
+			if confirm, err := readPickerKey(keys); err != nil || confirm != keyYes {
+				p.status = ""
+				if err != nil {
+					return "", err
+				}
+				break
+			}
+			if err := actions.logout(current.Org); err != nil {
+				p.status = colorize(colorRed, fmt.Sprintf("Error: %v", err), p.color)
+				break
+			}
+			p.orgs = append(p.orgs[:p.cursor], p.orgs[p.cursor+1:]...)
+			if p.cursor >= len(p.orgs) && p.cursor > 0 {
+				p.cursor--
+			}
+			if current.Org.Alias == p.defaultAlias {
+				p.defaultAlias = ""
+			}
+			p.status = fmt.Sprintf("Logged out of %q", current.Org.Alias)
+		}
+	}
+}
+
+func runOrgSwitch(cmd *cobra.Command, args []string) {
+	if !isInteractive() {
+		log.Fatalf("Error: org switch needs a terminal; use \"org use <alias>\" instead")
+	}
+	thresholds, orgs := openExpiryCheck(nil)
+	if len(orgs) == 0 {
+		fmt.Fprintln(os.Stderr, "No orgs in the token store")
+		return
+	}
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	fd := stdinFd
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		log.Fatalf("Error setting up the terminal: %v", err)
+	}
+	// The screen is restored around each action, so its output and any
+	// re-login prompt show normally
+	enter := func() { fmt.Fprint(os.Stderr, "\x1b[?1049h\x1b[?25l") }
+	leave := func() { fmt.Fprint(os.Stderr, "\x1b[?25h\x1b[?1049l") }
+	cooked := func(action func() error) error {
+		leave()
+		term.Restore(fd, state)
+		err := action()
+		term.MakeRaw(fd)
+		enter()
+		return err
+	}
+	actions := pickerActions{
+		refresh: func(org *StoredOrg) error {
+			return cooked(func() error { return refreshStoredOrg(store, org, nil) })
+		},
+		open: func(org *StoredOrg) error {
+			return cooked(func() error {
+				var userinfo struct{}
+				if err := orgGetJSON(store, org, "/services/oauth2/userinfo", &userinfo); err != nil {
+					return fmt.Errorf("error checking the org's session: %v", err)
+				}
+				return authDeps.Browser.Open(frontdoorURL(org, ""))
+			})
+		},
+		logout: func(org *StoredOrg) error {
+			return cooked(func() error { return logoutOrg(store, org, false) })
+		},
+	}
+
+	picker := newOrgPicker(checkExpiry(thresholds, orgs, authDeps.Clock.Now()), thresholds, defaultOrg, authDeps.Clock.Now(), useColor(os.Stderr))
+	enter()
+	alias, err := picker.run(stdin, os.Stderr, actions)
+	leave()
+	term.Restore(fd, state)
+	if err != nil {
+		log.Fatalf("Error reading the terminal: %v", err)
+	}
+	if alias == "" {
+		return
+	}
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	if err := setDefaultOrg(dir, flagProfile, alias); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	infof("Default org set to %q", alias)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadPickerKey(t *testing.T) {
+	keys := bufio.NewReader(strings.NewReader("\x1b[A\x1b[Bjk\rqrolyx"))
+	for _, want := range []pickerKey{keyUp, keyDown, keyDown, keyUp, keyEnter, keyQuit, keyRefresh, keyOpen, keyLogout, keyYes, keyOther} {
+		got, err := readPickerKey(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("readPickerKey = %d, want %d", got, want)
+		}
+	}
+
+	// Esc on its own
+	if got, _ := readPickerKey(bufio.NewReader(strings.NewReader("\x1b"))); got != keyQuit {
+		t.Errorf("Esc = %d, want keyQuit", got)
+	}
+}
+
+func testPicker(t *testing.T) *orgPicker {
+	t.Helper()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	thresholds := &expiryThresholds{Session: 2 * time.Hour, Warning: defaultExpiryWarning, Critical: defaultExpiryCritical}
+	orgs := []*StoredOrg{
+		{Alias: "dev", Username: "dev@acme.com", InstanceURL: "https://dev.my.salesforce.com", IssuedAt: now.Add(-time.Hour)},
+		{Alias: "prod", Username: "admin@acme.com", InstanceURL: "https://acme.my.salesforce.com", IssuedAt: now.Add(-3 * time.Hour)},
+		{Alias: "uat", Username: "qa@acme.com.uat", InstanceURL: "https://acme--uat.sandbox.my.salesforce.com", IssuedAt: now.Add(-time.Hour)},
+	}
+	return newOrgPicker(checkExpiry(thresholds, orgs, now), thresholds, "prod", now, false)
+}
+
+func TestOrgPickerRender(t *testing.T) {
+	p := testPicker(t)
+	var out bytes.Buffer
+	p.render(&out)
+	lines := strings.Split(out.String(), "\r\n")
+	if !strings.HasPrefix(lines[0], "\x1b[H\x1b[2J    ALIAS") {
+		t.Errorf("header = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "› * prod") || !strings.Contains(lines[2], "expired") {
+		t.Errorf("default org line = %q, want it highlighted, marked and expired", lines[2])
+	}
+	if !strings.HasPrefix(lines[1], "    dev") || !strings.Contains(lines[1], "dev@acme.com") {
+		t.Errorf("dev line = %q", lines[1])
+	}
+}
+
+func TestOrgPickerRun(t *testing.T) {
+	p := testPicker(t)
+	var refreshed, loggedOut []string
+	actions := pickerActions{
+		refresh: func(org *StoredOrg) error {
+			refreshed = append(refreshed, org.Alias)
+			org.IssuedAt = p.now
+			return nil
+		},
+		open: func(org *StoredOrg) error { return errors.New("no browser") },
+		logout: func(org *StoredOrg) error {
+			loggedOut = append(loggedOut, org.Alias)
+			return nil
+		},
+	}
+
+	// Refresh prod, fail to open it, decline then confirm logging out of
+	// uat, and pick the org the cursor falls back to
+	var out bytes.Buffer
+	alias, err := p.run(bufio.NewReader(strings.NewReader("ro\x1b[Blnly\r")), &out, actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias != "prod" {
+		t.Errorf("picked %q, want prod", alias)
+	}
+	if strings.Join(refreshed, ",") != "prod" || strings.Join(loggedOut, ",") != "uat" {
+		t.Errorf("refreshed %v and logged out of %v", refreshed, loggedOut)
+	}
+	if p.orgs[1].Level != expiryOK {
+		t.Errorf("prod is %s after a refresh", p.orgs[1].Level)
+	}
+	if len(p.orgs) != 2 {
+		t.Errorf("%d orgs left after logging out of one", len(p.orgs))
+	}
+	for _, want := range []string{`Refreshed "prod"`, "Error: no browser", `Log out of "uat"? [y/N]`, `Logged out of "uat"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q", want)
+		}
+	}
+}
+
+func TestOrgPickerQuit(t *testing.T) {
+	p := testPicker(t)
+	alias, err := p.run(bufio.NewReader(strings.NewReader("jq")), &bytes.Buffer{}, pickerActions{})
+	if err != nil || alias != "" {
+		t.Errorf("run = %q, %v after quitting", alias, err)
+	}
+	if p.cursor != 2 {
+		t.Errorf("cursor at %d, want 2", p.cursor)
+	}
+}
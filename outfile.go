@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// --out, a file to write token output to instead of stdout
+var flagOut string
+
+// writeTokenOutput prints a command's token output on stdout, writes it to
+// the --out file or hands it to GitHub Actions, then wipes it
+func writeTokenOutput(output []byte) error {
+	defer wipeBytes(output)
+	if flagGitHubActions {
+		return writeGitHubActions(os.Stdout, output)
+	}
+	if flagOut == "" {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+	if err := writeFileAtomic(flagOut, output); err != nil {
+		return err
+	}
+	infof("Wrote tokens to %s", flagOut)
+	return nil
+}
+
+// writeFileAtomic replaces path with data, readable only by the current
+// user. The data goes to a temporary file in the same directory that is
+// renamed over path, so readers never see a partial file and an existing
+// file is kept if the write fails.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp already uses 0600; Chmod makes it explicit where the umask
+	// or platform would differ
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error setting permissions on %s: %v", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new\n" {
+		t.Fatalf("Expected the file to be replaced, got %q (%v)", data, err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be gone, found %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDir(t *testing.T) {
+	if err := writeFileAtomic(filepath.Join(t.TempDir(), "missing", "tokens.json"), []byte("x")); err == nil {
+		t.Error("Expected a write into a missing directory to fail")
+	}
+}
+
+func TestWriteTokenOutputToFile(t *testing.T) {
+	withQuiet(t)
+	defer func() { flagOut = "" }()
+	flagOut = filepath.Join(t.TempDir(), "tokens.json")
+
+	output := []byte(`{"access_token":"secret"}` + "\n")
+	if err := writeTokenOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(flagOut)
+	if err != nil || string(data) != `{"access_token":"secret"}`+"\n" {
+		t.Errorf("Unexpected file contents %q (%v)", data, err)
+	}
+	for _, b := range output {
+		if b != 0 {
+			t.Fatal("Expected the output buffer to be wiped")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	outputJSON = "json"
+	outputText = "text"
+	// outputJSONCompact is JSON on a single line
+	outputJSONCompact = "json-compact"
+	outputYAML        = "yaml"
+	// outputEnv prints KEY=value lines for .env files
+	outputEnv = "env"
+	// outputTable is a two-column FIELD/VALUE table
+	outputTable = "table"
+	// outputShellFormat prints statements that export SF_* variables, in the
+	// dialect chosen with --shell
+	outputShellFormat = "shell"
+	// outputSfdxURL prints a login as an SFDX auth URL for sf org login sfdx-url
+	outputSfdxURL = "sfdx-url"
+)
+
+// outputFormats lists the --output values for help and error messages
+var outputFormats = []string{outputJSON, outputJSONCompact, outputYAML, outputEnv, outputShellFormat, outputTable, outputText, outputSfdxURL}
+
+// Global output flags, defined on the root command and inherited by every
+// subcommand
+var (
+	flagVerbose   bool
+	flagOutput    string
+	flagProfile   string
+	flagTokenOnly bool
+)
+
+// checkOutputFlags rejects contradictory or unknown output settings
+func checkOutputFlags() error {
+	if flagDebug {
+		flagVerbose = true
+	}
+	if flagQuiet && flagVerbose {
+		return fmt.Errorf("--quiet cannot be used with --verbose or --debug")
+	}
+	switch flagOutput {
+	case "", outputJSON, outputJSONCompact, outputYAML, outputEnv, outputShellFormat, outputTable, outputText, outputSfdxURL:
+	default:
+		return fmt.Errorf("unknown output format %q (use %s)", flagOutput, strings.Join(outputFormats, ", "))
+	}
+	if err := checkShellFlag(); err != nil {
+		return err
+	}
+	if err := checkGitHubActionsFlags(); err != nil {
+		return err
+	}
+	if err := checkTokenOnlyFlag(); err != nil {
+		return err
+	}
+	if flagFilter == "" {
+		outputFilter = nil
+		return nil
+	}
+	if flagOutput != "" && flagOutput != outputJSON && flagOutput != outputJSONCompact {
+		return fmt.Errorf("--filter works on JSON output and cannot be used with --output %s", flagOutput)
+	}
+	filter, err := parseFilter(flagFilter)
+	if err != nil {
+		return err
+	}
+	outputFilter = filter
+	return nil
+}
+
+// checkTokenOnlyFlag rejects the output settings --token-only replaces
+func checkTokenOnlyFlag() error {
+	switch {
+	case !flagTokenOnly:
+		return nil
+	case flagOutput != "":
+		return fmt.Errorf("--token-only cannot be used with --output")
+	case flagFilter != "":
+		return fmt.Errorf("--token-only cannot be used with --filter")
+	case flagGitHubActions:
+		return fmt.Errorf("--token-only cannot be used with --github-actions")
+	}
+	return nil
+}
+
+// tokenOnlyOutput is the --token-only output: the token alone, with a
+// newline only when it is printed to a terminal, so $(...) and pipes get
+// exactly the token
+func tokenOnlyOutput(token string) []byte {
+	out := []byte(token)
+	if flagOut == "" && term.IsTerminal(int(os.Stdout.Fd())) {
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// outputFormat is the format selected with --output, or the command's own
+// default when none was given. --filter implies JSON.
+func outputFormat(commandDefault string) string {
+	if flagOutput != "" {
+		return flagOutput
+	}
+	if outputFilter != nil {
+		return outputJSON
+	}
+	return commandDefault
+}
+
+// infof prints an informational message to stderr unless --quiet is set.
+// Stdout is kept for results, so they can be piped.
+func infof(format string, args ...interface{}) {
+	if !flagQuiet {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// verbosef prints a diagnostic message to stderr when --verbose is set.
+// It goes through the scrubber like the log output.
+func verbosef(format string, args ...interface{}) {
+	if flagVerbose {
+		fmt.Fprintf(scrubWriter{w: os.Stderr}, format+"\n", args...)
+	}
+}
+
+// writeJSON prints v as indented JSON on stdout
+func writeJSON(v interface{}) error {
+	data, err := marshalOutput(v, true)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// marshalOutput encodes v, newline-terminated, with --filter applied. The
+// result may hold tokens, so callers writing secrets wipe it afterwards.
+func marshalOutput(v interface{}, indent bool) ([]byte, error) {
+	var data []byte
+	var err error
+	if indent {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling JSON: %v", err)
+	}
+	if outputFilter == nil {
+		return append(data, '\n'), nil
+	}
+	defer wipeBytes(data)
+	return filterJSON(data, indent)
+}
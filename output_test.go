@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckOutputFlags(t *testing.T) {
+	defer func() { flagQuiet, flagVerbose, flagOutput = false, false, "" }()
+
+	for _, format := range append([]string{""}, outputFormats...) {
+		flagOutput = format
+		if err := checkOutputFlags(); err != nil {
+			t.Errorf("Output %q should be accepted: %v", format, err)
+		}
+	}
+
+	flagOutput = "xml"
+	if err := checkOutputFlags(); err == nil {
+		t.Error("Expected an unknown output format to be rejected")
+	}
+
+	flagOutput = ""
+	flagQuiet, flagVerbose = true, true
+	if err := checkOutputFlags(); err == nil {
+		t.Error("Expected --quiet with --verbose to be rejected")
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	defer func() { flagOutput = "" }()
+
+	if got := outputFormat(outputText); got != outputText {
+		t.Errorf("Expected the command default, got %q", got)
+	}
+	flagOutput = outputJSON
+	if got := outputFormat(outputText); got != outputJSON {
+		t.Errorf("Expected --output to win, got %q", got)
+	}
+}
+
+func TestFormatTokenResponse(t *testing.T) {
+	result := &TokenResponse{AccessToken: "access", RefreshToken: "refresh", InstanceURL: "https://na1.salesforce.com"}
+
+	data, err := formatTokenResponse(result, outputJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded TokenResponse
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != *result {
+		t.Errorf("Unexpected JSON output %s (%v)", data, err)
+	}
+
+	data, err = formatTokenResponse(result, outputText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "access_token: access\n") || !strings.HasSuffix(string(data), "\n") {
+		t.Errorf("Unexpected text output %q", data)
+	}
+	expiresAt := time.Date(2026, 10, 14, 14, 0, 0, 0, time.UTC)
+	result.ExpiresAt, result.ExpiresIn = &expiresAt, 7200
+	data, err = formatTokenResponse(result, outputText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "expires_at: 2026-10-14T14:00:00Z\nexpires_in: 7200\n") {
+		t.Errorf("Unexpected text output with expiry %q", data)
+	}
+}
+
+func TestGlobalFlagsInherited(t *testing.T) {
+	for _, name := range []string{"quiet", "verbose", "output", "token-only", "profile", "store"} {
+		if rootCmd.PersistentFlags().Lookup(name) == nil {
+			t.Errorf("--%s should be a persistent root flag", name)
+		}
+	}
+}
+
+func TestTokenOnly(t *testing.T) {
+	flagTokenOnly = true
+	defer func() { flagTokenOnly, flagOutput, flagFilter = false, "", "" }()
+
+	if err := checkOutputFlags(); err != nil {
+		t.Errorf("--token-only should be accepted: %v", err)
+	}
+	result := &TokenResponse{AccessToken: "00Dxx!access", RefreshToken: "refresh", InstanceURL: "https://na1.salesforce.com"}
+	data, err := formatTokenResponse(result, outputJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Test output is not a terminal, so there is no newline
+	if string(data) != "00Dxx!access" {
+		t.Errorf("--token-only printed %q", data)
+	}
+
+	for _, set := range []func(){
+		func() { flagOutput = outputText },
+		func() { flagFilter = ".access_token" },
+	} {
+		flagOutput, flagFilter = "", ""
+		set()
+		if err := checkOutputFlags(); err == nil {
+			t.Errorf("--token-only should be rejected with --output %q --filter %q", flagOutput, flagFilter)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+)
+
+const crashExitCode = 2
+
+// secretPatterns match the shapes sensitive values take in error messages,
+// URLs, form bodies and JSON so they can be masked without having to keep
+// a copy of every secret around for comparison
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// key=value, key: value and "key":"value" forms
+	{regexp.MustCompile(`(?i)\b(client_secret|access_token|refresh_token|id_token|password|assertion|client_assertion|subject_token|actor_token|asset_token|code_verifier|csrf_token|secret_id|\w+_sid)("?\s*[:=]\s*"?)([^"&\s,}]+)`), `${1}${2}[REDACTED]`},
+	// code and sid are ordinary words, so they are only masked as query or
+	// form parameters and as quoted JSON keys
+	{regexp.MustCompile(`(?i)((?:^|[?&])(?:code|sid)=)([^&\s"]+)`), `${1}[REDACTED]`},
+	{regexp.MustCompile(`(?i)("(?:code|sid)"\s*:\s*"?)([^"\s,}]+)`), `${1}[REDACTED]`},
+	// Authorization headers
+	{regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/!=-]+`), `${1} [REDACTED]`},
+	// Salesforce session IDs (access tokens) start with the org ID and a '!'
+	{regexp.MustCompile(`\b00D[A-Za-z0-9]{12,15}![A-Za-z0-9._-]+`), `[REDACTED]`},
+	// Vault service, batch and recovery tokens
+	{regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]{20,}`), `[REDACTED]`},
+	// Salesforce refresh tokens
+	{regexp.MustCompile(`\b5Aep[A-Za-z0-9._]{20,}`), `[REDACTED]`},
+}
+
+// scrubSecrets masks anything in s that looks like a credential
+func scrubSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// scrubWriter masks credentials in everything written through it. It is
+// installed as the log output so error messages never print secrets.
+type scrubWriter struct {
+	w io.Writer
+}
+
+func (s scrubWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(s.w, scrubSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// handlePanic must be deferred at the top of main and of every goroutine the
+// CLI starts. It replaces Go's default crash output, which prints the panic
+// value verbatim, with a scrubbed report.
+func handlePanic() {
+	if r := recover(); r != nil {
+		fmt.Fprint(os.Stderr, formatCrash(r, debug.Stack()))
+		os.Exit(crashExitCode)
+	}
+}
+
+func formatCrash(r interface{}, stack []byte) string {
+	return fmt.Sprintf("sfdc-auth crashed: %s\n\n%s\nPlease report this at https://github.com/mr-menno/sfdc-go-auth-cli/issues\n",
+		scrubSecrets(fmt.Sprint(r)), scrubSecrets(string(stack)))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScrubSecrets(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		leaked string
+	}{
+		{"form body", "grant_type=authorization_code&client_secret=ABCDEF123456&code=aPrx42", "ABCDEF123456"},
+		{"form code", "client_id=x&code=aPrxSuperSecretCode", "aPrxSuperSecretCode"},
+		{"query code", "GET /callback?code=aPrxQueryCode&state=s", "aPrxQueryCode"},
+		{"json code", `{"code": "aPrxJSONCode"}`, "aPrxJSONCode"},
+		{"json sid", `{"sid":"00Dsessionvalue"}`, "00Dsessionvalue"},
+		{"json", `{"access_token":"tok_value_123","instance_url":"https://x"}`, "tok_value_123"},
+		{"json spaced", `{"refresh_token": "refresh_value_123"}`, "refresh_value_123"},
+		{"bearer", "Authorization: Bearer abc.def-ghi", "abc.def-ghi"},
+		{"session id", "token 00D5g000004XyZ1!AQ4AQFakeSessionValue.abc was rejected", "AQ4AQFakeSessionValue"},
+		{"refresh token", "got 5Aep861TSESvWeug_xvFHRBTTbf_YrTWgEyjBJrfh3  back", "5Aep861TSESvWeug_xvFHRBTTbf"},
+		{"vault token", "login as hvs.CAESIJ2vQfakeVaultToken123 failed", "CAESIJ2vQfakeVaultToken123"},
+		{"approle secret id", `{"role_id":"r","secret_id":"6a174c20-f6de"}`, "6a174c20-f6de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scrubSecrets(tt.input)
+			if strings.Contains(got, tt.leaked) {
+				t.Errorf("scrubSecrets(%q) = %q still contains %q", tt.input, got, tt.leaked)
+			}
+			if !strings.Contains(got, "[REDACTED]") {
+				t.Errorf("scrubSecrets(%q) = %q should mark the redaction", tt.input, got)
+			}
+		})
+	}
+
+	// Ordinary text is left alone
+	for _, plain := range []string{
+		"Error exchanging code for tokens: token request failed with status: 400",
+		"unexpected status code: 400",
+		"sid: not set",
+	} {
+		if got := scrubSecrets(plain); got != plain {
+			t.Errorf("scrubSecrets should not alter %q, got %q", plain, got)
+		}
+	}
+}
+
+func TestScrubWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := scrubWriter{w: &buf}
+
+	input := []byte("request failed: client_secret=hunter2\n")
+	n, err := w.Write(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(input) {
+		t.Errorf("Write should report the original length %d, got %d", len(input), n)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("scrubWriter leaked the secret: %q", buf.String())
+	}
+}
+
+func TestFormatCrash(t *testing.T) {
+	r := errors.New(`decode failed near {"access_token":"00D5g000004XyZ1!AQ4AQsecret"}`)
+	stack := []byte("goroutine 1 [running]:\nmain.exchangeCodeForTokens(...)\n")
+
+	out := formatCrash(r, stack)
+	if strings.Contains(out, "AQ4AQsecret") {
+		t.Errorf("Crash report leaked the token: %s", out)
+	}
+	if !strings.Contains(out, "main.exchangeCodeForTokens") {
+		t.Error("Crash report should keep the stack trace")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+const (
+	passwordEnv      = "SFDC_AUTH_PASSWORD"
+	securityTokenEnv = "SFDC_AUTH_SECURITY_TOKEN"
+)
+
+var (
+	flagPasswordInsecure     bool
+	flagPasswordUsername     string
+	flagPasswordClientID     string
+	flagPasswordClientSecret string
+	flagPasswordDomain       string
+)
+
+var passwordCmd = &cobra.Command{
+	Use:   "password",
+	Short: "Log in with the legacy username-password grant",
+	Long: `Log in with the OAuth username-password (resource owner password) grant,
+for older sandboxes that still rely on it. The password and security token
+are prompted for without echo, or read from ` + passwordEnv + ` and
+` + securityTokenEnv + `.
+
+This grant hands the password to the tool, bypasses multi-factor
+authentication and is blocked by default in new orgs, so it must be
+enabled explicitly with --insecure-password-grant. Prefer the browser, JWT
+or device flows.`,
+	Args: cobra.NoArgs,
+	Run:  runPassword,
+}
+
+func init() {
+	passwordCmd.Flags().BoolVar(&flagPasswordInsecure, "insecure-password-grant", false, "Acknowledge that the username-password grant is insecure and use it anyway")
+	passwordCmd.Flags().StringVarP(&flagPasswordUsername, "username", "u", "", "Username to log in as")
+	passwordCmd.Flags().StringVarP(&flagPasswordClientID, "client-id", "c", "", "Salesforce Client ID (Consumer Key)")
+	passwordCmd.Flags().StringVarP(&flagPasswordClientSecret, "client-secret", "s", "", "Salesforce Client Secret (Consumer Secret); prompted for if not given")
+	passwordCmd.Flags().StringVarP(&flagPasswordDomain, "domain", "d", defaultSalesforceDomain, "Salesforce domain (e.g., test.salesforce.com)")
+	passwordCmd.Flags().StringVarP(&flagAlias, "alias", "a", "", "Alias to save the org under in the token store (defaults to the org ID)")
+	_ = passwordCmd.MarkFlagRequired("username")
+	_ = passwordCmd.MarkFlagRequired("client-id")
+
+	rootCmd.AddCommand(passwordCmd)
+}
+
+func runPassword(cmd *cobra.Command, args []string) {
+	if !flagPasswordInsecure {
+		log.Fatalf("Error: the username-password grant is insecure and disabled; pass --insecure-password-grant to use it anyway")
+	}
+	log.Printf("Warning: using the username-password grant, which bypasses multi-factor authentication")
+
+	clientID = flagPasswordClientID
+	clientSecret := newSecret([]byte(flagPasswordClientSecret))
+	flagPasswordClientSecret = ""
+	defer func() { clientSecret.Wipe() }()
+	if clientSecret.Empty() {
+		var err error
+		if clientSecret, err = readClientSecret(); err != nil {
+			log.Fatalf("Error getting client credentials: %v", err)
+		}
+	}
+
+	password, err := readPasswordWithToken()
+	if err != nil {
+		log.Fatalf("Error reading password: %v", err)
+	}
+	defer password.Wipe()
+
+	tokenResponse, err := exchangePassword(flagPasswordDomain, clientID, flagPasswordUsername, clientSecret, password)
+	password.Wipe()
+	if err != nil {
+		clientSecret.Wipe()
+		failLogin(err)
+	}
+	completeLogin(flagPasswordDomain, tokenResponse, clientSecret)
+}
+
+// exchangePassword performs the password grant. Salesforce expects the
+// security token appended to the password unless the IP is trusted.
+func exchangePassword(domain, clientID, username string, clientSecret, password *secret) (*SalesforceOAuthResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "password")
+	data.Set("client_id", clientID)
+	data.Set("username", username)
+	encoded := data.Encode()
+
+	// Both secrets are escaped straight into a body that is wiped once sent
+	body := make([]byte, 0, sfauth.FormBodyLen(encoded, "client_secret", clientSecret.Bytes())+sfauth.FormBodyLen("", "password", password.Bytes()))
+	body = append(body, encoded...)
+	body = sfauth.AppendFormValue(body, "client_secret", clientSecret.Bytes())
+	body = sfauth.AppendFormValue(body, "password", password.Bytes())
+	defer wipeBytes(body)
+
+	return withMaintenanceRetry("", func() (*SalesforceOAuthResponse, error) {
+		return postTokenBody(getSalesforceTokenURL(domain), "password", body)
+	})
+}
+
+// readPasswordWithToken returns the password with the security token
+// appended, from the environment or hidden prompts
+func readPasswordWithToken() (*secret, error) {
+	password, err := readHiddenValue(passwordEnv, msgPromptPassword)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) == 0 {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+	token, err := readHiddenValue(securityTokenEnv, msgPromptSecurityToken)
+	if err != nil {
+		wipeBytes(password)
+		return nil, err
+	}
+
+	combined := make([]byte, 0, len(password)+len(token))
+	combined = append(append(combined, password...), token...)
+	wipeBytes(password)
+	wipeBytes(token)
+	return newSecret(combined), nil
+}
+
+// readHiddenValue reads env, or prompts for the value without echoing it
+func readHiddenValue(env string, prompt *i18n.Message) ([]byte, error) {
+	if value := os.Getenv(env); value != "" {
+		return []byte(value), nil
+	}
+	return promptHidden(tr(prompt, nil))
+}
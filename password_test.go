@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExchangePassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "password" || r.FormValue("username") != "me@example.com.uat" ||
+			r.FormValue("password") != "p&ss w0rdTOKEN" || r.FormValue("client_secret") != "shh" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "authentication failure"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "access", "instance_url": "https://cs42.salesforce.com"}`))
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	t.Setenv(passwordEnv, "p&ss w0rd")
+	t.Setenv(securityTokenEnv, "TOKEN")
+	password, err := readPasswordWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer password.Wipe()
+	clientSecret := newSecret([]byte("shh"))
+	defer clientSecret.Wipe()
+
+	resp, err := exchangePassword("test.salesforce.com", "client", "me@example.com.uat", clientSecret, password)
+	if err != nil {
+		t.Fatalf("exchangePassword: %v", err)
+	}
+	if resp.AccessToken != "access" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	wrong := newSecret([]byte("wrong"))
+	defer wrong.Wipe()
+	if _, err := exchangePassword("test.salesforce.com", "client", "me@example.com.uat", clientSecret, wrong); !isInvalidGrant(err) {
+		t.Errorf("Expected invalid_grant for a wrong password, got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// unixPeerCredentials is not implemented here, so grpc refuses every call
+func unixPeerCredentials(conn *net.UnixConn) (uint32, int32, error) {
+	return 0, 0, errors.New("peer credentials are not supported on this platform")
+}
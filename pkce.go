@@ -0,0 +1,30 @@
+package main
+
+import "github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+
+var (
+	flagPKCE bool
+
+	// codeVerifier is the PKCE secret of the login in progress, empty when
+	// PKCE is not used
+	codeVerifier string
+)
+
+// pkceEnabled reports whether the login uses PKCE (RFC 7636). Salesforce
+// supports it for the web server flow; the other browser flows do not
+// exchange a code and the hybrid flow has its own code grant.
+func pkceEnabled() bool {
+	return flagPKCE && flagGrant == grantAuthorizationCode
+}
+
+// generateCodeVerifier returns 43 characters of base64url-encoded randomness,
+// the shortest verifier RFC 7636 allows
+func generateCodeVerifier() (string, error) {
+	return sfauth.NewCodeVerifier()
+}
+
+// codeChallenge derives the S256 challenge sent with the authorization
+// request from the verifier sent with the token request
+func codeChallenge(verifier string) string {
+	return sfauth.CodeChallenge(verifier)
+}
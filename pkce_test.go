@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	if got := codeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("codeChallenge = %q", got)
+	}
+	verifier, err := generateCodeVerifier()
+	if err != nil || len(verifier) != 43 {
+		t.Errorf("Expected a 43 character verifier, got %q (%v)", verifier, err)
+	}
+}
+
+func TestRunAuthFlowUsesPKCE(t *testing.T) {
+	withQuiet(t)
+	defer func() { codeVerifier = "" }()
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access"}}
+	browser := newFakeBrowser(url.Values{"code": {"the-code"}})
+	authURL := &fakeAuthURL{}
+	deps := &oauthDeps{AuthURL: authURL, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	// No client secret: with PKCE the app need not require one
+	if _, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil); err != nil {
+		t.Fatalf("runAuthFlow failed: %v", err)
+	}
+	<-browser.done
+
+	u, err := url.Parse(authURL.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := u.Query()
+	if codeVerifier == "" || params.Get("code_challenge") != codeChallenge(codeVerifier) || params.Get("code_challenge_method") != "S256" {
+		t.Errorf("Expected an S256 challenge for the verifier in %s", authURL.url)
+	}
+}
+
+func TestExchangeCodeSendsVerifier(t *testing.T) {
+	defer func() { codeVerifier = "" }()
+	codeVerifier = "the-verifier"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code_verifier") != "the-verifier" || r.FormValue("client_secret") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "invalid code verifier"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "access"}`))
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	if _, err := exchangeCodeForTokens("the-code", "login.salesforce.com", nil); err != nil {
+		t.Errorf("Expected the verifier to be sent without a secret: %v", err)
+	}
+}
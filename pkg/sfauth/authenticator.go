@@ -0,0 +1,227 @@
+package sfauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Authenticator runs the web server flow for one Connected App. Create it
+// with New and configure it with Options.
+type Authenticator struct {
+	clientID     string
+	clientSecret []byte
+	domain       string
+	redirectURI  string
+	listenAddr   string
+	scopes       []string
+	pkce         bool
+	httpClient   *http.Client
+	openBrowser  func(url string) error
+}
+
+// Option configures an Authenticator
+type Option func(*Authenticator)
+
+// DefaultRedirectURI is the callback URL an Authenticator listens on unless
+// WithRedirectURI gives another
+const DefaultRedirectURI = "http://localhost:8080/callback"
+
+// New returns an Authenticator for the Connected App with the given
+// consumer key. It logs in to DefaultDomain with PKCE, on DefaultRedirectURI.
+func New(clientID string, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		clientID:    clientID,
+		domain:      DefaultDomain,
+		redirectURI: DefaultRedirectURI,
+		pkce:        true,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// WithClientSecret sets the consumer secret, for Connected Apps that require
+// one in token requests
+func WithClientSecret(secret string) Option {
+	return func(a *Authenticator) { a.clientSecret = []byte(secret) }
+}
+
+// WithDomain sets the login host, such as test.salesforce.com or a My
+// Domain
+func WithDomain(domain string) Option {
+	return func(a *Authenticator) { a.domain = domain }
+}
+
+// WithRedirectURI sets the callback URL registered on the Connected App.
+// Login serves it on its port unless WithListenAddr says otherwise.
+func WithRedirectURI(redirectURI string) Option {
+	return func(a *Authenticator) { a.redirectURI = redirectURI }
+}
+
+// WithListenAddr sets the address the callback server listens on, when it
+// differs from the redirect URI's port, for example behind a port mapping
+func WithListenAddr(addr string) Option {
+	return func(a *Authenticator) { a.listenAddr = addr }
+}
+
+// WithScopes sets the scopes to request, such as "api" and "refresh_token"
+func WithScopes(scopes ...string) Option {
+	return func(a *Authenticator) { a.scopes = scopes }
+}
+
+// WithPKCE turns PKCE on or off; it is on by default
+func WithPKCE(enabled bool) Option {
+	return func(a *Authenticator) { a.pkce = enabled }
+}
+
+// WithHTTPClient sets the client for token and revoke requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Authenticator) { a.httpClient = client }
+}
+
+// WithBrowser sets how the user is sent to the authorization URL, for
+// example by opening it in the default browser. Without it Login only waits
+// for the callback, so the caller has to show the URL from AuthURL.
+func WithBrowser(open func(url string) error) Option {
+	return func(a *Authenticator) { a.openBrowser = open }
+}
+
+// AuthURL returns the authorization URL for a login with the given state and
+// PKCE challenge (empty without PKCE)
+func (a *Authenticator) AuthURL(state, codeChallenge string) string {
+	return BuildAuthURL(a.domain, AuthParams{
+		ClientID:      a.clientID,
+		RedirectURI:   a.redirectURI,
+		State:         state,
+		Scope:         strings.Join(a.scopes, " "),
+		CodeChallenge: codeChallenge,
+	})
+}
+
+// Exchange trades an authorization code for tokens
+func (a *Authenticator) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	return ExchangeCode(ctx, a.httpClient, a.domain, CodeExchange{
+		ClientID:     a.clientID,
+		ClientSecret: a.clientSecret,
+		RedirectURI:  a.redirectURI,
+		Code:         code,
+		CodeVerifier: codeVerifier,
+	})
+}
+
+// Refresh gets a new access token with a refresh token
+func (a *Authenticator) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	return Refresh(ctx, a.httpClient, a.domain, RefreshRequest{ClientID: a.clientID, ClientSecret: a.clientSecret, RefreshToken: refreshToken})
+}
+
+// Revoke revokes an access or refresh token
+func (a *Authenticator) Revoke(ctx context.Context, token string) error {
+	return Revoke(ctx, a.httpClient, a.domain, token)
+}
+
+// callbackResult is what the callback handler hands to Login
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// Login runs the web server flow: it serves the redirect URI, sends the user
+// to the authorization URL and exchanges the code the callback receives.
+// It returns when the exchange is done or ctx is cancelled.
+func (a *Authenticator) Login(ctx context.Context) (*Token, error) {
+	redirect, err := url.Parse(a.redirectURI)
+	if err != nil || redirect.Host == "" {
+		return nil, fmt.Errorf("invalid redirect URI %q", a.redirectURI)
+	}
+	if redirect.Scheme != "http" {
+		return nil, fmt.Errorf("the callback server only serves http redirect URIs, not %q", a.redirectURI)
+	}
+	listen := a.listenAddr
+	if listen == "" {
+		listen = "localhost:" + redirect.Port()
+		if redirect.Port() == "" {
+			listen = "localhost:80"
+		}
+	}
+	path := redirect.Path
+	if path == "" {
+		path = "/"
+	}
+
+	state, err := NewState()
+	if err != nil {
+		return nil, err
+	}
+	var verifier, challenge string
+	if a.pkce {
+		if verifier, err = NewCodeVerifier(); err != nil {
+			return nil, err
+		}
+		challenge = CodeChallenge(verifier)
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("error starting callback server: %v", err)
+	}
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		result := readCallback(r.URL.Query(), state)
+		if result.err != nil {
+			http.Error(w, "Login failed: "+result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Login complete. You can close this window.")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if a.openBrowser != nil {
+		if err := a.openBrowser(a.AuthURL(state, challenge)); err != nil {
+			return nil, fmt.Errorf("error opening browser: %v", err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return a.Exchange(ctx, result.code, verifier)
+	}
+}
+
+// readCallback takes the authorization code, or the OAuth error, from the
+// callback's query
+func readCallback(query url.Values, state string) callbackResult {
+	if query.Get("state") != state {
+		return callbackResult{err: errors.New("invalid state parameter")}
+	}
+	if code := query.Get("error"); code != "" {
+		return callbackResult{err: &Error{Code: code, Description: query.Get("error_description")}}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("no authorization code received")}
+	}
+	return callbackResult{code: code}
+}
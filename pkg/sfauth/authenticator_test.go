@@ -0,0 +1,98 @@
+package sfauth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// freeRedirectURI returns a loopback redirect URI on a port nothing listens on
+func freeRedirectURI(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return "http://" + l.Addr().String() + "/callback"
+}
+
+// callbackBrowser follows the authorization URL back to the redirect URI
+// with the given query, as Salesforce would after the user logged in
+func callbackBrowser(query url.Values) func(string) error {
+	return func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		params := u.Query()
+		if query.Get("state") == "" {
+			query.Set("state", params.Get("state"))
+		}
+		go func() {
+			resp, err := http.Get(params.Get("redirect_uri") + "?" + query.Encode())
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+}
+
+func TestAuthenticatorLogin(t *testing.T) {
+	domain, client := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "abc" || r.Form.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"00D!AQ","instance_url":"https://na1.salesforce.com"}`))
+	})
+
+	auth := New("3MVG9",
+		WithDomain(domain),
+		WithRedirectURI(freeRedirectURI(t)),
+		WithScopes("api", "refresh_token"),
+		WithHTTPClient(client),
+		WithBrowser(callbackBrowser(url.Values{"code": {"abc"}})),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	token, err := auth.Login(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "00D!AQ" {
+		t.Errorf("Unexpected token %+v", token)
+	}
+}
+
+func TestAuthenticatorLoginErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	auth := New("3MVG9", WithRedirectURI(freeRedirectURI(t)), WithBrowser(callbackBrowser(url.Values{"error": {"access_denied"}, "error_description": {"end-user denied authorization"}})))
+	_, err := auth.Login(ctx)
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "access_denied" {
+		t.Errorf("Expected the callback's OAuth error, got %v", err)
+	}
+
+	auth = New("3MVG9", WithRedirectURI(freeRedirectURI(t)), WithBrowser(callbackBrowser(url.Values{"code": {"abc"}, "state": {"forged"}})))
+	if _, err := auth.Login(ctx); err == nil || err.Error() != "invalid state parameter" {
+		t.Errorf("Expected a forged state to be rejected, got %v", err)
+	}
+}
+
+func TestAuthenticatorLoginCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	auth := New("3MVG9", WithRedirectURI(freeRedirectURI(t)))
+	if _, err := auth.Login(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the login to stop with its context, got %v", err)
+	}
+}
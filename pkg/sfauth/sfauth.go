@@ -0,0 +1,381 @@
+// Package sfauth runs Salesforce OAuth 2.0 flows for Go programs: it builds
+// authorization URLs, exchanges authorization codes, refreshes and revokes
+// tokens, and with an Authenticator runs the whole browser login against a
+// loopback callback server.
+//
+// It is the library behind the sfdc-auth command line tool, without the
+// tool's token store, configuration or output handling.
+package sfauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDomain is the login host for production orgs. Sandboxes log in
+// through test.salesforce.com, and orgs with My Domain through their own.
+const DefaultDomain = "login.salesforce.com"
+
+// Token is a token endpoint response
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	InstanceURL  string `json:"instance_url"`
+	// ID is the identity URL of the user the token was issued to
+	ID        string `json:"id"`
+	TokenType string `json:"token_type"`
+	// IssuedAt is milliseconds since the epoch, as a string
+	IssuedAt  string `json:"issued_at"`
+	Signature string `json:"signature"`
+	// Scope is the space-separated list of scopes that were granted
+	Scope string `json:"scope,omitempty"`
+	// ExpiresIn is the lifetime of the access token in seconds, 0 when the
+	// token endpoint does not say
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	// IDToken is the OpenID Connect ID token, when the openid scope was
+	// granted
+	IDToken string `json:"id_token,omitempty"`
+	// Raw is the whole response body, for fields Token has no place for. It
+	// holds the tokens too; wipe it once done with it.
+	Raw []byte `json:"-"`
+}
+
+// Error is an OAuth error from the authorization or token endpoint
+type Error struct {
+	// Status is the HTTP status of a token endpoint response, 0 for an
+	// error returned to the callback
+	Status      int
+	Code        string
+	Description string
+	// RetryAfter is how long the Retry-After header of a 429 or 503
+	// response asked the client to wait, 0 when there was none
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := e.Code
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.Status == 0 {
+		return msg
+	}
+	if msg == "" {
+		return fmt.Sprintf("token request failed with status: %d", e.Status)
+	}
+	return fmt.Sprintf("token request failed with status: %d (%s)", e.Status, msg)
+}
+
+// RevokeError is a non-200 response from the revoke endpoint. Salesforce
+// answers 400 for a token that has already expired or been revoked.
+type RevokeError struct {
+	Status int
+}
+
+func (e *RevokeError) Error() string {
+	return fmt.Sprintf("revoke request failed with status: %d", e.Status)
+}
+
+// AuthorizeEndpoint is the authorization URL of a login domain
+func AuthorizeEndpoint(domain string) string {
+	return fmt.Sprintf("https://%s/services/oauth2/authorize", domain)
+}
+
+// TokenEndpoint is the token URL of a login domain
+func TokenEndpoint(domain string) string {
+	return fmt.Sprintf("https://%s/services/oauth2/token", domain)
+}
+
+// RevokeEndpoint is the revoke URL of a login domain
+func RevokeEndpoint(domain string) string {
+	return fmt.Sprintf("https://%s/services/oauth2/revoke", domain)
+}
+
+// AuthParams are the query parameters of an authorization URL
+type AuthParams struct {
+	ClientID    string
+	RedirectURI string
+	State       string
+	// Scope is space-separated; empty leaves the Connected App's defaults
+	Scope string
+	// CodeChallenge is the S256 PKCE challenge, see CodeChallenge
+	CodeChallenge string
+	// ResponseType defaults to "code", the web server flow
+	ResponseType string
+	// Nonce is echoed in the ID token's nonce claim when the openid scope is
+	// granted, see NewNonce
+	Nonce string
+}
+
+// BuildAuthURL returns the URL to send the user to in order to log in
+func BuildAuthURL(domain string, p AuthParams) string {
+	responseType := p.ResponseType
+	if responseType == "" {
+		responseType = "code"
+	}
+	params := url.Values{}
+	params.Add("response_type", responseType)
+	params.Add("client_id", p.ClientID)
+	params.Add("redirect_uri", p.RedirectURI)
+	if p.State != "" {
+		params.Add("state", p.State)
+	}
+	if p.Scope != "" {
+		params.Add("scope", p.Scope)
+	}
+	if p.CodeChallenge != "" {
+		params.Add("code_challenge", p.CodeChallenge)
+		params.Add("code_challenge_method", "S256")
+	}
+	if p.Nonce != "" {
+		params.Add("nonce", p.Nonce)
+	}
+	return AuthorizeEndpoint(domain) + "?" + params.Encode()
+}
+
+// CodeExchange is a web server flow token request
+type CodeExchange struct {
+	// GrantType defaults to "authorization_code"; the hybrid app flow uses
+	// "hybrid_auth_code"
+	GrantType string
+	ClientID  string
+	// ClientSecret is left out of the request when empty, for Connected Apps
+	// that do not require one. It is escaped straight into the request
+	// body, which is wiped once sent, so it never has to be a string.
+	ClientSecret []byte
+	RedirectURI  string
+	Code         string
+	// CodeVerifier is the PKCE verifier whose challenge was in the
+	// authorization URL
+	CodeVerifier string
+}
+
+// ExchangeCode trades an authorization code for tokens. A nil client uses
+// http.DefaultClient.
+func ExchangeCode(ctx context.Context, client *http.Client, domain string, req CodeExchange) (*Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", orDefault(req.GrantType, "authorization_code"))
+	data.Set("client_id", req.ClientID)
+	data.Set("redirect_uri", req.RedirectURI)
+	data.Set("code", req.Code)
+	if req.CodeVerifier != "" {
+		data.Set("code_verifier", req.CodeVerifier)
+	}
+	return postSecretForm(ctx, client, TokenEndpoint(domain), data, req.ClientSecret)
+}
+
+// RefreshRequest is a refresh token grant
+type RefreshRequest struct {
+	// GrantType defaults to "refresh_token"; hybrid app sessions are
+	// refreshed with "hybrid_refresh"
+	GrantType string
+	ClientID  string
+	// ClientSecret is optional, as Connected Apps can be configured not to
+	// require it for refreshes. It is wiped from the request body like the
+	// secret of a CodeExchange.
+	ClientSecret []byte
+	RefreshToken string
+}
+
+// Refresh gets a new access token with a refresh token. With refresh token
+// rotation, the returned Token also holds a new refresh token.
+func Refresh(ctx context.Context, client *http.Client, domain string, req RefreshRequest) (*Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", orDefault(req.GrantType, "refresh_token"))
+	data.Set("client_id", req.ClientID)
+	data.Set("refresh_token", req.RefreshToken)
+	return postSecretForm(ctx, client, TokenEndpoint(domain), data, req.ClientSecret)
+}
+
+// Revoke revokes an access or refresh token. Revoking a refresh token also
+// ends the sessions issued from it.
+func Revoke(ctx context.Context, client *http.Client, domain, token string) error {
+	data := url.Values{}
+	data.Set("token", token)
+	resp, err := postForm(ctx, client, RevokeEndpoint(domain), []byte(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("error making revoke request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &RevokeError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// PostToken posts an encoded form to a token endpoint and decodes the
+// response, for grants ExchangeCode and Refresh do not cover. A caller that
+// put secrets in form can wipe it once PostToken returns. Network errors are
+// wrapped, so they can be told apart from an *Error and retried.
+func PostToken(ctx context.Context, client *http.Client, endpoint string, form []byte) (*Token, error) {
+	resp, err := postForm(ctx, client, endpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("error making token request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ReadError(resp)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		wipe(raw)
+		return nil, fmt.Errorf("error reading token response: %v", err)
+	}
+	var token Token
+	if err := json.Unmarshal(raw, &token); err != nil {
+		wipe(raw)
+		return nil, fmt.Errorf("error decoding token response: %v", err)
+	}
+	token.Raw = raw
+	return &token, nil
+}
+
+// AppendFormValue appends key=value to a form-encoded body, escaping the
+// value byte by byte so a secret never has to be converted to a string
+func AppendFormValue(body []byte, key string, value []byte) []byte {
+	const hex = "0123456789ABCDEF"
+
+	if len(body) > 0 {
+		body = append(body, '&')
+	}
+	body = append(body, key...)
+	body = append(body, '=')
+	for _, c := range value {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			body = append(body, c)
+		case c == ' ':
+			body = append(body, '+')
+		default:
+			body = append(body, '%', hex[c>>4], hex[c&0x0f])
+		}
+	}
+	return body
+}
+
+// FormBodyLen is an upper bound on the size of a form body holding encoded
+// values and the escaped key=value, so the buffer can be allocated once and
+// never leave unwiped copies behind when it grows
+func FormBodyLen(encoded string, key string, value []byte) int {
+	return len(encoded) + 1 + len(key) + 1 + 3*len(value)
+}
+
+// postSecretForm posts data to a token endpoint with the client secret, when
+// there is one, escaped into a pre-sized body that is wiped once sent
+func postSecretForm(ctx context.Context, client *http.Client, endpoint string, data url.Values, clientSecret []byte) (*Token, error) {
+	encoded := data.Encode()
+	body := make([]byte, 0, FormBodyLen(encoded, "client_secret", clientSecret))
+	body = append(body, encoded...)
+	if len(clientSecret) > 0 {
+		body = AppendFormValue(body, "client_secret", clientSecret)
+	}
+	defer wipe(body)
+	return PostToken(ctx, client, endpoint, body)
+}
+
+func postForm(ctx context.Context, client *http.Client, endpoint string, form []byte) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(form))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(req)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// wipe zeroes b in place
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// ReadError builds the error for a non-200 token endpoint response from its
+// {"error", "error_description"} body
+func ReadError(resp *http.Response) *Error {
+	oauthErr := &Error{Status: resp.StatusCode, RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	var body struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil {
+		oauthErr.Code, oauthErr.Description = body.Error, body.Description
+	}
+	return oauthErr
+}
+
+// ParseRetryAfter reads a Retry-After header, given in seconds or as an HTTP
+// date, as the time left to wait from now. It is 0 when the header is
+// missing, invalid or already past.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	at, err := http.ParseTime(value)
+	if err != nil || !at.After(now) {
+		return 0
+	}
+	return at.Sub(now).Round(time.Second)
+}
+
+// NewCodeVerifier returns a PKCE code verifier: 43 characters of
+// base64url-encoded randomness, the shortest RFC 7636 allows
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating PKCE code verifier: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 challenge for the authorization URL from
+// the verifier sent with the token request
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewState returns a random state parameter to tie a callback to the
+// authorization request that started it
+func NewState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating state: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewNonce returns a random nonce for the authorization request, so an ID
+// token can be tied to the login it was issued for and not replayed
+func NewNonce() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating nonce: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
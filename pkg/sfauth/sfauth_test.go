@@ -0,0 +1,204 @@
+package sfauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer answers the token and revoke endpoints over TLS like a login
+// domain would; its host is passed as the domain
+func tokenServer(t *testing.T, handler http.HandlerFunc) (domain string, client *http.Client) {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://"), server.Client()
+}
+
+func TestBuildAuthURL(t *testing.T) {
+	got := BuildAuthURL("login.salesforce.com", AuthParams{
+		ClientID:      "3MVG9",
+		RedirectURI:   "http://localhost:8080/callback",
+		State:         "xyz",
+		Scope:         "api refresh_token",
+		CodeChallenge: "challenge",
+		Nonce:         "n-0S6",
+	})
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "login.salesforce.com" || u.Path != "/services/oauth2/authorize" {
+		t.Errorf("Unexpected endpoint %s", got)
+	}
+	q := u.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != "3MVG9" || q.Get("scope") != "api refresh_token" ||
+		q.Get("state") != "xyz" || q.Get("code_challenge") != "challenge" || q.Get("code_challenge_method") != "S256" || q.Get("nonce") != "n-0S6" {
+		t.Errorf("Unexpected parameters %v", q)
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	domain, client := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/oauth2/token" {
+			http.NotFound(w, r)
+			return
+		}
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != "abc" ||
+			r.Form.Get("code_verifier") != "verifier" || r.Form.Get("client_secret") != "s&h h" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"unexpected request"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"00D!AQ","refresh_token":"5Aep","instance_url":"https://na1.salesforce.com","scope":"api","expires_in":7200}`))
+	})
+
+	token, err := ExchangeCode(context.Background(), client, domain, CodeExchange{
+		ClientID: "3MVG9", ClientSecret: []byte("s&h h"), RedirectURI: DefaultRedirectURI, Code: "abc", CodeVerifier: "verifier",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "00D!AQ" || token.RefreshToken != "5Aep" || token.Scope != "api" || token.ExpiresIn != 7200 {
+		t.Errorf("Unexpected token %+v", token)
+	}
+	if !strings.Contains(string(token.Raw), `"instance_url"`) {
+		t.Errorf("Expected the raw response to be kept, got %q", token.Raw)
+	}
+}
+
+func TestRefreshGrantType(t *testing.T) {
+	domain, client := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "hybrid_refresh" || r.Form.Get("refresh_token") != "5Aep" || r.Form.Has("client_secret") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"unexpected request"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"00D!AQ","instance_url":"https://na1.salesforce.com"}`))
+	})
+
+	token, err := Refresh(context.Background(), client, domain, RefreshRequest{GrantType: "hybrid_refresh", ClientID: "3MVG9", RefreshToken: "5Aep"})
+	if err != nil || token.AccessToken != "00D!AQ" {
+		t.Fatalf("Refresh = %+v, %v", token, err)
+	}
+}
+
+func TestPostTokenNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	endpoint := server.URL
+	server.Close()
+
+	_, err := PostToken(context.Background(), nil, endpoint, []byte("grant_type=refresh_token"))
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("Expected the network error to be wrapped, got %v", err)
+	}
+}
+
+func TestAppendFormValue(t *testing.T) {
+	values := []string{"plain", "with space", "sym&bols=+/?%", "üñí", "a.b-c_d~e"}
+	for _, v := range values {
+		encoded := url.Values{"client_id": {"id"}}.Encode()
+		body := make([]byte, 0, FormBodyLen(encoded, "client_secret", []byte(v)))
+		body = append(body, encoded...)
+		capBefore := cap(body)
+		body = AppendFormValue(body, "client_secret", []byte(v))
+
+		if cap(body) != capBefore {
+			t.Errorf("Body for %q was reallocated", v)
+		}
+		parsed, err := url.ParseQuery(string(body))
+		if err != nil {
+			t.Fatalf("Body for %q does not parse: %v", v, err)
+		}
+		if got := parsed.Get("client_secret"); got != v {
+			t.Errorf("AppendFormValue round trip: got %q, want %q", got, v)
+		}
+		if got := parsed.Get("client_id"); got != "id" {
+			t.Errorf("Existing values should be preserved, got %q", got)
+		}
+	}
+}
+
+func TestRefreshError(t *testing.T) {
+	domain, client := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"expired access/refresh token"}`))
+	})
+
+	_, err := Refresh(context.Background(), client, domain, RefreshRequest{ClientID: "3MVG9", RefreshToken: "5Aep"})
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Status != http.StatusBadRequest || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("Expected an invalid_grant error, got %v", err)
+	}
+	if err.Error() != "token request failed with status: 400 (invalid_grant: expired access/refresh token)" {
+		t.Errorf("Unexpected message %q", err)
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	domain, client := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := Refresh(context.Background(), client, domain, RefreshRequest{ClientID: "3MVG9", RefreshToken: "5Aep"})
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Status != http.StatusTooManyRequests || oauthErr.RetryAfter != 7*time.Second {
+		t.Fatalf("Expected a 429 asking for 7s, got %v (%+v)", err, oauthErr)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		" 5 ":                           5 * time.Second,
+		"-3":                            0,
+		"soon":                          0,
+		"Fri, 01 Mar 2024 12:00:30 GMT": 30 * time.Second,
+		"Fri, 01 Mar 2024 11:59:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := ParseRetryAfter(value, now); got != want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	domain, client := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/services/oauth2/revoke" || r.Form.Get("token") != "5Aep" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	if err := Revoke(context.Background(), client, domain, "5Aep"); err != nil {
+		t.Fatal(err)
+	}
+	err := Revoke(context.Background(), client, domain, "stale")
+	var revokeErr *RevokeError
+	if !errors.As(err, &revokeErr) || revokeErr.Status != http.StatusBadRequest {
+		t.Errorf("Expected a RevokeError, got %v", err)
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Appendix B of RFC 7636
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Unexpected challenge %q", got)
+	}
+	verifier, err := NewCodeVerifier()
+	if err != nil || len(verifier) != 43 {
+		t.Errorf("Expected a 43 character verifier, got %q (%v)", verifier, err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// pluginPrefix names the executables on PATH that become subcommands, as
+// sfdc-auth-<name>
+const pluginPrefix = "sfdc-auth-"
+
+// Environment passed to plugins. pluginOrgEnv is also read, to pick the org
+// instead of the default org.
+const (
+	pluginOrgEnv         = "SFDC_AUTH_ORG"
+	pluginInstanceURLEnv = "SFDC_AUTH_INSTANCE_URL"
+	pluginUsernameEnv    = "SFDC_AUTH_USERNAME"
+	pluginOrgIDEnv       = "SFDC_AUTH_ORG_ID"
+	pluginBinEnv         = "SFDC_AUTH_BIN"
+)
+
+const pluginGroup = "plugins"
+
+// findPlugins lists the sfdc-auth-<name> executables in the PATH
+// directories, by name. The first one found wins, as for the shell.
+func findPlugins(path string) map[string]string {
+	plugins := map[string]string{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry.Name())
+			if !ok || plugins[name] != "" {
+				continue
+			}
+			file := filepath.Join(dir, entry.Name())
+			if info, err := os.Stat(file); err != nil || !isExecutable(info) {
+				continue
+			}
+			plugins[name] = file
+		}
+	}
+	return plugins
+}
+
+// pluginName is the subcommand an executable file provides, if any
+func pluginName(file string) (string, bool) {
+	if runtime.GOOS == "windows" {
+		if !strings.EqualFold(filepath.Ext(file), ".exe") {
+			return "", false
+		}
+		file = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	name := strings.TrimPrefix(file, pluginPrefix)
+	if name == file || name == "" || strings.ContainsAny(name, " \t") {
+		return "", false
+	}
+	return name, true
+}
+
+func isExecutable(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0
+}
+
+// addPluginCommands adds a subcommand for each plugin on path. Plugins do
+// not replace built-in commands.
+func addPluginCommands(root *cobra.Command, path string) {
+	plugins := findPlugins(path)
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		if !isBuiltinCommand(root, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	root.AddGroup(&cobra.Group{ID: pluginGroup, Title: "Plugin Commands:"})
+	for _, name := range names {
+		file := plugins[name]
+		root.AddCommand(&cobra.Command{
+			Use:                name,
+			Short:              "Plugin at " + file,
+			GroupID:            pluginGroup,
+			DisableFlagParsing: true,
+			Run: func(cmd *cobra.Command, args []string) {
+				runPlugin(file, args)
+			},
+		})
+	}
+}
+
+func isBuiltinCommand(root *cobra.Command, name string) bool {
+	if name == "help" || name == "completion" {
+		return true
+	}
+	for _, c := range root.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPlugin runs a plugin with the org context in its environment, and exits
+// with its exit status
+func runPlugin(file string, args []string) {
+	plugin := exec.Command(file, args...)
+	plugin.Stdin, plugin.Stdout, plugin.Stderr = os.Stdin, os.Stdout, os.Stderr
+	plugin.Env = append(os.Environ(), pluginEnv()...)
+
+	verbosef("Running plugin %s", file)
+	err := plugin.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		log.Fatalf("Error running plugin %s: %v", file, err)
+	}
+}
+
+// pluginEnv is the environment describing the org for a plugin: the org
+// named by SFDC_AUTH_ORG, or the default org. Its access token is refreshed
+// first if it is about to expire. Without an org, only the path of this
+// executable is passed.
+func pluginEnv() []string {
+	var env []string
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, pluginBinEnv+"="+exe)
+	}
+
+	store, org, err := openStoredOrg(os.Getenv(pluginOrgEnv))
+	if err != nil {
+		verbosef("Running the plugin without an org: %v", err)
+		return env
+	}
+	defer store.Close()
+	if !cachedTokenUsable(org, defaultRefreshMinTTL, authDeps.Clock.Now()) {
+		if err := refreshStoredOrg(store, org, nil); err != nil {
+			log.Printf("Warning: could not refresh the access token for %q: %v", org.Alias, err)
+		}
+	}
+	recordAuthEvent(eventTokenRead, org, nil)
+	return append(env, orgEnv(org)...)
+}
+
+// orgEnv describes a stored org as environment variables
+func orgEnv(org *StoredOrg) []string {
+	env := []string{
+		pluginOrgEnv + "=" + org.Alias,
+		pluginInstanceURLEnv + "=" + org.InstanceURL,
+		accessTokenEnv + "=" + org.AccessToken,
+	}
+	if org.Username != "" {
+		env = append(env, pluginUsernameEnv+"="+org.Username)
+	}
+	if org.OrgID != "" {
+		env = append(env, pluginOrgIDEnv+"="+org.OrgID)
+	}
+	return env
+}
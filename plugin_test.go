@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func writePlugin(t *testing.T, dir, name string, mode os.FileMode) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestFindPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are .exe files on Windows")
+	}
+	first, second := t.TempDir(), t.TempDir()
+	deploy := writePlugin(t, first, "sfdc-auth-deploy", 0755)
+	writePlugin(t, second, "sfdc-auth-deploy", 0755)
+	audit := writePlugin(t, second, "sfdc-auth-audit", 0755)
+	writePlugin(t, first, "sfdc-auth-notes", 0644)
+	writePlugin(t, first, "sfdc-auth-", 0755)
+	writePlugin(t, first, "other-tool", 0755)
+	if err := os.Mkdir(filepath.Join(first, "sfdc-auth-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := findPlugins(strings.Join([]string{first, "", filepath.Join(first, "missing"), second}, string(os.PathListSeparator)))
+	if len(got) != 2 || got["deploy"] != deploy || got["audit"] != audit {
+		t.Errorf("findPlugins = %v, want deploy from the first directory and audit", got)
+	}
+}
+
+func TestAddPluginCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are .exe files on Windows")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "sfdc-auth-deploy", 0755)
+	writePlugin(t, dir, "sfdc-auth-whoami", 0755)
+	writePlugin(t, dir, "sfdc-auth-help", 0755)
+
+	root := &cobra.Command{Use: "sfdc-auth"}
+	root.AddCommand(&cobra.Command{Use: "whoami"})
+	addPluginCommands(root, dir)
+
+	cmd, _, err := root.Find([]string{"deploy", "--alias", "prod"})
+	if err != nil || cmd.Name() != "deploy" {
+		t.Fatalf("Find(deploy) = %v, %v", cmd, err)
+	}
+	if cmd.GroupID != pluginGroup || !cmd.DisableFlagParsing {
+		t.Errorf("plugin command is not set up to pass its flags through: %+v", cmd)
+	}
+	if len(root.Commands()) != 2 {
+		t.Errorf("plugins should not replace built-in commands, have %d commands", len(root.Commands()))
+	}
+	if !root.ContainsGroup(pluginGroup) {
+		t.Error("plugin group not added")
+	}
+}
+
+func TestOrgEnv(t *testing.T) {
+	org := &StoredOrg{Alias: "prod", InstanceURL: "https://acme.my.salesforce.com", AccessToken: "00D!access", Username: "me@acme.com", OrgID: "00D000000000001AAA"}
+	got := strings.Join(orgEnv(org), "\n")
+	want := strings.Join([]string{
+		"SFDC_AUTH_ORG=prod",
+		"SFDC_AUTH_INSTANCE_URL=https://acme.my.salesforce.com",
+		"SFDC_AUTH_ACCESS_TOKEN=00D!access",
+		"SFDC_AUTH_USERNAME=me@acme.com",
+		"SFDC_AUTH_ORG_ID=00D000000000001AAA",
+	}, "\n")
+	if got != want {
+		t.Errorf("orgEnv =\n%s\nwant\n%s", got, want)
+	}
+}
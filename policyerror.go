@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+)
+
+// oauthError is an error reported by Salesforce at the authorize step (as
+// callback query parameters) or the token step (as a JSON body)
+type oauthError = sfauth.Error
+
+// readOAuthError builds the error for a non-200 token endpoint response.
+// Salesforce explains refusals in an {"error", "error_description"} body.
+func readOAuthError(resp *http.Response) *oauthError {
+	return sfauth.ReadError(resp)
+}
+
+// policyHint is remediation for one family of Connected App policy errors
+type policyHint struct {
+	match []string // lower-case substrings of the error code or description
+	steps string
+}
+
+var policyHints = []policyHint{
+	{
+		match: []string{"oauth_app_blocked", "app is blocked"},
+		steps: `The Connected App is blocked in this org. An administrator can unblock it:
+  1. Setup > Connected Apps OAuth Usage
+  2. Find the app and click Unblock
+  Sessions are ended when an app is blocked, so log in again afterwards.`,
+	},
+	{
+		match: []string{"not admin approved", "hasn't approved", "not approved"},
+		steps: `The user is not allowed to use the Connected App. Either:
+  - Setup > Manage Connected Apps > (app) > Edit Policies, and set Permitted
+    Users to "All users may self-authorize"; or
+  - keep "Admin approved users are pre-authorized" and add the user's profile
+    or a permission set on the app's Profiles / Permission Sets related lists.
+  Policy changes can take a few minutes to apply.`,
+	},
+	{
+		match: []string{"ip restricted", "login hours"},
+		steps: `The login was refused because of IP restrictions or login hours. Either:
+  - Setup > Manage Connected Apps > (app) > Edit Policies, and set IP
+    Relaxation to "Relax IP restrictions"; or
+  - add this machine's address to the profile's Login IP Ranges or to
+    Setup > Network Access, and check the profile's Login Hours.`,
+	},
+}
+
+// policyGuidance returns remediation steps when err is a Connected App
+// policy error Salesforce is known to return, and "" otherwise
+func policyGuidance(err error) string {
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		return ""
+	}
+	text := strings.ToLower(oauthErr.Code + " " + oauthErr.Description)
+	for _, hint := range policyHints {
+		for _, m := range hint.match {
+			if strings.Contains(text, m) {
+				return hint.steps
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPolicyGuidance(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&oauthError{Code: "OAUTH_APP_BLOCKED", Description: "this app is blocked by admin"}, "Unblock"},
+		{&oauthError{Status: 400, Code: "invalid_app_access", Description: "user is not admin approved to access this app"}, "Permitted"},
+		{&oauthError{Status: 400, Code: "invalid_grant", Description: "ip restricted or invalid login hours"}, "IP"},
+		{fmt.Errorf("OAuth error: %w", &oauthError{Code: "OAUTH_APP_BLOCKED"}), "Unblock"},
+		{&oauthError{Status: 400, Code: "invalid_grant", Description: "authentication failure"}, ""},
+		{fmt.Errorf("token request failed with status: 400"), ""},
+	}
+	for _, tt := range tests {
+		got := policyGuidance(tt.err)
+		if tt.want == "" && got != "" {
+			t.Errorf("Expected no guidance for %v, got %q", tt.err, got)
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("Expected guidance for %v to mention %q, got %q", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestPostTokenRequestOAuthError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant", "error_description": "ip restricted or invalid login hours"}`))
+	}))
+	defer server.Close()
+
+	_, err := postTokenRequest(server.URL, url.Values{"grant_type": {"refresh_token"}}, nil)
+	if err == nil || err.Error() != "token request failed with status: 400 (invalid_grant: ip restricted or invalid login hours)" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if policyGuidance(err) == "" {
+		t.Error("Expected guidance for an IP restriction error")
+	}
+}
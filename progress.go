@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressFrames are the spinner animation
+var progressFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+var progressInterval = 100 * time.Millisecond
+
+// progress shows the steps of a login on stderr: finished steps as ✓ lines,
+// and the current one as a spinner with its elapsed time. A nil progress is
+// disabled and all its methods do nothing.
+type progress struct {
+	w     io.Writer
+	total int
+
+	mu      sync.Mutex
+	step    int
+	label   string
+	started time.Time
+	frame   int
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startProgress returns a progress for total steps, or nil when there is no
+// terminal to draw it on, or --quiet or --verbose is set
+func startProgress(total int) *progress {
+	if flagQuiet || flagVerbose || !term.IsTerminal(int(os.Stdout.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return newProgress(os.Stderr, total)
+}
+
+func newProgress(w io.Writer, total int) *progress {
+	return &progress{w: w, total: total}
+}
+
+// Done prints a step that has already finished
+func (p *progress) Done(label string) {
+	if p == nil {
+		return
+	}
+	p.finish(true)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.step++
+	fmt.Fprintf(p.w, "✓ [%d/%d] %s\n", p.step, p.total, label)
+}
+
+// Step finishes the current step and starts spinning on the next
+func (p *progress) Step(label string) {
+	if p == nil {
+		return
+	}
+	p.finish(true)
+	p.mu.Lock()
+	p.step++
+	p.label, p.started, p.frame = label, time.Now(), 0
+	p.stop, p.stopped = make(chan struct{}), make(chan struct{})
+	p.draw()
+	p.mu.Unlock()
+	go p.spin(p.stop, p.stopped)
+}
+
+// Stop finishes the current step, marking it failed unless ok
+func (p *progress) Stop(ok bool) {
+	if p == nil {
+		return
+	}
+	p.finish(ok)
+}
+
+func (p *progress) spin(stop, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// draw redraws the spinner line; the caller holds p.mu
+func (p *progress) draw() {
+	fmt.Fprintf(p.w, "\r%s [%d/%d] %s %s\x1b[K", progressFrames[p.frame%len(progressFrames)], p.step, p.total, p.label, formatElapsed(time.Since(p.started)))
+}
+
+// finish stops the spinner, if one is running, and replaces its line with
+// the step's outcome
+func (p *progress) finish(ok bool) {
+	p.mu.Lock()
+	stop, stopped := p.stop, p.stopped
+	p.stop, p.stopped = nil, nil
+	p.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mark := "✓"
+	if !ok {
+		mark = "✗"
+	}
+	fmt.Fprintf(p.w, "\r%s [%d/%d] %s (%s)\x1b[K\n", mark, p.step, p.total, p.label, formatElapsed(time.Since(p.started)))
+}
+
+// formatElapsed prints whole seconds, or minutes and seconds
+func formatElapsed(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
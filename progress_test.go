@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressSteps(t *testing.T) {
+	old := progressInterval
+	progressInterval = time.Millisecond
+	t.Cleanup(func() { progressInterval = old })
+
+	var buf bytes.Buffer
+	p := newProgress(&buf, 3)
+	p.Done("Starting local server")
+	p.Step("Waiting for OAuth callback...")
+	time.Sleep(20 * time.Millisecond)
+	p.Step("Exchanging the authorization code for tokens...")
+	p.Stop(false)
+	p.Stop(true) // nothing left to finish
+
+	out := buf.String()
+	for _, want := range []string{
+		"✓ [1/3] Starting local server\n",
+		"\r✓ [2/3] Waiting for OAuth callback... (0s)\x1b[K\n",
+		"\r✗ [3/3] Exchanging the authorization code for tokens... (0s)\x1b[K\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%q", want, out)
+		}
+	}
+	if !strings.Contains(out, "\r"+progressFrames[1]+" [2/3] Waiting for OAuth callback... 0s") {
+		t.Errorf("spinner did not animate:\n%q", out)
+	}
+	if strings.Count(out, "[3/3]") != 2 {
+		t.Errorf("the last step should be drawn once and finished once:\n%q", out)
+	}
+}
+
+func TestProgressDisabled(t *testing.T) {
+	// Test output is not a terminal
+	p := startProgress(3)
+	if p != nil {
+		t.Fatal("startProgress returned a progress without a terminal")
+	}
+	p.Done("step")
+	p.Step("step")
+	p.Stop(true)
+}
+
+func TestFormatElapsed(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		1500 * time.Millisecond: "1s",
+		59 * time.Second:        "59s",
+		125 * time.Second:       "2m05s",
+	} {
+		if got := formatElapsed(d); got != want {
+			t.Errorf("formatElapsed(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	proxyAuthBasic     = "basic"
+	proxyAuthNTLM      = "ntlm"
+	proxyAuthNegotiate = "negotiate"
+
+	proxyAuthEnv     = "SFDC_AUTH_PROXY_AUTH"
+	proxyUserEnv     = "SFDC_AUTH_PROXY_USER"
+	proxyPasswordEnv = "SFDC_AUTH_PROXY_PASSWORD"
+)
+
+var (
+	flagProxyAuth string
+	// flagProxy overrides HTTPS_PROXY and HTTP_PROXY for this run
+	flagProxy string
+)
+
+// proxyFromEnvironment picks the proxy for a request; a variable so tests
+// can point it at a fake proxy
+var proxyFromEnvironment = http.ProxyFromEnvironment
+
+// setupProxy installs a transport that authenticates to the proxy from
+// --proxy or HTTPS_PROXY/HTTP_PROXY, for every outbound call. Basic
+// credentials come from the proxy URL or the environment; NTLM and Negotiate
+// (Kerberos) run their challenge on the CONNECT tunnel. They use credentials
+// of their own, not the Windows logon session, as SSPI is not supported.
+func setupProxy() error {
+	if flagProxy != "" {
+		proxy, err := explicitProxy(flagProxy, os.Getenv("NO_PROXY")+","+os.Getenv("no_proxy"))
+		if err != nil {
+			return err
+		}
+		proxyFromEnvironment = proxy
+	}
+
+	mode := flagProxyAuth
+	if mode == "" {
+		mode = os.Getenv(proxyAuthEnv)
+	}
+	user, password := os.Getenv(proxyUserEnv), os.Getenv(proxyPasswordEnv)
+
+	var newAuth func() proxyAuthenticator
+	switch strings.ToLower(mode) {
+	case "":
+		// Credentials in the proxy URL already work; only credentials from
+		// the environment, or --proxy, need a transport of our own
+		if user == "" && flagProxy == "" {
+			return nil
+		}
+		fallthrough
+	case proxyAuthBasic:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = basicProxy(user, password)
+		http.DefaultTransport = transport
+		return nil
+	case proxyAuthNTLM:
+		if user == "" {
+			return fmt.Errorf("NTLM proxy authentication needs %s (as DOMAIN\\user) and %s%s", proxyUserEnv, proxyPasswordEnv, windowsLogonNote())
+		}
+		newAuth = func() proxyAuthenticator { return &ntlmProxyAuth{user: user, password: password} }
+	case proxyAuthNegotiate:
+		cl, err := loadKerberosClient()
+		if err != nil {
+			return fmt.Errorf("error loading Kerberos credentials: %v%s", err, windowsLogonNote())
+		}
+		newAuth = func() proxyAuthenticator { return &negotiateProxyAuth{client: cl} }
+	default:
+		return fmt.Errorf("unknown proxy authentication %q (use %s, %s or %s)", mode, proxyAuthBasic, proxyAuthNTLM, proxyAuthNegotiate)
+	}
+
+	dialer := &proxyDialer{mode: strings.ToLower(mode), newAuth: newAuth}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	http.DefaultTransport = &proxyTransport{Transport: transport}
+	return nil
+}
+
+// explicitProxy sends every request through raw, a proxy URL or a bare
+// host:port, except for hosts in noProxy (NO_PROXY syntax)
+func explicitProxy(raw, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid --proxy %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported --proxy scheme %q (use http, https or socks5)", u.Scheme)
+	}
+	cfg := &httpproxy.Config{HTTPProxy: u.String(), HTTPSProxy: u.String(), NoProxy: noProxy}
+	proxyFunc := cfg.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return proxyFunc(r.URL)
+	}, nil
+}
+
+// basicProxy adds credentials to proxy URLs that do not carry their own
+func basicProxy(user, password string) func(*http.Request) (*url.URL, error) {
+	return func(r *http.Request) (*url.URL, error) {
+		proxy, err := proxyFromEnvironment(r)
+		if err != nil || proxy == nil || proxy.User != nil || user == "" {
+			return proxy, err
+		}
+		withUser := *proxy
+		withUser.User = url.UserPassword(user, password)
+		return &withUser, nil
+	}
+}
+
+// proxyAuthenticator produces Proxy-Authorization values for one
+// connection's handshake
+type proxyAuthenticator interface {
+	// initial is sent with the first CONNECT
+	initial(proxyHost string) (string, error)
+	// respond answers the Proxy-Authenticate challenges of a 407
+	respond(challenges []string) (string, error)
+}
+
+// windowsLogonNote tells Windows users that the logon session is not used
+// for proxy authentication, as there is no SSPI support
+func windowsLogonNote() string {
+	if runtime.GOOS != "windows" {
+		return ""
+	}
+	return " (the Windows logon session is not used: give the credentials in the environment, or for negotiate an MIT krb5.conf and a ticket cache from kinit)"
+}
+
+// proxyDialer opens connections through an authenticating proxy with
+// CONNECT, which keeps multi-step handshakes on a single connection. The
+// CONNECT goes over TLS to an https proxy; a socks5 proxy cannot run the
+// handshake and is refused.
+type proxyDialer struct {
+	mode    string
+	newAuth func() proxyAuthenticator
+}
+
+// proxyTransport passes each request to the proxyDialer in its context, so
+// the proxy is chosen for the request's real URL and not guessed from the
+// port being dialled
+type proxyTransport struct {
+	*http.Transport
+}
+
+type proxyRequestKey struct{}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Transport.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyRequestKey{}, req)))
+}
+
+func (d *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	req, ok := ctx.Value(proxyRequestKey{}).(*http.Request)
+	if !ok {
+		return nil, fmt.Errorf("proxy dialer used without a proxyTransport")
+	}
+	proxy, err := proxyFromEnvironment(req)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if proxy == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	if proxy.Scheme != "http" && proxy.Scheme != "https" {
+		return nil, fmt.Errorf("--proxy-auth %s needs an http or https proxy, not %s", d.mode, proxy.Scheme)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to proxy: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, proxyTLSConfig(proxy.Hostname()))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error connecting to proxy: %v", err)
+		}
+		conn = tlsConn
+	}
+	if err := d.connect(conn, proxy.Hostname(), addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connect asks the proxy for a tunnel to addr, answering its challenges
+func (d *proxyDialer) connect(conn net.Conn, proxyHost, addr string) error {
+	auth := d.newAuth()
+	header, err := auth.initial(proxyHost)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	for round := 0; round < 3; round++ {
+		req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+		if header != "" {
+			req.Header.Set("Proxy-Authorization", header)
+		}
+		if err := req.Write(conn); err != nil {
+			return fmt.Errorf("error writing to proxy: %v", err)
+		}
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			return fmt.Errorf("error reading from proxy: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			// The tunnel is open; reading the body would block on it
+			return nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusProxyAuthRequired:
+			if header, err = auth.respond(resp.Header.Values("Proxy-Authenticate")); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("proxy refused the connection to %s: %s", addr, resp.Status)
+		}
+	}
+	return fmt.Errorf("proxy authentication failed")
+}
+
+// proxyTLSConfig verifies an https proxy the way Salesforce is verified,
+// with --ca-bundle or --insecure-skip-verify applied
+func proxyTLSConfig(host string) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tlsClientConfig != nil {
+		cfg = tlsClientConfig.Clone()
+	}
+	cfg.ServerName = host
+	return cfg
+}
+
+func proxyAddr(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	if proxy.Scheme == "https" {
+		return net.JoinHostPort(proxy.Hostname(), "443")
+	}
+	return net.JoinHostPort(proxy.Hostname(), "80")
+}
+
+// ntlmProxyAuth runs the NTLM negotiate/challenge/authenticate exchange
+type ntlmProxyAuth struct {
+	user, password string
+	answered       bool
+}
+
+func (a *ntlmProxyAuth) initial(string) (string, error) {
+	_, domain, _ := ntlmssp.GetDomain(a.user)
+	negotiate, err := ntlmssp.NewNegotiateMessage(domain, "")
+	if err != nil {
+		return "", fmt.Errorf("error creating NTLM negotiate message: %v", err)
+	}
+	return "NTLM " + base64.StdEncoding.EncodeToString(negotiate), nil
+}
+
+func (a *ntlmProxyAuth) respond(challenges []string) (string, error) {
+	if a.answered {
+		return "", fmt.Errorf("proxy rejected the NTLM credentials")
+	}
+	for _, c := range challenges {
+		encoded, ok := strings.CutPrefix(c, "NTLM ")
+		if !ok {
+			continue
+		}
+		challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return "", fmt.Errorf("malformed NTLM challenge: %v", err)
+		}
+		user, _, domainNeeded := ntlmssp.GetDomain(a.user)
+		authenticate, err := ntlmssp.ProcessChallenge(challenge, user, a.password, domainNeeded)
+		if err != nil {
+			return "", fmt.Errorf("error answering NTLM challenge: %v", err)
+		}
+		a.answered = true
+		return "NTLM " + base64.StdEncoding.EncodeToString(authenticate), nil
+	}
+	return "", fmt.Errorf("proxy did not offer NTLM authentication")
+}
+
+// negotiateProxyAuth sends a Kerberos SPNEGO token for HTTP/<proxy host>
+type negotiateProxyAuth struct {
+	client *krbclient.Client
+}
+
+func (a *negotiateProxyAuth) initial(proxyHost string) (string, error) {
+	s := spnego.SPNEGOClient(a.client, "HTTP/"+proxyHost)
+	if err := s.AcquireCred(); err != nil {
+		return "", fmt.Errorf("error acquiring Kerberos credentials: %v", err)
+	}
+	token, err := s.InitSecContext()
+	if err != nil {
+		return "", fmt.Errorf("error getting a Kerberos ticket for the proxy: %v", err)
+	}
+	raw, err := token.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("error encoding SPNEGO token: %v", err)
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func (a *negotiateProxyAuth) respond([]string) (string, error) {
+	return "", fmt.Errorf("proxy rejected the Kerberos ticket")
+}
+
+// loadKerberosClient uses the ticket cache from kinit, found the way the MIT
+// tools find it
+func loadKerberosClient() (*krbclient.Client, error) {
+	confPath := os.Getenv("KRB5_CONFIG")
+	if confPath == "" {
+		confPath = "/etc/krb5.conf"
+	}
+	cfg, err := krbconfig.Load(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ccache := strings.TrimPrefix(os.Getenv("KRB5CCNAME"), "FILE:")
+	if ccache == "" {
+		ccache = filepath.Join(os.TempDir(), fmt.Sprintf("krb5cc_%d", os.Getuid()))
+	}
+	cache, err := credentials.LoadCCache(ccache)
+	if err != nil {
+		return nil, fmt.Errorf("no Kerberos ticket cache (run kinit): %v", err)
+	}
+	return krbclient.NewFromCCache(cache, cfg, krbclient.DisablePAFXFAST(true))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeProxyAuth answers one challenge with the challenge's own name
+type fakeProxyAuth struct{}
+
+func (fakeProxyAuth) initial(string) (string, error) { return "Test hello", nil }
+
+func (fakeProxyAuth) respond(challenges []string) (string, error) {
+	for _, c := range challenges {
+		if token, ok := strings.CutPrefix(c, "Test "); ok {
+			return "Test answer-" + token, nil
+		}
+	}
+	return "", fmt.Errorf("no Test challenge")
+}
+
+// newChallengeProxy serves CONNECT only to clients that answer a challenge
+// on the same connection, the way NTLM proxies do
+func newChallengeProxy(t *testing.T) *httptest.Server {
+	return httptest.NewServer(challengeProxyHandler(t))
+}
+
+func challengeProxyHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.Header.Get("Proxy-Authorization") {
+		case "Test hello":
+			w.Header().Set("Proxy-Authenticate", "Test xyz")
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		case "Test answer-xyz":
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(target, conn)
+			target.Close()
+		}()
+		io.Copy(conn, target)
+		conn.Close()
+	})
+}
+
+func withProxy(t *testing.T, proxy string) {
+	original := proxyFromEnvironment
+	t.Cleanup(func() { proxyFromEnvironment = original })
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyFromEnvironment = func(*http.Request) (*url.URL, error) { return proxyURL, nil }
+}
+
+func TestProxyDialerAnswersChallenge(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "through the tunnel")
+	}))
+	defer backend.Close()
+	proxy := newChallengeProxy(t)
+	defer proxy.Close()
+	withProxy(t, proxy.URL)
+
+	dialer := &proxyDialer{newAuth: func() proxyAuthenticator { return fakeProxyAuth{} }}
+	client := &http.Client{Transport: &proxyTransport{Transport: &http.Transport{DialContext: dialer.DialContext}}}
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("Get through proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "through the tunnel" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestProxyDialerOverTLS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "through the tunnel")
+	}))
+	defer backend.Close()
+	proxy := httptest.NewTLSServer(challengeProxyHandler(t))
+	defer proxy.Close()
+	withProxy(t, proxy.URL)
+	tlsClientConfig = proxy.Client().Transport.(*http.Transport).TLSClientConfig
+	defer func() { tlsClientConfig = nil }()
+
+	dialer := &proxyDialer{newAuth: func() proxyAuthenticator { return fakeProxyAuth{} }}
+	client := &http.Client{Transport: &proxyTransport{Transport: &http.Transport{DialContext: dialer.DialContext}}}
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("Get through an https proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "through the tunnel" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestProxyDialerSeesRequestScheme(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	original := proxyFromEnvironment
+	defer func() { proxyFromEnvironment = original }()
+	var scheme string
+	proxyFromEnvironment = func(r *http.Request) (*url.URL, error) {
+		scheme = r.URL.Scheme
+		return nil, nil
+	}
+
+	// An https URL on a port other than 443 must still pick HTTPS_PROXY
+	dialer := &proxyDialer{newAuth: func() proxyAuthenticator { return fakeProxyAuth{} }}
+	transport := backend.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	resp, err := (&http.Client{Transport: &proxyTransport{Transport: transport}}).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if scheme != "https" {
+		t.Errorf("proxy chosen for scheme %q, want https", scheme)
+	}
+}
+
+func TestProxyDialerRefusesSOCKS(t *testing.T) {
+	withProxy(t, "socks5://proxy.corp:1080")
+
+	dialer := &proxyDialer{mode: proxyAuthNTLM, newAuth: func() proxyAuthenticator { return fakeProxyAuth{} }}
+	client := &http.Client{Transport: &proxyTransport{Transport: &http.Transport{DialContext: dialer.DialContext}}}
+	if _, err := client.Get("http://example.invalid/"); err == nil || !strings.Contains(err.Error(), "needs an http or https proxy") {
+		t.Errorf("expected a socks5 proxy to be refused, got %v", err)
+	}
+}
+
+func TestProxyDialerReportsRefusal(t *testing.T) {
+	proxy := newChallengeProxy(t)
+	defer proxy.Close()
+	withProxy(t, proxy.URL)
+
+	dialer := &proxyDialer{newAuth: func() proxyAuthenticator { return &ntlmProxyAuth{user: `CORP\pat`, password: "secret"} }}
+	client := &http.Client{Transport: &proxyTransport{Transport: &http.Transport{DialContext: dialer.DialContext}}}
+	if _, err := client.Get("http://example.invalid/"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the proxy's 403 to be reported, got %v", err)
+	}
+}
+
+func TestBasicProxyAddsCredentials(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://login.salesforce.com/", nil)
+
+	withProxy(t, "http://proxy.corp:8080")
+	proxy, err := basicProxy("pat", "secret")(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password, _ := proxy.User.Password(); proxy.User.Username() != "pat" || password != "secret" {
+		t.Errorf("proxy user = %v, want pat:secret", proxy.User)
+	}
+
+	// Credentials in the proxy URL win
+	withProxy(t, "http://other:pw@proxy.corp:8080")
+	proxy, _ = basicProxy("pat", "secret")(req)
+	if proxy.User.Username() != "other" {
+		t.Errorf("proxy user = %v, want the one from the URL", proxy.User)
+	}
+}
+
+func TestNTLMProxyAuthNegotiates(t *testing.T) {
+	header, err := (&ntlmProxyAuth{user: `CORP\pat`, password: "secret"}).initial("proxy.corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// base64 of the "NTLMSSP\0" signature followed by message type 1
+	if !strings.HasPrefix(header, "NTLM TlRMTVNTUAAB") {
+		t.Errorf("initial header = %q, want an NTLM negotiate message", header)
+	}
+	if _, err := (&ntlmProxyAuth{}).respond([]string{"Basic realm=proxy"}); err == nil {
+		t.Error("expected an error when the proxy does not offer NTLM")
+	}
+}
+
+func TestSetupProxyRejectsUnknownMode(t *testing.T) {
+	original := flagProxyAuth
+	defer func() { flagProxyAuth = original }()
+
+	flagProxyAuth = "digest"
+	if err := setupProxy(); err == nil {
+		t.Error("expected an error for an unknown proxy authentication")
+	}
+	flagProxyAuth = proxyAuthNTLM
+	t.Setenv(proxyUserEnv, "")
+	if err := setupProxy(); err == nil {
+		t.Error("expected NTLM without a user to be refused")
+	}
+}
+
+func TestExplicitProxy(t *testing.T) {
+	proxy, err := explicitProxy("proxy.corp:8080", "internal.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &http.Request{URL: &url.URL{Scheme: "https", Host: "login.salesforce.com"}}
+	got, err := proxy(req)
+	if err != nil || got == nil || got.String() != "http://proxy.corp:8080" {
+		t.Errorf("Expected the --proxy for Salesforce, got %v (%v)", got, err)
+	}
+	req = &http.Request{URL: &url.URL{Scheme: "https", Host: "internal.example.com"}}
+	if got, err := proxy(req); err != nil || got != nil {
+		t.Errorf("Expected NO_PROXY hosts to be reached directly, got %v (%v)", got, err)
+	}
+
+	if _, err := explicitProxy("ftp://proxy.corp:21", ""); err == nil {
+		t.Error("Expected an unsupported proxy scheme to be rejected")
+	}
+}
+
+func TestSetupProxyFlag(t *testing.T) {
+	originalTransport, originalProxy := http.DefaultTransport, proxyFromEnvironment
+	defer func() {
+		http.DefaultTransport, proxyFromEnvironment, flagProxy = originalTransport, originalProxy, ""
+	}()
+	t.Setenv(proxyAuthEnv, "")
+	t.Setenv(proxyUserEnv, "")
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+
+	flagProxy = "http://flag-proxy:8080"
+	if err := setupProxy(); err != nil {
+		t.Fatal(err)
+	}
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok || transport.Proxy == nil {
+		t.Fatalf("Expected a transport using --proxy, got %#v", http.DefaultTransport)
+	}
+	got, err := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "login.salesforce.com"}})
+	if err != nil || got == nil || got.Host != "flag-proxy:8080" {
+		t.Errorf("Expected --proxy to win over HTTPS_PROXY, got %v (%v)", got, err)
+	}
+}
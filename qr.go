@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrQuietZone is the light margin, in modules, drawn around a QR code.
+// Phones read codes in a terminal fine with less than the four the standard
+// asks for.
+const qrQuietZone = 2
+
+var flagNoQR bool
+
+// writeQRCode draws content as a QR code with ANSI colours, two modules per
+// character cell using half blocks, so it can be scanned from the terminal.
+// It is drawn dark on light whatever the terminal's own colours are.
+func writeQRCode(w io.Writer, content string) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("error encoding QR code: %v", err)
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	size := len(bitmap) + 2*qrQuietZone
+	dark := func(x, y int) bool {
+		x, y = x-qrQuietZone, y-qrQuietZone
+		return y >= 0 && y < len(bitmap) && x >= 0 && x < len(bitmap[y]) && bitmap[y][x]
+	}
+
+	var b strings.Builder
+	for y := 0; y < size; y += 2 {
+		b.WriteString("\x1b[30;107m")
+		for x := 0; x < size; x++ {
+			switch top, bottom := dark(x, y), dark(x, y+1); {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
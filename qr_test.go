@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteQRCode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeQRCode(&buf, "https://login.salesforce.com/setup/connect"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	var rows [][]rune
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "\x1b[30;107m") || !strings.HasSuffix(line, "\x1b[0m") {
+			t.Fatalf("line %q is not drawn dark on light", line)
+		}
+		rows = append(rows, []rune(strings.TrimSuffix(strings.TrimPrefix(line, "\x1b[30;107m"), "\x1b[0m")))
+	}
+
+	// A version 3 code is 29 modules wide, plus the quiet zone, and two
+	// module rows share a line
+	size := 29 + 2*qrQuietZone
+	if len(rows) != (size+1)/2 {
+		t.Errorf("drew %d lines, want %d", len(rows), (size+1)/2)
+	}
+	for i, row := range rows {
+		if len(row) != size {
+			t.Fatalf("line %d is %d cells wide, want %d", i, len(row), size)
+		}
+	}
+	if strings.TrimSpace(string(rows[0])) != "" {
+		t.Errorf("first line %q should be quiet zone", string(rows[0]))
+	}
+	// The top edge of the top-left finder pattern: a full row of dark
+	// modules over a row that is only dark at its ends
+	if got := string(rows[1][2:9]); got != "█▀▀▀▀▀█" {
+		t.Errorf("finder pattern top = %q", got)
+	}
+}
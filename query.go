@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var flagQueryAlias string
+
+var queryCmd = &cobra.Command{
+	Use:   "query <soql>",
+	Short: "Run a SOQL query against a stored org",
+	Long: `Run a SOQL query with a stored org's token through the REST API and print
+the records as a table, or with -o json as the API returns them. Every page
+of results is fetched, so large queries can take a while.
+
+The access token is refreshed and saved if it has expired.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runQuery,
+}
+
+func init() {
+	queryCmd.Flags().StringVarP(&flagQueryAlias, "alias", "a", "", "Alias of the stored org (default: the default org)")
+
+	rootCmd.AddCommand(queryCmd)
+}
+
+// queryResult is the records of every page of a query
+type queryResult struct {
+	TotalSize int               `json:"totalSize"`
+	Records   []json.RawMessage `json:"records"`
+}
+
+func runQuery(cmd *cobra.Command, args []string) {
+	store, org, err := useStoredOrg(flagQueryAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	result, err := runSOQL(func(path string, out interface{}) error { return orgGetJSON(store, org, path, out) }, args[0])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if outputFormat(outputText) == outputJSON {
+		if err := writeJSON(result); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+		return
+	}
+	if err := writeQueryTable(os.Stdout, result.Records); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+	infof("Total records: %d", result.TotalSize)
+}
+
+// runSOQL runs a query and follows nextRecordsUrl until every record has
+// been read
+func runSOQL(get func(path string, out interface{}) error, soql string) (*queryResult, error) {
+	result := &queryResult{Records: []json.RawMessage{}}
+	path := "/services/data/" + salesforceAPIVersion + "/query?q=" + url.QueryEscape(soql)
+	for path != "" {
+		var page struct {
+			TotalSize      int               `json:"totalSize"`
+			Done           bool              `json:"done"`
+			NextRecordsURL string            `json:"nextRecordsUrl"`
+			Records        []json.RawMessage `json:"records"`
+		}
+		if err := get(path, &page); err != nil {
+			return nil, fmt.Errorf("error running query: %v", err)
+		}
+		result.TotalSize = page.TotalSize
+		result.Records = append(result.Records, page.Records...)
+		path = ""
+		if !page.Done && page.NextRecordsURL != "" {
+			verbosef("Fetched %d of %d records", len(result.Records), page.TotalSize)
+			path = page.NextRecordsURL
+		}
+	}
+	return result, nil
+}
+
+// writeQueryTable prints one row per record with a column for every field,
+// relationship fields as Owner.Name. The attributes the API adds to each
+// record are left out.
+func writeQueryTable(out io.Writer, records []json.RawMessage) error {
+	var columns []string
+	seen := map[string]bool{}
+	rows := make([]map[string]string, 0, len(records))
+	for _, record := range records {
+		fields, err := flattenJSON(record)
+		if err != nil {
+			return fmt.Errorf("error reading record: %v", err)
+		}
+		row := map[string]string{}
+		for _, f := range fields {
+			if containsString(f.path, "attributes") {
+				continue
+			}
+			name := strings.Join(f.path, ".")
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+			row[name] = f.value
+		}
+		rows = append(rows, row)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, c := range columns {
+			values[i] = orDash(row[c])
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	return w.Flush()
+}
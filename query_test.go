@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunSOQLFollowsPages(t *testing.T) {
+	soql := "SELECT Id, Name FROM Account"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/data/" + salesforceAPIVersion + "/query":
+			if r.URL.Query().Get("q") != soql {
+				t.Errorf("Unexpected query %q", r.URL.Query().Get("q"))
+			}
+			w.Write([]byte(`{"totalSize": 3, "done": false, "nextRecordsUrl": "/services/data/` + salesforceAPIVersion + `/query/01gxx-2000",
+				"records": [{"attributes": {"type": "Account"}, "Id": "001A", "Name": "Acme"}, {"attributes": {"type": "Account"}, "Id": "001B", "Name": "Globex"}]}`))
+		case "/services/data/" + salesforceAPIVersion + "/query/01gxx-2000":
+			w.Write([]byte(`{"totalSize": 3, "done": true, "records": [{"attributes": {"type": "Account"}, "Id": "001C", "Name": "Initech"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{InstanceURL: server.URL, AccessToken: "access"}
+	result, err := runSOQL(func(path string, out interface{}) error { return getOrgJSON(org, path, out) }, soql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalSize != 3 || len(result.Records) != 3 {
+		t.Fatalf("Expected 3 records from 2 pages, got %d of %d", len(result.Records), result.TotalSize)
+	}
+	var last struct{ Name string }
+	if err := json.Unmarshal(result.Records[2], &last); err != nil || last.Name != "Initech" {
+		t.Errorf("Unexpected last record %s", result.Records[2])
+	}
+}
+
+func TestRunSOQLError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{InstanceURL: server.URL, AccessToken: "access"}
+	if _, err := runSOQL(func(path string, out interface{}) error { return getOrgJSON(org, path, out) }, "SELECT Nope FROM Account"); err == nil || !strings.Contains(err.Error(), "error running query") {
+		t.Errorf("Expected a query error, got %v", err)
+	}
+}
+
+func TestWriteQueryTable(t *testing.T) {
+	records := []json.RawMessage{
+		json.RawMessage(`{"attributes": {"type": "Case"}, "Id": "500A", "Owner": {"attributes": {"type": "User"}, "Name": "Pat"}, "Subject": null}`),
+		json.RawMessage(`{"attributes": {"type": "Case"}, "Id": "500B", "Owner": {"attributes": {"type": "User"}, "Name": "Sam"}, "Subject": "Broken"}`),
+	}
+	var out bytes.Buffer
+	if err := writeQueryTable(&out, records); err != nil {
+		t.Fatal(err)
+	}
+	want := "Id    Owner.Name  Subject\n500A  Pat         -\n500B  Sam         Broken\n"
+	if out.String() != want {
+		t.Errorf("writeQueryTable =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeQueryTable(&out, nil); err != nil || out.Len() != 0 {
+		t.Errorf("Expected no table without records, got %q", out.String())
+	}
+}
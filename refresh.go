@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+	"github.com/spf13/cobra"
+)
+
+// defaultRefreshMinTTL is how long a cached access token must still be good
+// for with --if-expired
+const defaultRefreshMinTTL = 5 * time.Minute
+
+var (
+	flagRefreshAlias        string
+	flagRefreshToken        string
+	flagRefreshClientID     string
+	flagRefreshClientSecret string
+	flagRefreshDomain       string
+	flagRefreshAll          bool
+	flagRefreshWorkers      int
+	flagRefreshIfExpired    bool
+	flagRefreshMinTTL       time.Duration
+)
+
+var refreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Get a fresh access token with a refresh token",
+	Long: `Run the refresh token grant and print a fresh access token in the same
+form as a login, so scripts need not repeat the browser flow.
+
+With --alias, or the default org set with "org use", the stored org is
+refreshed and saved; if its refresh token has been revoked, an interactive
+user is offered a new login. Otherwise pass --refresh-token (or set
+SFDC_REFRESH_TOKEN) and --client-id; nothing is saved.
+
+With --all, every stored org is refreshed, --workers at a time, and saved.
+Instead of tokens, a JSON report of each org's outcome is printed, and the
+exit status is non-zero if any org failed. Orgs whose refresh token has been
+revoked are reported, not logged in again.
+
+With --if-expired, a stored org's cached access token is printed as it is
+unless it expires within --min-ttl, going by the session timeout, so callers
+that run often need not hit the token endpoint every time.`,
+	Args: cobra.NoArgs,
+	Run:  runRefresh,
+}
+
+func init() {
+	refreshCmd.Flags().StringVarP(&flagRefreshAlias, "alias", "a", "", "Alias of the stored org to refresh (default: the default org)")
+	refreshCmd.Flags().StringVar(&flagRefreshToken, "refresh-token", "", "Refresh token to use instead of a stored org, or - to read it from stdin (default: from SFDC_REFRESH_TOKEN)")
+	refreshCmd.Flags().StringVarP(&flagRefreshClientID, "client-id", "c", "", "Salesforce Client ID (Consumer Key), with --refresh-token")
+	refreshCmd.Flags().StringVarP(&flagRefreshClientSecret, "client-secret", "s", "", "Client secret, if the Connected App requires one for refreshes")
+	refreshCmd.Flags().StringVarP(&flagRefreshDomain, "domain", "d", defaultSalesforceDomain, "Salesforce domain, with --refresh-token")
+	refreshCmd.Flags().BoolVar(&flagRefreshAll, "all", false, "Refresh every stored org and report the outcome of each")
+	refreshCmd.Flags().IntVar(&flagRefreshWorkers, "workers", defaultRefreshWorkers, "Orgs to refresh at once, with --all")
+	refreshCmd.MarkFlagsMutuallyExclusive("all", "alias")
+	refreshCmd.Flags().BoolVar(&flagRefreshIfExpired, "if-expired", false, "Print the cached access token instead if it is good for at least --min-ttl")
+	refreshCmd.Flags().DurationVar(&flagRefreshMinTTL, "min-ttl", defaultRefreshMinTTL, "Time the cached access token must have left, with --if-expired")
+	refreshCmd.MarkFlagsMutuallyExclusive("all", "refresh-token")
+	refreshCmd.MarkFlagsMutuallyExclusive("if-expired", "all")
+	refreshCmd.MarkFlagsMutuallyExclusive("if-expired", "refresh-token")
+
+	rootCmd.AddCommand(refreshCmd)
+}
+
+func runRefresh(cmd *cobra.Command, args []string) {
+	clientSecret := newSecret([]byte(flagRefreshClientSecret))
+	flagRefreshClientSecret = ""
+	defer clientSecret.Wipe()
+
+	if flagRefreshMinTTL < 0 {
+		log.Fatalf("Error: --min-ttl cannot be negative")
+	}
+	if flagRefreshAll {
+		runRefreshAll(clientSecret)
+		return
+	}
+
+	// SFDC_REFRESH_TOKEN is applied to the flag by applyCredentialEnv
+	refreshToken := flagRefreshToken
+	flagRefreshToken = ""
+
+	var org *StoredOrg
+	var previous string
+	// expiresIn is the token endpoint's expires_in, 0 for a cached token
+	var expiresIn int64
+	switch {
+	case flagRefreshAlias != "" && refreshToken != "":
+		log.Fatalf("Error: use either --alias or --refresh-token, not both")
+	case flagRefreshAlias != "" || (refreshToken == "" && defaultOrg != ""):
+		store, stored, err := openStoredOrg(flagRefreshAlias)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		previous = stored.RefreshToken
+		if flagRefreshIfExpired && cachedTokenUsable(stored, flagRefreshMinTTL, authDeps.Clock.Now()) {
+			verbosef("The cached access token for %q is good for at least %s, not refreshing", stored.Alias, flagRefreshMinTTL)
+			recordAuthEvent(eventTokenRead, stored, nil)
+		} else {
+			var resp *SalesforceOAuthResponse
+			if resp, err = refreshStoredOrgToken(store, stored, clientSecret); err == nil {
+				expiresIn = resp.ExpiresIn
+			}
+		}
+		store.Close()
+		if err != nil {
+			failRefresh(err)
+		}
+		org = stored
+	case refreshToken != "":
+		if flagRefreshClientID == "" {
+			log.Fatalf("Error: --refresh-token needs --client-id")
+		}
+		previous = refreshToken
+		org = &StoredOrg{ClientID: flagRefreshClientID, RefreshToken: refreshToken, Domain: flagRefreshDomain}
+		resp, err := refreshAccessToken(org, clientSecret)
+		if err != nil {
+			failRefresh(fmt.Errorf("error refreshing token: %w", err))
+		}
+		applyRefresh(org, resp)
+		// Nothing is saved for a refresh token given on the command line
+		recordAuthEvent(eventRefresh, org, nil)
+		expiresIn = resp.ExpiresIn
+	default:
+		log.Fatalf("Error: give --alias or --refresh-token, or set a default org with \"org use\"")
+	}
+
+	// Only a rotated refresh token needs saving again
+	if org.RefreshToken != previous {
+		if err := writeOPRefreshToken(org.RefreshToken); err != nil {
+			log.Printf("Warning: could not save the refresh token to 1Password: %v", err)
+		}
+	}
+
+	result := TokenResponse{AccessToken: org.AccessToken, RefreshToken: org.RefreshToken, InstanceURL: org.InstanceURL}
+	result.setExpiry(org.IssuedAt, expiresIn, authDeps.Clock.Now())
+	output, err := formatTokenResponse(&result, outputFormat(outputJSON))
+	if err != nil {
+		log.Fatalf("Error formatting output: %v", err)
+	}
+	if err := writeTokenOutput(output); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
+
+// runRefreshAll refreshes every stored org and prints the report
+func runRefreshAll(clientSecret *secret) {
+	if flagRefreshWorkers < 1 {
+		log.Fatalf("Error: --workers must be at least 1")
+	}
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+	orgs, err := store.List()
+	if err != nil {
+		log.Fatalf("Error listing orgs: %v", err)
+	}
+
+	r := &orgRefresher{store: store, clientSecret: clientSecret, refresh: refreshAccessToken, workers: flagRefreshWorkers}
+	batch := r.refreshAll(orgs)
+	if err := writeJSON(batch); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+	if batch.Failed > 0 {
+		store.Close()
+		os.Exit(1)
+	}
+}
+
+// cachedTokenUsable reports whether the org's access token is estimated to
+// last at least minTTL beyond now
+func cachedTokenUsable(org *StoredOrg, minTTL time.Duration, now time.Time) bool {
+	if org.AccessToken == "" || (org.IssuedAt.IsZero() && org.UpdatedAt.IsZero()) {
+		return false
+	}
+	expiresAt := (&expiryThresholds{Session: sessionTimeout}).expiresAt(org)
+	return expiresAt.Sub(now) >= minTTL
+}
+
+// failRefresh exits like failLogin, with exitMaintenance for an org in
+// maintenance
+func failRefresh(err error) {
+	if isCancelled(err) {
+		exitOnCancel()
+	}
+	if isMaintenanceError(err) {
+		log.Print(err)
+		os.Exit(exitMaintenance)
+	}
+	log.Fatalf("Error: %v", err)
+}
+
+// refreshAccessToken performs the refresh_token grant for a stored org with
+// sfauth.Refresh. The client secret is optional because Connected Apps can
+// be configured not to require it for refreshes.
+func refreshAccessToken(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	if org.RefreshToken == "" {
+		return nil, fmt.Errorf("org %q has no refresh token", org.Alias)
+	}
+
+	if clientSecret.Empty() && org.ClientSecret != "" {
+		clientSecret = newSecret([]byte(org.ClientSecret))
+		defer clientSecret.Wipe()
+	}
+
+	req := sfauth.RefreshRequest{
+		GrantType:    refreshGrantType(org),
+		ClientID:     org.ClientID,
+		ClientSecret: clientSecret.Bytes(),
+		RefreshToken: org.RefreshToken,
+	}
+	domain := refreshDomain(org)
+
+	resp, err := withMaintenanceRetry(org.InstanceName, func() (*SalesforceOAuthResponse, error) {
+		return sendToken(getSalesforceTokenURL(domain), req.GrantType, func(ctx context.Context) (*sfauth.Token, error) {
+			return sfauth.Refresh(ctx, nil, domain, req)
+		})
+	})
+	if err != nil {
+		recordAuthEvent(eventRefresh, org, err)
+	}
+	return resp, err
+}
+
+// refreshDomain picks the host to send refresh grants to: the login domain
+// the org authenticated against, falling back to its instance
+func refreshDomain(org *StoredOrg) string {
+	if org.Domain != "" {
+		return org.Domain
+	}
+	if u, err := url.Parse(org.InstanceURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return defaultSalesforceDomain
+}
+
+// applyRefresh updates a stored org with the result of a refresh grant
+func applyRefresh(org *StoredOrg, resp *SalesforceOAuthResponse) {
+	org.AccessToken = resp.AccessToken
+	if resp.InstanceURL != "" {
+		org.InstanceURL = resp.InstanceURL
+	}
+	// Refresh token rotation returns a new refresh token
+	if resp.RefreshToken != "" {
+		org.RefreshToken = resp.RefreshToken
+	}
+	if issuedAt, err := parseIssuedAt(resp.IssuedAt); err == nil {
+		org.IssuedAt = issuedAt
+	}
+	org.UpdatedAt = authDeps.Clock.Now().UTC()
+}
+
+// saveRefresh saves an org updated by applyRefresh and records the refresh,
+// as failed if it could not be saved, so the audit log and webhooks never
+// report a refresh whose tokens were lost
+func saveRefresh(store TokenStore, org *StoredOrg) error {
+	err := store.Put(org)
+	if err != nil {
+		err = fmt.Errorf("error saving org: %v", err)
+	}
+	recordAuthEvent(eventRefresh, org, err)
+	return err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPostTokenRequest(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		form = r.PostForm
+		w.Write([]byte(`{"access_token":"new_access","instance_url":"https://na1.salesforce.com","issued_at":"1700000000000"}`))
+	}))
+	defer server.Close()
+
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", "refresh1")
+	resp, err := postTokenRequest(server.URL, data, newSecret([]byte("s&cret")))
+	if err != nil {
+		t.Fatalf("postTokenRequest failed: %v", err)
+	}
+	if resp.AccessToken != "new_access" {
+		t.Errorf("Unexpected access token %q", resp.AccessToken)
+	}
+	if form.Get("client_secret") != "s&cret" || form.Get("refresh_token") != "refresh1" {
+		t.Errorf("Unexpected form %v", form)
+	}
+
+	// Without a secret the parameter is left out entirely
+	if _, err := postTokenRequest(server.URL, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := form["client_secret"]; ok {
+		t.Error("client_secret should not be sent when empty")
+	}
+}
+
+func TestPostTokenRequestFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := postTokenRequest(server.URL, url.Values{}, nil); err == nil {
+		t.Error("Expected an error for a non-200 response")
+	}
+}
+
+func TestApplyRefresh(t *testing.T) {
+	org := &StoredOrg{Alias: "prod", AccessToken: "old", RefreshToken: "refresh1", InstanceURL: "https://na1.salesforce.com"}
+	applyRefresh(org, &SalesforceOAuthResponse{AccessToken: "new", IssuedAt: "1700000000000"})
+
+	if org.AccessToken != "new" {
+		t.Errorf("Expected new access token, got %q", org.AccessToken)
+	}
+	if org.RefreshToken != "refresh1" || org.InstanceURL != "https://na1.salesforce.com" {
+		t.Error("Fields missing from the response should be kept")
+	}
+	if !org.IssuedAt.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("Unexpected issued at %v", org.IssuedAt)
+	}
+
+	// A rotated refresh token replaces the stored one
+	applyRefresh(org, &SalesforceOAuthResponse{AccessToken: "newer", RefreshToken: "refresh2"})
+	if org.RefreshToken != "refresh2" {
+		t.Errorf("Expected rotated refresh token, got %q", org.RefreshToken)
+	}
+}
+
+// failingStore refuses to save anything
+type failingStore struct{ TokenStore }
+
+func (failingStore) Put(*StoredOrg) error { return errors.New("disk full") }
+
+func TestSaveRefreshRecordsOnlySavedRefreshes(t *testing.T) {
+	path := withAuditLog(t)
+	org := &StoredOrg{Alias: "prod", RefreshToken: "refresh"}
+
+	if err := saveRefresh(failingStore{newTestStore(t)}, org); err == nil {
+		t.Fatal("Expected the save error")
+	}
+	if err := saveRefresh(newTestStore(t), org); err != nil {
+		t.Fatal(err)
+	}
+	events := auditedEvents(t, path)
+	if len(events) != 2 || events[0] != "refresh prod failure" || events[1] != "refresh prod success" {
+		t.Errorf("Unexpected audit events %q", events)
+	}
+}
+
+func TestRefreshDomain(t *testing.T) {
+	tests := []struct {
+		org  StoredOrg
+		want string
+	}{
+		{StoredOrg{Domain: "test.salesforce.com", InstanceURL: "https://cs1.salesforce.com"}, "test.salesforce.com"},
+		{StoredOrg{InstanceURL: "https://acme.my.salesforce.com"}, "acme.my.salesforce.com"},
+		{StoredOrg{}, defaultSalesforceDomain},
+	}
+	for _, tt := range tests {
+		if got := refreshDomain(&tt.org); got != tt.want {
+			t.Errorf("refreshDomain(%+v) = %q, want %q", tt.org, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshStoredOrgSendsClientSecret(t *testing.T) {
+	withFakeRevoker(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "shh" || r.FormValue("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "invalid client credentials"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "fresh", "refresh_token": "rotated", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	org := &StoredOrg{Alias: "prod", RefreshToken: "refresh", Domain: "login.example.com"}
+	secret := newSecret([]byte("shh"))
+	defer secret.Wipe()
+
+	resp, err := refreshStoredOrgToken(store, org, secret)
+	if err != nil {
+		t.Fatalf("refreshStoredOrgToken: %v", err)
+	}
+	if resp.ExpiresIn != 3600 {
+		t.Errorf("Expected expires_in to be passed on, got %d", resp.ExpiresIn)
+	}
+	saved, err := store.Get("prod")
+	if err != nil || saved.AccessToken != "fresh" || saved.RefreshToken != "rotated" {
+		t.Errorf("Expected the rotated tokens to be saved, got %+v (%v)", saved, err)
+	}
+}
+
+func TestRefreshAccessTokenUsesStoredClientSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "from-vault" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "invalid client credentials"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "fresh"}`))
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	org := &StoredOrg{Alias: "prod", RefreshToken: "refresh", Domain: "login.example.com", ClientSecret: "from-vault"}
+	resp, err := refreshAccessToken(org, nil)
+	if err != nil {
+		t.Fatalf("refreshAccessToken: %v", err)
+	}
+	if resp.AccessToken != "fresh" {
+		t.Errorf("AccessToken = %q, want fresh", resp.AccessToken)
+	}
+}
+
+func TestCachedTokenUsable(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	old := sessionTimeout
+	sessionTimeout = time.Hour
+	t.Cleanup(func() { sessionTimeout = old })
+
+	for _, tt := range []struct {
+		name string
+		org  StoredOrg
+		want bool
+	}{
+		{"fresh", StoredOrg{AccessToken: "access", IssuedAt: now.Add(-10 * time.Minute)}, true},
+		{"within min-ttl", StoredOrg{AccessToken: "access", IssuedAt: now.Add(-57 * time.Minute)}, false},
+		{"expired", StoredOrg{AccessToken: "access", IssuedAt: now.Add(-2 * time.Hour)}, false},
+		{"updated only", StoredOrg{AccessToken: "access", UpdatedAt: now.Add(-10 * time.Minute)}, true},
+		{"no issue time", StoredOrg{AccessToken: "access"}, false},
+		{"no access token", StoredOrg{IssuedAt: now}, false},
+	} {
+		if got := cachedTokenUsable(&tt.org, 5*time.Minute, now); got != tt.want {
+			t.Errorf("%s: cachedTokenUsable = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
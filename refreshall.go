@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultRefreshWorkers = 4
+
+// orgRefreshResult is one org's outcome in refresh --all
+type orgRefreshResult struct {
+	Alias       string     `json:"alias"`
+	Username    string     `json:"username,omitempty"`
+	InstanceURL string     `json:"instance_url,omitempty"`
+	Refreshed   bool       `json:"refreshed"`
+	IssuedAt    *time.Time `json:"issued_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// batchRefreshResult is the report refresh --all prints
+type batchRefreshResult struct {
+	Refreshed int                `json:"refreshed"`
+	Failed    int                `json:"failed"`
+	Orgs      []orgRefreshResult `json:"orgs"`
+}
+
+// orgRefresher refreshes stored orgs from a pool of workers. Token requests
+// run in parallel; writes to the store, which need not be safe for
+// concurrent use, take turns.
+type orgRefresher struct {
+	store        TokenStore
+	clientSecret *secret
+	refresh      func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error)
+	workers      int
+
+	mu sync.Mutex
+}
+
+// refreshAll refreshes every org and reports each outcome, in the order of
+// orgs. An org that fails does not stop the others.
+func (r *orgRefresher) refreshAll(orgs []*StoredOrg) *batchRefreshResult {
+	results := make([]orgRefreshResult, len(orgs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := max(min(r.workers, len(orgs)), 1)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer handlePanic()
+			for j := range jobs {
+				results[j] = r.refreshOrg(orgs[j])
+			}
+		}()
+	}
+	for i := range orgs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	batch := &batchRefreshResult{Orgs: results}
+	for _, res := range results {
+		if res.Refreshed {
+			batch.Refreshed++
+		} else {
+			batch.Failed++
+		}
+	}
+	return batch
+}
+
+// refreshOrg refreshes and saves one org. Unlike a single refresh, a revoked
+// refresh token is only reported, since there is nobody to log in again.
+func (r *orgRefresher) refreshOrg(org *StoredOrg) orgRefreshResult {
+	result := orgRefreshResult{Alias: org.Alias, Username: org.Username, InstanceURL: org.InstanceURL}
+	resp, err := r.refresh(org, r.clientSecret)
+	if err != nil {
+		result.Error = fmt.Sprintf("error refreshing token: %v", err)
+		verbosef("Refreshing %q failed: %v", org.Alias, err)
+		return result
+	}
+	previous := *org
+	applyRefresh(org, resp)
+	r.mu.Lock()
+	err = r.store.Put(org)
+	r.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("error saving org: %v", err)
+		recordAuthEvent(eventRefresh, org, err)
+		result.Error = err.Error()
+		return result
+	}
+	recordAuthEvent(eventRefresh, org, nil)
+	revokeSuperseded(&previous, org)
+
+	issued := org.IssuedAt
+	result.Refreshed, result.IssuedAt, result.InstanceURL = true, &issued, org.InstanceURL
+	verbosef("Refreshed %q", org.Alias)
+	return result
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshAll(t *testing.T) {
+	withQuiet(t)
+	withFakeRevoker(t)
+	store := newTestStore(t, "dev", "prod", "uat", "qa", "staging")
+	orgs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every worker blocks until all of them are busy, so the batch only
+	// finishes if the refreshes really run in parallel
+	const workers = 3
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	started := make(chan struct{})
+	var once sync.Once
+	r := &orgRefresher{
+		store:   store,
+		workers: workers,
+		refresh: func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+			mu.Lock()
+			inFlight++
+			peak = max(peak, inFlight)
+			if inFlight == workers {
+				once.Do(func() { close(started) })
+			}
+			mu.Unlock()
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+			}
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+
+			if org.Alias == "uat" {
+				return nil, fmt.Errorf("token request failed with status: 400")
+			}
+			return &SalesforceOAuthResponse{AccessToken: "refreshed_" + org.Alias, InstanceURL: "https://na1.salesforce.com"}, nil
+		},
+	}
+	batch := r.refreshAll(orgs)
+
+	if peak != workers {
+		t.Errorf("peak concurrent refreshes = %d, want %d", peak, workers)
+	}
+	if batch.Refreshed != 4 || batch.Failed != 1 || len(batch.Orgs) != 5 {
+		t.Fatalf("batch = %d refreshed, %d failed, %d orgs; want 4, 1, 5", batch.Refreshed, batch.Failed, len(batch.Orgs))
+	}
+	for i, res := range batch.Orgs {
+		if res.Alias != orgs[i].Alias {
+			t.Errorf("result %d is for %q, want %q", i, res.Alias, orgs[i].Alias)
+		}
+		if res.Alias == "uat" {
+			if res.Refreshed || !strings.Contains(res.Error, "status: 400") {
+				t.Errorf("uat result = %+v, want the refresh error", res)
+			}
+			continue
+		}
+		if !res.Refreshed || res.IssuedAt == nil || res.Error != "" {
+			t.Errorf("%s result = %+v, want refreshed", res.Alias, res)
+		}
+		saved, err := store.Get(res.Alias)
+		if err != nil || saved.AccessToken != "refreshed_"+res.Alias {
+			t.Errorf("saved %s = %+v, %v; want the new access token", res.Alias, saved, err)
+		}
+	}
+}
+
+func TestRefreshAllEmpty(t *testing.T) {
+	r := &orgRefresher{store: newTestStore(t), workers: defaultRefreshWorkers}
+	batch := r.refreshAll(nil)
+	if batch.Refreshed != 0 || batch.Failed != 0 || batch.Orgs == nil {
+		t.Errorf("batch for no orgs = %+v, want an empty report", batch)
+	}
+}
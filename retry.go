@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+)
+
+const (
+	defaultRetries      = 2
+	defaultRetryBackoff = time.Second
+
+	// maxRetryAfter is the longest Retry-After that is waited out; a longer
+	// one fails at once rather than stalling a batch job
+	maxRetryAfter = 2 * time.Minute
+)
+
+var (
+	flagRetries      int
+	flagRetryBackoff time.Duration
+
+	retrySleep = time.Sleep
+)
+
+// isTransientError reports whether a failed token request is worth sending
+// again: a network error, a 429 or a 5xx from the token endpoint. Certificate
+// failures and cancelled runs will not go away on their own.
+func isTransientError(err error) bool {
+	if isCancelled(err) {
+		return false
+	}
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Status == http.StatusTooManyRequests || oauthErr.Status >= http.StatusInternalServerError
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	// Only errors from the connection itself; the transport's own, such as
+	// a request missing from a --replay trace, fail the same way every time
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(urlErr.Err, &netErr) || errors.Is(urlErr.Err, io.EOF) || errors.Is(urlErr.Err, io.ErrUnexpectedEOF)
+}
+
+// withRetry runs a token request up to --retries more times while it fails
+// with a transient error, doubling the delay from --retry-backoff each time.
+// A Retry-After from the endpoint replaces the delay. Longer outages are
+// left to withMaintenanceRetry.
+func withRetry(call func() (*SalesforceOAuthResponse, error)) (*SalesforceOAuthResponse, error) {
+	delay := flagRetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := call()
+		if err == nil || attempt >= flagRetries || !isTransientError(err) {
+			return resp, err
+		}
+		wait, reason := delay, "Token request failed"
+		var oauthErr *oauthError
+		if errors.As(err, &oauthErr) {
+			rateLimited := oauthErr.Status == http.StatusTooManyRequests
+			switch {
+			case oauthErr.RetryAfter > maxRetryAfter && rateLimited:
+				return nil, fmt.Errorf("rate limited, and Salesforce asked to wait %s before retrying: %w", oauthErr.RetryAfter, err)
+			case oauthErr.RetryAfter > maxRetryAfter:
+				// A long outage, for withMaintenanceRetry to wait out
+				return nil, err
+			case oauthErr.RetryAfter > 0:
+				wait = oauthErr.RetryAfter
+			}
+			if rateLimited {
+				reason = "Rate limited by the token endpoint"
+			}
+		}
+		verbosef("Token request failed: %v", err)
+		infof("%s; retrying in %s (retry %d of %d)", reason, wait, attempt+1, flagRetries)
+		retrySleep(wait)
+		if runCtx.Err() != nil {
+			return nil, errCancelled
+		}
+		delay *= 2
+	}
+}
+
+// doWithRateLimitRetry sends an API request, sending it again up to
+// --retries more times while the org answers 429 Too Many Requests. It
+// waits for the response's Retry-After, or backs off from --retry-backoff
+// without one. The last response is returned as it is, so callers report a
+// 429 as they would any other status.
+func doWithRateLimitRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	delay := flagRetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= flagRetries {
+			return resp, err
+		}
+		wait := delay
+		if retryAfter := sfauth.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); retryAfter > 0 {
+			wait = retryAfter
+		}
+		// A body that cannot be read again cannot be sent again
+		if wait > maxRetryAfter || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		infof("Rate limited by %s; retrying in %s (retry %d of %d)", req.URL.Host, wait, attempt+1, flagRetries)
+		retrySleep(wait)
+		if runCtx.Err() != nil {
+			return nil, errCancelled
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		delay *= 2
+	}
+}
+
+// checkRetryFlags rejects negative --retries and --retry-backoff
+func checkRetryFlags() error {
+	if flagRetries < 0 {
+		return fmt.Errorf("--retries must not be negative")
+	}
+	if flagRetryBackoff < 0 {
+		return fmt.Errorf("--retry-backoff must not be negative")
+	}
+	return nil
+}
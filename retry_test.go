@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFakeRetrySleep records retry delays instead of sleeping
+func withFakeRetrySleep(t *testing.T, retries int) *[]time.Duration {
+	t.Helper()
+	var slept []time.Duration
+	originalSleep, originalRetries, originalBackoff := retrySleep, flagRetries, flagRetryBackoff
+	retrySleep = func(d time.Duration) { slept = append(slept, d) }
+	flagRetries, flagRetryBackoff = retries, time.Second
+	t.Cleanup(func() { retrySleep, flagRetries, flagRetryBackoff = originalSleep, originalRetries, originalBackoff })
+	return &slept
+}
+
+func TestIsTransientError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&oauthError{Status: http.StatusBadGateway}, true},
+		{&oauthError{Status: http.StatusServiceUnavailable}, true},
+		{&oauthError{Status: http.StatusTooManyRequests}, true},
+		{&oauthError{Status: http.StatusBadRequest, Code: "invalid_grant"}, false},
+		{fmt.Errorf("error making token request: %w", &url.Error{Op: "Post", URL: "https://x", Err: refused}), true},
+		{fmt.Errorf("error making token request: %w", &url.Error{Op: "Post", URL: "https://x", Err: io.EOF}), true},
+		{fmt.Errorf("error making token request: %w", &url.Error{Op: "Post", URL: "https://x", Err: errors.New("no recorded exchange")}), false},
+		{errors.New("error decoding token response: unexpected end of JSON input"), false},
+		{errCancelled, false},
+	}
+	for _, tt := range tests {
+		if got := isTransientError(tt.err); got != tt.want {
+			t.Errorf("isTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetryBacksOff(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 3)
+
+	calls := 0
+	resp, err := withRetry(func() (*SalesforceOAuthResponse, error) {
+		calls++
+		if calls < 4 {
+			return nil, &oauthError{Status: http.StatusInternalServerError}
+		}
+		return &SalesforceOAuthResponse{AccessToken: "access"}, nil
+	})
+	if err != nil || resp.AccessToken != "access" {
+		t.Fatalf("Expected success after retrying, got %v", err)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	if fmt.Sprint(*slept) != fmt.Sprint(want) {
+		t.Errorf("Expected delays %v, got %v", want, *slept)
+	}
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 2)
+
+	calls := 0
+	_, err := withRetry(func() (*SalesforceOAuthResponse, error) {
+		calls++
+		return nil, &oauthError{Status: http.StatusBadGateway}
+	})
+	if err == nil || calls != 3 || len(*slept) != 2 {
+		t.Errorf("Expected 3 attempts then the error, got %d attempts and %v", calls, err)
+	}
+}
+
+func TestWithRetryStopsOnPermanentError(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 2)
+
+	calls := 0
+	_, err := withRetry(func() (*SalesforceOAuthResponse, error) {
+		calls++
+		return nil, &oauthError{Status: http.StatusBadRequest, Code: "invalid_grant"}
+	})
+	if err == nil || calls != 1 || len(*slept) != 0 {
+		t.Errorf("Expected one attempt for invalid_grant, got %d", calls)
+	}
+}
+
+func TestPostTokenBodyRetriesServerErrors(t *testing.T) {
+	withQuiet(t)
+	withFakeRetrySleep(t, 2)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "grant_type=refresh_token" {
+			t.Errorf("Attempt %d sent body %q", calls, body)
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"access_token":"access"}`))
+	}))
+	defer server.Close()
+
+	resp, err := postTokenBody(server.URL, "refresh_token", []byte("grant_type=refresh_token"))
+	if err != nil || resp.AccessToken != "access" {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 requests, got %d", calls)
+	}
+}
+
+func TestPostTokenBodyRetriesNetworkErrors(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 1)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	if _, err := postTokenBody("http://"+addr+"/services/oauth2/token", "refresh_token", nil); err == nil {
+		t.Fatal("Expected an error from a closed port")
+	}
+	if len(*slept) != 1 {
+		t.Errorf("Expected one retry after a refused connection, got %d", len(*slept))
+	}
+}
+
+func TestWithRetryHonoursRetryAfter(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 2)
+
+	calls := 0
+	resp, err := withRetry(func() (*SalesforceOAuthResponse, error) {
+		calls++
+		switch calls {
+		case 1:
+			return nil, &oauthError{Status: http.StatusTooManyRequests, RetryAfter: 10 * time.Second}
+		case 2:
+			return nil, &oauthError{Status: http.StatusTooManyRequests}
+		}
+		return &SalesforceOAuthResponse{AccessToken: "access"}, nil
+	})
+	if err != nil || resp.AccessToken != "access" {
+		t.Fatalf("Expected success after the rate limit passed, got %v", err)
+	}
+	// Without a Retry-After the backoff carries on from where it was
+	want := []time.Duration{10 * time.Second, 2 * time.Second}
+	if fmt.Sprint(*slept) != fmt.Sprint(want) {
+		t.Errorf("Expected delays %v, got %v", want, *slept)
+	}
+}
+
+func TestWithRetryRefusesLongRetryAfter(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 2)
+
+	_, err := withRetry(func() (*SalesforceOAuthResponse, error) {
+		return nil, &oauthError{Status: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	})
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) || len(*slept) != 0 {
+		t.Fatalf("Expected the 429 at once, got %v after %v", err, *slept)
+	}
+	if !strings.Contains(err.Error(), "asked to wait 1h0m0s") {
+		t.Errorf("Unexpected message %q", err)
+	}
+}
+
+func TestPostTokenBodyRetriesRateLimit(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 2)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"access_token":"access"}`))
+	}))
+	defer server.Close()
+
+	resp, err := postTokenBody(server.URL, "refresh_token", []byte("grant_type=refresh_token"))
+	if err != nil || resp.AccessToken != "access" {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if fmt.Sprint(*slept) != fmt.Sprint([]time.Duration{3 * time.Second}) {
+		t.Errorf("Expected to wait the Retry-After, got %v", *slept)
+	}
+}
+
+func TestDoWithRateLimitRetry(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 2)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"Name":"Acme"}` {
+			t.Errorf("Attempt %d sent body %q", calls, body)
+		}
+		if calls < 3 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{"Name":"Acme"}`))
+	resp, err := doWithRateLimitRetry(server.Client(), req)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	resp.Body.Close()
+	if calls != 3 || len(*slept) != 2 {
+		t.Errorf("Expected 3 requests and 2 waits, got %d and %v", calls, *slept)
+	}
+}
+
+func TestDoWithRateLimitRetryGivesUp(t *testing.T) {
+	withQuiet(t)
+	slept := withFakeRetrySleep(t, 1)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := doWithRateLimitRetry(server.Client(), req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected the last 429 back, got %v", err)
+	}
+	resp.Body.Close()
+	if calls != 2 || fmt.Sprint(*slept) != fmt.Sprint([]time.Duration{time.Second}) {
+		t.Errorf("Expected 2 requests after a backoff of 1s, got %d and %v", calls, *slept)
+	}
+}
+
+func TestCheckRetryFlags(t *testing.T) {
+	withFakeRetrySleep(t, -1)
+	if err := checkRetryFlags(); err == nil {
+		t.Error("Expected negative --retries to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mr-menno/sfdc-go-auth-cli/pkg/sfauth"
+)
+
+// revokeSupersededTokens controls whether a refresh token replaced by
+// rotation or a fresh login is revoked ("revoke_superseded" in config.json)
+var revokeSupersededTokens = true
+
+// revokeStatusError is a non-200 response from the revoke endpoint
+type revokeStatusError = sfauth.RevokeError
+
+// isTokenAlreadyInvalid reports whether a revoke failed because the token
+// had already expired or been revoked, which Salesforce answers with 400
+func isTokenAlreadyInvalid(err error) bool {
+	var statusErr *revokeStatusError
+	return errors.As(err, &statusErr) && statusErr.Status == http.StatusBadRequest
+}
+
+func getSalesforceRevokeURL(domain string) string {
+	return sfauth.RevokeEndpoint(domain)
+}
+
+// revokeToken revokes an access or refresh token at the revoke endpoint of
+// domain with sfauth.Revoke. Revoking a refresh token also ends the sessions
+// issued from it.
+func revokeToken(domain, token string) error {
+	verbosef("POST %s", getSalesforceRevokeURL(domain))
+	return sfauth.Revoke(runCtx, nil, domain, token)
+}
+
+// revokeSuperseded revokes the previous refresh token of an org once a new
+// one has been saved, so stale tokens do not stay valid. Failures are only
+// logged; the new token is already in place. A token that belonged to
+// another user is left alone, as it was not superseded for them.
+func revokeSuperseded(previous, current *StoredOrg) {
+	if !revokeSupersededTokens || previous == nil || previous.RefreshToken == "" || previous.RefreshToken == current.RefreshToken {
+		return
+	}
+	if previous.OrgID != current.OrgID || previous.UserID != current.UserID {
+		return
+	}
+	if err := authDeps.Revoker.Revoke(refreshDomain(previous), previous.RefreshToken); err != nil {
+		log.Printf("Warning: could not revoke the superseded refresh token for %q: %v", previous.Alias, err)
+		recordAuthEvent(eventRevoke, previous, err)
+		return
+	}
+	infof("Revoked the superseded refresh token for %q", previous.Alias)
+	recordAuthEvent(eventRevoke, previous, nil)
+}
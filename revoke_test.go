@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRevokeToken(t *testing.T) {
+	var revoked string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/oauth2/revoke" {
+			http.NotFound(w, r)
+			return
+		}
+		revoked = r.FormValue("token")
+		if revoked == "unknown" {
+			http.Error(w, `{"error":"unsupported_token_type"}`, http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	originalTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = originalTransport }()
+	domain := strings.TrimPrefix(server.URL, "https://")
+
+	if err := revokeToken(domain, "refresh1"); err != nil {
+		t.Fatalf("revokeToken failed: %v", err)
+	}
+	if revoked != "refresh1" {
+		t.Errorf("Unexpected token revoked %q", revoked)
+	}
+	if err := revokeToken(domain, "unknown"); !isTokenAlreadyInvalid(err) {
+		t.Errorf("Expected a 400 for an unknown token, got %v", err)
+	}
+}
+
+func TestRevokeSuperseded(t *testing.T) {
+	withQuiet(t)
+	revoker := withFakeRevoker(t)
+	previous := &StoredOrg{Alias: "prod", RefreshToken: "old"}
+
+	revokeSuperseded(nil, &StoredOrg{RefreshToken: "new"})
+	revokeSuperseded(previous, &StoredOrg{RefreshToken: "old"})
+	if len(revoker.revoked) != 0 {
+		t.Fatalf("Nothing should be revoked without rotation, got %v", revoker.revoked)
+	}
+
+	revokeSuperseded(previous, &StoredOrg{RefreshToken: "new"})
+	if len(revoker.revoked) != 1 || revoker.revoked[0] != "old" {
+		t.Errorf("Expected the old token to be revoked, got %v", revoker.revoked)
+	}
+
+	// Another user's token under the same alias was not superseded
+	revokeSuperseded(&StoredOrg{Alias: "prod", UserID: "005other", RefreshToken: "theirs"}, &StoredOrg{UserID: "005me", RefreshToken: "mine"})
+	if len(revoker.revoked) != 1 {
+		t.Errorf("Another user's token should not be revoked, got %v", revoker.revoked)
+	}
+
+	revokeSupersededTokens = false
+	defer func() { revokeSupersededTokens = true }()
+	revokeSuperseded(previous, &StoredOrg{RefreshToken: "newer"})
+	if len(revoker.revoked) != 1 {
+		t.Error("Revoking should be skipped when turned off")
+	}
+}
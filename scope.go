@@ -0,0 +1,31 @@
+package main
+
+import "strings"
+
+// flagScopes are the OAuth scopes given with --scopes, as typed
+var flagScopes []string
+
+// parseScopes accepts --scopes repeated, comma-separated or space-separated
+// and returns each scope once, in the order given
+func parseScopes(values []string) []string {
+	var scopes []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, scope := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// requestedScope is the scope parameter to send: the --scopes given, or the
+// flow's default
+func requestedScope(defaultScope string) string {
+	if scopes := parseScopes(flagScopes); len(scopes) > 0 {
+		return strings.Join(scopes, " ")
+	}
+	return defaultScope
+}
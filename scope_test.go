@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	got := parseScopes([]string{"api refresh_token", "web,api", " openid "})
+	if want := []string{"api", "refresh_token", "web", "openid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseScopes = %v, want %v", got, want)
+	}
+}
+
+func TestAuthURLScopes(t *testing.T) {
+	defer func() { flagScopes = nil }()
+
+	flagScopes = []string{"api", "refresh_token,web"}
+	u, err := url.Parse(salesforceAuthURL{}.AuthURL("login.salesforce.com", "id", "http://localhost:8080/callback", "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("scope"); got != "api refresh_token web" {
+		t.Errorf("Expected the requested scopes, got %q", got)
+	}
+
+	flagScopes = nil
+	if got := authorizeScope(); got != "full refresh_token" {
+		t.Errorf("Expected the default scope, got %q", got)
+	}
+}
+
+func TestTokenResponseScope(t *testing.T) {
+	result := &TokenResponse{AccessToken: "access", InstanceURL: "https://na1.salesforce.com", Scope: "api refresh_token"}
+	data, err := formatTokenResponse(result, outputJSON)
+	if err != nil || !strings.Contains(string(data), `"scope": "api refresh_token"`) {
+		t.Errorf("Expected the granted scope in the JSON output, got %s (%v)", data, err)
+	}
+	data, err = formatTokenResponse(result, outputText)
+	if err != nil || !strings.Contains(string(data), "scope: api refresh_token\n") {
+		t.Errorf("Expected the granted scope in the text output, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultScratchDurationDays = 7
+
+var (
+	flagScratchDevHub       string
+	flagScratchDefinition   string
+	flagScratchClientID     string
+	flagScratchClientSecret string
+	flagScratchRedirectURI  string
+	flagScratchDurationDays int
+	flagScratchTimeout      time.Duration
+	flagScratchInterval     time.Duration
+
+	scratchSleep = time.Sleep
+)
+
+// scratchDefinitionSkipped are definition file keys that are not fields of
+// ScratchOrgInfo; the sf CLI deploys them as metadata once the org exists
+var scratchDefinitionSkipped = []string{"settings", "objectSettings"}
+
+var scratchCmd = &cobra.Command{
+	Use:   "scratch",
+	Short: "Create a scratch org from a Dev Hub and log in to it",
+	Long: `Create a scratch org with a stored Dev Hub org's token, wait for Salesforce to
+sign it up, and log in to it with the auth code the signup returns. The
+scratch org is saved to the token store under --alias like any other login.
+
+The definition file is the usual project-scratch-def.json. Its "settings" and
+"objectSettings" are not applied; deploy them with the sf CLI afterwards.
+
+The Connected App given with --client-id (default: the one the Dev Hub logged
+in with) must list --redirect-uri as a callback URL. Salesforce hands the
+scratch org's auth code to that app, so no browser is needed.`,
+	Args: cobra.NoArgs,
+	Run:  runScratch,
+}
+
+func init() {
+	scratchCmd.Flags().StringVar(&flagScratchDevHub, "devhub", "", "Alias of the stored Dev Hub org (default: the default org)")
+	scratchCmd.Flags().StringVarP(&flagScratchDefinition, "definition", "f", "", "Scratch org definition file (project-scratch-def.json)")
+	scratchCmd.Flags().StringVarP(&flagAlias, "alias", "a", "", "Alias to save the scratch org under in the token store (defaults to the org ID)")
+	scratchCmd.Flags().StringVarP(&flagScratchClientID, "client-id", "c", "", "Connected App to log in to the scratch org with (default: the Dev Hub's)")
+	scratchCmd.Flags().StringVarP(&flagScratchClientSecret, "client-secret", "s", "", "Client secret, if the Connected App requires one")
+	scratchCmd.Flags().StringVar(&flagScratchRedirectURI, "redirect-uri", "", "Callback URL of the Connected App (default: http://localhost:"+defaultPort+defaultCallbackPath+")")
+	scratchCmd.Flags().IntVar(&flagScratchDurationDays, "duration-days", defaultScratchDurationDays, "Days until the scratch org expires (1-30)")
+	scratchCmd.Flags().DurationVar(&flagScratchTimeout, "timeout", 10*time.Minute, "Give up waiting for the signup after this long")
+	scratchCmd.Flags().DurationVar(&flagScratchInterval, "interval", 10*time.Second, "Time between signup status checks")
+	_ = scratchCmd.MarkFlagRequired("definition")
+
+	rootCmd.AddCommand(scratchCmd)
+}
+
+// scratchOrgInfo is the Dev Hub's record of a scratch org signup
+type scratchOrgInfo struct {
+	ID             string `json:"Id"`
+	Status         string `json:"Status"`
+	ErrorCode      string `json:"ErrorCode"`
+	SignupUsername string `json:"SignupUsername"`
+	LoginURL       string `json:"LoginUrl"`
+	AuthCode       string `json:"AuthCode"`
+	ScratchOrg     string `json:"ScratchOrg"`
+	ExpirationDate string `json:"ExpirationDate"`
+}
+
+func runScratch(cmd *cobra.Command, args []string) {
+	clientSecret := newSecret([]byte(flagScratchClientSecret))
+	flagScratchClientSecret = ""
+	defer clientSecret.Wipe()
+
+	if flagScratchDurationDays < 1 || flagScratchDurationDays > 30 {
+		log.Fatalf("Error: --duration-days must be between 1 and 30")
+	}
+	if flagScratchInterval <= 0 {
+		log.Fatalf("Error: --interval must be positive")
+	}
+	fields, err := readScratchDefinition(flagScratchDefinition)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	store, devhub, err := useStoredOrg(flagScratchDevHub)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	clientID = flagScratchClientID
+	if clientID == "" {
+		clientID = devhub.ClientID
+	}
+	if clientID == "" {
+		log.Fatalf("Error: the Dev Hub %q has no client ID stored; pass --client-id", devhub.Alias)
+	}
+	redirectURI = flagScratchRedirectURI
+	if redirectURI == "" {
+		redirectURI = "http://localhost:" + defaultPort + defaultCallbackPath
+	}
+	codeVerifier = ""
+	fields["ConnectedAppConsumerKey"] = clientID
+	fields["ConnectedAppCallbackUrl"] = redirectURI
+	fields["DurationDays"] = flagScratchDurationDays
+
+	id, err := createScratchOrg(store, devhub, fields)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	infof("Requested scratch org %s from Dev Hub %q, waiting for it to be created", id, devhub.Alias)
+	info, err := waitForScratchOrg(store, devhub, id, flagScratchTimeout, flagScratchInterval)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	infof("Scratch org %s is ready for %s, expiring %s", info.ScratchOrg, info.SignupUsername, info.ExpirationDate)
+
+	domain, err := scratchLoginDomain(info.LoginURL)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	tokenResponse, err := exchangeCodeForTokens(info.AuthCode, domain, clientSecret)
+	if err != nil {
+		failLogin(err)
+	}
+	completeLogin(domain, tokenResponse, clientSecret)
+}
+
+// readScratchDefinition turns a scratch org definition file into
+// ScratchOrgInfo fields: orgName becomes OrgName, and the features list is
+// joined with semicolons
+func readScratchDefinition(path string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scratch org definition: %v", err)
+	}
+	var def map[string]interface{}
+	if err := json.Unmarshal(raw, &def); err != nil {
+		return nil, fmt.Errorf("error decoding scratch org definition %s: %v", path, err)
+	}
+
+	fields := make(map[string]interface{}, len(def))
+	for key, value := range def {
+		if containsString(scratchDefinitionSkipped, key) {
+			log.Printf("Warning: %q in %s is not applied; deploy it with the sf CLI", key, path)
+			continue
+		}
+		if key == "features" {
+			list, ok := value.([]interface{})
+			if !ok {
+				fields["Features"] = value
+				continue
+			}
+			features := make([]string, 0, len(list))
+			for _, f := range list {
+				features = append(features, fmt.Sprint(f))
+			}
+			value = strings.Join(features, ";")
+		}
+		r, size := utf8.DecodeRuneInString(key)
+		fields[string(unicode.ToUpper(r))+key[size:]] = value
+	}
+	if fields["Edition"] == nil {
+		return nil, fmt.Errorf("scratch org definition %s has no edition", path)
+	}
+	return fields, nil
+}
+
+// createScratchOrg inserts a ScratchOrgInfo record in the Dev Hub, which
+// starts the signup, and returns its ID
+func createScratchOrg(store TokenStore, devhub *StoredOrg, fields map[string]interface{}) (string, error) {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error encoding scratch org request: %v", err)
+	}
+	resp, err := orgRequest(store, devhub, http.MethodPost, "/services/data/"+salesforceAPIVersion+"/sobjects/ScratchOrgInfo", nil, body)
+	if err != nil {
+		return "", fmt.Errorf("error creating scratch org: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		var apiErrs []struct {
+			Message   string `json:"message"`
+			ErrorCode string `json:"errorCode"`
+		}
+		if json.Unmarshal(resp.Body, &apiErrs) == nil && len(apiErrs) > 0 {
+			return "", fmt.Errorf("error creating scratch org: %s: %s", apiErrs[0].ErrorCode, apiErrs[0].Message)
+		}
+		return "", fmt.Errorf("error creating scratch org: Dev Hub responded %s", resp.Status)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(resp.Body, &created); err != nil || created.ID == "" {
+		return "", fmt.Errorf("error creating scratch org: unexpected response from the Dev Hub")
+	}
+	return created.ID, nil
+}
+
+// waitForScratchOrg polls the signup every interval until the scratch org is
+// active, the signup fails, or timeout has passed
+func waitForScratchOrg(store TokenStore, devhub *StoredOrg, id string, timeout, interval time.Duration) (*scratchOrgInfo, error) {
+	soql := "SELECT Id, Status, ErrorCode, SignupUsername, LoginUrl, AuthCode, ScratchOrg, ExpirationDate FROM ScratchOrgInfo WHERE Id = '" + id + "'"
+	get := func(path string, out interface{}) error {
+		return orgGetJSON(store, devhub, path, out)
+	}
+	var waited time.Duration
+	for {
+		result, err := runSOQL(get, soql)
+		if err != nil {
+			return nil, fmt.Errorf("error checking scratch org %s: %v", id, err)
+		}
+		if len(result.Records) == 0 {
+			return nil, fmt.Errorf("scratch org request %s not found in the Dev Hub", id)
+		}
+		var info scratchOrgInfo
+		if err := json.Unmarshal(result.Records[0], &info); err != nil {
+			return nil, fmt.Errorf("error decoding ScratchOrgInfo: %v", err)
+		}
+		switch info.Status {
+		case "Active":
+			if info.AuthCode == "" || info.LoginURL == "" {
+				return nil, fmt.Errorf("scratch org %s is active but the Dev Hub returned no auth code", id)
+			}
+			return &info, nil
+		case "Error", "Deleted":
+			return nil, fmt.Errorf("scratch org signup failed with status %s (error code %s)", info.Status, info.ErrorCode)
+		}
+		if waited+interval > timeout {
+			return nil, fmt.Errorf("scratch org %s is still %s after %s", id, info.Status, timeout)
+		}
+		verbosef("Scratch org %s is %s; checking again in %s", id, info.Status, interval)
+		scratchSleep(interval)
+		waited += interval
+	}
+}
+
+// scratchLoginDomain is the host of the scratch org's login URL, where its
+// auth code is redeemed and later refreshes go
+func scratchLoginDomain(loginURL string) (string, error) {
+	u, err := url.Parse(loginURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid scratch org login URL %q", loginURL)
+	}
+	return u.Host, nil
+}
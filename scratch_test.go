@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadScratchDefinition(t *testing.T) {
+	withQuiet(t)
+	path := filepath.Join(t.TempDir(), "project-scratch-def.json")
+	def := `{
+  "orgName": "Acme dev",
+  "edition": "Developer",
+  "features": ["EnableSetPasswordInApi", "Communities"],
+  "hasSampleData": true,
+  "settings": {"lightningExperienceSettings": {"enableS1DesktopEnabled": true}}
+}`
+	if err := os.WriteFile(path, []byte(def), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	fields, err := readScratchDefinition(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"OrgName":       "Acme dev",
+		"Edition":       "Developer",
+		"Features":      "EnableSetPasswordInApi;Communities",
+		"HasSampleData": true,
+	}
+	if len(fields) != len(want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+	if !strings.Contains(logged.String(), `"settings"`) {
+		t.Errorf("Expected a warning that settings are not applied, got %q", logged.String())
+	}
+
+	if err := os.WriteFile(path, []byte(`{"orgName": "no edition"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readScratchDefinition(path); err == nil || !strings.Contains(err.Error(), "no edition") {
+		t.Errorf("definition without an edition error = %v", err)
+	}
+}
+
+// fakeDevHub accepts one ScratchOrgInfo, reports it as Creating for the
+// first polls status checks and with the final status after that
+func fakeDevHub(t *testing.T, polls int, final string) (*httptest.Server, *map[string]interface{}) {
+	t.Helper()
+	var created map[string]interface{}
+	checks := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer devhub-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/sobjects/ScratchOrgInfo"):
+			json.NewDecoder(r.Body).Decode(&created)
+			if created["Edition"] == "Bogus" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`[{"message":"invalid edition","errorCode":"INVALID_OR_NULL_FOR_RESTRICTED_PICKLIST"}]`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"2SR000000000001","success":true,"errors":[]}`))
+		case strings.HasSuffix(r.URL.Path, "/query"):
+			if !strings.Contains(r.URL.Query().Get("q"), "'2SR000000000001'") {
+				t.Errorf("unexpected query %q", r.URL.Query().Get("q"))
+			}
+			checks++
+			record := map[string]string{"Id": "2SR000000000001", "Status": "Creating"}
+			if checks > polls {
+				record = map[string]string{
+					"Id": "2SR000000000001", "Status": final, "ErrorCode": "C-1033",
+					"SignupUsername": "test-abc@example.com", "LoginUrl": "https://ability-dream-1234-dev-ed.scratch.my.salesforce.com",
+					"AuthCode": "aPrx.scratch-code", "ScratchOrg": "00D000000000009", "ExpirationDate": "2024-01-22",
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"totalSize": 1, "done": true, "records": []interface{}{record}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &created
+}
+
+func withScratchSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var slept []time.Duration
+	old := scratchSleep
+	scratchSleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { scratchSleep = old })
+	return &slept
+}
+
+func TestCreateAndWaitForScratchOrg(t *testing.T) {
+	withQuiet(t)
+	slept := withScratchSleep(t)
+	server, created := fakeDevHub(t, 2, "Active")
+	store := newTestStore(t)
+	devhub := &StoredOrg{Alias: "devhub", InstanceURL: server.URL, AccessToken: "devhub-token"}
+
+	id, err := createScratchOrg(store, devhub, map[string]interface{}{"Edition": "Developer", "ConnectedAppConsumerKey": "3MVG9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "2SR000000000001" || (*created)["ConnectedAppConsumerKey"] != "3MVG9" {
+		t.Errorf("created %s with %v", id, *created)
+	}
+
+	info, err := waitForScratchOrg(store, devhub, id, time.Minute, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AuthCode != "aPrx.scratch-code" || info.SignupUsername != "test-abc@example.com" {
+		t.Errorf("info = %+v", info)
+	}
+	if len(*slept) != 2 {
+		t.Errorf("slept %d times, want 2", len(*slept))
+	}
+	domain, err := scratchLoginDomain(info.LoginURL)
+	if err != nil || domain != "ability-dream-1234-dev-ed.scratch.my.salesforce.com" {
+		t.Errorf("scratchLoginDomain = %q, %v", domain, err)
+	}
+}
+
+func TestScratchOrgErrors(t *testing.T) {
+	withQuiet(t)
+	withScratchSleep(t)
+	store := newTestStore(t)
+
+	server, _ := fakeDevHub(t, 0, "Error")
+	devhub := &StoredOrg{Alias: "devhub", InstanceURL: server.URL, AccessToken: "devhub-token"}
+	if _, err := createScratchOrg(store, devhub, map[string]interface{}{"Edition": "Bogus"}); err == nil || !strings.Contains(err.Error(), "invalid edition") {
+		t.Errorf("createScratchOrg with a bad edition error = %v", err)
+	}
+	if _, err := waitForScratchOrg(store, devhub, "2SR000000000001", time.Minute, time.Second); err == nil || !strings.Contains(err.Error(), "C-1033") {
+		t.Errorf("failed signup error = %v", err)
+	}
+
+	slow, _ := fakeDevHub(t, 100, "Active")
+	devhub.InstanceURL = slow.URL
+	if _, err := waitForScratchOrg(store, devhub, "2SR000000000001", 30*time.Second, 10*time.Second); err == nil || !strings.Contains(err.Error(), "still Creating") {
+		t.Errorf("timed out signup error = %v", err)
+	}
+}
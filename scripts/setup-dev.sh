@@ -9,14 +9,14 @@ echo "🚀 Setting up development environment for Salesforce OAuth CLI..."
 
 # Check if Go is installed
 if ! command -v go &> /dev/null; then
-    echo "❌ Go is not installed. Please install Go 1.19+ first."
+    echo "❌ Go is not installed. Please install Go 1.23+ first."
     echo "   Visit: https://golang.org/dl/"
     exit 1
 fi
 
 # Check Go version
 GO_VERSION=$(go version | awk '{print $3}' | sed 's/go//')
-REQUIRED_VERSION="1.19"
+REQUIRED_VERSION="1.23"
 
 if ! printf '%s\n%s\n' "$REQUIRED_VERSION" "$GO_VERSION" | sort -V -C; then
     echo "❌ Go version $GO_VERSION is too old. Please upgrade to Go $REQUIRED_VERSION or later."
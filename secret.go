@@ -0,0 +1,55 @@
+package main
+
+// secret holds sensitive bytes such as a client secret. Unlike a string, its
+// backing memory can be overwritten, so callers Wipe it as soon as the value
+// has been used to shrink the window in which it could end up in a core dump
+// or swap.
+//
+// Access and refresh tokens are not held in one: they live in StoredOrg for
+// as long as a command runs, are encoded by every store backend and output
+// format, and are short-lived or revocable where a client secret is not.
+// What is wiped for them is the raw token response and the formatted output,
+// and token flags are cleared once read so they do not outlive the command's
+// use of them.
+type secret struct {
+	b []byte
+}
+
+// newSecret takes ownership of b; the caller must not keep its own copy
+func newSecret(b []byte) *secret {
+	return &secret{b: b}
+}
+
+// Bytes returns the secret without copying it
+func (s *secret) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.b
+}
+
+// Empty reports whether the secret has no content
+func (s *secret) Empty() bool {
+	return s == nil || len(s.b) == 0
+}
+
+// Wipe zeroes the secret's memory
+func (s *secret) Wipe() {
+	if s == nil {
+		return
+	}
+	wipeBytes(s.b)
+	s.b = nil
+}
+
+// String never reveals the value, so a secret is safe to pass to fmt or log
+func (s *secret) String() string {
+	return "[REDACTED]"
+}
+
+// wipeBytes zeroes b in place
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
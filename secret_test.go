@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSecretWipe(t *testing.T) {
+	buf := []byte("super-secret")
+	s := newSecret(buf)
+
+	if s.Empty() {
+		t.Error("Secret should not be empty before wiping")
+	}
+	if string(s.Bytes()) != "super-secret" {
+		t.Errorf("Unexpected secret bytes: %q", s.Bytes())
+	}
+
+	s.Wipe()
+	for i, b := range buf {
+		if b != 0 {
+			t.Fatalf("Byte %d not wiped", i)
+		}
+	}
+	if !s.Empty() {
+		t.Error("Secret should be empty after wiping")
+	}
+
+	// A nil secret is safe to use
+	var missing *secret
+	missing.Wipe()
+	if !missing.Empty() {
+		t.Error("Nil secret should be empty")
+	}
+}
+
+func TestSecretNeverFormatted(t *testing.T) {
+	s := newSecret([]byte("super-secret"))
+	for _, out := range []string{fmt.Sprint(s), fmt.Sprintf("%v", s), fmt.Sprintf("%s", s)} {
+		if out != "[REDACTED]" {
+			t.Errorf("Secret formatted as %q", out)
+		}
+	}
+}
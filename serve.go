@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultServeListen = "127.0.0.1:9900"
+
+var (
+	flagServeListen       string
+	flagServeTokenFile    string
+	flagServeClientSecret string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve stored org tokens over a local REST API",
+	Long: `Serve the token store over a REST API bound to a loopback address, so
+scripts and editors can fetch and refresh tokens without shelling out.
+
+Endpoints:
+  GET  /orgs                  list stored orgs (no tokens)
+  GET  /token/{alias}         a valid access token, refreshed first if it has
+                              expired or is about to
+  GET  /orgs/{alias}/token    stored access token and instance URL
+  POST /orgs/{alias}/refresh  refresh the access token and save it
+
+How long tokens last is estimated from "session_timeout" in config.json;
+/token/{alias} refreshes them once less than "expiry_critical" is left.
+
+Every request must send "Authorization: Bearer <secret>", where the secret is
+generated afresh each time the server starts and printed on startup.`,
+	Args: cobra.NoArgs,
+	Run:  runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&flagServeListen, "listen", defaultServeListen, "Loopback address to listen on")
+	serveCmd.Flags().StringVar(&flagServeTokenFile, "token-file", "", "Also write the session bearer secret to this file (mode 0600)")
+	serveCmd.Flags().StringVarP(&flagServeClientSecret, "client-secret", "s", "", "Client secret to send when refreshing, if the Connected App requires one")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+// apiServer answers the REST API from a token store
+type apiServer struct {
+	*tokenVendor
+	token []byte
+}
+
+// apiOrg is the token-free view of a stored org returned by GET /orgs
+type apiOrg struct {
+	Alias       string    `json:"alias"`
+	OrgID       string    `json:"org_id"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	PhotoURL    string    `json:"photo_url,omitempty"`
+	OrgName     string    `json:"org_name,omitempty"`
+	Edition     string    `json:"edition,omitempty"`
+	IsSandbox   bool      `json:"is_sandbox"`
+	Instance    string    `json:"instance,omitempty"`
+	InstanceURL string    `json:"instance_url"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// apiToken is returned by the token and refresh endpoints
+type apiToken struct {
+	AccessToken string    `json:"access_token"`
+	InstanceURL string    `json:"instance_url"`
+	IssuedAt    time.Time `json:"issued_at"`
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	if err := checkLoopbackAddr(flagServeListen); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	clientSecret := newSecret([]byte(flagServeClientSecret))
+	flagServeClientSecret = ""
+	defer clientSecret.Wipe()
+
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadProfileConfig(dir, flagProfile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	expiry, err := loadExpiryThresholds(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	token, err := generateSessionToken()
+	if err != nil {
+		log.Fatalf("Error generating session secret: %v", err)
+	}
+	defer wipeBytes(token)
+
+	if flagServeTokenFile != "" {
+		if err := os.WriteFile(flagServeTokenFile, append(token, '\n'), 0600); err != nil {
+			log.Fatalf("Error writing token file: %v", err)
+		}
+		defer os.Remove(flagServeTokenFile)
+	}
+
+	listener, err := net.Listen("tcp", flagServeListen)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", flagServeListen, err)
+	}
+
+	vendor := &tokenVendor{store: store, clientSecret: clientSecret, refresh: refreshAccessToken, expiry: expiry, now: authDeps.Clock.Now}
+	api := &apiServer{tokenVendor: vendor, token: token}
+	server := &http.Server{
+		Handler:           api.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(scrubWriter{w: os.Stderr}, "", log.LstdFlags),
+	}
+
+	// Ctrl-C stops the server; requests in flight get to finish
+	ctx := cmd.Context()
+	go func() {
+		defer handlePanic()
+		vendor.watchExpiry(ctx)
+	}()
+	go func() {
+		defer handlePanic()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	infof("Serving the %s token store on http://%s", flagStore, listener.Addr())
+	// Without the secret no client can connect, so --quiet only hides it
+	// when the token file holds it
+	if !flagQuiet || flagServeTokenFile == "" {
+		fmt.Fprintf(os.Stderr, "Session bearer secret: %s\n", token)
+	}
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// checkLoopbackAddr refuses listen addresses reachable from other machines,
+// since the API hands out live access tokens
+func checkLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("listen address %q is not a loopback address", addr)
+}
+
+// generateSessionToken returns a random bearer secret for one server run
+func generateSessionToken() ([]byte, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	defer wipeBytes(raw)
+	token := make([]byte, base64.RawURLEncoding.EncodedLen(len(raw)))
+	base64.RawURLEncoding.Encode(token, raw)
+	return token, nil
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orgs", s.handleListOrgs)
+	mux.HandleFunc("GET /token/{alias}", s.handleValidToken)
+	mux.HandleFunc("GET /orgs/{alias}/token", s.handleOrgToken)
+	mux.HandleFunc("POST /orgs/{alias}/refresh", s.handleRefreshOrg)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests that do not carry the session bearer secret
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), s.token) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sfdc-auth"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid bearer secret")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *apiServer) handleListOrgs(w http.ResponseWriter, r *http.Request) {
+	orgs, err := s.store.List()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("error listing orgs: %v", err))
+		return
+	}
+	result := make([]apiOrg, 0, len(orgs))
+	for _, org := range orgs {
+		result = append(result, newAPIOrg(org))
+	}
+	writeAPIJSON(w, http.StatusOK, result)
+}
+
+func (s *apiServer) handleOrgToken(w http.ResponseWriter, r *http.Request) {
+	alias := r.PathValue("alias")
+	org, err := s.storedToken(alias)
+	if err != nil {
+		writeVendorError(w, alias, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newAPIToken(org))
+}
+
+// handleValidToken serves the stored access token while it is expected to
+// last, and refreshes it first otherwise
+func (s *apiServer) handleValidToken(w http.ResponseWriter, r *http.Request) {
+	alias := r.PathValue("alias")
+	org, err := s.validToken(alias)
+	if err != nil {
+		writeVendorError(w, alias, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newAPIToken(org))
+}
+
+func (s *apiServer) handleRefreshOrg(w http.ResponseWriter, r *http.Request) {
+	alias := r.PathValue("alias")
+	org, err := s.refreshToken(alias)
+	if err != nil {
+		writeVendorError(w, alias, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newAPIToken(org))
+}
+
+// writeVendorError answers with the status matching a token vendor error
+func writeVendorError(w http.ResponseWriter, alias string, err error) {
+	switch {
+	case errors.Is(err, errOrgNotFound):
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("org %q not found", alias))
+	case errors.Is(err, errRefreshFailed):
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func newAPIToken(org *StoredOrg) apiToken {
+	return apiToken{AccessToken: org.AccessToken, InstanceURL: org.InstanceURL, IssuedAt: org.IssuedAt}
+}
+
+func newAPIOrg(org *StoredOrg) apiOrg {
+	return apiOrg{
+		Alias:       org.Alias,
+		OrgID:       org.OrgID,
+		UserID:      org.UserID,
+		Username:    org.Username,
+		DisplayName: org.DisplayName,
+		Email:       org.Email,
+		PhotoURL:    org.PhotoURL,
+		OrgName:     org.OrgName,
+		Edition:     org.Edition,
+		IsSandbox:   org.IsSandbox,
+		Instance:    org.InstanceName,
+		InstanceURL: org.InstanceURL,
+		UpdatedAt:   org.UpdatedAt,
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: error writing response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPIServer(t *testing.T) (*apiServer, *httptest.Server) {
+	t.Helper()
+	api := &apiServer{
+		tokenVendor: newTestVendor(t),
+		token:       []byte("session-secret"),
+	}
+	server := httptest.NewServer(api.routes())
+	t.Cleanup(server.Close)
+	return api, server
+}
+
+func apiRequest(t *testing.T, method, url, bearer string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeRequiresBearerSecret(t *testing.T) {
+	_, server := newTestAPIServer(t)
+
+	for _, bearer := range []string{"", "wrong"} {
+		resp := apiRequest(t, "GET", server.URL+"/orgs", bearer)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Bearer %q: expected 401, got %d", bearer, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeListOrgs(t *testing.T) {
+	_, server := newTestAPIServer(t)
+
+	resp := apiRequest(t, "GET", server.URL+"/orgs", "session-secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orgs []apiOrg
+	if err := json.Unmarshal(body, &orgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 2 || orgs[0].Alias != "dev" || orgs[1].Alias != "prod" {
+		t.Errorf("Unexpected orgs %+v", orgs)
+	}
+	if strings.Contains(string(body), "_refresh") {
+		t.Error("Org listing should not include tokens")
+	}
+}
+
+func TestServeOrgToken(t *testing.T) {
+	_, server := newTestAPIServer(t)
+	auditLog := withAuditLog(t)
+
+	resp := apiRequest(t, "GET", server.URL+"/orgs/missing/token", "session-secret")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing org, got %d", resp.StatusCode)
+	}
+	resp = apiRequest(t, "GET", server.URL+"/orgs/prod/token", "session-secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for a stored org, got %d", resp.StatusCode)
+	}
+	want := []string{"token-read missing failure", "token-read prod success"}
+	if got := auditedEvents(t, auditLog); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Audited %v, want %v", got, want)
+	}
+
+	resp = apiRequest(t, "POST", server.URL+"/orgs/prod/token", "session-secret")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeRefreshOrg(t *testing.T) {
+	api, server := newTestAPIServer(t)
+
+	resp := apiRequest(t, "POST", server.URL+"/orgs/prod/refresh", "session-secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	var token apiToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "refreshed_prod" {
+		t.Errorf("Unexpected access token %q", token.AccessToken)
+	}
+
+	// The refreshed token is saved and served afterwards
+	org, err := api.store.Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.AccessToken != "refreshed_prod" || org.RefreshToken != "prod_refresh" {
+		t.Errorf("Unexpected stored org %+v", org)
+	}
+
+	resp = apiRequest(t, "POST", server.URL+"/orgs/dev/refresh", "session-secret")
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected 502 when the refresh fails, got %d", resp.StatusCode)
+	}
+}
+
+func TestCheckLoopbackAddr(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:9900", "localhost:9900", "[::1]:9900"} {
+		if err := checkLoopbackAddr(addr); err != nil {
+			t.Errorf("checkLoopbackAddr(%q) failed: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"0.0.0.0:9900", ":9900", "192.168.1.10:9900", "127.0.0.1"} {
+		if err := checkLoopbackAddr(addr); err == nil {
+			t.Errorf("checkLoopbackAddr(%q) should fail", addr)
+		}
+	}
+}
+
+func TestServeValidToken(t *testing.T) {
+	api, server := newTestAPIServer(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	api.expiry = &expiryThresholds{Session: 2 * time.Hour, Warning: 15 * time.Minute, Critical: 5 * time.Minute}
+	api.now = func() time.Time { return now }
+
+	fresh := &StoredOrg{Alias: "fresh", AccessToken: "fresh_access", RefreshToken: "fresh_refresh", IssuedAt: now.Add(-time.Hour)}
+	stale := &StoredOrg{Alias: "stale", AccessToken: "stale_access", RefreshToken: "stale_refresh", IssuedAt: now.Add(-2*time.Hour + time.Minute)}
+	for _, org := range []*StoredOrg{fresh, stale} {
+		if err := api.store.Put(org); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token := func(alias string) apiToken {
+		t.Helper()
+		resp := apiRequest(t, "GET", server.URL+"/token/"+alias, "session-secret")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", alias, resp.StatusCode)
+		}
+		var token apiToken
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	if got := token("fresh"); got.AccessToken != "fresh_access" {
+		t.Errorf("Expected the stored token while it lasts, got %q", got.AccessToken)
+	}
+	if got := token("stale"); got.AccessToken != "refreshed_stale" {
+		t.Errorf("Expected a token about to expire to be refreshed, got %q", got.AccessToken)
+	}
+	if org, err := api.store.Get("stale"); err != nil || org.AccessToken != "refreshed_stale" {
+		t.Errorf("Expected the refreshed token to be saved, got %+v (%v)", org, err)
+	}
+
+	if resp := apiRequest(t, "GET", server.URL+"/token/missing", "session-secret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing org, got %d", resp.StatusCode)
+	}
+	// dev was never issued a token and its refresh fails
+	if resp := apiRequest(t, "GET", server.URL+"/token/dev", "session-secret"); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected 502 when the refresh fails, got %d", resp.StatusCode)
+	}
+}
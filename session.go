@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// apiStatusError is a non-200 response from an org's REST API
+type apiStatusError struct {
+	Status int
+}
+
+func (e *apiStatusError) Error() string {
+	return fmt.Sprintf("request failed with status: %d", e.Status)
+}
+
+// openStoredOrg opens the configured token store and reads the org saved
+// under alias, or the default org when alias is empty. The caller closes the
+// store.
+func openStoredOrg(alias string) (TokenStore, *StoredOrg, error) {
+	if alias == "" {
+		alias = defaultOrg
+	}
+	if alias == "" {
+		return nil, nil, fmt.Errorf("no org given (use --alias, or set a default with \"org use\")")
+	}
+	store, err := openConfiguredStore()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening token store: %v", err)
+	}
+	org, err := store.Get(alias)
+	if errors.Is(err, errOrgNotFound) {
+		store.Close()
+		return nil, nil, fmt.Errorf("org %q not found in the token store", alias)
+	}
+	if err != nil {
+		store.Close()
+		return nil, nil, fmt.Errorf("error reading org %q: %v", alias, err)
+	}
+	return store, org, nil
+}
+
+// useStoredOrg is openStoredOrg for commands that call the org with its
+// stored access token, auditing the read as a token-read event
+func useStoredOrg(alias string) (TokenStore, *StoredOrg, error) {
+	store, org, err := openStoredOrg(alias)
+	if err != nil {
+		if alias == "" {
+			alias = defaultOrg
+		}
+		recordAuthEvent(eventTokenRead, &StoredOrg{Alias: alias}, err)
+		return nil, nil, err
+	}
+	recordAuthEvent(eventTokenRead, org, nil)
+	return store, org, nil
+}
+
+// orgGetJSON makes an authenticated GET against the org, refreshing and
+// saving the access token once if the session has expired
+func orgGetJSON(store TokenStore, org *StoredOrg, path string, out interface{}) error {
+	err := getOrgJSON(org, path, out)
+	var statusErr *apiStatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusUnauthorized || org.RefreshToken == "" {
+		return err
+	}
+
+	verbosef("Session for %q has expired, refreshing", org.Alias)
+	if err := refreshStoredOrg(store, org, nil); err != nil {
+		return err
+	}
+	return getOrgJSON(org, path, out)
+}
+
+// refreshStoredOrg refreshes the org's access token and saves it. When the
+// refresh token has been revoked or has expired, an interactive user is
+// offered a new browser login instead. The client secret may be nil.
+func refreshStoredOrg(store TokenStore, org *StoredOrg, clientSecret *secret) error {
+	_, err := refreshStoredOrgToken(store, org, clientSecret)
+	return err
+}
+
+// refreshStoredOrgToken is refreshStoredOrg, returning the token response
+// too, for callers that print what Salesforce said about it, such as its
+// expires_in
+func refreshStoredOrgToken(store TokenStore, org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+	resp, err := refreshAccessToken(org, clientSecret)
+	if isInvalidGrant(err) && isInteractive() && confirmRelogin(org.Alias) {
+		return reloginOrg(store, org)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing token: %w", err)
+	}
+	previous := *org
+	applyRefresh(org, resp)
+	if err := saveRefresh(store, org); err != nil {
+		return nil, err
+	}
+	revokeSuperseded(&previous, org)
+	return resp, nil
+}
+
+// isInvalidGrant reports whether a refresh failed because the refresh token
+// is no good any more
+func isInvalidGrant(err error) bool {
+	var oauthErr *oauthError
+	return errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant"
+}
+
+// isInteractive reports whether a user is at the terminal to answer prompts
+// and complete a browser login
+var isInteractive = func() bool {
+	return stdinIsTerminal() && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// confirmRelogin asks whether to log in again, defaulting to yes
+func confirmRelogin(alias string) bool {
+	answer, err := promptLine(tr(msgConfirmRelogin, map[string]interface{}{"Alias": alias}))
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(strings.ToLower(answer), "n")
+}
+
+// reloginOrg runs the browser login for an org whose refresh token stopped
+// working and saves the result under the same alias, returning the login's
+// token response. The new login must be for the same org and user, so
+// another user's tokens never end up under it. A client secret saved with
+// the org is used, and kept, rather than asked for again.
+func reloginOrg(store TokenStore, org *StoredOrg) (*SalesforceOAuthResponse, error) {
+	clientID = org.ClientID
+	clientSecret := newSecret([]byte(org.ClientSecret))
+	if clientSecret.Empty() {
+		var err error
+		if clientSecret, err = readClientSecret(); err != nil {
+			return nil, fmt.Errorf("error getting client secret: %v", err)
+		}
+	}
+	defer clientSecret.Wipe()
+
+	if inContainer() {
+		flagContainer = true
+	}
+	callback, err := resolveCallback(flagPort, flagBind, flagRedirectURI, flagContainer)
+	if err != nil {
+		return nil, err
+	}
+	port = callback.Listen
+	redirectURI = callback.RedirectURI
+
+	domain := refreshDomain(org)
+	resp, err := runAuthFlow(runCtx, authDeps, callback, domain, clientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %v", err)
+	}
+
+	fresh := newStoredOrg(org.Alias, domain, resp)
+	if fresh.OrgID != org.OrgID || fresh.UserID != org.UserID {
+		return nil, fmt.Errorf("logged in as a different org or user; %q was not updated", org.Alias)
+	}
+	if err := enrichOrg(fresh); err != nil {
+		log.Printf("Warning: could not fetch org details: %v", err)
+	}
+	if storeKeepsClientSecret() && !clientSecret.Empty() {
+		fresh.ClientSecret = string(clientSecret.Bytes())
+	}
+	err = store.Put(fresh)
+	fresh.ClientSecret = ""
+	if err != nil {
+		return nil, fmt.Errorf("error saving org: %v", err)
+	}
+	*org = *fresh
+	infof("%s", tr(msgSavedOrg, map[string]interface{}{"Alias": org.Alias, "Store": flagStore}))
+	return resp, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOrgGetJSONRefreshesExpiredSession(t *testing.T) {
+	withQuiet(t)
+	withFakeRevoker(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/services/oauth2/token":
+			w.Write([]byte(`{"access_token": "fresh"}`))
+		case r.Header.Get("Authorization") != "Bearer fresh":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.Write([]byte(`{"ok": true}`))
+		}
+	}))
+	defer server.Close()
+
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+	// Refresh grants go to https://<domain>; send them to the test server
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	org := &StoredOrg{Alias: "prod", AccessToken: "stale", RefreshToken: "refresh", InstanceURL: server.URL, Domain: "login.example.com"}
+
+	var out struct {
+		OK bool `json:"ok"`
+	}
+	if err := orgGetJSON(store, org, "/services/data", &out); err != nil || !out.OK {
+		t.Fatalf("Expected the request to succeed after refreshing: %v", err)
+	}
+	saved, err := store.Get("prod")
+	if err != nil || saved.AccessToken != "fresh" {
+		t.Errorf("Expected the refreshed token to be saved, got %+v (%v)", saved, err)
+	}
+}
+
+// rewriteTransport sends every request to a plain HTTP test server
+type rewriteTransport struct {
+	target string
+	base   http.RoundTripper
+}
+
+func (rt rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	u, err := url.Parse(rt.target)
+	if err != nil {
+		return nil, err
+	}
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = u.Scheme, u.Host
+	return rt.base.RoundTrip(r)
+}
+
+func TestIsInvalidGrant(t *testing.T) {
+	if !isInvalidGrant(&oauthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "expired access/refresh token"}) {
+		t.Error("Expected invalid_grant to be detected")
+	}
+	if isInvalidGrant(&oauthError{Status: http.StatusServiceUnavailable}) || isInvalidGrant(errors.New("network down")) || isInvalidGrant(nil) {
+		t.Error("Only invalid_grant errors should be detected")
+	}
+}
+
+func TestRefreshStoredOrgInvalidGrantNonInteractive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant", "error_description": "expired access/refresh token"}`))
+	}))
+	defer server.Close()
+
+	original, originalInteractive := http.DefaultTransport, isInteractive
+	defer func() { http.DefaultTransport, isInteractive = original, originalInteractive }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+	isInteractive = func() bool { return false }
+
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	err = refreshStoredOrg(store, &StoredOrg{Alias: "prod", RefreshToken: "revoked", Domain: "login.example.com"}, nil)
+	if !isInvalidGrant(err) {
+		t.Errorf("Expected the invalid_grant error without a terminal, got %v", err)
+	}
+}
+
+func TestUseStoredOrgAudits(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	auditLog := withAuditLog(t)
+	if err := saveToStore(&StoredOrg{Alias: "prod", AccessToken: "00D!access", InstanceURL: "https://acme.my.salesforce.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, org, err := useStoredOrg("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if org.AccessToken != "00D!access" {
+		t.Errorf("Unexpected org %+v", org)
+	}
+	if _, _, err := useStoredOrg("missing"); err == nil {
+		t.Error("Expected a missing org to be an error")
+	}
+	want := []string{"token-read prod success", "token-read missing failure"}
+	if got := auditedEvents(t, auditLog); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Audited %v, want %v", got, want)
+	}
+}
+
+// recordingStore remembers every org saved to it, as a vault or Azure Key
+// Vault store would receive them
+type recordingStore struct {
+	TokenStore
+	puts []StoredOrg
+}
+
+func (s *recordingStore) Put(org *StoredOrg) error {
+	s.puts = append(s.puts, *org)
+	return s.TokenStore.Put(org)
+}
+
+func TestReloginOrgKeepsStoredClientSecret(t *testing.T) {
+	withQuiet(t)
+	withGrant(t, grantAuthorizationCode)
+	// Only the code is piped in: a client secret prompt would take it
+	withStdin(t, "the-code\n")
+	originalStore, originalClientID, originalContainer, originalDeps := flagStore, clientID, flagContainer, authDeps
+	flagStore, flagManual = storeTypeVault, true
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "fresh", RefreshToken: "new", ID: "https://login.salesforce.com/id/00D000000000001AAA/005000000000001AAA"}}
+	authDeps = &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: manualBrowser{}}
+	defer func() {
+		flagStore, clientID, flagContainer, authDeps, flagManual = originalStore, originalClientID, originalContainer, originalDeps, false
+	}()
+
+	store := &recordingStore{TokenStore: newTestStore(t)}
+	org := &StoredOrg{Alias: "prod", OrgID: "00D000000000001AAA", UserID: "005000000000001AAA", ClientID: "3MVG9", ClientSecret: "vault-secret", RefreshToken: "revoked", Domain: "login.salesforce.com"}
+	if _, err := reloginOrg(store, org); err != nil {
+		t.Fatalf("reloginOrg: %v", err)
+	}
+	if exchanger.secret != "vault-secret" {
+		t.Errorf("Expected the stored client secret to be used, got %q", exchanger.secret)
+	}
+	if len(store.puts) != 1 || store.puts[0].ClientSecret != "vault-secret" || store.puts[0].RefreshToken != "new" {
+		t.Fatalf("Expected the new login to be saved with the client secret, got %+v", store.puts)
+	}
+	if org.RefreshToken != "new" || org.ClientSecret != "" {
+		t.Errorf("Expected the caller's org to be updated without the secret, got %+v", org)
+	}
+}
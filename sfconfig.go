@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	sfProjectFileName = "sfdx-project.json"
+	sfConfigDirName   = ".sf"
+	sfTargetOrgKey    = "target-org"
+)
+
+var flagSetDefaultSfOrg bool
+
+// setDefaultSfOrg makes org the sf CLI target org of the project containing
+// the working directory
+func setDefaultSfOrg(org *StoredOrg) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	project, err := findSfProject(wd)
+	if err != nil {
+		return err
+	}
+
+	// The sf CLI resolves target-org as an alias or a username; our aliases
+	// are only known to it once the org is registered there, so prefer the
+	// username
+	target := org.Username
+	if target == "" {
+		target = org.Alias
+	}
+	if err := setSfConfigValue(project, sfTargetOrgKey, target); err != nil {
+		return err
+	}
+	infof("Set %s to %s in %s", sfTargetOrgKey, target, filepath.Join(project, sfConfigDirName, configFileName))
+	return nil
+}
+
+// findSfProject walks up from dir to the Salesforce DX project root, the
+// directory holding sfdx-project.json
+func findSfProject(dir string) (string, error) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, sfProjectFileName)); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("not in a Salesforce DX project (no %s found)", sfProjectFileName)
+		}
+		dir = parent
+	}
+}
+
+// setSfConfigValue sets one key in a project's .sf/config.json, keeping
+// any other settings in it
+func setSfConfigValue(project, key, value string) error {
+	dir := filepath.Join(project, sfConfigDirName)
+	path := filepath.Join(dir, configFileName)
+
+	settings := map[string]interface{}{}
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return fmt.Errorf("error decoding %s: %v", path, err)
+		}
+	}
+	settings[key] = value
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", dir, err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
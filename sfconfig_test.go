@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindSfProject(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, sfProjectFileName), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(root, "force-app", "main")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := findSfProject(nested)
+	if err != nil || got != root {
+		t.Errorf("Expected project root %s, got %s (%v)", root, got, err)
+	}
+	if _, err := findSfProject(t.TempDir()); err == nil {
+		t.Error("Expected an error outside a project")
+	}
+}
+
+func TestSetSfConfigValue(t *testing.T) {
+	project := t.TempDir()
+	dir := filepath.Join(project, sfConfigDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, configFileName)
+	if err := os.WriteFile(path, []byte(`{"target-dev-hub": "hub", "target-org": "old"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setSfConfigValue(project, sfTargetOrgKey, "me@example.com.uat"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]string
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings["target-org"] != "me@example.com.uat" || settings["target-dev-hub"] != "hub" {
+		t.Errorf("Unexpected settings %v", settings)
+	}
+}
+
+func TestSetSfConfigValueCreatesConfig(t *testing.T) {
+	project := t.TempDir()
+	if err := setSfConfigValue(project, sfTargetOrgKey, "uat"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(project, sfConfigDirName, configFileName)); err != nil {
+		t.Errorf("Expected .sf/config.json to be created: %v", err)
+	}
+}
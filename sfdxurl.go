@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const sfdxAuthURLScheme = "force://"
+
+var (
+	flagImportAuthURL     string
+	flagImportAuthURLFile string
+
+	flagExportAlias        string
+	flagExportClientSecret string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import an org from an SFDX auth URL",
+	Long: `Import an org the sf CLI already has credentials for, from an SFDX auth
+URL of the form force://<clientId>:<clientSecret>:<refreshToken>@<instance>
+as printed by "sf org display --verbose". The refresh token is used at once
+to mint an access token, which is printed like a login, and the org saved
+to the token store.
+
+--sfdx-auth-url-file reads the URL from a file, either on its own or as the
+JSON output of "sf org display --verbose --json".
+
+The client secret in the URL is only used for the first refresh and is not
+stored; if the Connected App requires it for refreshes, pass --client-secret
+to later refresh and serve commands.`,
+	Args: cobra.NoArgs,
+	Run:  runImport,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print a stored org as an SFDX auth URL",
+	Long: `Print a stored org as an SFDX auth URL for "sf org login sfdx-url", so
+this tool can bootstrap sf CLI auth in pipelines. Logins can print the same
+URL straight away with --output sfdx-url.
+
+Client secrets are never stored, so pass --client-secret if the Connected App
+requires one for refreshes; the secret is then embedded in the URL.`,
+	Args: cobra.NoArgs,
+	Run:  runExport,
+}
+
+func init() {
+	importCmd.Flags().StringVar(&flagImportAuthURL, "sfdx-auth-url", "", "SFDX auth URL (force://...)")
+	importCmd.Flags().StringVarP(&flagImportAuthURLFile, "sfdx-auth-url-file", "f", "", "File holding the SFDX auth URL")
+	importCmd.Flags().StringVarP(&flagAlias, "alias", "a", "", "Alias to save the org under in the token store (defaults to the org ID)")
+	importCmd.MarkFlagsOneRequired("sfdx-auth-url", "sfdx-auth-url-file")
+	importCmd.MarkFlagsMutuallyExclusive("sfdx-auth-url", "sfdx-auth-url-file")
+
+	exportCmd.Flags().StringVarP(&flagExportAlias, "alias", "a", "", "Alias of the stored org to export (default: the default org)")
+	exportCmd.Flags().StringVarP(&flagExportClientSecret, "client-secret", "s", "", "Client secret to embed in the URL, if the Connected App requires one")
+
+	rootCmd.AddCommand(importCmd, exportCmd)
+}
+
+// sfdxAuth is the content of an SFDX auth URL
+type sfdxAuth struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	InstanceURL  string
+}
+
+func runImport(cmd *cobra.Command, args []string) {
+	raw := flagImportAuthURL
+	if flagImportAuthURLFile != "" {
+		data, err := os.ReadFile(flagImportAuthURLFile)
+		if err != nil {
+			log.Fatalf("Error reading SFDX auth URL file: %v", err)
+		}
+		raw = sfdxAuthURLFromFile(data)
+		wipeBytes(data)
+	}
+	auth, err := parseSfdxAuthURL(raw)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	clientID = auth.ClientID
+	clientSecret := newSecret([]byte(auth.ClientSecret))
+	defer clientSecret.Wipe()
+	domain := strings.TrimPrefix(auth.InstanceURL, "https://")
+	org := &StoredOrg{ClientID: auth.ClientID, RefreshToken: auth.RefreshToken, Domain: domain, InstanceURL: auth.InstanceURL}
+
+	tokenResponse, err := refreshAccessToken(org, clientSecret)
+	if err != nil {
+		failLogin(err)
+	}
+	if tokenResponse.RefreshToken == "" {
+		tokenResponse.RefreshToken = auth.RefreshToken
+	}
+	if tokenResponse.InstanceURL == "" {
+		tokenResponse.InstanceURL = auth.InstanceURL
+	}
+	if auth.ClientSecret != "" {
+		log.Printf("Warning: the client secret in the auth URL is not stored; pass --client-secret to refresh if the Connected App requires it")
+	}
+	completeLogin(domain, tokenResponse, clientSecret)
+}
+
+func runExport(cmd *cobra.Command, args []string) {
+	clientSecret := newSecret([]byte(flagExportClientSecret))
+	flagExportClientSecret = ""
+	defer clientSecret.Wipe()
+
+	store, org, err := openStoredOrg(flagExportAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	output, err := sfdxAuthURL(org.ClientID, clientSecret, org.RefreshToken, org.InstanceURL)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	recordAuthEvent(eventTokenRead, org, nil)
+	if err := writeTokenOutput(output); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
+
+// sfdxAuthURL renders force://<clientId>:<clientSecret>:<refreshToken>@<instance>,
+// newline-terminated, the way the sf CLI prints it: without the instance's
+// scheme. The caller wipes the result once it is written.
+func sfdxAuthURL(clientID string, clientSecret *secret, refreshToken, instanceURL string) ([]byte, error) {
+	if refreshToken == "" {
+		return nil, fmt.Errorf("no refresh token to export; the Connected App must grant the refresh_token scope")
+	}
+	if clientID == "" || instanceURL == "" {
+		return nil, fmt.Errorf("a client ID and instance URL are needed for an SFDX auth URL")
+	}
+	instance := strings.TrimPrefix(instanceURL, "https://")
+	out := make([]byte, 0, len(sfdxAuthURLScheme)+len(clientID)+len(clientSecret.Bytes())+len(refreshToken)+len(instance)+4)
+	out = append(out, sfdxAuthURLScheme...)
+	out = append(out, clientID...)
+	out = append(out, ':')
+	out = append(out, clientSecret.Bytes()...)
+	out = append(out, ':')
+	out = append(out, refreshToken...)
+	out = append(out, '@')
+	out = append(out, instance...)
+	return append(out, '\n'), nil
+}
+
+// parseSfdxAuthURL splits force://<clientId>:<clientSecret>:<refreshToken>@<instance>.
+// The secret may be empty, as in the sf CLI's own force://PlatformCLI::...
+// URLs.
+func parseSfdxAuthURL(raw string) (*sfdxAuth, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(raw), sfdxAuthURLScheme)
+	if !ok {
+		return nil, fmt.Errorf("invalid SFDX auth URL: must start with %s", sfdxAuthURLScheme)
+	}
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return nil, fmt.Errorf("invalid SFDX auth URL: missing @<instance>")
+	}
+	parts := strings.SplitN(rest[:at], ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid SFDX auth URL: expected <clientId>:<clientSecret>:<refreshToken>@<instance>")
+	}
+
+	instance := rest[at+1:]
+	if !strings.Contains(instance, "://") {
+		instance = "https://" + instance
+	}
+	u, err := url.Parse(instance)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SFDX auth URL: bad instance %q", rest[at+1:])
+	}
+
+	// Refresh tokens are URL-encoded by some tools ("%21" for "!")
+	refreshToken, err := url.PathUnescape(parts[2])
+	if err != nil {
+		refreshToken = parts[2]
+	}
+	return &sfdxAuth{ClientID: parts[0], ClientSecret: parts[1], RefreshToken: refreshToken, InstanceURL: "https://" + u.Host}, nil
+}
+
+// sfdxAuthURLFromFile accepts a bare URL or sf org display --json output
+func sfdxAuthURLFromFile(data []byte) string {
+	var display struct {
+		Result struct {
+			SfdxAuthURL string `json:"sfdxAuthUrl"`
+		} `json:"result"`
+		SfdxAuthURL string `json:"sfdxAuthUrl"`
+	}
+	if json.Unmarshal(data, &display) == nil {
+		if display.Result.SfdxAuthURL != "" {
+			return display.Result.SfdxAuthURL
+		}
+		if display.SfdxAuthURL != "" {
+			return display.SfdxAuthURL
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
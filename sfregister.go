@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	sfdxDirName       = ".sfdx"
+	sfdxAliasFileName = "alias.json"
+	// sfdxKeyFileName is the sf CLI's "generic" keychain, the usual one on
+	// Linux, holding the key its auth files are encrypted with
+	sfdxKeyFileName = "key.json"
+	sfdxKeyService  = "sfdx"
+	sfdxKeyAccount  = "local"
+	// sfdxKeyLength is the length of the sf CLI's key: 16 random bytes,
+	// hex-encoded, whose characters are themselves the AES-256 key
+	sfdxKeyLength = 32
+	// sfdxIVBytes random bytes, again hex-encoded, make the GCM nonce
+	sfdxIVBytes = 6
+)
+
+// --register-sfdx, the sf CLI alias to register a login under
+var flagRegisterSfdx string
+
+// registerSfdxOrg writes org into the sf CLI's auth files so sf and sfdx
+// commands work with it under alias straight away: ~/.sfdx/<username>.json
+// with the tokens encrypted the way the sf CLI does it, and the alias in
+// ~/.sfdx/alias.json.
+func registerSfdxOrg(org *StoredOrg, clientSecret *secret, alias string) error {
+	if org.Username == "" {
+		return fmt.Errorf("the org's username is unknown, and the sf CLI files its auth under it")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error locating home directory: %v", err)
+	}
+	dir := filepath.Join(home, sfdxDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error creating %s: %v", dir, err)
+	}
+
+	key, err := sfdxKey(dir)
+	if err != nil {
+		return err
+	}
+	if err := writeSfdxAuthFile(dir, key, org, clientSecret); err != nil {
+		return err
+	}
+	if err := setSfdxAlias(dir, alias, org.Username); err != nil {
+		return err
+	}
+	infof("Registered %s with the sf CLI as %q", org.Username, alias)
+	return nil
+}
+
+// sfdxKey returns the sf CLI's encryption key, from key.json if the sf CLI
+// uses its generic keychain and otherwise from the OS keychain. Without one,
+// a key is created where the sf CLI would look for it first.
+func sfdxKey(dir string) (string, error) {
+	keyFile := filepath.Join(dir, sfdxKeyFileName)
+	raw, err := os.ReadFile(keyFile)
+	if err == nil {
+		var generic struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(raw, &generic); err != nil {
+			return "", fmt.Errorf("error decoding %s: %v", keyFile, err)
+		}
+		return checkSfdxKey(generic.Key)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("error reading %s: %v", keyFile, err)
+	}
+
+	key, err := keyring.Get(sfdxKeyService, sfdxKeyAccount)
+	if err == nil {
+		return checkSfdxKey(key)
+	}
+	if !errors.Is(err, keyring.ErrNotFound) && runtime.GOOS != "linux" {
+		return "", fmt.Errorf("error reading the sf CLI key from the keychain: %v", err)
+	}
+
+	random := make([]byte, sfdxKeyLength/2)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key = hex.EncodeToString(random)
+	if runtime.GOOS == "linux" {
+		data, err := json.Marshal(map[string]string{"service": sfdxKeyService, "account": sfdxKeyAccount, "key": key})
+		if err != nil {
+			return "", err
+		}
+		if err := writeFileAtomic(keyFile, data); err != nil {
+			return "", fmt.Errorf("error saving the sf CLI key: %v", err)
+		}
+		return key, nil
+	}
+	if err := keyring.Set(sfdxKeyService, sfdxKeyAccount, key); err != nil {
+		return "", fmt.Errorf("error saving the sf CLI key to the keychain: %v", err)
+	}
+	return key, nil
+}
+
+func checkSfdxKey(key string) (string, error) {
+	if len(key) != sfdxKeyLength {
+		return "", fmt.Errorf("unsupported sf CLI encryption key (%d characters, expected %d)", len(key), sfdxKeyLength)
+	}
+	return key, nil
+}
+
+// sfdxEncrypt encrypts a value the way the sf CLI's crypto does: AES-256-GCM
+// with the key's characters as the key and a hex string as the nonce,
+// written as <nonce><ciphertext hex>:<tag hex>
+func sfdxEncrypt(key string, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	random := make([]byte, sfdxIVBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	iv := hex.EncodeToString(random)
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, []byte(iv), plaintext, nil)
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return iv + hex.EncodeToString(ciphertext) + ":" + hex.EncodeToString(tag), nil
+}
+
+// writeSfdxAuthFile creates or updates ~/.sfdx/<username>.json, keeping any
+// fields the sf CLI added that this tool does not know about
+func writeSfdxAuthFile(dir, key string, org *StoredOrg, clientSecret *secret) error {
+	path := filepath.Join(dir, org.Username+".json")
+	auth, err := readSfdxJSON(path)
+	if err != nil {
+		return err
+	}
+
+	encrypted := map[string][]byte{
+		"accessToken":  []byte(org.AccessToken),
+		"refreshToken": []byte(org.RefreshToken),
+	}
+	if !clientSecret.Empty() {
+		encrypted["clientSecret"] = clientSecret.Bytes()
+	} else {
+		delete(auth, "clientSecret")
+	}
+	for field, value := range encrypted {
+		if len(value) == 0 {
+			delete(auth, field)
+			continue
+		}
+		if auth[field], err = sfdxEncrypt(key, value); err != nil {
+			return fmt.Errorf("error encrypting %s: %v", field, err)
+		}
+	}
+	auth["username"] = org.Username
+	auth["orgId"] = org.OrgID
+	auth["instanceUrl"] = org.InstanceURL
+	auth["loginUrl"] = "https://" + org.Domain
+	auth["clientId"] = org.ClientID
+	auth["isSandbox"] = org.IsSandbox
+	if _, ok := auth["isDevHub"]; !ok {
+		auth["isDevHub"] = false
+	}
+
+	data, err := json.MarshalIndent(auth, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// setSfdxAlias points alias at username in ~/.sfdx/alias.json
+func setSfdxAlias(dir, alias, username string) error {
+	path := filepath.Join(dir, sfdxAliasFileName)
+	aliases, err := readSfdxJSON(path)
+	if err != nil {
+		return err
+	}
+	orgs, _ := aliases["orgs"].(map[string]interface{})
+	if orgs == nil {
+		orgs = map[string]interface{}{}
+	}
+	orgs[alias] = username
+	aliases["orgs"] = orgs
+
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// readSfdxJSON reads one of the sf CLI's JSON files, or an empty object if
+// it does not exist yet
+func readSfdxJSON(path string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", path, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// sfdxDecrypt reverses sfdxEncrypt the way the sf CLI reads its auth files
+func sfdxDecrypt(t *testing.T, key, value string) string {
+	t.Helper()
+	body, tagHex, ok := strings.Cut(value, ":")
+	if !ok || len(body) < 2*sfdxIVBytes {
+		t.Fatalf("Malformed encrypted value %q", value)
+	}
+	iv, ciphertextHex := body[:2*sfdxIVBytes], body[2*sfdxIVBytes:]
+	ciphertext, err := hex.DecodeString(ciphertextHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := hex.DecodeString(tagHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := gcm.Open(nil, []byte(iv), append(ciphertext, tag...), nil)
+	if err != nil {
+		t.Fatalf("Could not decrypt %q: %v", value, err)
+	}
+	return string(plain)
+}
+
+func readJSONFile(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestRegisterSfdxOrg(t *testing.T) {
+	keyring.MockInit()
+	withQuiet(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	dir := filepath.Join(home, sfdxDirName)
+	key := strings.Repeat("0123456789abcdef", 2)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Set(sfdxKeyService, sfdxKeyAccount, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, sfdxAliasFileName), []byte(`{"orgs": {"hub": "hub@example.com"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	org := &StoredOrg{
+		Username:     "me@example.com.uat",
+		OrgID:        "00D000000000001",
+		InstanceURL:  "https://acme--uat.sandbox.my.salesforce.com",
+		Domain:       "test.salesforce.com",
+		ClientID:     "3MVG9",
+		AccessToken:  "00D!access",
+		RefreshToken: "5Aep-refresh",
+		IsSandbox:    true,
+	}
+	if err := registerSfdxOrg(org, newSecret([]byte("shh")), "uat"); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := readJSONFile(t, filepath.Join(dir, "me@example.com.uat.json"))
+	if got := sfdxDecrypt(t, key, auth["accessToken"].(string)); got != org.AccessToken {
+		t.Errorf("Expected the access token to decrypt, got %q", got)
+	}
+	if got := sfdxDecrypt(t, key, auth["refreshToken"].(string)); got != org.RefreshToken {
+		t.Errorf("Expected the refresh token to decrypt, got %q", got)
+	}
+	if got := sfdxDecrypt(t, key, auth["clientSecret"].(string)); got != "shh" {
+		t.Errorf("Expected the client secret to decrypt, got %q", got)
+	}
+	if auth["loginUrl"] != "https://test.salesforce.com" || auth["clientId"] != "3MVG9" || auth["isSandbox"] != true {
+		t.Errorf("Unexpected auth file %v", auth)
+	}
+
+	aliases := readJSONFile(t, filepath.Join(dir, sfdxAliasFileName))
+	orgs := aliases["orgs"].(map[string]interface{})
+	if orgs["uat"] != org.Username || orgs["hub"] != "hub@example.com" {
+		t.Errorf("Expected the alias added next to the existing one, got %v", orgs)
+	}
+}
+
+func TestRegisterSfdxOrgNeedsUsername(t *testing.T) {
+	if err := registerSfdxOrg(&StoredOrg{AccessToken: "x"}, nil, "uat"); err == nil {
+		t.Error("Expected an org without a username to be rejected")
+	}
+}
+
+func TestSfdxKeyFromGenericKeychain(t *testing.T) {
+	dir := t.TempDir()
+	key := strings.Repeat("a", sfdxKeyLength)
+	if err := os.WriteFile(filepath.Join(dir, sfdxKeyFileName), []byte(`{"service":"sfdx","account":"local","key":"`+key+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := sfdxKey(dir)
+	if err != nil || got != key {
+		t.Errorf("Expected the key from %s, got %q (%v)", sfdxKeyFileName, got, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, sfdxKeyFileName), []byte(`{"key":"short"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sfdxKey(dir); err == nil {
+		t.Error("Expected a key of the wrong length to be rejected")
+	}
+}
+
+func TestSfdxKeyCreated(t *testing.T) {
+	keyring.MockInit()
+	dir := t.TempDir()
+	key, err := sfdxKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != sfdxKeyLength {
+		t.Fatalf("Expected a %d character key, got %q", sfdxKeyLength, key)
+	}
+	again, err := sfdxKey(dir)
+	if err != nil || again != key {
+		t.Errorf("Expected the created key to be reused, got %q (%v)", again, err)
+	}
+	if runtime.GOOS == "linux" {
+		if _, err := os.Stat(filepath.Join(dir, sfdxKeyFileName)); err != nil {
+			t.Errorf("Expected the key in %s on Linux: %v", sfdxKeyFileName, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// exitCancelled is the exit status after SIGINT or SIGTERM, 128 + SIGINT as
+// shells report an interrupted command
+const exitCancelled = 130
+
+// cancelGrace is how long a cancelled command gets to shut down, for
+// example to close the callback server, before the process exits anyway.
+// It covers the 5 second shutdown of the serve and broker servers.
+const cancelGrace = 6 * time.Second
+
+// errCancelled is returned by work cut short by SIGINT or SIGTERM
+var errCancelled = errors.New("cancelled")
+
+// runCtx is the context of the running command, cancelled on SIGINT or
+// SIGTERM. Commands get it as cmd.Context(); HTTP requests are bound to it
+// by cancelTransport.
+var runCtx = context.Background()
+
+// watchSignals cancels runCtx on the first SIGINT or SIGTERM. A second
+// signal, or a command still running after cancelGrace, exits at once.
+func watchSignals() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runCtx = ctx
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		cancel()
+		if !flagQuiet {
+			fmt.Fprintln(os.Stderr, "Cancelling; press Ctrl-C again to exit now")
+		}
+		select {
+		case <-signals:
+		case <-time.After(cancelGrace):
+		case <-done:
+			return
+		}
+		exitOnCancel()
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// isCancelled reports whether err comes from, or followed, SIGINT or
+// SIGTERM. Most errors are formatted into messages along the way, so a
+// cancelled run counts too.
+func isCancelled(err error) bool {
+	return errors.Is(err, errCancelled) || errors.Is(err, context.Canceled) || runCtx.Err() != nil
+}
+
+// exitOnCancel exits with exitCancelled
+func exitOnCancel() {
+	log.Print("Cancelled")
+	os.Exit(exitCancelled)
+}
+
+// cancelTransport binds every HTTP request to runCtx, so a signal aborts
+// token, API and sync requests in flight and fails the ones that follow
+type cancelTransport struct {
+	base http.RoundTripper
+}
+
+func (t *cancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if runCtx.Err() != nil {
+		return nil, errCancelled
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(runCtx, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		stop()
+		cancel()
+		if runCtx.Err() != nil {
+			return nil, errCancelled
+		}
+		return nil, err
+	}
+	// The body is still read after RoundTrip returns, so the request stays
+	// cancellable until it is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, release: func() { stop(); cancel() }}
+	return resp, nil
+}
+
+// setupCancelTransport wraps the default transport in a cancelTransport,
+// once. It runs after setupProxy and setupHAR, which wrap it themselves.
+func setupCancelTransport() {
+	if _, ok := http.DefaultTransport.(*cancelTransport); !ok {
+		http.DefaultTransport = &cancelTransport{base: http.DefaultTransport}
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
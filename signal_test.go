@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withCancelledRun makes runCtx a context cancelled as if by Ctrl-C
+func withCancelledRun(t *testing.T) {
+	t.Helper()
+	original := runCtx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx = ctx
+	t.Cleanup(func() { runCtx = original })
+}
+
+func TestRunAuthFlowCancelled(t *testing.T) {
+	withQuiet(t)
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: &fakeExchanger{}, Clock: systemClock{}, Browser: manualBrowser{}}
+	callback := testCallback(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := runAuthFlow(ctx, deps, callback, "login.salesforce.com", nil)
+	if !errors.Is(err, errCancelled) {
+		t.Fatalf("Expected the flow to be cancelled, got %v", err)
+	}
+
+	// The callback server must have let go of its port
+	l, err := net.Listen("tcp", callback.Listen)
+	if err != nil {
+		t.Fatalf("Expected the callback port to be free again: %v", err)
+	}
+	l.Close()
+}
+
+func TestCancelTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &cancelTransport{base: http.DefaultTransport}}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	withCancelledRun(t)
+	_, err = client.Get(server.URL)
+	if !errors.Is(err, errCancelled) {
+		t.Errorf("Expected requests to fail once cancelled, got %v", err)
+	}
+	if !isCancelled(errors.New("error making token request: cancelled")) {
+		t.Error("Expected any error after cancellation to count as cancelled")
+	}
+}
+
+func TestCancelTransportAbortsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	original := runCtx
+	ctx, cancel := context.WithCancel(context.Background())
+	runCtx = ctx
+	defer func() { runCtx = original }()
+
+	client := &http.Client{Transport: &cancelTransport{base: http.DefaultTransport}}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := client.Get(server.URL); !errors.Is(err, errCancelled) {
+		t.Errorf("Expected the request in flight to be aborted, got %v", err)
+	}
+}
+
+func TestSetupCancelTransportOnce(t *testing.T) {
+	original := http.DefaultTransport
+	defer func() { http.DefaultTransport = original }()
+
+	setupCancelTransport()
+	setupCancelTransport()
+	wrapped, ok := http.DefaultTransport.(*cancelTransport)
+	if !ok || wrapped.base != original {
+		t.Errorf("Expected the default transport wrapped exactly once, got %#v", http.DefaultTransport)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagExpiryWarning  time.Duration
+	flagExpiryCritical time.Duration
+	flagValidateStrict bool
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show stored orgs and how soon their access tokens expire",
+	Long: `Show every org in the token store with the estimated expiry of its access
+token. Expiry is estimated from when the token was issued plus the session
+timeout ("session_timeout" in config.json, default 2h).
+
+Tokens within "expiry_warning" (default 15m) or "expiry_critical" (default 5m)
+of expiring are highlighted.`,
+	Args: cobra.NoArgs,
+	Run:  runStatus,
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [alias...]",
+	Short: "Check stored access tokens against the expiry thresholds",
+	Long: `Check the orgs given (or every stored org) against the expiry thresholds.
+Exits non-zero if a token has expired, or with --strict if any token is
+within the warning threshold, for use in pre-deploy checks.`,
+	Run: runValidate,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{statusCmd, validateCmd} {
+		cmd.Flags().DurationVar(&flagExpiryWarning, "warn", 0, "Warn when less than this is left (overrides expiry_warning)")
+		cmd.Flags().DurationVar(&flagExpiryCritical, "critical", 0, "Critical when less than this is left (overrides expiry_critical)")
+	}
+	validateCmd.Flags().BoolVar(&flagValidateStrict, "strict", false, "Also fail when a token is within the warning or critical threshold")
+
+	rootCmd.AddCommand(statusCmd, validateCmd)
+}
+
+// orgExpiry is one org's expiry state
+type orgExpiry struct {
+	Org       *StoredOrg
+	ExpiresAt time.Time
+	Level     expiryLevel
+}
+
+// orgExpiryJSON is the --output json form of an orgExpiry
+type orgExpiryJSON struct {
+	Alias       string      `json:"alias"`
+	Username    string      `json:"username,omitempty"`
+	DisplayName string      `json:"display_name,omitempty"`
+	Email       string      `json:"email,omitempty"`
+	PhotoURL    string      `json:"photo_url,omitempty"`
+	OrgName     string      `json:"org_name,omitempty"`
+	Edition     string      `json:"edition,omitempty"`
+	IsSandbox   bool        `json:"is_sandbox"`
+	Instance    string      `json:"instance,omitempty"`
+	InstanceURL string      `json:"instance_url"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	State       expiryLevel `json:"state"`
+}
+
+func runStatus(cmd *cobra.Command, args []string) {
+	thresholds, orgs := openExpiryCheck(nil)
+	now := authDeps.Clock.Now()
+	results := checkExpiry(thresholds, orgs, now)
+	if outputFormat(outputText) == outputJSON {
+		if err := writeJSON(expiryJSON(results)); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+		return
+	}
+	writeStatus(os.Stdout, results, now, useColor(os.Stdout))
+}
+
+func runValidate(cmd *cobra.Command, args []string) {
+	thresholds, orgs := openExpiryCheck(args)
+	now := authDeps.Clock.Now()
+	results := checkExpiry(thresholds, orgs, now)
+	passed := validationPassed(results, flagValidateStrict)
+
+	if outputFormat(outputText) == outputJSON {
+		verdict := struct {
+			Passed bool            `json:"passed"`
+			Orgs   []orgExpiryJSON `json:"orgs"`
+		}{passed, expiryJSON(results)}
+		if err := writeJSON(verdict); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+	} else {
+		color := useColor(os.Stdout)
+		for _, r := range results {
+			fmt.Printf("%s: %s (%s)\n", r.Org.Alias, colorLevel(r.Level, string(r.Level), color), describeExpiry(r.ExpiresAt, now))
+		}
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+func expiryJSON(results []orgExpiry) []orgExpiryJSON {
+	out := make([]orgExpiryJSON, 0, len(results))
+	for _, r := range results {
+		out = append(out, orgExpiryJSON{
+			Alias:       r.Org.Alias,
+			Username:    r.Org.Username,
+			DisplayName: r.Org.DisplayName,
+			Email:       r.Org.Email,
+			PhotoURL:    r.Org.PhotoURL,
+			OrgName:     r.Org.OrgName,
+			Edition:     r.Org.Edition,
+			IsSandbox:   r.Org.IsSandbox,
+			Instance:    r.Org.InstanceName,
+			InstanceURL: r.Org.InstanceURL,
+			ExpiresAt:   r.ExpiresAt,
+			State:       r.Level,
+		})
+	}
+	return out
+}
+
+// openExpiryCheck loads the thresholds and the orgs to check, all of them
+// when no aliases are given
+func openExpiryCheck(aliases []string) (*expiryThresholds, []*StoredOrg) {
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadProfileConfig(dir, flagProfile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	thresholds, err := loadExpiryThresholds(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if flagExpiryWarning > 0 {
+		thresholds.Warning = flagExpiryWarning
+	}
+	if flagExpiryCritical > 0 {
+		thresholds.Critical = flagExpiryCritical
+	}
+	if err := thresholds.validate(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	store, err := openConfiguredStore()
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+	defer store.Close()
+
+	var orgs []*StoredOrg
+	if len(aliases) == 0 {
+		if orgs, err = store.List(); err != nil {
+			log.Fatalf("Error listing orgs: %v", err)
+		}
+		return thresholds, orgs
+	}
+	for _, alias := range aliases {
+		org, err := store.Get(alias)
+		if errors.Is(err, errOrgNotFound) {
+			log.Fatalf("Org %q not found in the token store", alias)
+		}
+		if err != nil {
+			log.Fatalf("Error reading org %q: %v", alias, err)
+		}
+		orgs = append(orgs, org)
+	}
+	return thresholds, orgs
+}
+
+func checkExpiry(thresholds *expiryThresholds, orgs []*StoredOrg, now time.Time) []orgExpiry {
+	results := make([]orgExpiry, 0, len(orgs))
+	for _, org := range orgs {
+		results = append(results, orgExpiry{Org: org, ExpiresAt: thresholds.expiresAt(org), Level: thresholds.level(org, now)})
+	}
+	return results
+}
+
+// validationPassed fails on expired tokens, and in strict mode on anything
+// past the warning threshold
+func validationPassed(results []orgExpiry, strict bool) bool {
+	for _, r := range results {
+		if r.Level == expiryExpired || (strict && r.Level != expiryOK) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeStatus(out io.Writer, results []orgExpiry, now time.Time, color bool) {
+	if len(results) == 0 {
+		fmt.Fprintln(out, "No orgs in the token store")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tORG\tEDITION\tUSER\tINSTANCE\tEXPIRES\tSTATE")
+	for _, r := range results {
+		// Colour codes would throw off the column widths, so only the last
+		// column is coloured
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Org.Alias, orDash(r.Org.OrgName), orDash(orgEdition(r.Org)), orgUserLabel(r.Org), orgInstance(r.Org), describeExpiry(r.ExpiresAt, now), colorLevel(r.Level, string(r.Level), color))
+	}
+	w.Flush()
+}
+
+// orDash fills empty table cells, for orgs saved before their details were
+// recorded
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func describeExpiry(expiresAt, now time.Time) string {
+	remaining := expiresAt.Sub(now).Round(time.Minute)
+	switch {
+	case remaining == 0:
+		return "now"
+	case remaining < 0:
+		return formatMinutes(-remaining) + " ago"
+	}
+	return "in " + formatMinutes(remaining)
+}
+
+// formatMinutes prints a whole-minute duration without the trailing "0s"
+func formatMinutes(d time.Duration) string {
+	return strings.TrimSuffix(d.String(), "0s")
+}
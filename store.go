@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storeTypeFile     = "file"
+	storeTypeSQLite   = "sqlite"
+	storeTypeBolt     = "bolt"
+	storeTypeKeychain = "keychain"
+	storeTypeVault    = "vault"
+	storeTypeAzure    = "azure-keyvault"
+	storeTypeNone     = "none"
+
+	storeDirName  = "sfdc-auth"
+	storeFileName = "tokens.json"
+)
+
+// errOrgNotFound is returned when an alias is not present in the token store
+var errOrgNotFound = errors.New("org not found in token store")
+
+// StoredOrg represents an authenticated org persisted in the token store
+type StoredOrg struct {
+	Alias        string    `json:"alias"`
+	OrgID        string    `json:"org_id"`
+	UserID       string    `json:"user_id"`
+	Username     string    `json:"username,omitempty"`
+	DisplayName  string    `json:"display_name,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	PhotoURL     string    `json:"photo_url,omitempty"`
+	InstanceURL  string    `json:"instance_url"`
+	OrgName      string    `json:"org_name,omitempty"`
+	Edition      string    `json:"edition,omitempty"`
+	InstanceName string    `json:"instance_name,omitempty"`
+	IsSandbox    bool      `json:"is_sandbox,omitempty"`
+	Hybrid       bool      `json:"hybrid,omitempty"`
+	Domain       string    `json:"domain"`
+	ClientID     string    `json:"client_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	IssuedAt     time.Time `json:"issued_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// ClientSecret is only kept by the secret manager stores (vault,
+	// azure-keyvault), and used by refreshes when no --client-secret is given
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// secretOrg is the record the secret manager stores keep for an org: the
+// org, which can hold the Connected App's client secret, and the store
+// format version
+type secretOrg struct {
+	Version int `json:"version"`
+	StoredOrg
+}
+
+// TokenStore persists authenticated orgs between runs
+type TokenStore interface {
+	Get(alias string) (*StoredOrg, error)
+	Put(org *StoredOrg) error
+	Delete(alias string) error
+	List() ([]*StoredOrg, error)
+	Close() error
+}
+
+// defaultStoreDir returns the directory holding the token store files
+func defaultStoreDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating config directory: %v", err)
+	}
+	return filepath.Join(configDir, storeDirName), nil
+}
+
+// openTokenStore opens the token store backend of the given type in dir
+func openTokenStore(storeType, dir string) (TokenStore, error) {
+	switch storeType {
+	case storeTypeFile, "":
+		return newFileStore(filepath.Join(dir, storeFileName))
+	case storeTypeSQLite:
+		return newSQLiteStore(filepath.Join(dir, sqliteFileName))
+	case storeTypeBolt:
+		return newBoltStore(filepath.Join(dir, boltFileName))
+	case storeTypeKeychain:
+		return newKeychainStore()
+	case storeTypeVault:
+		return newVaultStore(flagVaultPath)
+	case storeTypeAzure:
+		return openAzureKeyVaultStore(flagAzureVaultURL)
+	default:
+		return nil, fmt.Errorf("unknown token store %q (expected %s, %s, %s, %s, %s, %s or %s)",
+			storeType, storeTypeFile, storeTypeSQLite, storeTypeBolt, storeTypeKeychain, storeTypeVault, storeTypeAzure, storeTypeNone)
+	}
+}
+
+// newStoredOrg builds a store record from a token endpoint response
+func newStoredOrg(alias, domain string, resp *SalesforceOAuthResponse) *StoredOrg {
+	orgID, userID := parseIdentityURL(resp.ID)
+	if alias == "" {
+		alias = orgID
+	}
+
+	org := &StoredOrg{
+		Alias:        alias,
+		OrgID:        orgID,
+		UserID:       userID,
+		InstanceURL:  resp.InstanceURL,
+		Domain:       domain,
+		ClientID:     clientID,
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		Hybrid:       flagGrant == grantHybrid,
+		UpdatedAt:    authDeps.Clock.Now().UTC(),
+	}
+	if issuedAt, err := parseIssuedAt(resp.IssuedAt); err == nil {
+		org.IssuedAt = issuedAt
+	}
+	return org
+}
+
+// placeOrg picks the alias a fresh login is saved under and returns the
+// entry it replaces, if any. Logins are keyed by org and user: without an
+// explicit alias a user keeps the alias they were saved under before, and a
+// second user of the same org gets an alias of their own rather than
+// replacing the first user's tokens.
+func placeOrg(store TokenStore, org *StoredOrg, explicitAlias bool) (*StoredOrg, error) {
+	if !explicitAlias && org.OrgID != "" && org.UserID != "" {
+		orgs, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range orgs {
+			if existing.OrgID == org.OrgID && existing.UserID == org.UserID {
+				org.Alias = existing.Alias
+				return existing, nil
+			}
+		}
+		// Nothing is stored for this user, so whatever holds the default
+		// alias belongs to someone else
+		if _, err := store.Get(org.Alias); err == nil {
+			org.Alias = userAlias(org)
+		} else if !errors.Is(err, errOrgNotFound) {
+			return nil, err
+		}
+	}
+
+	previous, err := store.Get(org.Alias)
+	if errors.Is(err, errOrgNotFound) {
+		return nil, nil
+	}
+	return previous, err
+}
+
+// userAlias is the default alias for a second user of an org. Usernames are
+// unique across all Salesforce orgs.
+func userAlias(org *StoredOrg) string {
+	if org.Username != "" {
+		return org.Username
+	}
+	return org.OrgID + "-" + org.UserID
+}
+
+// parseIdentityURL extracts the org and user IDs from an identity URL of the
+// form https://login.salesforce.com/id/<orgId>/<userId>
+func parseIdentityURL(id string) (string, string) {
+	u, err := url.Parse(id)
+	if err != nil {
+		return "", ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "id" {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
+
+// parseIssuedAt converts the millisecond timestamp returned by Salesforce
+func parseIssuedAt(issuedAt string) (time.Time, error) {
+	var ms int64
+	if _, err := fmt.Sscanf(issuedAt, "%d", &ms); err != nil {
+		return time.Time{}, fmt.Errorf("invalid issued_at %q: %v", issuedAt, err)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// fileStore keeps all orgs in a single JSON document
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+type fileStoreData struct {
+	Version int                   `json:"version"`
+	Orgs    map[string]*StoredOrg `json:"orgs"`
+}
+
+// fileStoreMigrations upgrade the raw JSON document one format version at a
+// time; entry i migrates version i to version i+1. Append a migration here
+// whenever the on-disk format changes.
+var fileStoreMigrations = []func(doc map[string]interface{}) error{
+	// v0 -> v1: unversioned documents gain a version field
+	func(doc map[string]interface{}) error {
+		if _, ok := doc["orgs"]; !ok {
+			doc["orgs"] = map[string]interface{}{}
+		}
+		return nil
+	},
+}
+
+// fileStoreVersion is the format version written by this release
+var fileStoreVersion = len(fileStoreMigrations)
+
+func newFileStore(path string) (*fileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %v", err)
+	}
+	return &fileStore{path: path}, nil
+}
+
+func (s *fileStore) load() (*fileStoreData, error) {
+	data := &fileStoreData{Orgs: map[string]*StoredOrg{}}
+
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token store: %v", err)
+	}
+
+	raw, migrated, err := s.migrate(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, fmt.Errorf("error decoding token store: %v", err)
+	}
+	if data.Orgs == nil {
+		data.Orgs = map[string]*StoredOrg{}
+	}
+	if migrated {
+		if err := s.save(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// migrate upgrades an older document to the current format, backing up the
+// original file first. It reports whether the document changed.
+func (s *fileStore) migrate(raw []byte) ([]byte, bool, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, false, fmt.Errorf("error decoding token store: %v", err)
+	}
+
+	version := 0
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	if err := checkStoreVersion(s.path, version, fileStoreVersion); err != nil {
+		return nil, false, err
+	}
+	if version == fileStoreVersion {
+		return raw, false, nil
+	}
+
+	backup, err := backupStoreFile(s.path, version)
+	if err != nil {
+		return nil, false, err
+	}
+	for v := version; v < fileStoreVersion; v++ {
+		if err := fileStoreMigrations[v](doc); err != nil {
+			return nil, false, fmt.Errorf("error migrating token store to v%d: %v", v+1, err)
+		}
+	}
+	doc["version"] = fileStoreVersion
+
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		return nil, false, fmt.Errorf("error encoding migrated token store: %v", err)
+	}
+	logStoreMigration(s.path, version, fileStoreVersion, backup)
+	return raw, true, nil
+}
+
+func (s *fileStore) save(data *fileStoreData) error {
+	data.Version = fileStoreVersion
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding token store: %v", err)
+	}
+
+	if err := writeFileAtomic(s.path, raw); err != nil {
+		return fmt.Errorf("error saving token store: %v", err)
+	}
+	return nil
+}
+
+func (s *fileStore) Get(alias string) (*StoredOrg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	org, ok := data.Orgs[alias]
+	if !ok {
+		return nil, errOrgNotFound
+	}
+	return org, nil
+}
+
+func (s *fileStore) Put(org *StoredOrg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	data.Orgs[org.Alias] = org
+	return s.save(data)
+}
+
+func (s *fileStore) Delete(alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := data.Orgs[alias]; !ok {
+		return errOrgNotFound
+	}
+	delete(data.Orgs, alias)
+	return s.save(data)
+}
+
+func (s *fileStore) List() ([]*StoredOrg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	orgs := make([]*StoredOrg, 0, len(data.Orgs))
+	for _, org := range data.Orgs {
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Alias < orgs[j].Alias })
+	return orgs, nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+const (
+	azureKeyVaultVersion = 1
+
+	azureKeyVaultURLEnv = "AZURE_KEYVAULT_URL"
+	// azureSecretPrefix starts the name of every secret holding an org, so
+	// the store shares a vault with other secrets
+	azureSecretPrefix = "sfdc-auth-"
+	// azureSecretNameMax is Key Vault's limit on secret names
+	azureSecretNameMax = 127
+	// azurePurgeAttempts bounds how long Delete waits for a deleted secret
+	// to become purgeable
+	azurePurgeAttempts = 10
+)
+
+// --azure-vault-url, the Key Vault orgs are kept in
+var flagAzureVaultURL string
+
+// azureSecretEncoding turns aliases into the letters and digits Key Vault
+// allows in secret names
+var azureSecretEncoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv").WithPadding(base32.NoPadding)
+
+// azureKeyVaultStore keeps each org as a secret in an Azure Key Vault. It
+// signs in with DefaultAzureCredential: environment variables, workload
+// identity, managed identity or the Azure CLI, whichever is available.
+type azureKeyVaultStore struct {
+	client *azsecrets.Client
+}
+
+func openAzureKeyVaultStore(vaultURL string) (*azureKeyVaultStore, error) {
+	if vaultURL == "" {
+		vaultURL = os.Getenv(azureKeyVaultURLEnv)
+	}
+	if vaultURL == "" {
+		return nil, fmt.Errorf("--store azure-keyvault needs --azure-vault-url (or %s), e.g. https://my-vault.vault.azure.net", azureKeyVaultURLEnv)
+	}
+	// Requests go through the shared transport, so --proxy, --ca-bundle and
+	// --debug apply to Azure as well
+	options := policy.ClientOptions{Transport: http.DefaultClient}
+	cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{ClientOptions: options})
+	if err != nil {
+		return nil, fmt.Errorf("error setting up Azure credentials: %v", err)
+	}
+	return newAzureKeyVaultStore(vaultURL, cred, &azsecrets.ClientOptions{ClientOptions: options})
+}
+
+func newAzureKeyVaultStore(vaultURL string, cred azcore.TokenCredential, options *azsecrets.ClientOptions) (*azureKeyVaultStore, error) {
+	client, err := azsecrets.NewClient(vaultURL, cred, options)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Key Vault client: %v", err)
+	}
+	return &azureKeyVaultStore{client: client}, nil
+}
+
+// azureSecretName is the name of the secret holding alias
+func azureSecretName(alias string) (string, error) {
+	name := azureSecretPrefix + azureSecretEncoding.EncodeToString([]byte(alias))
+	if len(name) > azureSecretNameMax {
+		return "", fmt.Errorf("alias %q is too long for an Azure Key Vault secret name", alias)
+	}
+	return name, nil
+}
+
+// azureSecretAlias reverses azureSecretName, reporting false for secrets the
+// store did not write
+func azureSecretAlias(name string) (string, bool) {
+	encoded, ok := strings.CutPrefix(name, azureSecretPrefix)
+	if !ok {
+		return "", false
+	}
+	alias, err := azureSecretEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(alias), true
+}
+
+func isAzureStatus(err error, status int) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == status
+}
+
+func (s *azureKeyVaultStore) Get(alias string) (*StoredOrg, error) {
+	name, err := azureSecretName(alias)
+	if err != nil {
+		return nil, errOrgNotFound
+	}
+	resp, err := s.client.GetSecret(context.Background(), name, "", nil)
+	if isAzureStatus(err, http.StatusNotFound) {
+		return nil, errOrgNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading org %q from Key Vault: %v", alias, err)
+	}
+	if resp.Value == nil {
+		return nil, errOrgNotFound
+	}
+	var record secretOrg
+	if err := json.Unmarshal([]byte(*resp.Value), &record); err != nil {
+		return nil, fmt.Errorf("error decoding org %q from Key Vault: %v", alias, err)
+	}
+	if err := checkStoreVersion("in Key Vault", record.Version, azureKeyVaultVersion); err != nil {
+		return nil, err
+	}
+	return &record.StoredOrg, nil
+}
+
+func (s *azureKeyVaultStore) Put(org *StoredOrg) error {
+	name, err := azureSecretName(org.Alias)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(secretOrg{Version: azureKeyVaultVersion, StoredOrg: *org})
+	if err != nil {
+		return fmt.Errorf("error encoding org: %v", err)
+	}
+	value, contentType := string(raw), "application/json"
+	wipeBytes(raw)
+	params := azsecrets.SetSecretParameters{
+		Value:       &value,
+		ContentType: &contentType,
+		Tags:        map[string]*string{"sfdc-auth-alias": &org.Alias},
+	}
+	_, err = s.client.SetSecret(context.Background(), name, params, nil)
+	if isAzureStatus(err, http.StatusConflict) {
+		return fmt.Errorf("the Key Vault secret for %q was deleted but not purged yet; purge %s or wait for the retention period to end", org.Alias, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing org %q to Key Vault: %v", org.Alias, err)
+	}
+	return nil
+}
+
+// Delete deletes the org's secret and then purges it, so the refresh token
+// cannot be recovered and the alias can be used again. Purging needs the
+// purge permission; without it the secret stays recoverable until the
+// vault's retention period ends.
+func (s *azureKeyVaultStore) Delete(alias string) error {
+	name, err := azureSecretName(alias)
+	if err != nil {
+		return errOrgNotFound
+	}
+	ctx := context.Background()
+	_, err = s.client.DeleteSecret(ctx, name, nil)
+	if isAzureStatus(err, http.StatusNotFound) {
+		return errOrgNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting org %q from Key Vault: %v", alias, err)
+	}
+
+	// Deletion completes in the background; until it has, purging answers
+	// 404 or 409
+	for attempt := 0; attempt < azurePurgeAttempts; attempt++ {
+		_, err = s.client.PurgeDeletedSecret(ctx, name, nil)
+		if err == nil {
+			return nil
+		}
+		if !isAzureStatus(err, http.StatusNotFound) && !isAzureStatus(err, http.StatusConflict) {
+			break
+		}
+		retrySleep(time.Second)
+	}
+	verbosef("Could not purge the Key Vault secret %s, it stays recoverable: %v", name, err)
+	return nil
+}
+
+func (s *azureKeyVaultStore) List() ([]*StoredOrg, error) {
+	var orgs []*StoredOrg
+	pager := s.client.NewListSecretPropertiesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("error listing orgs in Key Vault: %v", err)
+		}
+		for _, props := range page.Value {
+			if props.ID == nil || (props.Attributes != nil && props.Attributes.Enabled != nil && !*props.Attributes.Enabled) {
+				continue
+			}
+			alias, ok := azureSecretAlias(props.ID.Name())
+			if !ok {
+				continue
+			}
+			org, err := s.Get(alias)
+			if errors.Is(err, errOrgNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Alias < orgs[j].Alias })
+	return orgs, nil
+}
+
+func (s *azureKeyVaultStore) Close() error {
+	return nil
+}
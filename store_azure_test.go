@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+const fakeAzureToken = "azure-test-token"
+
+// fakeKeyVault serves the parts of the Key Vault secrets API the
+// azure-keyvault store uses, including soft delete
+type fakeKeyVault struct {
+	mu      sync.Mutex
+	url     string
+	secrets map[string]string
+	deleted map[string]bool
+	disable map[string]bool
+}
+
+func (v *fakeKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// The client only sends a token once the vault has challenged it
+	if r.Header.Get("Authorization") != "Bearer "+fakeAzureToken {
+		w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/00000000-0000-0000-0000-000000000000", resource="https://vault.azure.net"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/secrets" && r.Method == http.MethodGet {
+		var items []map[string]interface{}
+		for name := range v.secrets {
+			items = append(items, map[string]interface{}{
+				"id":         v.url + "/secrets/" + name,
+				"attributes": map[string]bool{"enabled": !v.disable[name]},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": items})
+		return
+	}
+	if name, ok := strings.CutPrefix(r.URL.Path, "/deletedsecrets/"); ok && r.Method == http.MethodDelete {
+		if !v.deleted[name] {
+			v.notFound(w)
+			return
+		}
+		delete(v.deleted, name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	name, ok := strings.CutPrefix(r.URL.Path, "/secrets/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name, _, _ = strings.Cut(name, "/")
+
+	switch r.Method {
+	case http.MethodPut:
+		if v.deleted[name] {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":{"code":"Conflict","message":"Secret is currently in a deleted but recoverable state"}}`))
+			return
+		}
+		var body struct {
+			Value string `json:"value"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		v.secrets[name] = body.Value
+		json.NewEncoder(w).Encode(map[string]string{"id": v.url + "/secrets/" + name + "/1", "value": body.Value})
+	case http.MethodGet:
+		value, ok := v.secrets[name]
+		if !ok {
+			v.notFound(w)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": v.url + "/secrets/" + name + "/1", "value": value})
+	case http.MethodDelete:
+		if _, ok := v.secrets[name]; !ok {
+			v.notFound(w)
+			return
+		}
+		delete(v.secrets, name)
+		v.deleted[name] = true
+		json.NewEncoder(w).Encode(map[string]string{"id": v.url + "/secrets/" + name + "/1"})
+	}
+}
+
+func (v *fakeKeyVault) notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"error":{"code":"SecretNotFound","message":"A secret with the given name was not found"}}`))
+}
+
+// fakeAzureCredential hands out a fixed token instead of signing in
+type fakeAzureCredential struct{}
+
+func (fakeAzureCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: fakeAzureToken, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func newTestAzureKeyVaultStore(t *testing.T) (*azureKeyVaultStore, *fakeKeyVault) {
+	t.Helper()
+	vault := &fakeKeyVault{secrets: map[string]string{}, deleted: map[string]bool{}, disable: map[string]bool{}}
+	server := httptest.NewTLSServer(vault)
+	t.Cleanup(server.Close)
+	vault.url = server.URL
+
+	store, err := newAzureKeyVaultStore(server.URL, fakeAzureCredential{}, &azsecrets.ClientOptions{
+		ClientOptions: policy.ClientOptions{Transport: server.Client()},
+		// The challenge names the public cloud, not the test server
+		DisableChallengeResourceVerification: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Key Vault store: %v", err)
+	}
+	return store, vault
+}
+
+func TestAzureKeyVaultStore(t *testing.T) {
+	store, vault := newTestAzureKeyVaultStore(t)
+	testTokenStore(t, store)
+
+	if len(vault.deleted) != 0 {
+		t.Errorf("Delete left %d secrets unpurged", len(vault.deleted))
+	}
+}
+
+func TestAzureKeyVaultStoreSkipsOtherSecrets(t *testing.T) {
+	store, vault := newTestAzureKeyVaultStore(t)
+	if err := store.Put(&StoredOrg{Alias: "Prod.EU", ClientSecret: "app-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(&StoredOrg{Alias: "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	name, _ := azureSecretName("dev")
+	vault.disable[name] = true
+	vault.secrets["database-password"] = "hunter2"
+
+	list, err := store.List()
+	if err != nil || len(list) != 1 || list[0].Alias != "Prod.EU" {
+		t.Fatalf("List = %v, %v; want only Prod.EU", list, err)
+	}
+	if list[0].ClientSecret != "app-secret" {
+		t.Errorf("ClientSecret = %q, want it kept in Key Vault", list[0].ClientSecret)
+	}
+}
+
+func TestAzureKeyVaultStoreDeletedNotPurged(t *testing.T) {
+	store, vault := newTestAzureKeyVaultStore(t)
+	name, _ := azureSecretName("prod")
+	vault.deleted[name] = true
+
+	err := store.Put(&StoredOrg{Alias: "prod"})
+	if err == nil || !strings.Contains(err.Error(), "deleted but not purged") {
+		t.Errorf("Put over a deleted secret error = %v", err)
+	}
+}
+
+func TestAzureSecretName(t *testing.T) {
+	for _, alias := range []string{"prod", "Prod.EU", "my org/with spaces", "ünïcode"} {
+		name, err := azureSecretName(alias)
+		if err != nil {
+			t.Fatalf("azureSecretName(%q) failed: %v", alias, err)
+		}
+		for _, c := range name {
+			if !(c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z') {
+				t.Errorf("azureSecretName(%q) = %q, not a valid secret name", alias, name)
+				break
+			}
+		}
+		if got, ok := azureSecretAlias(name); !ok || got != alias {
+			t.Errorf("azureSecretAlias(%q) = %q, %v; want %q", name, got, ok, alias)
+		}
+	}
+	if _, err := azureSecretName(strings.Repeat("a", 100)); err == nil {
+		t.Error("azureSecretName accepted an alias too long for Key Vault")
+	}
+	if _, ok := azureSecretAlias("database-password"); ok {
+		t.Error("azureSecretAlias accepted a secret the store did not write")
+	}
+}
+
+func TestOpenAzureKeyVaultStoreNoURL(t *testing.T) {
+	t.Setenv(azureKeyVaultURLEnv, "")
+	if _, err := openAzureKeyVaultStore(""); err == nil || !strings.Contains(err.Error(), "--azure-vault-url") {
+		t.Errorf("openAzureKeyVaultStore without a URL error = %v", err)
+	}
+}
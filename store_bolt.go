@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltFileName    = "tokens.bolt"
+	boltOpenTimeout = 5 * time.Second
+)
+
+var (
+	boltOrgsBucket = []byte("orgs")
+	boltMetaBucket = []byte("meta")
+	boltVersionKey = []byte("version")
+)
+
+// boltMigrations upgrade the database one version at a time; entry i
+// migrates version i to i+1. Append a migration here whenever the layout
+// changes.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	// v0 -> v1: the orgs bucket keyed by alias
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltOrgsBucket)
+		return err
+	},
+}
+
+// boltStore keeps orgs in an embedded bbolt database. It gives durable,
+// file-locked writes without needing cgo or SQLite.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func newBoltStore(path string) (*boltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %v", err)
+	}
+
+	// bbolt takes an exclusive file lock, so a second process waits for the
+	// timeout rather than corrupting the database
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening bolt store: %v", err)
+	}
+	if err := migrateBoltStore(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+// migrateBoltStore brings the database layout up to date in one update
+// transaction, snapshotting an existing database before touching it
+func migrateBoltStore(db *bolt.DB, path string) error {
+	latest := len(boltMigrations)
+
+	version := 0
+	hasData := false
+	if err := db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(boltMetaBucket); meta != nil {
+			if v := meta.Get(boltVersionKey); v != nil {
+				if _, err := fmt.Sscanf(string(v), "%d", &version); err != nil {
+					return fmt.Errorf("invalid bolt store version %q", v)
+				}
+			}
+		}
+		hasData = tx.Bucket(boltOrgsBucket) != nil
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error reading bolt store version: %v", err)
+	}
+	if err := checkStoreVersion(path, version, latest); err != nil {
+		return err
+	}
+	if version == latest {
+		return nil
+	}
+
+	// Stores created before versioning was introduced have no meta bucket but
+	// already hold data, so back up whenever the orgs bucket exists
+	backup := ""
+	if hasData {
+		backup = storeBackupPath(path, version)
+		if err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(backup, 0600)
+		}); err != nil {
+			return fmt.Errorf("error backing up bolt store: %v", err)
+		}
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for v := version; v < latest; v++ {
+			if err := boltMigrations[v](tx); err != nil {
+				return fmt.Errorf("error migrating bolt store to v%d: %v", v+1, err)
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		return meta.Put(boltVersionKey, []byte(fmt.Sprintf("%d", latest)))
+	}); err != nil {
+		return err
+	}
+
+	if backup != "" {
+		logStoreMigration(path, version, latest, backup)
+	}
+	return nil
+}
+
+func (s *boltStore) Get(alias string) (*StoredOrg, error) {
+	var org *StoredOrg
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltOrgsBucket).Get([]byte(alias))
+		if data == nil {
+			return errOrgNotFound
+		}
+		var err error
+		org, err = decodeBoltOrg(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (s *boltStore) Put(org *StoredOrg) error {
+	data, err := json.Marshal(org)
+	if err != nil {
+		return fmt.Errorf("error encoding org: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltOrgsBucket).Put([]byte(org.Alias), data); err != nil {
+			return fmt.Errorf("error writing org to bolt store: %v", err)
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Delete(alias string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltOrgsBucket)
+		if bucket.Get([]byte(alias)) == nil {
+			return errOrgNotFound
+		}
+		if err := bucket.Delete([]byte(alias)); err != nil {
+			return fmt.Errorf("error deleting org from bolt store: %v", err)
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) List() ([]*StoredOrg, error) {
+	var orgs []*StoredOrg
+	// bbolt iterates keys in byte order, so the result is sorted by alias
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltOrgsBucket).ForEach(func(_, data []byte) error {
+			org, err := decodeBoltOrg(data)
+			if err != nil {
+				return err
+			}
+			orgs = append(orgs, org)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func decodeBoltOrg(data []byte) (*StoredOrg, error) {
+	var org StoredOrg
+	if err := json.Unmarshal(data, &org); err != nil {
+		return nil, fmt.Errorf("error decoding org from bolt store: %v", err)
+	}
+	return &org, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	// keychainService names the items holding one org each, keyed by alias
+	keychainService = "sfdc-auth"
+	// keychainIndexService holds the list of aliases, since the OS secret
+	// stores cannot enumerate items portably
+	keychainIndexService = "sfdc-auth-index"
+	keychainIndexUser    = "aliases"
+	keychainVersion      = 1
+)
+
+// keychainStore keeps each org in the OS secret store: the macOS Keychain,
+// Windows Credential Manager or the Linux Secret Service. One item per
+// alias keeps every item well under the Credential Manager size limit.
+type keychainStore struct {
+	mu sync.Mutex
+}
+
+type keychainIndex struct {
+	Version int      `json:"version"`
+	Aliases []string `json:"aliases"`
+}
+
+func newKeychainStore() (*keychainStore, error) {
+	s := &keychainStore{}
+	// Reading the index up front surfaces a locked or missing secret service
+	// before a login has been completed
+	if _, err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *keychainStore) loadIndex() (*keychainIndex, error) {
+	index := &keychainIndex{Version: keychainVersion}
+	raw, err := keyring.Get(keychainIndexService, keychainIndexUser)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading keychain: %v", err)
+	}
+	if err := json.Unmarshal([]byte(raw), index); err != nil {
+		return nil, fmt.Errorf("error decoding keychain index: %v", err)
+	}
+	if err := checkStoreVersion("in the keychain", index.Version, keychainVersion); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (s *keychainStore) saveIndex(index *keychainIndex) error {
+	index.Version = keychainVersion
+	sort.Strings(index.Aliases)
+	raw, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("error encoding keychain index: %v", err)
+	}
+	if err := keyring.Set(keychainIndexService, keychainIndexUser, string(raw)); err != nil {
+		return fmt.Errorf("error writing keychain: %v", err)
+	}
+	return nil
+}
+
+func (s *keychainStore) Get(alias string) (*StoredOrg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(alias)
+}
+
+func (s *keychainStore) get(alias string) (*StoredOrg, error) {
+	raw, err := keyring.Get(keychainService, alias)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, errOrgNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading keychain: %v", err)
+	}
+	var org StoredOrg
+	if err := json.Unmarshal([]byte(raw), &org); err != nil {
+		return nil, fmt.Errorf("error decoding org %q from keychain: %v", alias, err)
+	}
+	return &org, nil
+}
+
+func (s *keychainStore) Put(org *StoredOrg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := json.Marshal(org)
+	if err != nil {
+		return fmt.Errorf("error encoding org: %v", err)
+	}
+	if err := keyring.Set(keychainService, org.Alias, string(raw)); err != nil {
+		return fmt.Errorf("error writing keychain: %v", err)
+	}
+
+	index, err := s.loadIndex()
+	if err != nil {
+		return err
+	}
+	if containsString(index.Aliases, org.Alias) {
+		return nil
+	}
+	index.Aliases = append(index.Aliases, org.Alias)
+	return s.saveIndex(index)
+}
+
+func (s *keychainStore) Delete(alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := keyring.Delete(keychainService, alias)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return errOrgNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting from keychain: %v", err)
+	}
+
+	index, err := s.loadIndex()
+	if err != nil {
+		return err
+	}
+	kept := index.Aliases[:0]
+	for _, a := range index.Aliases {
+		if a != alias {
+			kept = append(kept, a)
+		}
+	}
+	index.Aliases = kept
+	return s.saveIndex(index)
+}
+
+func (s *keychainStore) List() ([]*StoredOrg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	orgs := make([]*StoredOrg, 0, len(index.Aliases))
+	for _, alias := range index.Aliases {
+		org, err := s.get(alias)
+		// An item removed outside this tool only drops out of the list
+		if errors.Is(err, errOrgNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Alias < orgs[j].Alias })
+	return orgs, nil
+}
+
+func (s *keychainStore) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// checkStoreVersion rejects stores written by a newer release, whose format
+// this binary cannot safely read or rewrite
+func checkStoreVersion(path string, version, latest int) error {
+	if version > latest {
+		return fmt.Errorf("token store %s has format version %d but this release only supports up to %d; please upgrade sfdc-auth",
+			path, version, latest)
+	}
+	return nil
+}
+
+// storeBackupPath returns where a store is copied before it is migrated away
+// from the given format version
+func storeBackupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// backupStoreFile copies a store file aside before migrating it
+func backupStoreFile(path string, version int) (string, error) {
+	backup := storeBackupPath(path, version)
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening token store for backup: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("error creating token store backup: %v", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("error writing token store backup: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("error writing token store backup: %v", err)
+	}
+	return backup, nil
+}
+
+func logStoreMigration(path string, from, to int, backup string) {
+	log.Printf("Migrated token store %s from format v%d to v%d (previous version saved to %s)", path, from, to, backup)
+}
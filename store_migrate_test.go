@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestFileStoreMigratesUnversioned(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, storeFileName)
+	legacy := `{"orgs": {"prod": {"alias": "prod", "refresh_token": "refresh"}}}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openTokenStore(storeTypeFile, dir)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	org, err := store.Get("prod")
+	if err != nil {
+		t.Fatalf("Expected legacy org to survive migration: %v", err)
+	}
+	if org.RefreshToken != "refresh" {
+		t.Errorf("Expected refresh token to be preserved, got %s", org.RefreshToken)
+	}
+
+	backup, err := os.ReadFile(storeBackupPath(path, 0))
+	if err != nil {
+		t.Fatalf("Expected backup of the v0 store: %v", err)
+	}
+	if string(backup) != legacy {
+		t.Error("Backup should contain the original store contents")
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data fileStoreData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != fileStoreVersion {
+		t.Errorf("Expected migrated store version %d, got %d", fileStoreVersion, data.Version)
+	}
+}
+
+func TestFileStoreRejectsNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, storeFileName), []byte(`{"version": 99, "orgs": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openTokenStore(storeTypeFile, dir)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	if _, err := store.List(); err == nil {
+		t.Error("Expected error reading a store from a newer release")
+	}
+}
+
+func TestSQLiteStoreMigratesUnversioned(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, sqliteFileName)
+
+	// Simulate a database created before schema versioning existed
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(sqliteMigrations[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO orgs (alias, updated_at, data) VALUES ('prod', CURRENT_TIMESTAMP, '{"alias":"prod"}')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := openTokenStore(storeTypeSQLite, dir)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Get("prod"); err != nil {
+		t.Errorf("Expected legacy org to survive migration: %v", err)
+	}
+	if _, err := os.Stat(storeBackupPath(path, 0)); err != nil {
+		t.Errorf("Expected backup of the v0 database: %v", err)
+	}
+
+	var version int
+	if err := store.(*sqliteStore).db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(sqliteMigrations) {
+		t.Errorf("Expected schema version %d, got %d", len(sqliteMigrations), version)
+	}
+}
+
+func TestSQLiteStoreFreshHasNoBackup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openTokenStore(storeTypeSQLite, dir)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	store.Close()
+
+	if _, err := os.Stat(storeBackupPath(filepath.Join(dir, sqliteFileName), 0)); !os.IsNotExist(err) {
+		t.Error("A freshly created database should not be backed up")
+	}
+}
+
+func TestBoltStoreMigratesUnversioned(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, boltFileName)
+
+	// Simulate a database created before schema versioning existed
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(boltOrgsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("prod"), []byte(`{"alias":"prod"}`))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := openTokenStore(storeTypeBolt, dir)
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Get("prod"); err != nil {
+		t.Errorf("Expected legacy org to survive migration: %v", err)
+	}
+	if _, err := os.Stat(storeBackupPath(path, 0)); err != nil {
+		t.Errorf("Expected backup of the v0 database: %v", err)
+	}
+}
+
+func TestCheckStoreVersion(t *testing.T) {
+	if err := checkStoreVersion("store", 1, 1); err != nil {
+		t.Errorf("Current version should be accepted: %v", err)
+	}
+	if err := checkStoreVersion("store", 0, 1); err != nil {
+		t.Errorf("Older version should be accepted for migration: %v", err)
+	}
+	if err := checkStoreVersion("store", 2, 1); err == nil {
+		t.Error("Newer version should be rejected")
+	}
+}
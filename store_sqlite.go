@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteFileName = "tokens.db"
+
+// sqliteMigrations upgrade the schema one version at a time; entry i migrates
+// PRAGMA user_version i to i+1. Append a migration here whenever the schema
+// changes.
+var sqliteMigrations = []string{
+	// v0 -> v1: the orgs table. The indexed columns are duplicated out of the
+	// JSON record so lookups by alias or org ID never decode every row.
+	`
+CREATE TABLE IF NOT EXISTS orgs (
+	alias        TEXT PRIMARY KEY,
+	org_id       TEXT NOT NULL DEFAULT '',
+	user_id      TEXT NOT NULL DEFAULT '',
+	username     TEXT NOT NULL DEFAULT '',
+	instance_url TEXT NOT NULL DEFAULT '',
+	updated_at   TIMESTAMP NOT NULL,
+	data         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_orgs_org_id ON orgs (org_id);
+CREATE INDEX IF NOT EXISTS idx_orgs_username ON orgs (username);
+`,
+}
+
+// sqliteStore keeps orgs in a SQLite database, which copes with many orgs and
+// concurrent writers far better than rewriting a single JSON file
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %v", err)
+	}
+	if err := restrictSQLiteFiles(path); err != nil {
+		return nil, err
+	}
+
+	// WAL mode lets readers proceed while another process writes, and the busy
+	// timeout makes concurrent writers wait instead of failing immediately
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite store: %v", err)
+	}
+	if err := migrateSQLiteStore(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// restrictSQLiteFiles makes the database 0600 before SQLite opens it, as
+// SQLite gives the -wal and -shm files it creates the database's mode.
+// Sidecar files left by releases that created them with the umask are
+// tightened too.
+func restrictSQLiteFiles(path string) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating sqlite store: %v", err)
+	}
+	f.Close()
+	for _, name := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Chmod(name, 0600); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error setting sqlite store permissions: %v", err)
+		}
+	}
+	return nil
+}
+
+// migrateSQLiteStore brings the schema up to date inside a single
+// transaction, snapshotting an existing database before touching it
+func migrateSQLiteStore(db *sql.DB, path string) error {
+	latest := len(sqliteMigrations)
+
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("error reading sqlite schema version: %v", err)
+	}
+	if err := checkStoreVersion(path, version, latest); err != nil {
+		return err
+	}
+	if version == latest {
+		return nil
+	}
+
+	// Stores created before versioning was introduced report version 0 but
+	// already hold data, so back up whenever the orgs table exists
+	var tables int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'orgs'`).Scan(&tables); err != nil {
+		return fmt.Errorf("error inspecting sqlite schema: %v", err)
+	}
+	backup := ""
+	if tables > 0 {
+		backup = storeBackupPath(path, version)
+		os.Remove(backup)
+		if _, err := db.Exec(`VACUUM INTO ?`, backup); err != nil {
+			return fmt.Errorf("error backing up sqlite store: %v", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting sqlite transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for v := version; v < latest; v++ {
+		if _, err := tx.Exec(sqliteMigrations[v]); err != nil {
+			return fmt.Errorf("error migrating sqlite store to v%d: %v", v+1, err)
+		}
+	}
+	// PRAGMA does not accept bound parameters
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, latest)); err != nil {
+		return fmt.Errorf("error updating sqlite schema version: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing sqlite migration: %v", err)
+	}
+
+	if backup != "" {
+		logStoreMigration(path, version, latest, backup)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Get(alias string) (*StoredOrg, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM orgs WHERE alias = ?`, alias).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errOrgNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading org from sqlite store: %v", err)
+	}
+	return decodeSQLiteOrg(data)
+}
+
+func (s *sqliteStore) Put(org *StoredOrg) error {
+	data, err := json.Marshal(org)
+	if err != nil {
+		return fmt.Errorf("error encoding org: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting sqlite transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(`
+		INSERT INTO orgs (alias, org_id, user_id, username, instance_url, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (alias) DO UPDATE SET
+			org_id = excluded.org_id,
+			user_id = excluded.user_id,
+			username = excluded.username,
+			instance_url = excluded.instance_url,
+			updated_at = excluded.updated_at,
+			data = excluded.data`,
+		org.Alias, org.OrgID, org.UserID, org.Username, org.InstanceURL, org.UpdatedAt, string(data))
+	if err != nil {
+		return fmt.Errorf("error writing org to sqlite store: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Delete(alias string) error {
+	res, err := s.db.Exec(`DELETE FROM orgs WHERE alias = ?`, alias)
+	if err != nil {
+		return fmt.Errorf("error deleting org from sqlite store: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errOrgNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) List() ([]*StoredOrg, error) {
+	rows, err := s.db.Query(`SELECT data FROM orgs ORDER BY alias`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing orgs from sqlite store: %v", err)
+	}
+	defer rows.Close()
+
+	var orgs []*StoredOrg
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading org from sqlite store: %v", err)
+		}
+		org, err := decodeSQLiteOrg(data)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func decodeSQLiteOrg(data string) (*StoredOrg, error) {
+	var org StoredOrg
+	if err := json.Unmarshal([]byte(data), &org); err != nil {
+		return nil, fmt.Errorf("error decoding org from sqlite store: %v", err)
+	}
+	return &org, nil
+}
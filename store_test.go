@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func testTokenStore(t *testing.T, store TokenStore) {
+	t.Helper()
+	defer store.Close()
+
+	if _, err := store.Get("missing"); !errors.Is(err, errOrgNotFound) {
+		t.Errorf("Expected errOrgNotFound for missing alias, got %v", err)
+	}
+
+	orgs := []*StoredOrg{
+		{Alias: "prod", OrgID: "00D000000000001", AccessToken: "access1", RefreshToken: "refresh1", UpdatedAt: time.Now().UTC()},
+		{Alias: "dev", OrgID: "00D000000000002", AccessToken: "access2", RefreshToken: "refresh2", UpdatedAt: time.Now().UTC()},
+	}
+	for _, org := range orgs {
+		if err := store.Put(org); err != nil {
+			t.Fatalf("Put(%s) failed: %v", org.Alias, err)
+		}
+	}
+
+	got, err := store.Get("prod")
+	if err != nil {
+		t.Fatalf("Get(prod) failed: %v", err)
+	}
+	if got.OrgID != "00D000000000001" || got.RefreshToken != "refresh1" {
+		t.Errorf("Get(prod) returned unexpected org: %+v", got)
+	}
+
+	// Updating an existing alias should replace the record
+	orgs[0].AccessToken = "access1-new"
+	if err := store.Put(orgs[0]); err != nil {
+		t.Fatalf("Put(prod) update failed: %v", err)
+	}
+	got, err = store.Get("prod")
+	if err != nil {
+		t.Fatalf("Get(prod) failed: %v", err)
+	}
+	if got.AccessToken != "access1-new" {
+		t.Errorf("Expected updated access token, got %s", got.AccessToken)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 2 || list[0].Alias != "dev" || list[1].Alias != "prod" {
+		t.Errorf("Expected orgs [dev prod] in alias order, got %d orgs", len(list))
+	}
+
+	if err := store.Delete("dev"); err != nil {
+		t.Fatalf("Delete(dev) failed: %v", err)
+	}
+	if err := store.Delete("dev"); !errors.Is(err, errOrgNotFound) {
+		t.Errorf("Expected errOrgNotFound deleting twice, got %v", err)
+	}
+	if _, err := store.Get("dev"); !errors.Is(err, errOrgNotFound) {
+		t.Errorf("Expected deleted org to be gone, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openTokenStore(storeTypeFile, dir)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	testTokenStore(t, store)
+
+	info, err := os.Stat(filepath.Join(dir, storeFileName))
+	if err != nil {
+		t.Fatalf("Store file should exist: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected store file permissions 0600, got %o", perm)
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openTokenStore(storeTypeSQLite, dir)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	testTokenStore(t, store)
+}
+
+func TestSQLiteStorePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, sqliteFileName)
+	// A -wal file left world-readable by an older release is tightened
+	if err := os.WriteFile(path+"-wal", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := openTokenStore(storeTypeSQLite, dir)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	defer store.Close()
+	if err := store.Put(&StoredOrg{Alias: "prod", UpdatedAt: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{path, path + "-wal", path + "-shm"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", filepath.Base(name), info.Mode().Perm())
+		}
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openTokenStore(storeTypeBolt, dir)
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	testTokenStore(t, store)
+
+	// The store must be closed and reopened cleanly for data to persist
+	store, err = openTokenStore(storeTypeBolt, dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen bolt store: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Get("prod"); err != nil {
+		t.Errorf("Expected prod to persist across reopen, got %v", err)
+	}
+}
+
+func TestKeychainStore(t *testing.T) {
+	keyring.MockInit()
+	store, err := openTokenStore(storeTypeKeychain, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open keychain store: %v", err)
+	}
+	testTokenStore(t, store)
+
+	// An item removed outside the tool drops out of the list
+	if err := keyring.Delete(keychainService, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := store.List()
+	if err != nil || len(list) != 0 {
+		t.Errorf("Expected an empty list, got %d orgs (%v)", len(list), err)
+	}
+}
+
+func TestSQLiteStoreConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	first, err := openTokenStore(storeTypeSQLite, dir)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	defer first.Close()
+	second, err := openTokenStore(storeTypeSQLite, dir)
+	if err != nil {
+		t.Fatalf("Failed to open second sqlite store: %v", err)
+	}
+	defer second.Close()
+
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		store := first
+		if i%2 == 1 {
+			store = second
+		}
+		go func(store TokenStore, alias string) {
+			errs <- store.Put(&StoredOrg{Alias: alias, UpdatedAt: time.Now().UTC()})
+		}(store, string(rune('a'+i)))
+	}
+	for i := 0; i < 20; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Concurrent Put failed: %v", err)
+		}
+	}
+
+	list, err := first.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 20 {
+		t.Errorf("Expected 20 orgs after concurrent writes, got %d", len(list))
+	}
+}
+
+func TestOpenTokenStoreUnknown(t *testing.T) {
+	if _, err := openTokenStore("bogus", t.TempDir()); err == nil {
+		t.Error("Expected error for unknown store type")
+	}
+}
+
+func TestNewStoredOrg(t *testing.T) {
+	clientID = "test_client_id"
+	resp := &SalesforceOAuthResponse{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		InstanceURL:  "https://test.my.salesforce.com",
+		ID:           "https://login.salesforce.com/id/00D000000000001AAA/005000000000001AAA",
+		IssuedAt:     "1700000000000",
+	}
+
+	org := newStoredOrg("", "login.salesforce.com", resp)
+	if org.Alias != "00D000000000001AAA" {
+		t.Errorf("Expected alias to default to org ID, got %s", org.Alias)
+	}
+	if org.UserID != "005000000000001AAA" {
+		t.Errorf("Expected user ID 005000000000001AAA, got %s", org.UserID)
+	}
+	if org.ClientID != "test_client_id" {
+		t.Errorf("Expected client ID to be recorded, got %s", org.ClientID)
+	}
+	if !org.IssuedAt.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("Unexpected issued at: %v", org.IssuedAt)
+	}
+
+	org = newStoredOrg("prod", "login.salesforce.com", resp)
+	if org.Alias != "prod" {
+		t.Errorf("Expected explicit alias prod, got %s", org.Alias)
+	}
+}
+
+func TestParseIdentityURL(t *testing.T) {
+	tests := []struct {
+		id     string
+		orgID  string
+		userID string
+	}{
+		{"https://login.salesforce.com/id/00Dxx/005xx", "00Dxx", "005xx"},
+		{"https://test.salesforce.com/id/00Dyy/005yy/", "00Dyy", "005yy"},
+		{"", "", ""},
+		{"https://login.salesforce.com/services/oauth2/token", "", ""},
+	}
+
+	for _, tt := range tests {
+		orgID, userID := parseIdentityURL(tt.id)
+		if orgID != tt.orgID || userID != tt.userID {
+			t.Errorf("parseIdentityURL(%q) = (%q, %q), want (%q, %q)", tt.id, orgID, userID, tt.orgID, tt.userID)
+		}
+	}
+}
+
+func TestPlaceOrgKeysByUser(t *testing.T) {
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	admin := &StoredOrg{Alias: "00Dorg", OrgID: "00Dorg", UserID: "005admin", Username: "admin@acme.com", RefreshToken: "admin1"}
+	if previous, err := placeOrg(store, admin, false); err != nil || previous != nil {
+		t.Fatalf("Expected a fresh entry, got %v (%v)", previous, err)
+	}
+	if err := store.Put(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second user of the same org must not replace the first
+	integration := &StoredOrg{Alias: "00Dorg", OrgID: "00Dorg", UserID: "005int", Username: "int@acme.com", RefreshToken: "int1"}
+	if previous, err := placeOrg(store, integration, false); err != nil || previous != nil {
+		t.Fatalf("Expected a fresh entry, got %v (%v)", previous, err)
+	}
+	if integration.Alias != "int@acme.com" {
+		t.Errorf("Expected the username as alias, got %q", integration.Alias)
+	}
+	if err := store.Put(integration); err != nil {
+		t.Fatal(err)
+	}
+
+	// Logging in again finds the user's own entry
+	again := &StoredOrg{Alias: "00Dorg", OrgID: "00Dorg", UserID: "005int", Username: "int@acme.com", RefreshToken: "int2"}
+	previous, err := placeOrg(store, again, false)
+	if err != nil || previous == nil || previous.RefreshToken != "int1" || again.Alias != "int@acme.com" {
+		t.Errorf("Expected the integration user's entry, got %+v (%v)", previous, err)
+	}
+
+	// An explicit alias is used as given
+	named := &StoredOrg{Alias: "uat", OrgID: "00Dorg", UserID: "005int"}
+	if previous, err := placeOrg(store, named, true); err != nil || previous != nil || named.Alias != "uat" {
+		t.Errorf("Expected the explicit alias, got %q (%v, %v)", named.Alias, previous, err)
+	}
+}
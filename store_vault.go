@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	vaultVersion = 1
+
+	defaultVaultAddr   = "https://127.0.0.1:8200"
+	vaultAuthToken     = "token"
+	vaultAuthAppRole   = "approle"
+	vaultAppRoleMount  = "approle"
+	vaultTokenFileName = ".vault-token"
+)
+
+var (
+	// --vault-path, the KV v2 path orgs are kept under, e.g. secret/data/sfdc/prod
+	flagVaultPath string
+	// --vault-auth, how to log in to Vault
+	flagVaultAuth string
+)
+
+// errVaultNotFound is returned for a 404 from Vault
+var errVaultNotFound = errors.New("not found in vault")
+
+// vaultStore keeps each org as a secret in a HashiCorp Vault KV v2 engine,
+// at <path>/<alias>. The Vault address, namespace and credentials come from
+// the usual VAULT_* environment variables.
+type vaultStore struct {
+	client    *http.Client
+	addr      string
+	namespace string
+	token     string
+	mount     string
+	prefix    string
+	// revoke is set when the token came from an AppRole login, and is
+	// revoked again on Close
+	revoke bool
+}
+
+func newVaultStore(path string) (*vaultStore, error) {
+	mount, prefix, err := parseVaultPath(path)
+	if err != nil {
+		return nil, err
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = defaultVaultAddr
+	}
+	s := &vaultStore{
+		client:    http.DefaultClient,
+		addr:      strings.TrimSuffix(addr, "/"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		mount:     mount,
+		prefix:    prefix,
+	}
+	if err := s.login(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseVaultPath splits a KV v2 API path such as secret/data/sfdc/prod into
+// its mount (secret) and the prefix orgs are kept under (sfdc/prod)
+func parseVaultPath(path string) (string, string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", "", fmt.Errorf("--store vault needs --vault-path, e.g. secret/data/sfdc/prod")
+	}
+	if mount, ok := strings.CutSuffix(path, "/data"); ok && mount != "" {
+		return mount, "", nil
+	}
+	mount, prefix, ok := strings.Cut(path, "/data/")
+	if !ok || mount == "" {
+		return "", "", fmt.Errorf("vault path %q is not a KV v2 path such as secret/data/sfdc/prod", path)
+	}
+	return mount, prefix, nil
+}
+
+// login picks up a Vault token: VAULT_TOKEN or ~/.vault-token with token
+// auth, or a fresh one from VAULT_ROLE_ID and VAULT_SECRET_ID with approle
+// auth. Without --vault-auth, a token is used if there is one.
+func (s *vaultStore) login() error {
+	method := flagVaultAuth
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if raw, err := os.ReadFile(filepath.Join(home, vaultTokenFileName)); err == nil {
+				token = strings.TrimSpace(string(raw))
+			}
+		}
+	}
+	if method == "" {
+		method = vaultAuthToken
+		if token == "" && os.Getenv("VAULT_ROLE_ID") != "" {
+			method = vaultAuthAppRole
+		}
+	}
+
+	switch method {
+	case vaultAuthToken:
+		if token == "" {
+			return fmt.Errorf("no vault token (set VAULT_TOKEN, run \"vault login\", or use --vault-auth approle)")
+		}
+		s.token = token
+		return nil
+	case vaultAuthAppRole:
+		roleID, secretID := os.Getenv("VAULT_ROLE_ID"), os.Getenv("VAULT_SECRET_ID")
+		if roleID == "" || secretID == "" {
+			return fmt.Errorf("--vault-auth approle needs VAULT_ROLE_ID and VAULT_SECRET_ID")
+		}
+		var resp struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		body := map[string]string{"role_id": roleID, "secret_id": secretID}
+		if err := s.do(http.MethodPost, "auth/"+vaultAppRoleMount+"/login", body, &resp); err != nil {
+			return fmt.Errorf("error logging in to vault with approle: %v", err)
+		}
+		if resp.Auth.ClientToken == "" {
+			return fmt.Errorf("error logging in to vault with approle: no token returned")
+		}
+		s.token, s.revoke = resp.Auth.ClientToken, true
+		verbosef("Logged in to vault at %s with approle", s.addr)
+		return nil
+	default:
+		return fmt.Errorf("unknown --vault-auth %q (expected %s or %s)", method, vaultAuthToken, vaultAuthAppRole)
+	}
+}
+
+// secretPath is the API path of an org's secret under the data or metadata
+// tree of the mount
+func (s *vaultStore) secretPath(tree, alias string) string {
+	parts := []string{s.mount, tree}
+	if s.prefix != "" {
+		parts = append(parts, s.prefix)
+	}
+	if alias != "" {
+		parts = append(parts, url.PathEscape(alias))
+	}
+	return strings.Join(parts, "/")
+}
+
+// do sends a request to the Vault API and decodes a JSON answer into out
+func (s *vaultStore) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding vault request: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, s.addr+"/v1/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("error creating vault request: %v", err)
+	}
+	req.Header.Set("X-Vault-Request", "true")
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error contacting vault: %v", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading vault response: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errVaultNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(raw, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(vaultErr.Errors, "; "))
+		}
+		return fmt.Errorf("vault returned %s", resp.Status)
+	}
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("error decoding vault response: %v", err)
+	}
+	return nil
+}
+
+func (s *vaultStore) Get(alias string) (*StoredOrg, error) {
+	var resp struct {
+		Data struct {
+			Data *secretOrg `json:"data"`
+		} `json:"data"`
+	}
+	err := s.do(http.MethodGet, s.secretPath("data", alias), nil, &resp)
+	// A deleted latest version reads as 404 too
+	if errors.Is(err, errVaultNotFound) || (err == nil && resp.Data.Data == nil) {
+		return nil, errOrgNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading org %q from vault: %v", alias, err)
+	}
+	if err := checkStoreVersion("in vault", resp.Data.Data.Version, vaultVersion); err != nil {
+		return nil, err
+	}
+	org := resp.Data.Data.StoredOrg
+	return &org, nil
+}
+
+func (s *vaultStore) Put(org *StoredOrg) error {
+	body := map[string]interface{}{"data": secretOrg{Version: vaultVersion, StoredOrg: *org}}
+	if err := s.do(http.MethodPost, s.secretPath("data", org.Alias), body, nil); err != nil {
+		return fmt.Errorf("error writing org %q to vault: %v", org.Alias, err)
+	}
+	return nil
+}
+
+// Delete removes every version of the org's secret, so an old refresh token
+// cannot be read back from the secret's history
+func (s *vaultStore) Delete(alias string) error {
+	err := s.do(http.MethodGet, s.secretPath("metadata", alias), nil, nil)
+	if errors.Is(err, errVaultNotFound) {
+		return errOrgNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error reading org %q from vault: %v", alias, err)
+	}
+	if err := s.do(http.MethodDelete, s.secretPath("metadata", alias), nil, nil); err != nil {
+		return fmt.Errorf("error deleting org %q from vault: %v", alias, err)
+	}
+	return nil
+}
+
+func (s *vaultStore) List() ([]*StoredOrg, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := s.do("LIST", s.secretPath("metadata", ""), nil, &resp)
+	if errors.Is(err, errVaultNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing orgs in vault: %v", err)
+	}
+
+	orgs := make([]*StoredOrg, 0, len(resp.Data.Keys))
+	for _, key := range resp.Data.Keys {
+		// Keys ending in / are folders below the path, not orgs
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		alias, err := url.PathUnescape(key)
+		if err != nil {
+			continue
+		}
+		org, err := s.Get(alias)
+		if errors.Is(err, errOrgNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Alias < orgs[j].Alias })
+	return orgs, nil
+}
+
+// Close revokes a token obtained with approle, which would otherwise stay
+// valid until its TTL runs out
+func (s *vaultStore) Close() error {
+	if !s.revoke {
+		return nil
+	}
+	s.revoke = false
+	if err := s.do(http.MethodPost, "auth/token/revoke-self", nil, nil); err != nil {
+		return fmt.Errorf("error revoking vault token: %v", err)
+	}
+	return nil
+}
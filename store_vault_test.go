@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault serves the parts of the KV v2 and AppRole APIs the vault store
+// uses, for secrets under secret/
+type fakeVault struct {
+	mu      sync.Mutex
+	token   string
+	secrets map[string]json.RawMessage
+	revoked bool
+}
+
+func newFakeVault(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	v := &fakeVault{token: token, secrets: map[string]json.RawMessage{}}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "")
+	t.Setenv("VAULT_SECRET_ID", "")
+	t.Setenv("HOME", t.TempDir())
+	return server
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	if path == "auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "s3cret" {
+			http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]string{"client_token": v.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != v.token || v.revoked {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	if path == "auth/token/revoke-self" {
+		v.revoked = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if key, ok := strings.CutPrefix(path, "secret/data/"); ok {
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := v.secrets[key]
+			if !ok {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case http.MethodPost:
+			var body struct {
+				Data json.RawMessage `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			v.secrets[key] = body.Data
+			w.Write([]byte(`{"data":{"version":1}}`))
+		}
+		return
+	}
+	if key, ok := strings.CutPrefix(path, "secret/metadata/"); ok {
+		switch r.Method {
+		case "LIST":
+			var keys []string
+			for k := range v.secrets {
+				if rest, ok := strings.CutPrefix(k, key+"/"); ok {
+					if dir, _, nested := strings.Cut(rest, "/"); nested {
+						rest = dir + "/"
+					}
+					keys = append(keys, rest)
+				}
+			}
+			if len(keys) == 0 {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case http.MethodGet, http.MethodDelete:
+			if _, ok := v.secrets[key]; !ok {
+				if r.Method == http.MethodGet {
+					http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+					return
+				}
+			}
+			if r.Method == http.MethodDelete {
+				delete(v.secrets, key)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Write([]byte(`{"data":{}}`))
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func withVaultFlags(t *testing.T, path, auth string) {
+	t.Helper()
+	oldPath, oldAuth := flagVaultPath, flagVaultAuth
+	flagVaultPath, flagVaultAuth = path, auth
+	t.Cleanup(func() { flagVaultPath, flagVaultAuth = oldPath, oldAuth })
+}
+
+func TestVaultStore(t *testing.T) {
+	newFakeVault(t, "hvs.test-token")
+	t.Setenv("VAULT_TOKEN", "hvs.test-token")
+	withVaultFlags(t, "secret/data/sfdc/prod", "")
+
+	store, err := openTokenStore(storeTypeVault, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open vault store: %v", err)
+	}
+	testTokenStore(t, store)
+}
+
+func TestVaultStoreSkipsFolders(t *testing.T) {
+	newFakeVault(t, "hvs.test-token")
+	t.Setenv("VAULT_TOKEN", "hvs.test-token")
+
+	withVaultFlags(t, "secret/data/sfdc/prod/team", "")
+	nested, err := openTokenStore(storeTypeVault, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nested.Put(&StoredOrg{Alias: "nested"}); err != nil {
+		t.Fatal(err)
+	}
+
+	withVaultFlags(t, "secret/data/sfdc/prod", "")
+	store, err := openTokenStore(storeTypeVault, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(&StoredOrg{Alias: "prod", ClientSecret: "app-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := store.List()
+	if err != nil || len(list) != 1 || list[0].Alias != "prod" {
+		t.Fatalf("List = %v, %v; want only prod", list, err)
+	}
+	if list[0].ClientSecret != "app-secret" {
+		t.Errorf("ClientSecret = %q, want it kept in vault", list[0].ClientSecret)
+	}
+}
+
+func TestVaultStoreAppRole(t *testing.T) {
+	server := newFakeVault(t, "hvs.approle-token")
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "s3cret")
+	withVaultFlags(t, "secret/data/sfdc", "")
+
+	store, err := newVaultStore(flagVaultPath)
+	if err != nil {
+		t.Fatalf("approle login failed: %v", err)
+	}
+	if err := store.Put(&StoredOrg{Alias: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Config.Handler.(*fakeVault).revoked {
+		t.Error("Close did not revoke the approle token")
+	}
+
+	t.Setenv("VAULT_SECRET_ID", "wrong")
+	if _, err := newVaultStore(flagVaultPath); err == nil || !strings.Contains(err.Error(), "invalid role or secret ID") {
+		t.Errorf("approle login with a bad secret ID error = %v", err)
+	}
+}
+
+func TestVaultStoreNoToken(t *testing.T) {
+	newFakeVault(t, "hvs.test-token")
+	if _, err := newVaultStore("secret/data/sfdc"); err == nil {
+		t.Error("newVaultStore without a token succeeded")
+	}
+}
+
+func TestParseVaultPath(t *testing.T) {
+	tests := []struct {
+		path, mount, prefix string
+		ok                  bool
+	}{
+		{"secret/data/sfdc/prod", "secret", "sfdc/prod", true},
+		{"/kv/data/sfdc/", "kv", "sfdc", true},
+		{"secret/data", "secret", "", true},
+		{"secret/sfdc/prod", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		mount, prefix, err := parseVaultPath(tt.path)
+		if (err == nil) != tt.ok || mount != tt.mount || prefix != tt.prefix {
+			t.Errorf("parseVaultPath(%q) = %q, %q, %v", tt.path, mount, prefix, err)
+		}
+	}
+}
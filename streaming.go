@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// replayNew is the replay ID for "only new events"; -2 asks for every
+	// event still retained
+	replayNew = -1
+
+	// bayeuxPollTimeout outlasts Salesforce's 110 second long poll
+	bayeuxPollTimeout = 2 * time.Minute
+)
+
+var (
+	flagStreamingAlias    string
+	flagStreamingReplayID int64
+)
+
+var streamingCmd = &cobra.Command{
+	Use:   "streaming",
+	Short: "Streaming API (CometD) commands",
+}
+
+var streamingSubscribeCmd = &cobra.Command{
+	Use:   "subscribe <channel>",
+	Short: "Subscribe to a Streaming API channel and print its events",
+	Long: `Subscribe to a PushTopic, generic or platform event channel such as
+/topic/MyTopic or /event/Order_Event__e using the Bayeux protocol, and print
+each event as a line of JSON until interrupted.
+
+--replay-id picks where to start: -1 for new events only, -2 for every event
+still retained, or the replay ID of the last event already processed.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runStreamingSubscribe,
+}
+
+func init() {
+	streamingSubscribeCmd.Flags().StringVarP(&flagStreamingAlias, "alias", "a", "", "Alias of the stored org to subscribe with (default: the default org)")
+	streamingSubscribeCmd.Flags().Int64Var(&flagStreamingReplayID, "replay-id", replayNew, "Replay ID to resume after (-1 new events, -2 all retained events)")
+
+	streamingCmd.AddCommand(streamingSubscribeCmd)
+	rootCmd.AddCommand(streamingCmd)
+}
+
+// bayeuxMessage is the part of a Bayeux response message the client reads
+type bayeuxMessage struct {
+	Channel    string          `json:"channel"`
+	ClientID   string          `json:"clientId"`
+	Successful bool            `json:"successful"`
+	Error      string          `json:"error"`
+	Data       json.RawMessage `json:"data"`
+	Advice     *struct {
+		Reconnect string `json:"reconnect"`
+	} `json:"advice"`
+}
+
+// streamEvent is one line of subscribe output
+type streamEvent struct {
+	Channel  string          `json:"channel"`
+	ReplayID int64           `json:"replayId,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// bayeuxClient is a long-polling CometD client for an org's Streaming API
+type bayeuxClient struct {
+	store    TokenStore
+	org      *StoredOrg
+	http     *http.Client
+	clientID string
+}
+
+func newBayeuxClient(store TokenStore, org *StoredOrg) *bayeuxClient {
+	// Salesforce ties a Bayeux session to its cookies
+	jar, _ := cookiejar.New(nil)
+	return &bayeuxClient{store: store, org: org, http: &http.Client{Jar: jar, Timeout: bayeuxPollTimeout}}
+}
+
+func runStreamingSubscribe(cmd *cobra.Command, args []string) {
+	store, org, err := useStoredOrg(flagStreamingAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	ctx := cmd.Context()
+	client := newBayeuxClient(store, org)
+	err = client.subscribe(ctx, args[0], flagStreamingReplayID, func(event *streamEvent) error {
+		line, err := marshalOutput(event, false)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(line)
+		return err
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// subscribe handshakes, subscribes to channel and passes each event to emit
+// until ctx ends or emit fails. After a reconnect it resumes from the last
+// event seen, so none are missed or repeated.
+func (c *bayeuxClient) subscribe(ctx context.Context, channel string, replayID int64, emit func(*streamEvent) error) error {
+	for {
+		if err := c.handshake(ctx); err != nil {
+			return err
+		}
+		if err := c.sendSubscribe(ctx, channel, replayID); err != nil {
+			return err
+		}
+		infof("Subscribed to %s", channel)
+
+		for rehandshake := false; !rehandshake; {
+			msgs, err := c.send(ctx, map[string]interface{}{
+				"channel":        "/meta/connect",
+				"clientId":       c.clientID,
+				"connectionType": "long-polling",
+			})
+			if c.sessionExpired(err) {
+				if err := refreshStoredOrg(c.store, c.org, nil); err != nil {
+					return err
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, m := range msgs {
+				if m.Channel == "/meta/connect" {
+					if !m.Successful {
+						if m.Advice != nil && m.Advice.Reconnect == "none" {
+							return fmt.Errorf("server ended the session: %s", m.Error)
+						}
+						verbosef("Reconnecting after %s", m.Error)
+						rehandshake = true
+					}
+					continue
+				}
+				if strings.HasPrefix(m.Channel, "/meta/") {
+					continue
+				}
+				event := &streamEvent{Channel: m.Channel, ReplayID: eventReplayID(m.Data), Data: m.Data}
+				if event.ReplayID != 0 {
+					replayID = event.ReplayID
+				}
+				if err := emit(event); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (c *bayeuxClient) handshake(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		msgs, err := c.send(ctx, map[string]interface{}{
+			"channel":                  "/meta/handshake",
+			"version":                  "1.0",
+			"supportedConnectionTypes": []string{"long-polling"},
+		})
+		if c.sessionExpired(err) && attempt == 0 {
+			if err := refreshStoredOrg(c.store, c.org, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("handshake failed: %w", err)
+		}
+		if len(msgs) == 0 || !msgs[0].Successful {
+			return fmt.Errorf("handshake failed: %s", firstError(msgs))
+		}
+		c.clientID = msgs[0].ClientID
+		return nil
+	}
+}
+
+func (c *bayeuxClient) sendSubscribe(ctx context.Context, channel string, replayID int64) error {
+	msgs, err := c.send(ctx, map[string]interface{}{
+		"channel":      "/meta/subscribe",
+		"clientId":     c.clientID,
+		"subscription": channel,
+		"ext":          map[string]interface{}{"replay": map[string]int64{channel: replayID}},
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe failed: %w", err)
+	}
+	if len(msgs) == 0 || !msgs[0].Successful {
+		return fmt.Errorf("subscribe to %s failed: %s", channel, firstError(msgs))
+	}
+	return nil
+}
+
+// send posts one Bayeux message and returns the messages in the response
+func (c *bayeuxClient) send(ctx context.Context, msg map[string]interface{}) ([]bayeuxMessage, error) {
+	body, err := json.Marshal([]interface{}{msg})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/cometd/%s", strings.TrimSuffix(c.org.InstanceURL, "/"), strings.TrimPrefix(salesforceAPIVersion, "v"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.org.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	verbosef("POST %s (%s)", endpoint, msg["channel"])
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &apiStatusError{Status: resp.StatusCode}
+	}
+
+	var msgs []bayeuxMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msgs); err != nil {
+		return nil, fmt.Errorf("error decoding Bayeux response: %v", err)
+	}
+	return msgs, nil
+}
+
+// sessionExpired reports whether err means the access token needs a refresh
+func (c *bayeuxClient) sessionExpired(err error) bool {
+	var statusErr *apiStatusError
+	return errors.As(err, &statusErr) && statusErr.Status == http.StatusUnauthorized && c.org.RefreshToken != ""
+}
+
+// eventReplayID reads data.event.replayId, which every durable event has
+func eventReplayID(data json.RawMessage) int64 {
+	var payload struct {
+		Event struct {
+			ReplayID int64 `json:"replayId"`
+		} `json:"event"`
+	}
+	if json.Unmarshal(data, &payload) != nil {
+		return 0
+	}
+	return payload.Event.ReplayID
+}
+
+func firstError(msgs []bayeuxMessage) string {
+	if len(msgs) == 0 {
+		return "empty response"
+	}
+	return msgs[0].Error
+}
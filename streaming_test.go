@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeCometD answers Bayeux requests, recording the replay IDs subscribed
+// with and dropping the client once after the first event
+type fakeCometD struct {
+	mu         sync.Mutex
+	handshakes int
+	replays    []int64
+	connects   int
+}
+
+func (f *fakeCometD) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var msgs []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil || len(msgs) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	msg := msgs[0]
+	var reply string
+	switch msg["channel"] {
+	case "/meta/handshake":
+		f.handshakes++
+		reply = `[{"channel": "/meta/handshake", "clientId": "client-1", "successful": true}]`
+	case "/meta/subscribe":
+		replay := msg["ext"].(map[string]interface{})["replay"].(map[string]interface{})["/topic/Orders"].(float64)
+		f.replays = append(f.replays, int64(replay))
+		reply = `[{"channel": "/meta/subscribe", "successful": true}]`
+	case "/meta/connect":
+		f.connects++
+		switch f.connects {
+		case 1:
+			reply = `[{"channel": "/topic/Orders", "data": {"event": {"replayId": 5}, "sobject": {"Id": "a01"}}}, {"channel": "/meta/connect", "successful": true}]`
+		case 2:
+			reply = `[{"channel": "/meta/connect", "successful": false, "error": "403::Unknown client", "advice": {"reconnect": "handshake"}}]`
+		default:
+			reply = `[{"channel": "/topic/Orders", "data": {"event": {"replayId": 6}, "sobject": {"Id": "a02"}}}, {"channel": "/meta/connect", "successful": true}]`
+		}
+	}
+	w.Write([]byte(reply))
+}
+
+func TestBayeuxSubscribeResumesAfterRehandshake(t *testing.T) {
+	withQuiet(t)
+	fake := &fakeCometD{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	org := &StoredOrg{Alias: "prod", AccessToken: "access", InstanceURL: server.URL}
+	client := newBayeuxClient(nil, org)
+
+	errDone := errors.New("done")
+	var events []*streamEvent
+	err := client.subscribe(context.Background(), "/topic/Orders", replayNew, func(e *streamEvent) error {
+		events = append(events, e)
+		if len(events) == 2 {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if events[0].ReplayID != 5 || events[1].ReplayID != 6 || events[0].Channel != "/topic/Orders" {
+		t.Errorf("Unexpected events %+v %+v", events[0], events[1])
+	}
+	if fake.handshakes != 2 || len(fake.replays) != 2 || fake.replays[0] != replayNew || fake.replays[1] != 5 {
+		t.Errorf("Expected a resubscribe from replay ID 5, got %d handshakes and replays %v", fake.handshakes, fake.replays)
+	}
+}
+
+func TestEventReplayID(t *testing.T) {
+	if got := eventReplayID(json.RawMessage(`{"event": {"replayId": 42}}`)); got != 42 {
+		t.Errorf("Expected 42, got %d", got)
+	}
+	if got := eventReplayID(json.RawMessage(`"not an object"`)); got != 0 {
+		t.Errorf("Expected 0, got %d", got)
+	}
+}
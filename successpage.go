@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// callbackPageTimeout bounds how long the callback request is held open
+	// waiting for the code exchange before the page is shown without it
+	callbackPageTimeout = 2 * time.Minute
+	// successPageCloseAfter is how many seconds the built-in page counts
+	// down before it tries to close its tab
+	successPageCloseAfter = 5
+)
+
+var (
+	flagSuccessPage     string
+	flagSuccessRedirect string
+)
+
+var (
+	// successPage renders the page shown at the callback after a login,
+	// loaded by runAuthFlow from --success-page or the built-in default
+	successPage *template.Template
+	// callbackResult hands the outcome of the code exchange to the callback
+	// handler, which holds the browser's request until it arrives
+	callbackResult = make(chan *successPageData, 1)
+	// callbackOrg is the org the success page was rendered for, already
+	// enriched, so completeLogin does not look it up a second time
+	callbackOrg *StoredOrg
+)
+
+// successPageData is what the success page template is rendered with. The
+// org fields are empty when they could not be looked up.
+type successPageData struct {
+	Title       string
+	Message     string
+	Username    string
+	Name        string
+	OrgName     string
+	InstanceURL string
+	Sandbox     bool
+	// CloseAfter is the countdown, in seconds, before the page closes
+	// itself
+	CloseAfter int
+}
+
+// defaultSuccessPage is the built-in success page
+const defaultSuccessPage = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Title}}</title>
+	<style>
+		body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center; background: #f3f3f3; font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; color: #181818; }
+		.card { background: #fff; border-radius: 8px; box-shadow: 0 2px 8px rgba(0, 0, 0, 0.12); padding: 2.5rem 3rem; max-width: 28rem; text-align: center; border-top: 4px solid #0176d3; }
+		.check { width: 3rem; height: 3rem; border-radius: 50%; background: #2e844a; color: #fff; font-size: 1.75rem; line-height: 3rem; margin: 0 auto 1rem; }
+		h1 { font-size: 1.4rem; margin: 0 0 0.75rem; }
+		dl { margin: 1.25rem 0; text-align: left; display: grid; grid-template-columns: auto 1fr; gap: 0.35rem 1rem; }
+		dt { color: #706e6b; }
+		dd { margin: 0; word-break: break-all; }
+		.badge { background: #fe9339; color: #fff; border-radius: 4px; padding: 0 0.4rem; font-size: 0.8rem; }
+		p { color: #444; margin: 0; }
+		.countdown { height: 3px; background: #0176d3; margin-top: 1.5rem; border-radius: 2px; animation: countdown {{.CloseAfter}}s linear forwards; }
+		@keyframes countdown { from { width: 100%; } to { width: 0; } }
+	</style>
+</head>
+<body data-status="success">
+	<div class="card">
+		<div class="check">&#10003;</div>
+		<h1>{{.Title}}</h1>
+		{{- if or .OrgName .Username}}
+		<dl>
+			{{- if .OrgName}}<dt>Org</dt><dd>{{.OrgName}}{{if .Sandbox}} <span class="badge">Sandbox</span>{{end}}</dd>{{end}}
+			{{- if .Username}}<dt>User</dt><dd>{{.Username}}</dd>{{end}}
+		</dl>
+		{{- end}}
+		<p>{{.Message}}</p>
+		<div class="countdown" id="countdown"></div>
+	</div>
+	<script>
+		// Let a page that opened this tab know the login is done, then try to
+		// close it. Browsers only allow that for tabs opened by a script, so
+		// the countdown is hidden if the tab stays open.
+		if (window.opener) {
+			window.opener.postMessage({source: "sfdc-auth", status: "success"}, "*");
+		}
+		setTimeout(function () {
+			window.close();
+			document.getElementById("countdown").style.display = "none";
+		}, {{.CloseAfter}} * 1000);
+	</script>
+</body>
+</html>
+`
+
+// loadSuccessPage parses the success page template at path, or the
+// built-in default when path is empty
+func loadSuccessPage(path string) (*template.Template, error) {
+	if path == "" {
+		return template.Must(template.New("success").Parse(defaultSuccessPage)), nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading success page: %v", err)
+	}
+	page, err := template.New("success").Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing success page %s: %v", path, err)
+	}
+	return page, nil
+}
+
+func newSuccessPageData() *successPageData {
+	return &successPageData{Title: tr(msgAuthSuccessful, nil), Message: tr(msgCloseWindow, nil), CloseAfter: successPageCloseAfter}
+}
+
+// checkSuccessRedirect makes sure --success-redirect is an absolute
+// http or https URL
+func checkSuccessRedirect(redirect string) error {
+	if redirect == "" {
+		return nil
+	}
+	u, err := url.Parse(redirect)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("--success-redirect must be an http or https URL, got %q", redirect)
+	}
+	return nil
+}
+
+// successPageFor looks up who logged in to fill in the success page. The
+// lookup is best effort: without it the page just has less to show.
+func successPageFor(domain string, tokenResponse *SalesforceOAuthResponse) *successPageData {
+	data := newSuccessPageData()
+	if tokenResponse == nil || tokenResponse.InstanceURL == "" {
+		return data
+	}
+	org := newStoredOrg(flagAlias, domain, tokenResponse)
+	if err := enrichOrg(org); err != nil {
+		verbosef("Could not look up the org for the success page: %v", err)
+		return data
+	}
+	callbackOrg = org
+	data.Username, data.Name, data.OrgName = org.Username, org.DisplayName, org.OrgName
+	data.InstanceURL, data.Sandbox = org.InstanceURL, org.IsSandbox
+	return data
+}
+
+// writeSuccessPage renders the success page, falling back to the built-in
+// one if a custom template fails on the data. With --success-redirect the
+// browser is sent on to that URL instead.
+func writeSuccessPage(w http.ResponseWriter, r *http.Request, data *successPageData) {
+	if flagSuccessRedirect != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, flagSuccessRedirect, http.StatusSeeOther)
+		return
+	}
+	page := successPage
+	if page == nil {
+		page, _ = loadSuccessPage("")
+	}
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		log.Printf("Warning: could not render the success page: %v", err)
+		buf.Reset()
+		fallback, _ := loadSuccessPage("")
+		fallback.Execute(&buf, data)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Warning: error writing response: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// pageBrowser follows the authorization URL to the callback like
+// fakeBrowser, and keeps the page the callback returns. Redirects are not
+// followed.
+type pageBrowser struct {
+	status   int
+	page     string
+	location string
+	done     chan error
+}
+
+func (b *pageBrowser) Open(authURL string) error {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return err
+	}
+	params := u.Query()
+	callback := params.Get("redirect_uri") + "?" + url.Values{"code": {"the-code"}, "state": {params.Get("state")}}.Encode()
+	go func() {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(callback)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			b.status, b.page, b.location = resp.StatusCode, string(body), resp.Header.Get("Location")
+		}
+		b.done <- err
+	}()
+	return nil
+}
+
+// fakeOrgInstance answers the lookups enrichOrg makes
+func fakeOrgInstance(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/oauth2/userinfo":
+			w.Write([]byte(`{"preferred_username": "pat@acme.com.uat", "name": "Pat <Smith>"}`))
+		case "/services/data/" + salesforceAPIVersion + "/query":
+			w.Write([]byte(`{"records": [{"Name": "Acme", "OrganizationType": "Enterprise Edition", "InstanceName": "CS42", "IsSandbox": true}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func withSuccessPage(t *testing.T, path string) {
+	t.Helper()
+	old := flagSuccessPage
+	flagSuccessPage = path
+	t.Cleanup(func() { flagSuccessPage = old })
+}
+
+func TestSuccessPageShowsOrg(t *testing.T) {
+	withQuiet(t)
+	withSuccessPage(t, "")
+	instance := fakeOrgInstance(t)
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access", InstanceURL: instance.URL}}
+	browser := &pageBrowser{done: make(chan error, 1)}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	if _, err := runAuthFlow(context.Background(), deps, testCallback(t), "test.salesforce.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-browser.done; err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Authentication successful!", "Acme", "Sandbox", "pat@acme.com.uat"} {
+		if !strings.Contains(browser.page, want) {
+			t.Errorf("success page is missing %q:\n%s", want, browser.page)
+		}
+	}
+	if !strings.Contains(browser.page, "window.close()") || !strings.Contains(browser.page, "countdown 5s") {
+		t.Errorf("success page does not count down to closing itself:\n%s", browser.page)
+	}
+	if callbackOrg == nil || callbackOrg.OrgName != "Acme" || callbackOrg.AccessToken != "access" {
+		t.Errorf("callbackOrg = %+v, want the enriched org kept for completeLogin", callbackOrg)
+	}
+}
+
+func TestCustomSuccessPage(t *testing.T) {
+	withQuiet(t)
+	path := filepath.Join(t.TempDir(), "success.html")
+	template := `<html><body class="acme">Welcome {{.Name}} to {{.OrgName}} ({{.InstanceURL}})</body></html>`
+	if err := os.WriteFile(path, []byte(template), 0600); err != nil {
+		t.Fatal(err)
+	}
+	withSuccessPage(t, path)
+	instance := fakeOrgInstance(t)
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access", InstanceURL: instance.URL}}
+	browser := &pageBrowser{done: make(chan error, 1)}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	if _, err := runAuthFlow(context.Background(), deps, testCallback(t), "test.salesforce.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	<-browser.done
+	want := `<html><body class="acme">Welcome Pat &lt;Smith&gt; to Acme (` + instance.URL + `)</body></html>`
+	if browser.page != want {
+		t.Errorf("page = %q, want %q", browser.page, want)
+	}
+}
+
+func TestSuccessRedirect(t *testing.T) {
+	withQuiet(t)
+	withSuccessPage(t, "")
+	old := flagSuccessRedirect
+	flagSuccessRedirect = "https://wiki.example.com/salesforce/logged-in"
+	t.Cleanup(func() { flagSuccessRedirect = old })
+	exchanger := &fakeExchanger{resp: &SalesforceOAuthResponse{AccessToken: "access"}}
+	browser := &pageBrowser{done: make(chan error, 1)}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	if _, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-browser.done; err != nil {
+		t.Fatal(err)
+	}
+	if browser.status != http.StatusSeeOther || browser.location != flagSuccessRedirect {
+		t.Errorf("callback responded %d to %q, want a redirect to the wiki", browser.status, browser.location)
+	}
+
+	for _, bad := range []string{"wiki.example.com/page", "javascript:alert(1)", "ftp://wiki.example.com/"} {
+		if err := checkSuccessRedirect(bad); err == nil {
+			t.Errorf("checkSuccessRedirect(%q) accepted it", bad)
+		}
+	}
+}
+
+func TestApplyConfigSuccessPageExclusion(t *testing.T) {
+	var page, redirect string
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&page, "success-page", "", "")
+	cmd.Flags().StringVar(&redirect, "success-redirect", "", "")
+	cmd.Flags().Set("success-page", "branded.html")
+
+	applyConfig(cmd, &Config{SuccessRedirect: "https://wiki.example.com/"})
+	if redirect != "" {
+		t.Errorf("success_redirect from config.json = %q, want --success-page to override it", redirect)
+	}
+}
+
+func TestSuccessPageAfterFailedExchange(t *testing.T) {
+	withQuiet(t)
+	withSuccessPage(t, "")
+	exchanger := &fakeExchanger{err: errors.New("invalid_grant: authorization code expired")}
+	browser := &pageBrowser{done: make(chan error, 1)}
+	deps := &oauthDeps{AuthURL: &fakeAuthURL{}, Exchanger: exchanger, Clock: systemClock{}, Browser: browser}
+
+	if _, err := runAuthFlow(context.Background(), deps, testCallback(t), "login.salesforce.com", nil); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("runAuthFlow error = %v", err)
+	}
+	<-browser.done
+	if browser.status != http.StatusBadGateway || strings.Contains(browser.page, "successful") {
+		t.Errorf("page after a failed exchange = %d %q", browser.status, browser.page)
+	}
+}
+
+func TestLoadSuccessPageErrors(t *testing.T) {
+	if _, err := loadSuccessPage(filepath.Join(t.TempDir(), "missing.html")); err == nil {
+		t.Error("Expected an error for a missing template")
+	}
+	path := filepath.Join(t.TempDir(), "broken.html")
+	if err := os.WriteFile(path, []byte("<p>{{.Username</p>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSuccessPage(path); err == nil || !strings.Contains(err.Error(), "error parsing success page") {
+		t.Errorf("broken template error = %v", err)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultSyncFileName = "sfdc-auth-store.enc"
+
+var (
+	// errRemoteEmpty is returned by Fetch when nothing has been pushed yet
+	errRemoteEmpty = errors.New("remote has no synced store yet")
+	// errSyncConflict is returned when the remote changed since the last sync
+	errSyncConflict = errors.New("remote store changed since the last sync")
+)
+
+// syncRemote is a location the encrypted store is synced to. Revisions are
+// opaque strings (ETags, commit hashes) used to detect concurrent changes.
+type syncRemote interface {
+	// Fetch returns the current remote content and its revision
+	Fetch() ([]byte, string, error)
+	// Store replaces the remote content if it is still at expectedRevision
+	// (empty meaning it must not exist yet) and returns the new revision
+	Store(data []byte, expectedRevision string) (string, error)
+}
+
+// newSyncRemote builds a remote from a URL:
+//
+//	s3://bucket/key
+//	https://dav.example.com/path/file.enc   (WebDAV)
+//	git+https://host/repo.git#path/file.enc (also git+ssh://, git+file://)
+func newSyncRemote(rawURL, workDir string) (syncRemote, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync remote %q: %v", rawURL, err)
+	}
+
+	switch {
+	case u.Scheme == "s3":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("s3 remote must look like s3://bucket/key")
+		}
+		return newS3Remote(u.Host, key)
+	case u.Scheme == "http" || u.Scheme == "https":
+		return &webdavRemote{url: rawURL, client: http.DefaultClient}, nil
+	case strings.HasPrefix(u.Scheme, "git+"):
+		path := u.Fragment
+		if path == "" {
+			path = defaultSyncFileName
+		}
+		u.Scheme = strings.TrimPrefix(u.Scheme, "git+")
+		u.Fragment = ""
+		repo := u.String()
+		sum := sha256.Sum256([]byte(repo))
+		dir := filepath.Join(workDir, "sync-git", hex.EncodeToString(sum[:8]))
+		return &gitRemote{repo: repo, path: path, dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unsupported sync remote scheme %q (expected s3, http(s) or git+...)", u.Scheme)
+	}
+}
+
+// webdavRemote stores the file with plain GET/PUT and uses ETags with
+// If-Match/If-None-Match so the server rejects conflicting writes.
+// Credentials may be given as URL userinfo.
+type webdavRemote struct {
+	url    string
+	client *http.Client
+}
+
+func (r *webdavRemote) newRequest(method string, body []byte) (*http.Request, error) {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	user := u.User
+	u.User = nil
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	return req, nil
+}
+
+func (r *webdavRemote) Fetch() ([]byte, string, error) {
+	req, err := r.newRequest(http.MethodGet, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching remote store: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", errRemoteEmpty
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetching remote store failed with status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading remote store: %v", err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+func (r *webdavRemote) Store(data []byte, expectedRevision string) (string, error) {
+	req, err := r.newRequest(http.MethodPut, data)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if expectedRevision == "" {
+		req.Header.Set("If-None-Match", "*")
+	} else {
+		req.Header.Set("If-Match", expectedRevision)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error uploading remote store: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return "", errSyncConflict
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("uploading remote store failed with status: %d", resp.StatusCode)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+	// Not every server returns an ETag on PUT, so read it back
+	_, revision, err := r.Fetch()
+	return revision, err
+}
+
+// s3Remote talks to the S3 REST API directly, signing requests with AWS
+// Signature Version 4. Credentials come from the standard AWS_* environment
+// variables; AWS_ENDPOINT_URL selects S3-compatible services.
+type s3Remote struct {
+	endpoint     string
+	bucket       string
+	key          string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	now          func() time.Time
+}
+
+func newS3Remote(bucket, key string) (*s3Remote, error) {
+	r := &s3Remote{
+		bucket:       bucket,
+		key:          key,
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		client:       http.DefaultClient,
+		now:          time.Now,
+	}
+	if r.region == "" {
+		r.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if r.region == "" {
+		r.region = "us-east-1"
+	}
+	if r.accessKey == "" || r.secretKey == "" {
+		return nil, fmt.Errorf("s3 remote requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if r.endpoint == "" {
+		r.endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", r.region)
+	}
+	return r, nil
+}
+
+func (r *s3Remote) objectURL() string {
+	return strings.TrimSuffix(r.endpoint, "/") + "/" + r.bucket + "/" + (&url.URL{Path: r.key}).EscapedPath()
+}
+
+func (r *s3Remote) do(method string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.objectURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	r.sign(req, body)
+	return r.client.Do(req)
+}
+
+func (r *s3Remote) Fetch() ([]byte, string, error) {
+	resp, err := r.do(http.MethodGet, nil, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching remote store: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", errRemoteEmpty
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetching remote store failed with status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading remote store: %v", err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+func (r *s3Remote) Store(data []byte, expectedRevision string) (string, error) {
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	if expectedRevision == "" {
+		headers["If-None-Match"] = "*"
+	} else {
+		headers["If-Match"] = expectedRevision
+	}
+
+	resp, err := r.do(http.MethodPut, data, headers)
+	if err != nil {
+		return "", fmt.Errorf("error uploading remote store: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 409 when a concurrent conditional write wins the race
+	if resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict {
+		return "", errSyncConflict
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("uploading remote store failed with status: %d", resp.StatusCode)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (r *s3Remote) sign(req *http.Request, body []byte) {
+	now := r.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if r.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + r.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+r.secretKey), day)
+	key = hmacSHA256(key, r.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gitRemote keeps the encrypted store as a file in a git repository using
+// the git command line, so existing SSH keys and credential helpers apply.
+// A rejected push means someone else pushed first.
+type gitRemote struct {
+	repo string
+	path string
+	dir  string
+}
+
+func (r *gitRemote) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// update clones the repository on first use and fast-forwards it afterwards
+func (r *gitRemote) update() error {
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(r.dir), 0700); err != nil {
+			return fmt.Errorf("error creating git work directory: %v", err)
+		}
+		cmd := exec.Command("git", "clone", "--quiet", r.repo, r.dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git clone failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	// An empty repository has nothing to pull yet
+	if _, err := r.git("rev-parse", "--verify", "HEAD"); err != nil {
+		return nil
+	}
+	_, err := r.git("pull", "--quiet", "--ff-only")
+	return err
+}
+
+func (r *gitRemote) revision() string {
+	rev, err := r.git("log", "-1", "--format=%H", "--", r.path)
+	if err != nil {
+		return ""
+	}
+	return rev
+}
+
+func (r *gitRemote) Fetch() ([]byte, string, error) {
+	if err := r.update(); err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(filepath.Join(r.dir, r.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", errRemoteEmpty
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading remote store: %v", err)
+	}
+	return data, r.revision(), nil
+}
+
+func (r *gitRemote) Store(data []byte, expectedRevision string) (string, error) {
+	if err := r.update(); err != nil {
+		return "", err
+	}
+	if r.revision() != expectedRevision {
+		return "", errSyncConflict
+	}
+
+	file := filepath.Join(r.dir, r.path)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return "", fmt.Errorf("error creating directory in git work tree: %v", err)
+	}
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return "", fmt.Errorf("error writing store to git work tree: %v", err)
+	}
+	previous, _ := r.git("rev-parse", "--verify", "HEAD")
+	if _, err := r.git("add", "--", r.path); err != nil {
+		return "", err
+	}
+	if _, err := r.git("commit", "--quiet", "-m", "Update sfdc-auth token store", "--", r.path); err != nil {
+		return "", err
+	}
+	if _, err := r.git("push", "--quiet", "origin", "HEAD"); err != nil {
+		// Drop the local commit so the next attempt starts from the remote
+		if previous != "" {
+			_, _ = r.git("reset", "--quiet", "--hard", previous)
+		} else {
+			_, _ = r.git("update-ref", "-d", "HEAD")
+		}
+		if strings.Contains(err.Error(), "rejected") {
+			return "", errSyncConflict
+		}
+		return "", err
+	}
+	return r.revision(), nil
+}
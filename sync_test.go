@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// memRemote is an in-memory syncRemote using a counter as the revision
+type memRemote struct {
+	data     []byte
+	revision int
+}
+
+func (r *memRemote) Fetch() ([]byte, string, error) {
+	if r.data == nil {
+		return nil, "", errRemoteEmpty
+	}
+	return r.data, fmt.Sprint(r.revision), nil
+}
+
+func (r *memRemote) Store(data []byte, expectedRevision string) (string, error) {
+	current := ""
+	if r.data != nil {
+		current = fmt.Sprint(r.revision)
+	}
+	if current != expectedRevision {
+		return "", errSyncConflict
+	}
+	r.data = data
+	r.revision++
+	return fmt.Sprint(r.revision), nil
+}
+
+func newTestStore(t *testing.T, aliases ...string) TokenStore {
+	t.Helper()
+	store, err := openTokenStore(storeTypeFile, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, alias := range aliases {
+		if err := store.Put(&StoredOrg{Alias: alias, RefreshToken: alias + "_refresh"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestSyncPushAndPull(t *testing.T) {
+	const remoteURL = "mem://test"
+	pass := []byte("pass")
+	remote := &memRemote{}
+
+	desktop := newTestStore(t, "prod", "uat")
+	desktopState, err := syncPush(desktop, remote, &syncState{}, remoteURL, &Config{}, pass, false)
+	if err != nil {
+		t.Fatalf("Initial push failed: %v", err)
+	}
+
+	laptop := newTestStore(t)
+	laptopState, err := syncPull(laptop, remote, &syncState{}, remoteURL, pass, false)
+	if err != nil {
+		t.Fatalf("Initial pull failed: %v", err)
+	}
+	orgs, _ := laptop.List()
+	if len(orgs) != 2 {
+		t.Fatalf("Expected 2 orgs after pull, got %d", len(orgs))
+	}
+
+	// The laptop removes an org and pushes
+	if err := laptop.Delete("uat"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncPush(laptop, remote, laptopState, remoteURL, &Config{}, pass, false); err != nil {
+		t.Fatalf("Laptop push failed: %v", err)
+	}
+
+	// The desktop pulls the change, which deletes the org locally too
+	if _, err := syncPull(desktop, remote, desktopState, remoteURL, pass, false); err != nil {
+		t.Fatalf("Desktop pull failed: %v", err)
+	}
+	if _, err := desktop.Get("uat"); !errors.Is(err, errOrgNotFound) {
+		t.Error("Expected org deleted on the laptop to be removed on the desktop")
+	}
+}
+
+func TestSyncDetectsConflicts(t *testing.T) {
+	const remoteURL = "mem://test"
+	pass := []byte("pass")
+	remote := &memRemote{}
+
+	desktop := newTestStore(t, "prod")
+	desktopState, err := syncPush(desktop, remote, &syncState{}, remoteURL, &Config{}, pass, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop := newTestStore(t)
+	laptopState, err := syncPull(laptop, remote, &syncState{}, remoteURL, pass, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both machines change their store; the laptop pushes first
+	if err := laptop.Put(&StoredOrg{Alias: "laptop"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncPush(laptop, remote, laptopState, remoteURL, &Config{}, pass, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := desktop.Put(&StoredOrg{Alias: "desktop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := syncPush(desktop, remote, desktopState, remoteURL, &Config{}, pass, false); !errors.Is(err, errSyncConflict) {
+		t.Errorf("Expected push conflict, got %v", err)
+	}
+	if _, err := syncPull(desktop, remote, desktopState, remoteURL, pass, false); !errors.Is(err, errSyncConflict) {
+		t.Errorf("Expected pull conflict, got %v", err)
+	}
+	if _, err := syncPull(desktop, remote, desktopState, remoteURL, pass, true); err != nil {
+		t.Errorf("Forced pull should succeed, got %v", err)
+	}
+}
+
+func TestSyncPullRefusesUnsyncedLocalOrgs(t *testing.T) {
+	remote := &memRemote{}
+	pass := []byte("pass")
+	if _, err := syncPush(newTestStore(t, "prod"), remote, &syncState{}, "mem://test", &Config{}, pass, false); err != nil {
+		t.Fatal(err)
+	}
+
+	local := newTestStore(t, "local-only")
+	if _, err := syncPull(local, remote, &syncState{}, "mem://test", pass, false); !errors.Is(err, errSyncConflict) {
+		t.Errorf("Expected conflict pulling over never-synced orgs, got %v", err)
+	}
+}
+
+func TestSyncStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	state, err := loadSyncState(dir)
+	if err != nil || state.Remote != "" {
+		t.Fatalf("Expected empty state for a fresh directory, got %+v (%v)", state, err)
+	}
+
+	if err := saveSyncState(dir, &syncState{Remote: "s3://bucket/key", Revision: "etag"}); err != nil {
+		t.Fatal(err)
+	}
+	state, err = loadSyncState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Remote != "s3://bucket/key" || state.Revision != "etag" {
+		t.Errorf("Unexpected state after round trip: %+v", state)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// telemetryURL is where usage events are sent, set with
+// -X main.telemetryURL=... by release builds. Builds without it never send
+// any, whatever the setting.
+var telemetryURL = ""
+
+const (
+	telemetryURLEnv = "SFDC_AUTH_TELEMETRY_URL"
+	// doNotTrackEnv turns telemetry off when set to anything but 0 or
+	// false, even if it was enabled (https://consoledonottrack.com)
+	doNotTrackEnv = "DO_NOT_TRACK"
+)
+
+var (
+	// telemetryEnabled is set for this run when the user opted in
+	telemetryEnabled bool
+	// telemetryCommand and telemetryFlow describe the running command
+	telemetryCommand string
+	telemetryFlow    string
+	telemetryOnce    sync.Once
+)
+
+var telemetryClient = &http.Client{Timeout: 2 * time.Second}
+
+var telemetryCmd = &cobra.Command{
+	Use:   "telemetry",
+	Short: "Manage anonymous usage telemetry (off unless enabled)",
+	Long: `Telemetry is off unless it is enabled here. When enabled, each run sends one
+event with the command name, login flow, OS, architecture, version, and
+whether it succeeded, with the class of error if not (e.g.
+oauth:invalid_grant or network). Org, user and token data are never sent,
+and nor is anything that identifies the machine or the user.
+
+--verbose prints each event as it is sent. DO_NOT_TRACK=1 turns telemetry
+off whatever the setting.`,
+}
+
+var telemetryEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Opt in to anonymous usage telemetry",
+	Args:  cobra.NoArgs,
+	Run:   func(cmd *cobra.Command, args []string) { runTelemetrySet(true) },
+}
+
+var telemetryDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Opt out of anonymous usage telemetry",
+	Args:  cobra.NoArgs,
+	Run:   func(cmd *cobra.Command, args []string) { runTelemetrySet(false) },
+}
+
+var telemetryStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether telemetry is enabled and what an event holds",
+	Args:  cobra.NoArgs,
+	Run:   runTelemetryStatus,
+}
+
+func init() {
+	telemetryCmd.AddCommand(telemetryEnableCmd, telemetryDisableCmd, telemetryStatusCmd)
+	rootCmd.AddCommand(telemetryCmd)
+}
+
+// telemetryEvent is all a run reports
+type telemetryEvent struct {
+	Command    string `json:"command"`
+	Flow       string `json:"flow,omitempty"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	Version    string `json:"version"`
+	Outcome    string `json:"outcome"`
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+// setupTelemetry turns telemetry on for this run if the user opted in in
+// config.json. The telemetry commands themselves, help and completion are
+// never reported.
+func setupTelemetry(cmd *cobra.Command, cfg *Config) {
+	telemetryEnabled = cfg.Telemetry != nil && *cfg.Telemetry && !doNotTrack()
+	telemetryCommand, telemetryFlow = telemetryCommandName(cmd), ""
+	if !cmd.HasParent() {
+		telemetryFlow = flagGrant
+	}
+	switch strings.Fields(telemetryCommand)[0] {
+	case "telemetry", "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		telemetryEnabled = false
+	}
+}
+
+// telemetryCommandName is the command path without the binary name. Plugins
+// are only reported as "plugin", since their names are the user's own.
+func telemetryCommandName(cmd *cobra.Command) string {
+	if !cmd.HasParent() {
+		return "login"
+	}
+	if cmd.GroupID == pluginGroup {
+		return "plugin"
+	}
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+func doNotTrack() bool {
+	v, ok := os.LookupEnv(doNotTrackEnv)
+	return ok && v != "" && v != "0" && !strings.EqualFold(v, "false")
+}
+
+// reportCommandSuccess sends the event of a run that finished normally
+func reportCommandSuccess(cmd *cobra.Command, args []string) {
+	sendTelemetry(nil)
+}
+
+// reportTelemetryFailure sends the event of a run that is failing. Only the
+// first event of a run is sent, so a failure is not followed by a success.
+func reportTelemetryFailure(err error) {
+	sendTelemetry(err)
+}
+
+// errLoggedFailure stands in for an error only known from its log line; it
+// is classed as "other"
+var errLoggedFailure = errors.New("command failed")
+
+// telemetryLogWriter reports the run as failed when an "Error" line is
+// logged, as commands exit through log.Fatalf("Error: ...") and so never
+// reach PersistentPostRun. Failures of auth events are already reported
+// with their class, which wins; the logged message itself is never sent.
+type telemetryLogWriter struct {
+	w io.Writer
+}
+
+func (t telemetryLogWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if strings.HasPrefix(logMessage(string(p)), "Error") {
+		reportTelemetryFailure(errLoggedFailure)
+	}
+	return n, err
+}
+
+func sendTelemetry(err error) {
+	if !telemetryEnabled {
+		return
+	}
+	telemetryOnce.Do(func() {
+		target := telemetryEndpoint()
+		if target == "" {
+			return
+		}
+		body, _ := json.Marshal(newTelemetryEvent(err))
+		verbosef("Sending telemetry to %s: %s", target, body)
+		resp, err := telemetryClient.Post(target, "application/json", bytes.NewReader(body))
+		if err != nil {
+			verbosef("Telemetry not sent: %v", err)
+			return
+		}
+		resp.Body.Close()
+	})
+}
+
+func telemetryEndpoint() string {
+	if u := os.Getenv(telemetryURLEnv); u != "" {
+		return u
+	}
+	return telemetryURL
+}
+
+func newTelemetryEvent(err error) *telemetryEvent {
+	event := &telemetryEvent{
+		Command: telemetryCommand,
+		Flow:    telemetryFlow,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Version: currentBuildInfo().Version,
+		Outcome: auditSuccess,
+	}
+	if err != nil {
+		event.Outcome, event.ErrorClass = auditFailure, errorClass(err)
+	}
+	return event
+}
+
+// oauthErrorCode matches the error codes of the OAuth spec and Salesforce;
+// anything else could carry data and is only reported as "oauth"
+var oauthErrorCode = regexp.MustCompile(`^[a-z_]{1,40}$`)
+
+// errorClass sorts an error into a class that says what went wrong without
+// any of the detail of the message
+func errorClass(err error) string {
+	var oauthErr *oauthError
+	var certErr *tls.CertificateVerificationError
+	var netErr net.Error
+	switch {
+	case isCancelled(err):
+		return "cancelled"
+	case isMaintenanceError(err):
+		return "maintenance"
+	case errors.As(err, &oauthErr):
+		if oauthErrorCode.MatchString(oauthErr.Code) {
+			return "oauth:" + oauthErr.Code
+		}
+		return "oauth"
+	case errors.As(err, &certErr):
+		return "tls"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
+
+func runTelemetrySet(enabled bool) {
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	cfg.Telemetry = &enabled
+	if err := saveConfig(dir, cfg); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if enabled {
+		infof("Telemetry enabled; run \"telemetry status\" to see what is sent")
+		if doNotTrack() {
+			log.Printf("Warning: %s is set, so no events are sent", doNotTrackEnv)
+		}
+	} else {
+		infof("Telemetry disabled")
+	}
+}
+
+func runTelemetryStatus(cmd *cobra.Command, args []string) {
+	dir, err := defaultStoreDir()
+	if err != nil {
+		log.Fatalf("Error locating config directory: %v", err)
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	state := "disabled"
+	switch {
+	case cfg.Telemetry == nil || !*cfg.Telemetry:
+	case doNotTrack():
+		state = "disabled by " + doNotTrackEnv
+	case telemetryEndpoint() == "":
+		state = "enabled, but this build has no telemetry endpoint, so nothing is sent"
+	default:
+		state = "enabled"
+	}
+	fmt.Printf("Telemetry: %s\n", state)
+	if target := telemetryEndpoint(); target != "" {
+		fmt.Printf("Endpoint:  %s\n", target)
+	}
+
+	example := newTelemetryEvent(nil)
+	example.Command, example.Flow = "login", grantAuthorizationCode
+	data, _ := json.MarshalIndent(example, "", "  ")
+	fmt.Printf("\nEach run sends one event like this:\n%s\n", data)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestErrorClass(t *testing.T) {
+	cases := map[error]string{
+		errCancelled: "cancelled",
+		fmt.Errorf("exchange: %w", &oauthError{Code: "invalid_grant", Description: "expired access/refresh token for me@acme.com"}): "oauth:invalid_grant",
+		&oauthError{Code: "Not A Code: 00D000000000001"}:                 "oauth",
+		fmt.Errorf("error making token request: %w", &netTimeoutError{}): "network",
+		errors.New("error reading config.json"):                          "other",
+	}
+	for err, want := range cases {
+		if got := errorClass(err); got != want {
+			t.Errorf("errorClass(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+// netTimeoutError is a net.Error
+type netTimeoutError struct{}
+
+func (netTimeoutError) Error() string   { return "i/o timeout" }
+func (netTimeoutError) Timeout() bool   { return true }
+func (netTimeoutError) Temporary() bool { return true }
+
+func TestSetupTelemetry(t *testing.T) {
+	t.Cleanup(func() { telemetryEnabled = false })
+	on := true
+	refresh := &cobra.Command{Use: "refresh"}
+	rootCmd.AddCommand(refresh)
+	t.Cleanup(func() { rootCmd.RemoveCommand(refresh) })
+
+	setupTelemetry(refresh, &Config{})
+	if telemetryEnabled {
+		t.Error("telemetry enabled without opting in")
+	}
+	setupTelemetry(refresh, &Config{Telemetry: &on})
+	if !telemetryEnabled || telemetryCommand != "refresh" || telemetryFlow != "" {
+		t.Errorf("enabled = %v, command %q, flow %q", telemetryEnabled, telemetryCommand, telemetryFlow)
+	}
+	setupTelemetry(rootCmd, &Config{Telemetry: &on})
+	if telemetryCommand != "login" || telemetryFlow != flagGrant {
+		t.Errorf("login reported as %q with flow %q", telemetryCommand, telemetryFlow)
+	}
+	setupTelemetry(telemetryStatusCmd, &Config{Telemetry: &on})
+	if telemetryEnabled {
+		t.Error("telemetry commands should not be reported")
+	}
+
+	t.Setenv(doNotTrackEnv, "1")
+	setupTelemetry(refresh, &Config{Telemetry: &on})
+	if telemetryEnabled {
+		t.Errorf("telemetry enabled with %s set", doNotTrackEnv)
+	}
+}
+
+func TestSendTelemetry(t *testing.T) {
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+	t.Setenv(telemetryURLEnv, server.URL)
+
+	telemetryEnabled, telemetryCommand, telemetryFlow, telemetryOnce = true, "refresh", "", sync.Once{}
+	t.Cleanup(func() { telemetryEnabled, telemetryOnce = false, sync.Once{} })
+
+	org := &StoredOrg{Alias: "prod", Username: "me@acme.com", AccessToken: "00D000000000001!secret"}
+	reportTelemetryFailure(fmt.Errorf("refresh of %s: %w", org.Username, &oauthError{Code: "invalid_grant"}))
+	reportCommandSuccess(nil, nil)
+
+	if len(bodies) != 1 {
+		t.Fatalf("sent %d events, want 1", len(bodies))
+	}
+	body := <-bodies
+	for _, leaked := range []string{"prod", "me@acme.com", "secret"} {
+		if strings.Contains(string(body), leaked) {
+			t.Errorf("event holds %q: %s", leaked, body)
+		}
+	}
+	var event telemetryEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Command != "refresh" || event.Outcome != auditFailure || event.ErrorClass != "oauth:invalid_grant" || event.OS == "" || event.Version == "" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestTelemetryLogWriter(t *testing.T) {
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+	t.Setenv(telemetryURLEnv, server.URL)
+
+	telemetryEnabled, telemetryCommand, telemetryFlow, telemetryOnce = true, "org list", "", sync.Once{}
+	t.Cleanup(func() { telemetryEnabled, telemetryOnce = false, sync.Once{} })
+
+	var out strings.Builder
+	w := telemetryLogWriter{w: &out}
+	w.Write([]byte("2024/01/02 03:04:05 Warning: something odd\n"))
+	if len(bodies) != 0 {
+		t.Fatal("a warning should not be reported")
+	}
+	w.Write([]byte("2024/01/02 03:04:05 Error loading store at /home/me: denied\n"))
+
+	if len(bodies) != 1 {
+		t.Fatalf("sent %d events, want 1", len(bodies))
+	}
+	body := <-bodies
+	if strings.Contains(string(body), "/home/me") {
+		t.Errorf("event holds the log message: %s", body)
+	}
+	var event telemetryEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Command != "org list" || event.Outcome != auditFailure || event.ErrorClass != "other" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if !strings.Contains(out.String(), "Error loading store") {
+		t.Errorf("log line not written through: %q", out.String())
+	}
+}
+
+func TestSendTelemetryDisabled(t *testing.T) {
+	sent := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { sent = true }))
+	defer server.Close()
+	t.Setenv(telemetryURLEnv, server.URL)
+
+	telemetryEnabled, telemetryOnce = false, sync.Once{}
+	reportCommandSuccess(nil, nil)
+	if sent {
+		t.Error("event sent with telemetry disabled")
+	}
+}
+
+func TestTelemetrySetting(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	withQuiet(t)
+
+	runTelemetrySet(true)
+	dir, err := defaultStoreDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Telemetry == nil || !*cfg.Telemetry {
+		t.Fatalf("telemetry not enabled in config: %+v", cfg.Telemetry)
+	}
+
+	runTelemetrySet(false)
+	if cfg, _ = loadConfig(dir); cfg.Telemetry == nil || *cfg.Telemetry {
+		t.Errorf("telemetry not disabled in config: %+v", cfg.Telemetry)
+	}
+}
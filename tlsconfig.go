@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+const caBundleEnv = "SFDC_AUTH_CA_BUNDLE"
+
+// --ca-bundle and --insecure-skip-verify, for TLS-intercepting proxies that
+// re-sign Salesforce traffic with a corporate CA
+var (
+	flagCABundle           string
+	flagInsecureSkipVerify bool
+)
+
+// tlsClientConfig is what setupTLS applied, nil without either flag; the
+// proxy dialer uses it to reach an https proxy as well
+var tlsClientConfig *tls.Config
+
+// setupTLS applies --ca-bundle or --insecure-skip-verify to the default
+// transport. It runs after setupProxy, which may have replaced it.
+func setupTLS() error {
+	bundle := flagCABundle
+	if bundle == "" {
+		bundle = os.Getenv(caBundleEnv)
+	}
+	if bundle == "" && !flagInsecureSkipVerify {
+		return nil
+	}
+	if bundle != "" && flagInsecureSkipVerify {
+		return fmt.Errorf("--ca-bundle and --insecure-skip-verify cannot be used together")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if flagInsecureSkipVerify {
+		log.Print("WARNING: --insecure-skip-verify is set. TLS certificates are not checked, so anyone on the network path can read and change the traffic, tokens included. Use --ca-bundle with your proxy's CA instead.")
+		cfg.InsecureSkipVerify = true
+	} else {
+		pool, err := loadCABundle(bundle)
+		if err != nil {
+			return err
+		}
+		cfg.RootCAs = pool
+		verbosef("Trusting the CAs in %s", bundle)
+	}
+
+	switch transport := http.DefaultTransport.(type) {
+	case *http.Transport:
+		transport = transport.Clone()
+		transport.TLSClientConfig = cfg
+		http.DefaultTransport = transport
+	case *proxyTransport:
+		clone := transport.Clone()
+		clone.TLSClientConfig = cfg
+		http.DefaultTransport = &proxyTransport{Transport: clone}
+	default:
+		return fmt.Errorf("cannot apply TLS settings to the HTTP transport")
+	}
+	tlsClientConfig = cfg
+	return nil
+}
+
+// loadCABundle adds the PEM certificates in path to the system roots, so
+// hosts not behind the intercepting proxy keep working
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withTLSFlags resets the TLS flags and the default transport after a test
+func withTLSFlags(t *testing.T) {
+	t.Helper()
+	original := http.DefaultTransport
+	t.Setenv(caBundleEnv, "")
+	t.Cleanup(func() {
+		http.DefaultTransport, flagCABundle, flagInsecureSkipVerify = original, "", false
+	})
+}
+
+func TestSetupTLSTrustsCABundle(t *testing.T) {
+	withTLSFlags(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}).Get(server.URL); err == nil {
+		t.Fatal("Expected the test server's certificate to be untrusted without --ca-bundle")
+	}
+
+	flagCABundle = bundle
+	if err := setupTLS(); err != nil {
+		t.Fatalf("setupTLS: %v", err)
+	}
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the CA bundle to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSetupTLSReadsBundleFromEnv(t *testing.T) {
+	withTLSFlags(t)
+	t.Setenv(caBundleEnv, filepath.Join(t.TempDir(), "missing.pem"))
+	if err := setupTLS(); err == nil || !strings.Contains(err.Error(), "error reading CA bundle") {
+		t.Fatalf("Expected the bundle from %s to be read, got %v", caBundleEnv, err)
+	}
+}
+
+func TestSetupTLSRejectsBundleWithoutCertificates(t *testing.T) {
+	withTLSFlags(t)
+	flagCABundle = filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(flagCABundle, []byte("not a certificate\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupTLS(); err == nil || !strings.Contains(err.Error(), "no PEM certificates") {
+		t.Fatalf("Expected an error for a bundle without certificates, got %v", err)
+	}
+}
+
+func TestSetupTLSInsecureSkipVerify(t *testing.T) {
+	withTLSFlags(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	flagInsecureSkipVerify = true
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	if err := setupTLS(); err != nil {
+		t.Fatalf("setupTLS: %v", err)
+	}
+	if !strings.Contains(logged.String(), "WARNING: --insecure-skip-verify") {
+		t.Errorf("Expected a warning, got %q", logged.String())
+	}
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected verification to be skipped, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSetupTLSRejectsBothFlags(t *testing.T) {
+	withTLSFlags(t)
+	flagCABundle, flagInsecureSkipVerify = "ca.pem", true
+	if err := setupTLS(); err == nil {
+		t.Fatal("Expected an error when --ca-bundle and --insecure-skip-verify are both set")
+	}
+}
+
+func TestSetupTLSLeavesTransportByDefault(t *testing.T) {
+	withTLSFlags(t)
+	original := http.DefaultTransport
+	if err := setupTLS(); err != nil {
+		t.Fatalf("setupTLS: %v", err)
+	}
+	if http.DefaultTransport != original {
+		t.Error("Expected the default transport to be left alone")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Endpoints token validate can call
+const (
+	tokenCheckUserinfo = "userinfo"
+	tokenCheckAPI      = "api"
+)
+
+var (
+	flagTokenAlias       string
+	flagTokenAccessToken string
+	flagTokenInstanceURL string
+	flagTokenCheck       string
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Check access tokens",
+}
+
+var tokenValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that an access token still works",
+	Long: `Call the org with an access token and report whether Salesforce still
+accepts it, exiting 0 if it does and 1 if it does not, so scripts can check a
+token before using it.
+
+The token is a stored org's (--alias, or the default org) or one given with
+--access-token (or ` + accessTokenEnv + `) and --instance-url. Unlike other
+commands, an expired stored token is reported rather than refreshed.
+
+--check userinfo (the default) calls the userinfo endpoint, which needs the
+id, openid or full scope; --check api lists the REST API resources, which
+needs the api scope.`,
+	Args: cobra.NoArgs,
+	Run:  runTokenValidate,
+}
+
+func init() {
+	tokenValidateCmd.Flags().StringVarP(&flagTokenAlias, "alias", "a", "", "Alias of the stored org (default: the default org)")
+	tokenValidateCmd.Flags().StringVar(&flagTokenAccessToken, "access-token", "", "Access token to check instead of a stored org (default: from "+accessTokenEnv+")")
+	tokenValidateCmd.Flags().StringVar(&flagTokenInstanceURL, "instance-url", "", "Instance URL the access token is for, with --access-token")
+	tokenValidateCmd.Flags().StringVar(&flagTokenCheck, "check", tokenCheckUserinfo, "Endpoint to call: userinfo or api")
+
+	tokenCmd.AddCommand(tokenValidateCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+// tokenVerdict is the result of token validate
+type tokenVerdict struct {
+	Valid       bool   `json:"valid"`
+	Alias       string `json:"alias,omitempty"`
+	InstanceURL string `json:"instance_url"`
+	Check       string `json:"check"`
+	Status      int    `json:"status,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func runTokenValidate(cmd *cobra.Command, args []string) {
+	if flagTokenCheck != tokenCheckUserinfo && flagTokenCheck != tokenCheckAPI {
+		log.Fatalf("Error: unknown --check %q (use %s or %s)", flagTokenCheck, tokenCheckUserinfo, tokenCheckAPI)
+	}
+	accessToken := flagTokenAccessToken
+	flagTokenAccessToken = ""
+	if accessToken == "" {
+		accessToken = os.Getenv(accessTokenEnv)
+	}
+
+	var org *StoredOrg
+	switch {
+	case flagTokenAlias != "" && accessToken != "":
+		log.Fatalf("Error: use either --alias or --access-token, not both")
+	case accessToken != "":
+		if flagTokenInstanceURL == "" {
+			log.Fatalf("Error: --access-token needs --instance-url")
+		}
+		org = &StoredOrg{AccessToken: accessToken, InstanceURL: flagTokenInstanceURL}
+	default:
+		store, stored, err := useStoredOrg(flagTokenAlias)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		store.Close()
+		org = stored
+	}
+
+	verdict := validateToken(org, flagTokenCheck)
+	if outputFormat(outputJSON) == outputText {
+		switch {
+		case verdict.Valid && verdict.Username != "":
+			fmt.Printf("valid: %s\n", verdict.Username)
+		case verdict.Valid:
+			fmt.Println("valid")
+		default:
+			fmt.Printf("invalid: %s\n", verdict.Error)
+		}
+	} else if err := writeJSON(verdict); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+	if !verdict.Valid {
+		os.Exit(1)
+	}
+}
+
+// validateToken calls the org with its access token. A token that cannot
+// be checked, because the org is unreachable, is reported as not valid.
+func validateToken(org *StoredOrg, check string) *tokenVerdict {
+	verdict := &tokenVerdict{Alias: org.Alias, InstanceURL: org.InstanceURL, Check: check}
+	if org.AccessToken == "" {
+		verdict.Error = "no access token"
+		return verdict
+	}
+
+	var err error
+	if check == tokenCheckAPI {
+		var resources map[string]string
+		err = getOrgJSON(org, "/services/data/"+salesforceAPIVersion+"/", &resources)
+	} else {
+		var userinfo struct {
+			PreferredUsername string `json:"preferred_username"`
+		}
+		err = getOrgJSON(org, "/services/oauth2/userinfo", &userinfo)
+		verdict.Username = userinfo.PreferredUsername
+	}
+
+	var statusErr *apiStatusError
+	switch {
+	case err == nil:
+		verdict.Valid, verdict.Status = true, http.StatusOK
+	case errors.As(err, &statusErr) && statusErr.Status == http.StatusUnauthorized:
+		verdict.Status = statusErr.Status
+		verdict.Error = "the token has expired or been revoked"
+	case errors.As(err, &statusErr):
+		verdict.Status = statusErr.Status
+		verdict.Error = fmt.Sprintf("the org rejected the token with status %d", statusErr.Status)
+	default:
+		verdict.Error = fmt.Sprintf("error checking the token: %v", err)
+	}
+	return verdict
+}
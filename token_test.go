@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch token := r.Header.Get("Authorization"); {
+		case token == "Bearer expired":
+			w.WriteHeader(http.StatusUnauthorized)
+		case token == "Bearer api-only" && r.URL.Path == "/services/oauth2/userinfo":
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Path == "/services/oauth2/userinfo":
+			w.Write([]byte(`{"preferred_username": "me@acme.com"}`))
+		case r.URL.Path == "/services/data/"+salesforceAPIVersion+"/":
+			w.Write([]byte(`{"sobjects": "/services/data/` + salesforceAPIVersion + `/sobjects"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		token, check string
+		want         tokenVerdict
+	}{
+		{"good", tokenCheckUserinfo, tokenVerdict{Valid: true, Status: http.StatusOK, Username: "me@acme.com"}},
+		{"good", tokenCheckAPI, tokenVerdict{Valid: true, Status: http.StatusOK}},
+		{"expired", tokenCheckUserinfo, tokenVerdict{Status: http.StatusUnauthorized, Error: "the token has expired or been revoked"}},
+		{"api-only", tokenCheckUserinfo, tokenVerdict{Status: http.StatusForbidden, Error: "the org rejected the token with status 403"}},
+		{"api-only", tokenCheckAPI, tokenVerdict{Valid: true, Status: http.StatusOK}},
+		{"", tokenCheckUserinfo, tokenVerdict{Error: "no access token"}},
+	} {
+		org := &StoredOrg{Alias: "dev", AccessToken: tt.token, InstanceURL: server.URL}
+		tt.want.Alias, tt.want.InstanceURL, tt.want.Check = "dev", server.URL, tt.check
+		if got := validateToken(org, tt.check); *got != tt.want {
+			t.Errorf("validateToken(%q, %s) = %+v, want %+v", tt.token, tt.check, *got, tt.want)
+		}
+	}
+}
+
+func TestValidateTokenUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	got := validateToken(&StoredOrg{AccessToken: "good", InstanceURL: server.URL}, tokenCheckUserinfo)
+	if got.Valid || got.Status != 0 || got.Error == "" {
+		t.Errorf("validateToken for a closed server = %+v", *got)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	updateRepository = "mr-menno/sfdc-go-auth-cli"
+	// updateChecksums lists the SHA-256 of every release asset, and
+	// updateSignature is its Ed25519 signature
+	updateChecksums = "checksums.txt"
+	updateSignature = "checksums.txt.sig"
+	// maxUpdateDownload bounds the size of a downloaded release asset
+	maxUpdateDownload = 256 << 20
+)
+
+var (
+	flagUpdateCheck   bool
+	flagUpdateVersion string
+	flagUpdateForce   bool
+
+	// updateAPIURL is the GitHub API the releases are read from
+	updateAPIURL = "https://api.github.com"
+	// releasePublicKey is the base64 Ed25519 key release checksums are
+	// signed with, set with -X main.releasePublicKey=... by release builds.
+	// When it is set, update only installs releases with a valid signature;
+	// without it, update needs --force.
+	releasePublicKey = ""
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update sfdc-auth to the latest GitHub release",
+	Long: `Check the project's GitHub releases for a newer version and replace the
+running binary with the one for this platform. The download is checked
+against the release's checksums.txt before anything is replaced, and binaries
+from the release builds also verify that checksums.txt carries the project's
+signature.
+
+A build without the project's signing key, such as one from go install or a
+source checkout, can only check the download against checksums.txt from the
+same release, which catches a corrupted download but not a tampered release.
+Such builds refuse to update unless --force is given.
+
+--check only reports whether an update is available. --version installs a
+given release instead of the latest, e.g. to go back to an older one. Set
+GITHUB_TOKEN to avoid GitHub's rate limit for anonymous requests.`,
+	Args: cobra.NoArgs,
+	Run:  runUpdate,
+}
+
+func init() {
+	updateCmd.Flags().BoolVar(&flagUpdateCheck, "check", false, "Only report whether a newer release is available")
+	updateCmd.Flags().StringVar(&flagUpdateVersion, "version", "", "Release to install, e.g. v1.5.0 (default: the latest)")
+	updateCmd.Flags().BoolVar(&flagUpdateForce, "force", false, "Install even if the release is not newer, this is a development build, or the release cannot be signature-checked")
+
+	rootCmd.AddCommand(updateCmd)
+}
+
+// githubRelease is the part of a GitHub release the update needs
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	HTMLURL string        `json:"html_url"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// updateCheck is what update --check prints
+type updateCheck struct {
+	Current         string `json:"current"`
+	Latest          string `json:"latest"`
+	UpdateAvailable bool   `json:"update_available"`
+	URL             string `json:"url"`
+}
+
+func runUpdate(cmd *cobra.Command, args []string) {
+	current := currentBuildInfo().Version
+	release, err := fetchRelease(flagUpdateVersion)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	latest := strings.TrimPrefix(release.TagName, "v")
+	newer := compareVersions(latest, current) > 0
+
+	if flagUpdateCheck {
+		check := updateCheck{Current: current, Latest: latest, UpdateAvailable: newer, URL: release.HTMLURL}
+		if outputFormat(outputText) == outputJSON {
+			if err := writeJSON(check); err != nil {
+				log.Fatalf("Error writing output: %v", err)
+			}
+			return
+		}
+		if newer {
+			fmt.Printf("sfdc-auth %s is available (running %s): %s\n", latest, current, release.HTMLURL)
+		} else {
+			fmt.Printf("sfdc-auth %s is up to date\n", current)
+		}
+		return
+	}
+
+	if !flagUpdateForce {
+		if current == "dev" {
+			log.Fatalf("Error: this is a development build; pass --force to replace it with release %s", latest)
+		}
+		if !newer && flagUpdateVersion == "" {
+			infof("sfdc-auth %s is up to date", current)
+			return
+		}
+		if compareVersions(latest, current) == 0 {
+			infof("sfdc-auth %s is already installed", current)
+			return
+		}
+		if releasePublicKey == "" {
+			log.Fatalf("Error: this build has no release signing key, so %s could only be checked against its own checksums.txt; pass --force to install it anyway", latest)
+		}
+	}
+	if releasePublicKey == "" {
+		log.Printf("WARNING: this build has no release signing key. %s is only checked against the checksums.txt published with it, not a signature.", latest)
+	}
+
+	binary, err := downloadRelease(release, updateAssetName(runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Error locating the running binary: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	infof("Updated %s from %s to %s", exe, current, latest)
+}
+
+// updateAssetName is the release asset with the raw binary for a platform
+func updateAssetName(goos, goarch string) string {
+	name := "sfdc-auth-" + goos + "-" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// fetchRelease reads the GitHub release tagged tag, or the latest release
+func fetchRelease(tag string) (*githubRelease, error) {
+	path := "/repos/" + updateRepository + "/releases/latest"
+	if tag != "" {
+		if !strings.HasPrefix(tag, "v") {
+			tag = "v" + tag
+		}
+		path = "/repos/" + updateRepository + "/releases/tags/" + tag
+	}
+	data, err := updateGet(updateAPIURL+path, "application/vnd.github+json")
+	if err != nil {
+		return nil, fmt.Errorf("error checking for releases: %v", err)
+	}
+	var release githubRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("error decoding release: %v", err)
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("error checking for releases: no release found")
+	}
+	return &release, nil
+}
+
+// downloadRelease downloads the named asset of release and checks it
+// against the release's checksums, and their signature when the binary was
+// built with releasePublicKey
+func downloadRelease(release *githubRelease, name string) ([]byte, error) {
+	assets := map[string]string{}
+	for _, asset := range release.Assets {
+		assets[asset.Name] = asset.URL
+	}
+	if assets[name] == "" {
+		return nil, fmt.Errorf("release %s has no binary for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	if assets[updateChecksums] == "" {
+		return nil, fmt.Errorf("release %s has no %s to verify the download with", release.TagName, updateChecksums)
+	}
+
+	checksums, err := updateGet(assets[updateChecksums], "")
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", updateChecksums, err)
+	}
+	if releasePublicKey != "" {
+		if assets[updateSignature] == "" {
+			return nil, fmt.Errorf("release %s is not signed", release.TagName)
+		}
+		signature, err := updateGet(assets[updateSignature], "")
+		if err != nil {
+			return nil, fmt.Errorf("error downloading %s: %v", updateSignature, err)
+		}
+		if err := verifyReleaseSignature(releasePublicKey, checksums, signature); err != nil {
+			return nil, err
+		}
+	}
+	want, err := releaseChecksum(checksums, name)
+	if err != nil {
+		return nil, err
+	}
+
+	verbosef("Downloading %s from %s", name, release.TagName)
+	binary, err := updateGet(assets[name], "")
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", name, err)
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != want {
+		return nil, fmt.Errorf("checksum mismatch for %s; not installing it", name)
+	}
+	return binary, nil
+}
+
+// releaseChecksum finds the SHA-256 of name in sha256sum output
+func releaseChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s in %s", name, updateChecksums)
+}
+
+// verifyReleaseSignature checks the Ed25519 signature of checksums.txt. The
+// signature may be raw or base64 encoded.
+func verifyReleaseSignature(publicKey string, checksums, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release public key built into this binary")
+	}
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid signature in %s", updateSignature)
+		}
+		signature = decoded
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), checksums, signature) {
+		return fmt.Errorf("signature of %s does not match the release key; not installing it", updateChecksums)
+	}
+	return nil
+}
+
+func updateGet(url, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, updateAPIURL) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub responded %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if len(data) > maxUpdateDownload {
+		return nil, fmt.Errorf("download is larger than %d bytes", maxUpdateDownload)
+	}
+	return data, nil
+}
+
+// replaceExecutable swaps the binary at path for binary. The new file is
+// written next to it and renamed over it, so a failed update leaves the old
+// binary in place. Windows cannot overwrite a running program, so there the
+// old binary is moved aside first.
+func replaceExecutable(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return fmt.Errorf("error writing the update next to %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing the update: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing the update: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error writing the update: %v", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("error moving %s aside: %v", path, err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			os.Rename(old, path)
+			return fmt.Errorf("error replacing %s: %v", path, err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %v", path, err)
+	}
+	return nil
+}
+
+// gitDescribeSuffix is what git describe appends to a tag for the commits
+// after it, e.g. 1.4.0-3-g0123456
+var gitDescribeSuffix = regexp.MustCompile(`^(\d+-g[0-9a-f]+)?(-?dirty)?$`)
+
+// compareVersions compares two dotted versions numerically, returning -1, 0
+// or 1. A pre-release (1.5.0-rc.1) sorts before its release and a git
+// describe version (1.5.0-3-g0123456) after it, and "dev" before everything.
+func compareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if b == "dev" {
+		return 1
+	}
+	if a == "dev" {
+		return -1
+	}
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	if aPre != "" && gitDescribeSuffix.MatchString(aPre) {
+		aPre = "~" + aPre
+	}
+	if bPre != "" && gitDescribeSuffix.MatchString(bPre) {
+		bPre = "~" + bPre
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case strings.HasPrefix(aPre, "~") != strings.HasPrefix(bPre, "~"):
+		if strings.HasPrefix(aPre, "~") {
+			return 1
+		}
+		return -1
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.5.0", "1.4.2", 1},
+		{"1.4.2", "1.5.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.5.0", "1.5.0", 0},
+		{"1.5", "1.5.0", 0},
+		{"1.5.0", "1.5.0-rc.1", 1},
+		{"1.5.0-rc.2", "1.5.0-rc.1", 1},
+		{"1.5.0", "1.5.0-3-g0123456", -1},
+		{"1.5.0", "1.5.0-dirty", -1},
+		{"1.6.0", "1.5.0-3-g0123456-dirty", 1},
+		{"1.0.0", "dev", 1},
+		{"dev", "1.0.0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// fakeReleases serves a GitHub release v1.5.0 with a binary for this
+// platform, its checksums.txt and, given a key, their signature
+func fakeReleases(t *testing.T, binary []byte, checksums string, key ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	name := updateAssetName(runtime.GOOS, runtime.GOARCH)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/" + updateRepository + "/releases/latest", "/repos/" + updateRepository + "/releases/tags/v1.5.0":
+			assets := []githubAsset{
+				{Name: name, URL: server.URL + "/download/" + name},
+				{Name: updateChecksums, URL: server.URL + "/download/" + updateChecksums},
+			}
+			if key != nil {
+				assets = append(assets, githubAsset{Name: updateSignature, URL: server.URL + "/download/" + updateSignature})
+			}
+			json.NewEncoder(w).Encode(githubRelease{TagName: "v1.5.0", HTMLURL: "https://github.com/" + updateRepository + "/releases/tag/v1.5.0", Assets: assets})
+		case "/download/" + name:
+			w.Write(binary)
+		case "/download/" + updateChecksums:
+			w.Write([]byte(checksums))
+		case "/download/" + updateSignature:
+			w.Write(ed25519.Sign(key, []byte(checksums)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	old := updateAPIURL
+	updateAPIURL = server.URL
+	t.Cleanup(func() { updateAPIURL = old })
+	return server
+}
+
+func checksumsFor(binary []byte) string {
+	sum := sha256.Sum256(binary)
+	return hex.EncodeToString(sum[:]) + "  " + updateAssetName(runtime.GOOS, runtime.GOARCH) + "\n" +
+		strings.Repeat("0", 64) + "  sfdc-auth-plan9-386\n"
+}
+
+func TestDownloadRelease(t *testing.T) {
+	withQuiet(t)
+	binary := []byte("#!/bin/sh\necho new release\n")
+	fakeReleases(t, binary, checksumsFor(binary), nil)
+
+	release, err := fetchRelease("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.TagName != "v1.5.0" {
+		t.Errorf("latest release = %q", release.TagName)
+	}
+	if _, err := fetchRelease("1.5.0"); err != nil {
+		t.Errorf("fetchRelease(1.5.0) = %v", err)
+	}
+	if _, err := fetchRelease("v9.9.9"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing release error = %v", err)
+	}
+
+	got, err := downloadRelease(release, updateAssetName(runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(binary) {
+		t.Errorf("downloaded %q", got)
+	}
+	if _, err := downloadRelease(release, "sfdc-auth-plan9-386"); err == nil || !strings.Contains(err.Error(), "no binary") {
+		t.Errorf("missing platform error = %v", err)
+	}
+}
+
+func TestDownloadReleaseChecksumMismatch(t *testing.T) {
+	withQuiet(t)
+	fakeReleases(t, []byte("tampered"), checksumsFor([]byte("original")), nil)
+	release, err := fetchRelease("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := downloadRelease(release, updateAssetName(runtime.GOOS, runtime.GOARCH)); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("checksum mismatch error = %v", err)
+	}
+}
+
+func TestDownloadReleaseSignature(t *testing.T) {
+	withQuiet(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("signed release")
+	fakeReleases(t, binary, checksumsFor(binary), private)
+	release, err := fetchRelease("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := releasePublicKey
+	t.Cleanup(func() { releasePublicKey = old })
+
+	releasePublicKey = base64.StdEncoding.EncodeToString(public)
+	if _, err := downloadRelease(release, updateAssetName(runtime.GOOS, runtime.GOARCH)); err != nil {
+		t.Errorf("signed release = %v", err)
+	}
+	releasePublicKey = base64.StdEncoding.EncodeToString(other)
+	if _, err := downloadRelease(release, updateAssetName(runtime.GOOS, runtime.GOARCH)); err == nil || !strings.Contains(err.Error(), "does not match the release key") {
+		t.Errorf("wrong key error = %v", err)
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sfdc-auth")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceExecutable(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("binary = %q, %v", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0755) {
+		t.Errorf("binary mode = %v, %v", info.Mode(), err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("left behind %d files next to the binary", len(entries)-1)
+	}
+}
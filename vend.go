@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// errRefreshFailed marks a token vendor error returned by the token endpoint
+// rather than the store, so servers can report it as an upstream failure
+var errRefreshFailed = errors.New("error refreshing token")
+
+// expiryCheckInterval is how often serve and grpc look for stored tokens
+// crossing the expiry thresholds
+var expiryCheckInterval = time.Minute
+
+// tokenVendor hands out and refreshes stored org tokens for the long-running
+// servers (serve and grpc)
+type tokenVendor struct {
+	store        TokenStore
+	clientSecret *secret
+	refresh      func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error)
+	// expiry decides when validToken refreshes; nil never does
+	expiry *expiryThresholds
+	now    func() time.Time
+
+	// mu serialises refreshes, so requests arriving together for an
+	// expired org refresh it once
+	mu sync.Mutex
+}
+
+// validToken returns the org with its stored access token while it is
+// expected to last, refreshing it first otherwise. The read is audited.
+func (v *tokenVendor) validToken(alias string) (*StoredOrg, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	org, err := v.get(alias)
+	if err != nil {
+		recordAuthEvent(eventTokenRead, &StoredOrg{Alias: alias}, err)
+		return nil, err
+	}
+	if v.needsRefresh(org) {
+		verbosef("Access token for %q has expired or is about to, refreshing", org.Alias)
+		if err := v.refreshOrg(org); err != nil {
+			recordAuthEvent(eventTokenRead, org, err)
+			return nil, err
+		}
+	}
+	recordAuthEvent(eventTokenRead, org, nil)
+	return org, nil
+}
+
+// storedToken returns the org with its stored access token as it is, even
+// if it has expired. The read is audited.
+func (v *tokenVendor) storedToken(alias string) (*StoredOrg, error) {
+	org, err := v.get(alias)
+	if err != nil {
+		recordAuthEvent(eventTokenRead, &StoredOrg{Alias: alias}, err)
+		return nil, err
+	}
+	recordAuthEvent(eventTokenRead, org, nil)
+	return org, nil
+}
+
+// refreshToken refreshes the org's access token and saves it
+func (v *tokenVendor) refreshToken(alias string) (*StoredOrg, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	org, err := v.get(alias)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.refreshOrg(org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// revoke revokes the org's tokens and removes it from the store, as logout
+// does
+func (v *tokenVendor) revoke(alias string, force bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	org, err := v.get(alias)
+	if err != nil {
+		return err
+	}
+	return logoutOrg(v.store, org, force)
+}
+
+// get reads an org, passing errOrgNotFound through unwrapped
+func (v *tokenVendor) get(alias string) (*StoredOrg, error) {
+	org, err := v.store.Get(alias)
+	if err != nil && !errors.Is(err, errOrgNotFound) {
+		return nil, fmt.Errorf("error reading org: %v", err)
+	}
+	return org, err
+}
+
+// needsRefresh reports whether the org's token has expired, or will within
+// the critical threshold
+func (v *tokenVendor) needsRefresh(org *StoredOrg) bool {
+	if v.expiry == nil {
+		return false
+	}
+	return v.expiry.expiresAt(org).Sub(v.now()) <= v.expiry.Critical
+}
+
+// refreshOrg refreshes and saves the org in place; callers hold mu
+func (v *tokenVendor) refreshOrg(org *StoredOrg) error {
+	resp, err := v.refresh(org, v.clientSecret)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRefreshFailed, err)
+	}
+	previous := *org
+	applyRefresh(org, resp)
+	if err := saveRefresh(v.store, org); err != nil {
+		return err
+	}
+	revokeSuperseded(&previous, org)
+	return nil
+}
+
+// watchExpiry checks the stored tokens every expiryCheckInterval until ctx is
+// done, notifying when one crosses an expiry threshold
+func (v *tokenVendor) watchExpiry(ctx context.Context) {
+	notified := map[string]expiryLevel{}
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		v.checkExpiry(notified)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkExpiry logs a warning and sends an expiry webhook event for each org
+// whose token has reached the warning or critical threshold since it was
+// last notified. notified holds the level each org was last notified at; a
+// refreshed token starts over.
+func (v *tokenVendor) checkExpiry(notified map[string]expiryLevel) {
+	if v.expiry == nil {
+		return
+	}
+	orgs, err := v.store.List()
+	if err != nil {
+		log.Printf("Warning: could not check token expiry: %v", err)
+		return
+	}
+	now := v.now()
+	for _, org := range orgs {
+		level, verb := v.expiry.level(org, now), "expires"
+		switch level {
+		case expiryOK:
+			delete(notified, org.Alias)
+			continue
+		case expiryExpired:
+			level, verb = expiryCritical, "expired"
+		}
+		if notified[org.Alias] == level || notified[org.Alias] == expiryCritical {
+			continue
+		}
+		notified[org.Alias] = level
+
+		event := eventExpiryWarning
+		if level == expiryCritical {
+			event = eventExpiryCritical
+		}
+		log.Printf("Warning: the access token for %q %s %s", org.Alias, verb, describeExpiry(v.expiry.expiresAt(org), now))
+		notifyWebhooks(event, org)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestVendor vends tokens for "prod" and "dev"; refreshing "dev" fails
+func newTestVendor(t *testing.T) *tokenVendor {
+	t.Helper()
+	return &tokenVendor{
+		store: newTestStore(t, "prod", "dev"),
+		refresh: func(org *StoredOrg, clientSecret *secret) (*SalesforceOAuthResponse, error) {
+			if org.Alias == "dev" {
+				return nil, fmt.Errorf("token request failed with status: 400")
+			}
+			return &SalesforceOAuthResponse{AccessToken: "refreshed_" + org.Alias, InstanceURL: "https://na1.salesforce.com"}, nil
+		},
+	}
+}
+
+func TestTokenVendorErrors(t *testing.T) {
+	withQuiet(t)
+	v := newTestVendor(t)
+
+	if _, err := v.validToken("missing"); !errors.Is(err, errOrgNotFound) {
+		t.Errorf("validToken(missing) error = %v, want errOrgNotFound", err)
+	}
+	if _, err := v.refreshToken("dev"); !errors.Is(err, errRefreshFailed) {
+		t.Errorf("refreshToken(dev) error = %v, want errRefreshFailed", err)
+	}
+	org, err := v.refreshToken("prod")
+	if err != nil {
+		t.Fatalf("refreshToken(prod): %v", err)
+	}
+	if org.AccessToken != "refreshed_prod" {
+		t.Errorf("AccessToken = %q, want refreshed_prod", org.AccessToken)
+	}
+}
+
+func TestTokenVendorNeedsRefresh(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	v := &tokenVendor{
+		expiry: &expiryThresholds{Session: 2 * time.Hour, Warning: 15 * time.Minute, Critical: 5 * time.Minute},
+		now:    func() time.Time { return now },
+	}
+	tests := []struct {
+		issued time.Time
+		want   bool
+	}{
+		{now.Add(-time.Hour), false},
+		{now.Add(-2*time.Hour + 10*time.Minute), false},
+		{now.Add(-2*time.Hour + 4*time.Minute), true},
+		{now.Add(-3 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		if got := v.needsRefresh(&StoredOrg{IssuedAt: tt.issued}); got != tt.want {
+			t.Errorf("needsRefresh(issued %s) = %v, want %v", tt.issued, got, tt.want)
+		}
+	}
+
+	v.expiry = nil
+	if v.needsRefresh(&StoredOrg{IssuedAt: now.Add(-3 * time.Hour)}) {
+		t.Error("needsRefresh with no thresholds = true, want false")
+	}
+}
+
+func TestTokenVendorCheckExpiry(t *testing.T) {
+	events := make(chan string, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event.Event + " " + event.Alias
+	}))
+	defer server.Close()
+	old := webhooks
+	webhooks = []webhookConfig{{URL: server.URL, Events: []string{eventExpiryWarning, eventExpiryCritical}}}
+	t.Cleanup(func() { webhooks = old })
+
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	store := newTestStore(t)
+	for alias, issued := range map[string]time.Time{
+		"prod": now.Add(-time.Hour),
+		"dev":  now.Add(-2*time.Hour + 10*time.Minute),
+		"uat":  now.Add(-3 * time.Hour),
+	} {
+		if err := store.Put(&StoredOrg{Alias: alias, IssuedAt: issued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := &tokenVendor{
+		store:  store,
+		expiry: &expiryThresholds{Session: 2 * time.Hour, Warning: 15 * time.Minute, Critical: 5 * time.Minute},
+		now:    func() time.Time { return now },
+	}
+	received := func() []string {
+		var got []string
+		for len(events) > 0 {
+			got = append(got, <-events)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	notified := map[string]expiryLevel{}
+	v.checkExpiry(notified)
+	if got := received(); strings.Join(got, ",") != "expiry-critical uat,expiry-warning dev" {
+		t.Errorf("First check sent %v", got)
+	}
+	v.checkExpiry(notified)
+	if got := received(); len(got) != 0 {
+		t.Errorf("Nothing new crossed a threshold, but sent %v", got)
+	}
+
+	// dev moves on to critical; uat is refreshed and expires again later
+	now = now.Add(6 * time.Minute)
+	if err := store.Put(&StoredOrg{Alias: "uat", IssuedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	v.checkExpiry(notified)
+	now = now.Add(2*time.Hour - 10*time.Minute)
+	v.checkExpiry(notified)
+	if got := received(); strings.Join(got, ",") != "expiry-critical dev,expiry-critical prod,expiry-warning uat" {
+		t.Errorf("Later checks sent %v", got)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set with -ldflags "-X main.version=... -X main.commit=...
+// -X main.buildTime=..." by make build. Builds without them, such as go
+// install, fall back to what the Go toolchain recorded in the binary.
+var (
+	version   = ""
+	commit    = ""
+	buildTime = ""
+)
+
+var flagVersionJSON bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version and build details",
+	Long: `Print the release version, the git commit and date it was built from, and the
+Go version it was built with. --json prints them as JSON, for tools that check
+which release they are talking to.`,
+	Args: cobra.NoArgs,
+	Run:  runVersion,
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&flagVersionJSON, "json", false, "Print the build details as JSON")
+
+	info := currentBuildInfo()
+	rootCmd.Version = info.Version
+	rootCmd.SetVersionTemplate(info.String() + "\n")
+	rootCmd.AddCommand(versionCmd)
+}
+
+// buildInfo is what version prints
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+func (b buildInfo) String() string {
+	details := []string{b.GoVersion, b.Platform}
+	if b.Commit != "" {
+		details = append([]string{"commit " + b.Commit}, details...)
+	}
+	if b.BuildTime != "" {
+		details = append(details, "built "+b.BuildTime)
+	}
+	return fmt.Sprintf("sfdc-auth %s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+func runVersion(cmd *cobra.Command, args []string) {
+	info := currentBuildInfo()
+	if !flagVersionJSON && outputFormat(outputText) == outputText {
+		fmt.Println(info)
+		return
+	}
+	if err := writeJSON(info); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
+
+// currentBuildInfo is the build metadata from -ldflags, filled in from the
+// binary's embedded build info where those were not set
+func currentBuildInfo() buildInfo {
+	embedded, _ := debug.ReadBuildInfo()
+	return resolveBuildInfo(version, commit, buildTime, embedded)
+}
+
+func resolveBuildInfo(version, commit, buildTime string, embedded *debug.BuildInfo) buildInfo {
+	info := buildInfo{
+		Version:   strings.TrimPrefix(version, "v"),
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if embedded != nil {
+		if info.Version == "" && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+			info.Version = strings.TrimPrefix(embedded.Main.Version, "v")
+		}
+		dirty := false
+		for _, setting := range embedded.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = shortCommit(setting.Value)
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				dirty = setting.Value == "true"
+			}
+		}
+		if commit == "" && dirty && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// shortCommit abbreviates a full commit hash the way git describe does
+func shortCommit(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestResolveBuildInfoFromLDFlags(t *testing.T) {
+	embedded := &debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "ffffffffffffffffffffffffffffffffffffffff"}}}
+	info := resolveBuildInfo("v1.4.0", "0123456789ab", "2024-03-01T12:00:00Z", embedded)
+	if info.Version != "1.4.0" || info.Commit != "0123456789ab" || info.BuildTime != "2024-03-01T12:00:00Z" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("Go details = %q, %q", info.GoVersion, info.Platform)
+	}
+	want := "sfdc-auth 1.4.0 (commit 0123456789ab, " + runtime.Version() + ", " + info.Platform + ", built 2024-03-01T12:00:00Z)"
+	if info.String() != want {
+		t.Errorf("String() = %q, want %q", info.String(), want)
+	}
+}
+
+func TestResolveBuildInfoFromEmbedded(t *testing.T) {
+	embedded := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.5.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+			{Key: "vcs.time", Value: "2024-04-02T08:30:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	info := resolveBuildInfo("", "", "", embedded)
+	if info.Version != "1.5.0" || info.Commit != "0123456789ab-dirty" || info.BuildTime != "2024-04-02T08:30:00Z" {
+		t.Errorf("info = %+v", info)
+	}
+
+	info = resolveBuildInfo("", "", "", &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}})
+	if info.Version != "dev" || info.Commit != "" {
+		t.Errorf("development build info = %+v", info)
+	}
+	if strings.Contains(info.String(), "commit") || strings.Contains(info.String(), "built") {
+		t.Errorf("String() without commit and build time = %q", info.String())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagWaitAlias    string
+	flagWaitTimeout  time.Duration
+	flagWaitInterval time.Duration
+	flagWaitExec     string
+
+	waitSleep = time.Sleep
+)
+
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait until a stored org accepts logins",
+	Long: `Refresh the stored org's token and call its API until both succeed, for
+example right after a sandbox refresh or an org migration. Exits 0 once the
+org is ready, or 75 (EX_TEMPFAIL) if it is not ready within --timeout.
+
+With --exec, the command is run through the shell once the org is ready,
+with SFDC_AUTH_ALIAS and SFDC_AUTH_INSTANCE_URL set, and its exit status
+becomes the exit status of wait.`,
+	Args: cobra.NoArgs,
+	Run:  runWait,
+}
+
+func init() {
+	waitCmd.Flags().StringVarP(&flagWaitAlias, "alias", "a", "", "Alias of the stored org to wait for (default: the default org)")
+	waitCmd.Flags().DurationVar(&flagWaitTimeout, "timeout", time.Hour, "Give up after this long")
+	waitCmd.Flags().DurationVar(&flagWaitInterval, "interval", time.Minute, "Time between attempts")
+	waitCmd.Flags().StringVar(&flagWaitExec, "exec", "", "Shell command to run once the org is ready")
+
+	rootCmd.AddCommand(waitCmd)
+}
+
+func runWait(cmd *cobra.Command, args []string) {
+	if flagWaitInterval <= 0 {
+		log.Fatalf("Error: --interval must be positive")
+	}
+	store, org, err := useStoredOrg(flagWaitAlias)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer store.Close()
+
+	if err := waitForOrg(store, org, flagWaitTimeout, flagWaitInterval); err != nil {
+		log.Print(err)
+		os.Exit(exitMaintenance)
+	}
+	infof("Org %q is ready", org.Alias)
+
+	if flagWaitExec != "" {
+		if err := runWaitHook(flagWaitExec, org); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			log.Fatalf("Error running --exec command: %v", err)
+		}
+	}
+}
+
+// waitForOrg retries checkOrgReady every interval until it succeeds or
+// timeout has passed
+func waitForOrg(store TokenStore, org *StoredOrg, timeout, interval time.Duration) error {
+	var waited time.Duration
+	for {
+		err := checkOrgReady(store, org)
+		if err == nil {
+			return nil
+		}
+		if waited+interval > timeout {
+			return fmt.Errorf("org %q is still not ready after %s: %v", org.Alias, timeout, err)
+		}
+		infof("Org %q is not ready yet (%v); retrying in %s", org.Alias, err, interval)
+		waitSleep(interval)
+		waited += interval
+	}
+}
+
+// checkOrgReady refreshes the org's access token, saving it, and confirms
+// the org answers API calls with it
+func checkOrgReady(store TokenStore, org *StoredOrg) error {
+	if org.RefreshToken != "" {
+		resp, err := refreshAccessToken(org, nil)
+		if err != nil {
+			return fmt.Errorf("error refreshing token: %v", err)
+		}
+		previous := *org
+		applyRefresh(org, resp)
+		if err := saveRefresh(store, org); err != nil {
+			return err
+		}
+		revokeSuperseded(&previous, org)
+	}
+
+	var userInfo struct{}
+	if err := getOrgJSON(org, "/services/oauth2/userinfo", &userInfo); err != nil {
+		return fmt.Errorf("error calling the org: %v", err)
+	}
+	return nil
+}
+
+// runWaitHook runs command through the platform shell, passing it the org
+// it waited for. Tokens are deliberately not put in its environment.
+func runWaitHook(command string, org *StoredOrg) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), "SFDC_AUTH_ALIAS="+org.Alias, "SFDC_AUTH_INSTANCE_URL="+org.InstanceURL)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
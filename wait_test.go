@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForOrgRetriesUntilReady(t *testing.T) {
+	withQuiet(t)
+	withFakeRevoker(t)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/services/oauth2/token" {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "invalid_grant", "error_description": "inactive organization"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token": "fresh"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	original, originalSleep := http.DefaultTransport, waitSleep
+	defer func() { http.DefaultTransport, waitSleep = original, originalSleep }()
+	http.DefaultTransport = rewriteTransport{target: server.URL, base: original}
+	var slept []time.Duration
+	waitSleep = func(d time.Duration) { slept = append(slept, d) }
+
+	store, err := newFileStore(filepath.Join(t.TempDir(), storeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	org := &StoredOrg{Alias: "uat", AccessToken: "stale", RefreshToken: "refresh", InstanceURL: server.URL, Domain: "test.example.com"}
+
+	if err := waitForOrg(store, org, time.Hour, time.Minute); err != nil {
+		t.Fatalf("Expected the org to become ready: %v", err)
+	}
+	if attempts != 3 || len(slept) != 2 {
+		t.Errorf("Expected 3 attempts with 2 waits, got %d attempts and waits %v", attempts, slept)
+	}
+	if saved, err := store.Get("uat"); err != nil || saved.AccessToken != "fresh" {
+		t.Errorf("Expected the fresh token to be saved, got %+v (%v)", saved, err)
+	}
+
+	// An org that never comes back gives up once the timeout is reached
+	attempts, slept = -100, nil
+	err = waitForOrg(store, org, 3*time.Minute, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "still not ready") || len(slept) != 3 {
+		t.Errorf("Expected to give up after 3 waits, got %v with waits %v", err, slept)
+	}
+}
+
+func TestRunWaitHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	org := &StoredOrg{Alias: "uat", InstanceURL: "https://cs42.salesforce.com"}
+	if err := runWaitHook(`test "$SFDC_AUTH_ALIAS" = uat && test "$SFDC_AUTH_INSTANCE_URL" = https://cs42.salesforce.com`, org); err != nil {
+		t.Errorf("Expected the hook to see the org: %v", err)
+	}
+	if err := runWaitHook("exit 3", org); err == nil {
+		t.Error("Expected a failing hook to be reported")
+	}
+}
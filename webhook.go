@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Auth events sent to webhooks and written to the audit log
+const (
+	eventLogin   = "login"
+	eventRefresh = "refresh"
+	eventRevoke  = "revoke"
+)
+
+// Expiry events sent to webhooks by serve and grpc when a stored token
+// crosses the expiry_warning or expiry_critical threshold. They are not
+// audited, as no credential changes hands.
+const (
+	eventExpiryWarning  = "expiry-warning"
+	eventExpiryCritical = "expiry-critical"
+)
+
+// Headers on webhook requests. The signature is the hex HMAC-SHA256 of the
+// body with the webhook's secret.
+const (
+	webhookEventHeader     = "X-Sfdc-Auth-Event"
+	webhookSignatureHeader = "X-Sfdc-Auth-Signature"
+)
+
+// webhookConfig is an entry of "webhooks" in config.json
+type webhookConfig struct {
+	URL string `json:"url"`
+	// Secret signs each request; it may be an op:// reference
+	Secret string `json:"secret,omitempty"`
+	// Events limits the webhook to some events; all are sent when empty
+	Events []string `json:"events,omitempty"`
+}
+
+// webhooks are the webhooks configured for this run
+var webhooks []webhookConfig
+
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// webhookEvent is the body of a webhook request. It describes who got a
+// credential, never the credential itself.
+type webhookEvent struct {
+	Event       string     `json:"event"`
+	Time        time.Time  `json:"time"`
+	Alias       string     `json:"alias,omitempty"`
+	OrgID       string     `json:"org_id,omitempty"`
+	UserID      string     `json:"user_id,omitempty"`
+	Username    string     `json:"username,omitempty"`
+	InstanceURL string     `json:"instance_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// checkWebhooks rejects webhooks config.json cannot have meant
+func checkWebhooks(hooks []webhookConfig) error {
+	for _, hook := range hooks {
+		if !strings.HasPrefix(hook.URL, "https://") && !strings.HasPrefix(hook.URL, "http://") {
+			return fmt.Errorf("webhook URL %q must be http or https", hook.URL)
+		}
+		for _, event := range hook.Events {
+			switch event {
+			case eventLogin, eventRefresh, eventRevoke, eventExpiryWarning, eventExpiryCritical:
+			default:
+				return fmt.Errorf("unknown webhook event %q for %s (use %s, %s, %s, %s or %s)", event, hook.URL, eventLogin, eventRefresh, eventRevoke, eventExpiryWarning, eventExpiryCritical)
+			}
+		}
+	}
+	return nil
+}
+
+// notifyWebhooks sends an event about an org to every webhook that wants
+// it. A webhook that fails is only logged, so an audit endpoint being down
+// never fails a login.
+func notifyWebhooks(event string, org *StoredOrg) {
+	if len(webhooks) == 0 {
+		return
+	}
+	body := newWebhookEvent(event, org, authDeps.Clock.Now())
+	for _, hook := range webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+		if err := hook.send(body); err != nil {
+			log.Printf("Warning: could not notify webhook %s: %v", scrubSecrets(hook.URL), err)
+		}
+	}
+}
+
+func newWebhookEvent(event string, org *StoredOrg, now time.Time) *webhookEvent {
+	e := &webhookEvent{
+		Event:       event,
+		Time:        now.UTC().Truncate(time.Second),
+		Alias:       org.Alias,
+		OrgID:       org.OrgID,
+		UserID:      org.UserID,
+		Username:    org.Username,
+		InstanceURL: org.InstanceURL,
+	}
+	if event != eventRevoke && !(org.IssuedAt.IsZero() && org.UpdatedAt.IsZero()) {
+		expiresAt := (&expiryThresholds{Session: sessionTimeout}).expiresAt(org).UTC().Truncate(time.Second)
+		e.ExpiresAt = &expiresAt
+	}
+	return e
+}
+
+func (h webhookConfig) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h webhookConfig) send(event *webhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event.Event)
+	if h.Secret != "" {
+		secret := h.Secret
+		if strings.HasPrefix(secret, opReferencePrefix) {
+			if secret, err = opRead(secret); err != nil {
+				return fmt.Errorf("error resolving the webhook secret: %v", err)
+			}
+		}
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook([]byte(secret), body))
+	}
+
+	verbosef("POST %s (%s event)", scrubSecrets(h.URL), event.Event)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhook is the hex HMAC-SHA256 of body
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyWebhooks(t *testing.T) {
+	type delivery struct {
+		event, signature string
+		body             []byte
+	}
+	deliveries := make(chan delivery, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header.Get(webhookEventHeader), r.Header.Get(webhookSignatureHeader), body}
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	old := webhooks
+	webhooks = []webhookConfig{
+		{URL: server.URL + "/audit", Secret: "s3cret"},
+		{URL: server.URL + "/revocations", Events: []string{eventRevoke}},
+		{URL: server.URL + "/down"},
+	}
+	t.Cleanup(func() { webhooks = old })
+
+	issued := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	org := &StoredOrg{Alias: "prod", OrgID: "00D000000000001AAA", UserID: "005000000000001AAA", Username: "me@acme.com", InstanceURL: "https://acme.my.salesforce.com", AccessToken: "00D!access", RefreshToken: "5Aep861", IssuedAt: issued}
+	notifyWebhooks(eventRefresh, org)
+
+	var got []delivery
+	for len(deliveries) > 0 {
+		got = append(got, <-deliveries)
+	}
+	if len(got) != 2 {
+		t.Fatalf("delivered %d events, want 2 (the revocation webhook skips refreshes)", len(got))
+	}
+	audit := got[0]
+	if audit.event != eventRefresh || audit.signature != "sha256="+signWebhook([]byte("s3cret"), audit.body) {
+		t.Errorf("event %q signed %q", audit.event, audit.signature)
+	}
+	if got[1].signature != "" {
+		t.Errorf("unsigned webhook sent signature %q", got[1].signature)
+	}
+	if strings.Contains(string(audit.body), "00D!access") || strings.Contains(string(audit.body), "5Aep861") {
+		t.Errorf("webhook body holds a token: %s", audit.body)
+	}
+	var event webhookEvent
+	if err := json.Unmarshal(audit.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Alias != "prod" || event.Username != "me@acme.com" || event.OrgID != org.OrgID || event.ExpiresAt == nil || !event.ExpiresAt.Equal(issued.Add(sessionTimeout)) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestCheckWebhooks(t *testing.T) {
+	if err := checkWebhooks([]webhookConfig{{URL: "https://audit.acme.com/hook", Events: []string{eventLogin, eventRevoke}}}); err != nil {
+		t.Errorf("valid webhook rejected: %v", err)
+	}
+	for _, hook := range []webhookConfig{
+		{URL: "audit.acme.com/hook"},
+		{URL: "https://audit.acme.com/hook", Events: []string{"logout"}},
+	} {
+		if err := checkWebhooks([]webhookConfig{hook}); err == nil {
+			t.Errorf("webhook %+v should be rejected", hook)
+		}
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// From RFC 4231 test case 2
+	got := signWebhook([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	if want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got != want {
+		t.Errorf("signWebhook = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const accessTokenEnv = "SFDC_AUTH_ACCESS_TOKEN"
+
+var (
+	flagWhoamiAlias       string
+	flagWhoamiAccessToken string
+	flagWhoamiInstanceURL string
+)
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show which user and org an access token belongs to",
+	Long: `Call the org's userinfo endpoint with an access token and print the
+username, user ID, org ID and profile of the user it was issued to.
+
+The token is a stored org's (--alias, or the default org), which is refreshed
+and saved if it has expired, or one given with --access-token (or
+` + accessTokenEnv + `) and --instance-url.`,
+	Args: cobra.NoArgs,
+	Run:  runWhoami,
+}
+
+func init() {
+	whoamiCmd.Flags().StringVarP(&flagWhoamiAlias, "alias", "a", "", "Alias of the stored org (default: the default org)")
+	whoamiCmd.Flags().StringVar(&flagWhoamiAccessToken, "access-token", "", "Access token to check instead of a stored org (default: from "+accessTokenEnv+")")
+	whoamiCmd.Flags().StringVar(&flagWhoamiInstanceURL, "instance-url", "", "Instance URL the access token is for, with --access-token")
+
+	rootCmd.AddCommand(whoamiCmd)
+}
+
+// whoamiResult is the identity behind an access token
+type whoamiResult struct {
+	Username    string `json:"username"`
+	UserID      string `json:"user_id"`
+	OrgID       string `json:"org_id"`
+	Name        string `json:"name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	UserType    string `json:"user_type,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	InstanceURL string `json:"instance_url"`
+}
+
+func runWhoami(cmd *cobra.Command, args []string) {
+	accessToken := flagWhoamiAccessToken
+	flagWhoamiAccessToken = ""
+	if accessToken == "" {
+		accessToken = os.Getenv(accessTokenEnv)
+	}
+
+	var org *StoredOrg
+	var get func(path string, out interface{}) error
+	switch {
+	case flagWhoamiAlias != "" && accessToken != "":
+		log.Fatalf("Error: use either --alias or --access-token, not both")
+	case accessToken != "":
+		if flagWhoamiInstanceURL == "" {
+			log.Fatalf("Error: --access-token needs --instance-url")
+		}
+		org = &StoredOrg{AccessToken: accessToken, InstanceURL: flagWhoamiInstanceURL}
+		get = func(path string, out interface{}) error { return getOrgJSON(org, path, out) }
+	default:
+		store, stored, err := useStoredOrg(flagWhoamiAlias)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer store.Close()
+		org = stored
+		get = func(path string, out interface{}) error { return orgGetJSON(store, org, path, out) }
+	}
+
+	result, err := fetchWhoami(get)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	result.InstanceURL = org.InstanceURL
+
+	if outputFormat(outputJSON) == outputText {
+		fmt.Printf("username: %s\nuser_id: %s\norg_id: %s\nprofile: %s\ninstance_url: %s\n", result.Username, result.UserID, result.OrgID, result.Profile, result.InstanceURL)
+		return
+	}
+	if err := writeJSON(result); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+}
+
+// fetchWhoami reads the userinfo endpoint and the user's profile. The
+// profile needs API access to the User object, so it is left out with a
+// warning if the query fails.
+func fetchWhoami(get func(path string, out interface{}) error) (*whoamiResult, error) {
+	var userinfo struct {
+		PreferredUsername string `json:"preferred_username"`
+		UserID            string `json:"user_id"`
+		OrganizationID    string `json:"organization_id"`
+		Name              string `json:"name"`
+		Email             string `json:"email"`
+		UserType          string `json:"user_type"`
+	}
+	if err := get("/services/oauth2/userinfo", &userinfo); err != nil {
+		return nil, fmt.Errorf("error fetching user info: %v", err)
+	}
+	result := &whoamiResult{
+		Username: userinfo.PreferredUsername,
+		UserID:   userinfo.UserID,
+		OrgID:    userinfo.OrganizationID,
+		Name:     userinfo.Name,
+		Email:    userinfo.Email,
+		UserType: userinfo.UserType,
+	}
+
+	var users struct {
+		Records []struct {
+			Profile *struct {
+				Name string `json:"Name"`
+			} `json:"Profile"`
+		} `json:"records"`
+	}
+	soql := fmt.Sprintf("SELECT Profile.Name FROM User WHERE Id = '%s'", escapeSOQL(result.UserID))
+	if err := get("/services/data/"+salesforceAPIVersion+"/query?q="+url.QueryEscape(soql), &users); err != nil {
+		log.Printf("Warning: could not look up the user's profile: %v", err)
+	} else if len(users.Records) == 1 && users.Records[0].Profile != nil {
+		result.Profile = users.Records[0].Profile.Name
+	}
+	return result, nil
+}
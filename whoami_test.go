@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchWhoami(t *testing.T) {
+	profileQuery := "SELECT Profile.Name FROM User WHERE Id = '005000000000001AAA'"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/oauth2/userinfo":
+			w.Write([]byte(`{"preferred_username": "me@acme.com", "user_id": "005000000000001AAA", "organization_id": "00D000000000001AAA", "name": "Pat Smith", "user_type": "STANDARD"}`))
+		case "/services/data/" + salesforceAPIVersion + "/query":
+			if r.URL.Query().Get("q") != profileQuery {
+				t.Errorf("Unexpected query %q", r.URL.Query().Get("q"))
+			}
+			w.Write([]byte(`{"records": [{"Profile": {"Name": "System Administrator"}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{InstanceURL: server.URL, AccessToken: "access"}
+	get := func(path string, out interface{}) error { return getOrgJSON(org, path, out) }
+	result, err := fetchWhoami(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := whoamiResult{Username: "me@acme.com", UserID: "005000000000001AAA", OrgID: "00D000000000001AAA", Name: "Pat Smith", UserType: "STANDARD", Profile: "System Administrator"}
+	if *result != want {
+		t.Errorf("fetchWhoami = %+v, want %+v", *result, want)
+	}
+}
+
+func TestFetchWhoamiWithoutProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/services/oauth2/userinfo" {
+			w.Write([]byte(`{"preferred_username": "me@acme.com", "user_id": "005000000000001AAA", "organization_id": "00D000000000001AAA"}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	org := &StoredOrg{InstanceURL: server.URL, AccessToken: "access"}
+	result, err := fetchWhoami(func(path string, out interface{}) error { return getOrgJSON(org, path, out) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Username != "me@acme.com" || result.Profile != "" {
+		t.Errorf("Expected the identity without a profile, got %+v", *result)
+	}
+}